@@ -0,0 +1,43 @@
+package commands
+
+import (
+	"fmt"
+
+	"driveprep/services"
+
+	"github.com/spf13/cobra"
+)
+
+// NewOfflineCommand returns the "offline" admin command group
+func NewOfflineCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "offline",
+		Short: "Offline token key management",
+	}
+
+	cmd.AddCommand(newOfflineKeygenCommand())
+
+	return cmd
+}
+
+func newOfflineKeygenCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "keygen",
+		Short: "Generate an Ed25519 key for signing offline tokens",
+		Long: "Prints a new OFFLINE_SIGNING_KEY and its public key.\n\n" +
+			"To rotate, move the public key of the current signing key into\n" +
+			"OFFLINE_VERIFY_KEYS (comma-separated) before switching OFFLINE_SIGNING_KEY,\n" +
+			"so tokens it already signed stay valid until they expire.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			seed, publicKey, keyID, err := services.GenerateOfflineSigningKey()
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("OFFLINE_SIGNING_KEY=%s\n", seed)
+			fmt.Printf("# public key: %s\n", publicKey)
+			fmt.Printf("# key id:     %s\n", keyID)
+			return nil
+		},
+	}
+}
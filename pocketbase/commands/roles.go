@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"driveprep/routes"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+)
+
+// NewRolesCommand returns the "roles" admin command group
+func NewRolesCommand(app core.App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "roles",
+		Short: "Staff role management",
+	}
+
+	cmd.AddCommand(newRolesListCommand(app))
+	cmd.AddCommand(newRolesGrantCommand(app))
+	cmd.AddCommand(newRolesRevokeCommand(app))
+
+	return cmd
+}
+
+func newRolesListCommand(app core.App) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List users with staff roles",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			users, err := app.FindRecordsByFilter("users", "roles != '[]' && roles != ''", "email", 0, 0)
+			if err != nil {
+				return err
+			}
+
+			if len(users) == 0 {
+				fmt.Println("No users have staff roles.")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "USER\tEMAIL\tROLES")
+			for _, user := range users {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", user.Id, user.Email(), strings.Join(user.GetStringSlice("roles"), ", "))
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func newRolesGrantCommand(app core.App) *cobra.Command {
+	return &cobra.Command{
+		Use:   "grant <email> <role>",
+		Short: "Give a user a staff role (" + strings.Join(routes.Roles(), ", ") + ")",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return updateRoles(app, args[0], args[1], func(roles []string, role string) []string {
+				if slices.Contains(roles, role) {
+					return roles
+				}
+				return append(roles, role)
+			})
+		},
+	}
+}
+
+func newRolesRevokeCommand(app core.App) *cobra.Command {
+	return &cobra.Command{
+		Use:   "revoke <email> <role>",
+		Short: "Take a staff role away from a user",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return updateRoles(app, args[0], args[1], func(roles []string, role string) []string {
+				return slices.DeleteFunc(roles, func(r string) bool { return r == role })
+			})
+		},
+	}
+}
+
+func updateRoles(app core.App, email, role string, change func(roles []string, role string) []string) error {
+	if !routes.IsRole(role) {
+		return fmt.Errorf("unknown role %q, expected one of: %s", role, strings.Join(routes.Roles(), ", "))
+	}
+
+	user, err := app.FindAuthRecordByEmail("users", email)
+	if err != nil {
+		return fmt.Errorf("no user with email %s", email)
+	}
+
+	roles := change(user.GetStringSlice("roles"), role)
+	user.Set("roles", roles)
+	if err := app.Save(user); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s roles: %s\n", user.Email(), strings.Join(roles, ", "))
+	return nil
+}
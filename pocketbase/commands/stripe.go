@@ -0,0 +1,111 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"driveprep/routes"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+)
+
+// NewStripeCommand returns the "stripe" admin command group
+func NewStripeCommand(app core.App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stripe",
+		Short: "Stripe billing maintenance",
+	}
+
+	cmd.AddCommand(newStripeReconcileCommand(app))
+
+	return cmd
+}
+
+func newStripeReconcileCommand(app core.App) *cobra.Command {
+	var apply bool
+	var fromFile string
+
+	cmd := &cobra.Command{
+		Use:   "reconcile",
+		Short: "Compare active and cancelled subscriptions with Stripe and report drift",
+		Long: "Looks up every active, cancelled and past due subscription in Stripe and\n" +
+			"reports where the subscription record or the user's premium fields disagree.\n" +
+			"The run is saved in stripe_reconcile_reports.\n\n" +
+			"With --from-file, subscriptions are read from a JSON array of\n" +
+			"{id, status, cancelAtPeriodEnd, currentPeriodStart, currentPeriodEnd}\n" +
+			"instead of the Stripe API.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var source routes.SubscriptionSource
+			if fromFile != "" {
+				static, err := loadStaticSubscriptions(fromFile)
+				if err != nil {
+					return err
+				}
+				source = static
+			} else {
+				if os.Getenv("STRIPE_SECRET_KEY") == "" {
+					return errors.New("STRIPE_SECRET_KEY is not set (use --from-file to reconcile against a file)")
+				}
+				source = routes.NewStripeSubscriptionSource()
+			}
+
+			report, err := routes.ReconcileStripeSubscriptions(app, source, apply, "cli")
+			if err != nil {
+				return err
+			}
+
+			if len(report.Items) == 0 {
+				fmt.Printf("No drift: %d subscription(s) match Stripe.\n", report.Checked)
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "SUBSCRIPTION\tSTRIPE ID\tEMAIL\tISSUES\tFIXED")
+			for _, item := range report.Items {
+				issues := strings.Join(item.Issues, "; ")
+				if item.Error != "" {
+					issues = strings.TrimPrefix(issues+"; error: "+item.Error, "; ")
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\n", item.SubscriptionID, item.StripeSubscriptionID, item.Email, issues, item.Fixed)
+			}
+			w.Flush()
+
+			fmt.Printf("\n%d checked, %d mismatched, %d fixed, %d error(s). Report %s.\n",
+				report.Checked, report.Mismatched, report.Fixed, report.Errors, report.ID)
+			if !apply {
+				fmt.Println("Dry run. Re-run with --apply to make subscriptions and users match Stripe.")
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&apply, "apply", false, "update subscriptions and users to match Stripe")
+	cmd.Flags().StringVar(&fromFile, "from-file", "", "read subscriptions from a JSON file instead of the Stripe API")
+
+	return cmd
+}
+
+// loadStaticSubscriptions reads a JSON array of subscriptions keyed by ID
+func loadStaticSubscriptions(path string) (routes.StaticSubscriptionSource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var subs []*routes.RemoteSubscription
+	if err := json.Unmarshal(data, &subs); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	source := routes.StaticSubscriptionSource{}
+	for _, sub := range subs {
+		source[sub.ID] = sub
+	}
+	return source, nil
+}
@@ -0,0 +1,66 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"driveprep/routes"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+)
+
+// NewXPCommand returns the "xp" admin command group
+func NewXPCommand(app core.App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "xp",
+		Short: "XP ledger maintenance",
+	}
+
+	cmd.AddCommand(newXPReconcileCommand(app))
+
+	return cmd
+}
+
+func newXPReconcileCommand(app core.App) *cobra.Command {
+	var apply bool
+
+	cmd := &cobra.Command{
+		Use:   "reconcile",
+		Short: "Recompute every user's XP from the xp_transactions ledger and report drift",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			drifts, err := routes.ReconcileXP(app, apply)
+			if err != nil {
+				return err
+			}
+
+			if len(drifts) == 0 {
+				fmt.Println("No drift: every user's XP matches the ledger.")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "USER\tEMAIL\tCACHED\tLEDGER\tDRIFT")
+			totalDrift := 0
+			for _, d := range drifts {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%+d\n", d.UserID, d.Email, d.CachedXP, d.LedgerXP, d.Drift)
+				totalDrift += d.Drift
+			}
+			w.Flush()
+
+			fmt.Printf("\n%d user(s) drifted, net drift %+d XP.\n", len(drifts), totalDrift)
+			if apply {
+				fmt.Println("Cached XP and levels were rewritten from the ledger.")
+			} else {
+				fmt.Println("Dry run. Re-run with --apply to rewrite cached XP from the ledger.")
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&apply, "apply", false, "rewrite users.xp and users.level from the ledger")
+
+	return cmd
+}
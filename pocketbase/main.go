@@ -4,7 +4,9 @@ import (
 	"log"
 	"os"
 	"strings"
+	_ "time/tzdata" // embed the IANA database so user timezones work on minimal hosts
 
+	"driveprep/commands"
 	"driveprep/routes"
 
 	"github.com/pocketbase/pocketbase"
@@ -26,16 +28,62 @@ func main() {
 		Automigrate: isGoRun,
 	})
 
+	// Admin commands
+	app.RootCmd.AddCommand(commands.NewXPCommand(app))
+	app.RootCmd.AddCommand(commands.NewRolesCommand(app))
+	app.RootCmd.AddCommand(commands.NewOfflineCommand())
+	app.RootCmd.AddCommand(commands.NewStripeCommand(app))
+
+	// Hooks are bound at app setup rather than on serve, so changes made
+	// outside the HTTP server (admin commands, migrations, stripe reconcile
+	// --apply) go through them too
+
+	// Version every question bank change
+	routes.RegisterQuestionBankHooks(app)
+
+	// Keep XP, streaks and badges out of the records API
+	routes.RegisterXPHooks(app)
+
+	// Keep purchases and premium state out of the records API
+	routes.RegisterEntitlementHooks(app)
+
+	// Revoke offline tokens on password changes and downgrades
+	routes.RegisterOfflineTokenHooks(app)
+
+	// Badge rules must parse
+	routes.RegisterBadgeRuleHooks(app)
+
+	// Staff roles and permissions
+	routes.RegisterRoleHooks(app)
+
+	// Valid timezones, changed at most once a day
+	routes.RegisterTimezoneHooks(app)
+
+	// Display names must pass moderation
+	routes.RegisterDisplayNameHooks(app)
+
 	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
 		// Register custom API routes
-		routes.RegisterStripeRoutes(app, se)
+		payments, err := routes.NewPaymentProvider(app)
+		if err != nil {
+			return err
+		}
+		routes.RegisterStripeRoutes(app, se, payments)
 		routes.RegisterLeaderboardRoutes(app, se)
+		routes.RegisterGroupRoutes(app, se)
+		routes.RegisterOrgRoutes(app, se)
 		routes.RegisterProgressRoutes(app, se)
 		routes.RegisterQuestionRoutes(app, se)
 		routes.RegisterSeedRoutes(app, se)
 		routes.RegisterTestRoutes(app, se)
+		routes.RegisterBlueprintRoutes(app, se)
+		routes.RegisterPracticeRoutes(app, se)
 		routes.RegisterLicenseRoutes(app, se)
-		routes.RegisterOfflineRoutes(app, se)
+		routes.RegisterLicenseBatchRoutes(app, se)
+		routes.RegisterEntitlementRoutes(app, se)
+		if err := routes.RegisterOfflineRoutes(app, se); err != nil {
+			return err
+		}
 
 		// Serves static files from the provided public dir (if exists)
 		se.Router.GET("/{path...}", apis.Static(os.DirFS("./pb_public"), false))
@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		questionSessions, err := app.FindCollectionByNameOrId("question_sessions")
+		if err != nil {
+			return nil // Collection doesn't exist yet, skip
+		}
+
+		// Blueprint used to assemble and score the session (sections, pass marks, drawn question IDs)
+		questionSessions.Fields.Add(
+			&core.JSONField{Name: "blueprint"},
+		)
+
+		return app.Save(questionSessions)
+	}, func(app core.App) error {
+		questionSessions, err := app.FindCollectionByNameOrId("question_sessions")
+		if err != nil {
+			return nil
+		}
+
+		questionSessions.Fields.RemoveByName("blueprint")
+
+		return app.Save(questionSessions)
+	})
+}
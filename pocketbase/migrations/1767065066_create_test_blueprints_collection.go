@@ -0,0 +1,120 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// Create test_blueprints collection for configurable test formats
+		blueprints := core.NewBaseCollection("test_blueprints")
+		blueprints.Fields.Add(
+			// Stable identifier clients can pass as blueprintId (e.g. "g1", "quick_quiz")
+			&core.TextField{Name: "slug", Required: true},
+			// Display name
+			&core.TextField{Name: "name", Required: true},
+			&core.TextField{Name: "description"},
+			// Sections as JSON array: [{id, name, categories, difficulties, questionCount, passMark}]
+			&core.JSONField{Name: "sections", Required: true},
+			// Time limit in minutes (capped by the server maximum)
+			&core.NumberField{Name: "timeLimitMinutes", OnlyInt: true, Min: PtrFloat(1)},
+			// Minimum overall score ratio to pass (0 = only section pass marks apply)
+			&core.NumberField{Name: "passRatio", Min: PtrFloat(0), Max: PtrFloat(1)},
+			// Premium-only blueprint?
+			&core.BoolField{Name: "requiresPremium"},
+			// Inactive blueprints can't be started or listed
+			&core.BoolField{Name: "isActive"},
+			// Used when the client doesn't send a blueprintId
+			&core.BoolField{Name: "isDefault"},
+			// Display order
+			&core.NumberField{Name: "sortOrder", OnlyInt: true},
+			// Timestamps
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+
+		blueprints.Indexes = append(blueprints.Indexes,
+			"CREATE UNIQUE INDEX idx_test_blueprints_slug ON test_blueprints (slug)",
+			"CREATE INDEX idx_test_blueprints_active ON test_blueprints (isActive)",
+		)
+
+		if err := app.Save(blueprints); err != nil {
+			return err
+		}
+
+		// Seed the built-in blueprints
+		defaults := []map[string]any{
+			{
+				"slug":             "g1",
+				"name":             "G1 Knowledge Test",
+				"description":      "Full mock exam: 20 road-sign and 20 rules-of-the-road questions, 16/20 needed in each",
+				"timeLimitMinutes": 60,
+				"passRatio":        0,
+				"requiresPremium":  false,
+				"isDefault":        true,
+				"sortOrder":        1,
+				"sections": []map[string]any{
+					{
+						"id":            "signs",
+						"name":          "Road Signs",
+						"categories":    []string{"Road Signs & Signals"},
+						"questionCount": 20,
+						"passMark":      16,
+					},
+					{
+						"id":   "rules",
+						"name": "Rules of the Road",
+						"categories": []string{
+							"Rules of the Road",
+							"Safe Driving & Vehicle Handling",
+							"Alcohol/Drugs & Penalties",
+							"Licensing & Documents",
+							"Miscellaneous",
+						},
+						"questionCount": 20,
+						"passMark":      16,
+					},
+				},
+			},
+			{
+				"slug":             "quick_quiz",
+				"name":             "Quick Quiz",
+				"description":      "10 mixed questions in 10 minutes",
+				"timeLimitMinutes": 10,
+				"passRatio":        0.8,
+				"requiresPremium":  false,
+				"isDefault":        false,
+				"sortOrder":        2,
+				"sections": []map[string]any{
+					{
+						"id":            "mixed",
+						"name":          "Mixed",
+						"questionCount": 10,
+					},
+				},
+			},
+		}
+
+		for _, data := range defaults {
+			record := core.NewRecord(blueprints)
+			record.Load(data)
+			record.Set("isActive", true)
+			if err := app.Save(record); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		// Down migration - drop collection
+		collection, err := app.FindCollectionByNameOrId("test_blueprints")
+		if err == nil {
+			if err = app.Delete(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,67 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return nil // Users collection doesn't exist yet
+		}
+
+		questions, err := app.FindCollectionByNameOrId("questions")
+		if err != nil {
+			return nil // Questions collection doesn't exist yet
+		}
+
+		// Create question_reviews collection for per-user spaced-repetition state (SM-2)
+		reviews := core.NewBaseCollection("question_reviews")
+		reviews.Fields.Add(
+			// Link to user
+			&core.RelationField{Name: "user", MaxSelect: 1, Required: true, CollectionId: users.Id, CascadeDelete: true},
+			// Link to question
+			&core.RelationField{Name: "question", MaxSelect: 1, Required: true, CollectionId: questions.Id, CascadeDelete: true},
+			// SM-2 ease factor (starts at 2.5, never below 1.3)
+			&core.NumberField{Name: "easeFactor"},
+			// Current interval in days (0 while relearning)
+			&core.NumberField{Name: "intervalDays"},
+			// Consecutive successful reviews
+			&core.NumberField{Name: "repetitions", OnlyInt: true},
+			// Number of times the question was forgotten
+			&core.NumberField{Name: "lapses", OnlyInt: true},
+			// When the question is next due
+			&core.DateField{Name: "dueAt"},
+			// When the question was last answered
+			&core.DateField{Name: "lastReviewedAt"},
+			// Whether the last answer was correct
+			&core.BoolField{Name: "lastCorrect"},
+			// Timestamps
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+
+		reviews.Indexes = append(reviews.Indexes,
+			"CREATE UNIQUE INDEX idx_question_reviews_unique ON question_reviews (user, question)",
+			"CREATE INDEX idx_question_reviews_due ON question_reviews (user, dueAt)",
+		)
+
+		if err := app.Save(reviews); err != nil {
+			return err
+		}
+
+		return nil
+	}, func(app core.App) error {
+		// Down migration - drop collection
+		collection, err := app.FindCollectionByNameOrId("question_reviews")
+		if err == nil {
+			if err = app.Delete(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,68 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return nil // Users collection doesn't exist yet
+		}
+
+		questions, err := app.FindCollectionByNameOrId("questions")
+		if err != nil {
+			return nil // Questions collection doesn't exist yet
+		}
+
+		// Create question_attempts collection: one row per answered question
+		attempts := core.NewBaseCollection("question_attempts")
+		attempts.Fields.Add(
+			// Link to user
+			&core.RelationField{Name: "user", MaxSelect: 1, Required: true, CollectionId: users.Id, CascadeDelete: true},
+			// Link to question
+			&core.RelationField{Name: "question", MaxSelect: 1, Required: true, CollectionId: questions.Id, CascadeDelete: true},
+			// Question category at the time of the attempt (denormalized for aggregation)
+			&core.TextField{Name: "category"},
+			// Question difficulty at the time of the attempt
+			&core.NumberField{Name: "difficulty", OnlyInt: true},
+			// Where the answer came from
+			&core.SelectField{Name: "source", MaxSelect: 1, Values: []string{"practice", "test"}, Required: true},
+			// Session ID for session-based answers
+			&core.TextField{Name: "sessionId"},
+			// Selected option index
+			&core.NumberField{Name: "selectedAnswer", OnlyInt: true},
+			// Whether the answer was correct
+			&core.BoolField{Name: "correct"},
+			// Time spent on the question in milliseconds
+			&core.NumberField{Name: "timeSpent", OnlyInt: true},
+			// Timestamps
+			&core.AutodateField{Name: "created", OnCreate: true},
+		)
+
+		attempts.Indexes = append(attempts.Indexes,
+			"CREATE INDEX idx_question_attempts_user ON question_attempts (user, created)",
+			"CREATE INDEX idx_question_attempts_user_category ON question_attempts (user, category)",
+			"CREATE INDEX idx_question_attempts_user_question ON question_attempts (user, question)",
+			"CREATE INDEX idx_question_attempts_session ON question_attempts (sessionId)",
+		)
+
+		if err := app.Save(attempts); err != nil {
+			return err
+		}
+
+		return nil
+	}, func(app core.App) error {
+		// Down migration - drop collection
+		collection, err := app.FindCollectionByNameOrId("question_attempts")
+		if err == nil {
+			if err = app.Delete(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
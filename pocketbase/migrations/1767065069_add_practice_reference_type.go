@@ -0,0 +1,15 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// Allow XP transactions for completed practice sessions
+		return setSelectValues(app, "xp_transactions", "referenceType", []string{"question", "test", "badge", "streak", "daily_challenge", "correction", "practice"})
+	}, func(app core.App) error {
+		return setSelectValues(app, "xp_transactions", "referenceType", []string{"question", "test", "badge", "streak", "daily_challenge", "correction"})
+	})
+}
@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		xpTransactions, err := app.FindCollectionByNameOrId("xp_transactions")
+		if err != nil {
+			return nil // Collection doesn't exist yet, skip
+		}
+
+		// XP used to be written straight to users.xp, so older balances are only
+		// partly covered by the ledger. Record the difference as an opening
+		// balance so the ledger sum matches what users already have.
+		var rows []struct {
+			ID       string `db:"id"`
+			CachedXP int    `db:"xp"`
+			LedgerXP int    `db:"ledger"`
+		}
+		err = app.DB().NewQuery(`
+			SELECT u.id, COALESCE(u.xp, 0) AS xp, COALESCE(SUM(t.amount), 0) AS ledger
+			FROM users u
+			LEFT JOIN xp_transactions t ON t.user = u.id
+			GROUP BY u.id
+			HAVING COALESCE(u.xp, 0) != COALESCE(SUM(t.amount), 0)`).All(&rows)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			record := core.NewRecord(xpTransactions)
+			record.Set("user", row.ID)
+			record.Set("amount", row.CachedXP-row.LedgerXP)
+			record.Set("reason", "opening_balance")
+			record.Set("referenceType", "correction")
+			if err := app.Save(record); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		if _, err := app.FindCollectionByNameOrId("xp_transactions"); err != nil {
+			return nil
+		}
+
+		_, err := app.DB().NewQuery("DELETE FROM xp_transactions WHERE reason = 'opening_balance'").Execute()
+		return err
+	})
+}
@@ -0,0 +1,120 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// Create badge_definitions collection so badges can be added and tuned without a deploy
+		badges := core.NewBaseCollection("badge_definitions")
+		badges.Fields.Add(
+			// Stable badge ID stored in users.badges (e.g. "first_steps")
+			&core.TextField{Name: "badgeId", Required: true},
+			// Display name and description
+			&core.TextField{Name: "name", Required: true},
+			&core.TextField{Name: "description"},
+			&core.TextField{Name: "icon"},
+			&core.SelectField{
+				Name:      "tier",
+				MaxSelect: 1,
+				Values:    []string{"bronze", "silver", "gold", "platinum", "legendary"},
+				Required:  true,
+			},
+			// XP credited when the badge is earned
+			&core.NumberField{Name: "xpReward", OnlyInt: true, Min: PtrFloat(0)},
+			// Rule expression over user stats, in PocketBase filter syntax
+			// e.g. "questionsCompleted >= 25" or "streak >= 7 && tests.passed >= 1"
+			&core.TextField{Name: "rule", Required: true},
+			// Inactive badges are neither evaluated nor awarded
+			&core.BoolField{Name: "isActive"},
+			// Display order
+			&core.NumberField{Name: "sortOrder", OnlyInt: true},
+			// Timestamps
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+
+		badges.Indexes = append(badges.Indexes,
+			"CREATE UNIQUE INDEX idx_badge_definitions_badge ON badge_definitions (badgeId)",
+		)
+
+		if err := app.Save(badges); err != nil {
+			return err
+		}
+
+		// Seed the badges that used to be hard-coded
+		categoryChampion := ""
+		for i, slug := range []string{"road_signs", "rules_of_road", "safe_driving", "alcohol_drugs", "licensing", "miscellaneous"} {
+			if i > 0 {
+				categoryChampion += " && "
+			}
+			categoryChampion += "categories." + slug + ".total >= 10 && categories." + slug + ".accuracy >= 80"
+		}
+
+		defaults := []map[string]any{
+			// Bronze tier
+			{"badgeId": "first_steps", "name": "First Steps", "description": "Complete your first question", "icon": "👶", "tier": "bronze", "xpReward": 50,
+				"rule": "questionsCompleted >= 1"},
+			{"badgeId": "early_bird", "name": "Early Bird", "description": "Study before 8 AM", "icon": "🌅", "tier": "bronze", "xpReward": 75,
+				"rule": "hour < 8 && questionsCompleted > 0"},
+			{"badgeId": "night_owl", "name": "Night Owl", "description": "Study after 10 PM", "icon": "🦉", "tier": "bronze", "xpReward": 75,
+				"rule": "hour >= 22 && questionsCompleted > 0"},
+			{"badgeId": "quick_learner", "name": "Quick Learner", "description": "Complete 25 questions", "icon": "📚", "tier": "bronze", "xpReward": 100,
+				"rule": "questionsCompleted >= 25"},
+			// Silver tier
+			{"badgeId": "sign_master", "name": "Sign Master", "description": "80%+ accuracy on 20+ road sign questions", "icon": "🚸", "tier": "silver", "xpReward": 200,
+				"rule": "categories.road_signs.total >= 20 && categories.road_signs.accuracy >= 80"},
+			{"badgeId": "road_scholar", "name": "Road Scholar", "description": "Complete 100+ practice questions", "icon": "🎓", "tier": "silver", "xpReward": 250,
+				"rule": "questionsCompleted >= 100"},
+			{"badgeId": "sharpshooter", "name": "Sharpshooter", "description": "Get 10 correct answers in a row", "icon": "🎯", "tier": "silver", "xpReward": 200,
+				"rule": "bestCorrectStreak >= 10"},
+			{"badgeId": "speed_demon", "name": "Speed Demon", "description": "Pass a test in under 15 minutes", "icon": "⚡", "tier": "silver", "xpReward": 250,
+				"rule": "tests.passed >= 1 && tests.fastestPassSeconds < 900"},
+			{"badgeId": "consistent", "name": "Consistent Learner", "description": "Maintain a 7-day streak", "icon": "🔥", "tier": "silver", "xpReward": 300,
+				"rule": "streak >= 7"},
+			// Gold tier
+			{"badgeId": "perfect_score", "name": "Perfect Score", "description": "Score 100% on a practice test", "icon": "💯", "tier": "gold", "xpReward": 500,
+				"rule": "tests.perfect >= 1"},
+			{"badgeId": "category_champion", "name": "Category Champion", "description": "Master all 6 categories (80%+ on 10+ questions)", "icon": "🏆", "tier": "gold", "xpReward": 750,
+				"rule": categoryChampion},
+			{"badgeId": "dedicated_driver", "name": "Dedicated Driver", "description": "Complete 250 questions", "icon": "🚗", "tier": "gold", "xpReward": 500,
+				"rule": "questionsCompleted >= 250"},
+			{"badgeId": "marathon_runner", "name": "Marathon Runner", "description": "Maintain a 14-day streak", "icon": "🏃", "tier": "gold", "xpReward": 500,
+				"rule": "streak >= 14"},
+			// Platinum tier
+			{"badgeId": "diamond_streak", "name": "Diamond Streak", "description": "Maintain a 30-day streak", "icon": "💎", "tier": "platinum", "xpReward": 1000,
+				"rule": "streak >= 30"},
+			{"badgeId": "test_master", "name": "Test Master", "description": "Pass 10 practice tests", "icon": "🎖️", "tier": "platinum", "xpReward": 750,
+				"rule": "tests.passed >= 10"},
+			{"badgeId": "perfectionist", "name": "Perfectionist", "description": "Get 3 perfect scores on tests", "icon": "✨", "tier": "platinum", "xpReward": 1000,
+				"rule": "tests.perfect >= 3"},
+			// Legendary tier
+			{"badgeId": "g1_legend", "name": "G1 Legend", "description": "Complete 500+ questions with 90%+ accuracy", "icon": "👑", "tier": "legendary", "xpReward": 2000,
+				"rule": "questionsCompleted >= 500 && accuracy >= 90"},
+		}
+
+		for i, data := range defaults {
+			record := core.NewRecord(badges)
+			record.Load(data)
+			record.Set("isActive", true)
+			record.Set("sortOrder", i+1)
+			if err := app.Save(record); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		// Down migration - drop collection
+		collection, err := app.FindCollectionByNameOrId("badge_definitions")
+		if err == nil {
+			if err = app.Delete(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
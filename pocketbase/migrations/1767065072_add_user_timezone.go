@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return nil // Collection doesn't exist yet, skip
+		}
+
+		users.Fields.Add(
+			// IANA timezone (e.g. "America/Toronto") used for streak days,
+			// daily challenges and time-of-day badges
+			&core.TextField{Name: "timezone", Max: 64},
+			// Local date (YYYY-MM-DD) of the last streak update
+			&core.TextField{Name: "lastStreakDate", Pattern: `^\d{4}-\d{2}-\d{2}$`},
+		)
+
+		return app.Save(users)
+	}, func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return nil
+		}
+
+		users.Fields.RemoveByName("timezone")
+		users.Fields.RemoveByName("lastStreakDate")
+
+		return app.Save(users)
+	})
+}
@@ -0,0 +1,83 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return nil // Users collection doesn't exist yet
+		}
+
+		// Create leaderboard_periods collection, one record per ranked period
+		periods := core.NewBaseCollection("leaderboard_periods")
+		periods.Fields.Add(
+			&core.SelectField{
+				Name:      "periodType",
+				MaxSelect: 1,
+				Values:    []string{"weekly", "monthly", "allTime"},
+				Required:  true,
+			},
+			// "2026-W07", "2026-02" or "all"
+			&core.TextField{Name: "periodKey", Required: true},
+			// Period window [startsAt, endsAt); empty for all-time
+			&core.DateField{Name: "startsAt"},
+			&core.DateField{Name: "endsAt"},
+			// When the snapshot was last recomputed from xp_transactions
+			&core.DateField{Name: "refreshedAt"},
+			// Number of ranked users in the snapshot
+			&core.NumberField{Name: "totalUsers", OnlyInt: true, Min: PtrFloat(0)},
+			// Set once the period has ended and received its final refresh
+			&core.BoolField{Name: "finalized"},
+			// Timestamps
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+
+		periods.Indexes = append(periods.Indexes,
+			"CREATE UNIQUE INDEX idx_leaderboard_periods_key ON leaderboard_periods (periodType, periodKey)",
+		)
+
+		if err := app.Save(periods); err != nil {
+			return err
+		}
+
+		// Create leaderboard_entries collection, the ranked XP totals of a period
+		entries := core.NewBaseCollection("leaderboard_entries")
+		entries.Fields.Add(
+			&core.RelationField{Name: "period", MaxSelect: 1, Required: true, CollectionId: periods.Id, CascadeDelete: true},
+			&core.RelationField{Name: "user", MaxSelect: 1, Required: true, CollectionId: users.Id, CascadeDelete: true},
+			// XP earned within the period
+			&core.NumberField{Name: "xp", OnlyInt: true},
+			// Competition rank (ties share a rank)
+			&core.NumberField{Name: "rank", OnlyInt: true, Min: PtrFloat(1)},
+		)
+
+		entries.Indexes = append(entries.Indexes,
+			"CREATE UNIQUE INDEX idx_leaderboard_entries_unique ON leaderboard_entries (period, user)",
+			"CREATE INDEX idx_leaderboard_entries_rank ON leaderboard_entries (period, rank)",
+		)
+
+		return app.Save(entries)
+	}, func(app core.App) error {
+		// Down migration - drop collections
+		collection, err := app.FindCollectionByNameOrId("leaderboard_entries")
+		if err == nil {
+			if err = app.Delete(collection); err != nil {
+				return err
+			}
+		}
+
+		collection, err = app.FindCollectionByNameOrId("leaderboard_periods")
+		if err == nil {
+			if err = app.Delete(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		entries, err := app.FindCollectionByNameOrId("leaderboard_entries")
+		if err != nil {
+			return nil // Collection doesn't exist yet, skip
+		}
+
+		// Boards are ordered by (rank, user) so ties page stably; covering both
+		// lets the top list and the nearby window read the index in order
+		entries.RemoveIndex("idx_leaderboard_entries_rank")
+		entries.AddIndex("idx_leaderboard_entries_rank", false, "period, rank, user", "")
+
+		return app.Save(entries)
+	}, func(app core.App) error {
+		entries, err := app.FindCollectionByNameOrId("leaderboard_entries")
+		if err != nil {
+			return nil
+		}
+
+		entries.RemoveIndex("idx_leaderboard_entries_rank")
+		entries.AddIndex("idx_leaderboard_entries_rank", false, "period, rank", "")
+
+		return app.Save(entries)
+	})
+}
@@ -0,0 +1,78 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return nil // Users collection doesn't exist yet
+		}
+
+		// Create study_groups collection for private leaderboards
+		groups := core.NewBaseCollection("study_groups")
+		groups.Fields.Add(
+			&core.TextField{Name: "name", Required: true, Max: 60},
+			&core.TextField{Name: "description", Max: 280},
+			// Deleting the owner's account deletes the group
+			&core.RelationField{Name: "owner", MaxSelect: 1, Required: true, CollectionId: users.Id, CascadeDelete: true},
+			// Code others use to join; the owner can regenerate it
+			&core.TextField{Name: "inviteCode", Required: true},
+			&core.NumberField{Name: "maxMembers", OnlyInt: true, Min: PtrFloat(2)},
+			// Timestamps
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+
+		groups.Indexes = append(groups.Indexes,
+			"CREATE UNIQUE INDEX idx_study_groups_invite_code ON study_groups (inviteCode)",
+			"CREATE INDEX idx_study_groups_owner ON study_groups (owner)",
+		)
+
+		if err := app.Save(groups); err != nil {
+			return err
+		}
+
+		// Create study_group_members collection, including the owner
+		members := core.NewBaseCollection("study_group_members")
+		members.Fields.Add(
+			&core.RelationField{Name: "studyGroup", MaxSelect: 1, Required: true, CollectionId: groups.Id, CascadeDelete: true},
+			&core.RelationField{Name: "user", MaxSelect: 1, Required: true, CollectionId: users.Id, CascadeDelete: true},
+			&core.SelectField{
+				Name:      "role",
+				MaxSelect: 1,
+				Values:    []string{"owner", "member"},
+				Required:  true,
+			},
+			// Joined at
+			&core.AutodateField{Name: "created", OnCreate: true},
+		)
+
+		members.Indexes = append(members.Indexes,
+			"CREATE UNIQUE INDEX idx_study_group_members_unique ON study_group_members (studyGroup, user)",
+			"CREATE INDEX idx_study_group_members_user ON study_group_members (user)",
+		)
+
+		return app.Save(members)
+	}, func(app core.App) error {
+		// Down migration - drop collections
+		collection, err := app.FindCollectionByNameOrId("study_group_members")
+		if err == nil {
+			if err = app.Delete(collection); err != nil {
+				return err
+			}
+		}
+
+		collection, err = app.FindCollectionByNameOrId("study_groups")
+		if err == nil {
+			if err = app.Delete(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
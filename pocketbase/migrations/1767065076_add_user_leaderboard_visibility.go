@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return nil // Users collection doesn't exist yet
+		}
+
+		users.Fields.Add(
+			// How the user appears on leaderboards; empty means public
+			&core.SelectField{
+				Name:      "leaderboardVisibility",
+				MaxSelect: 1,
+				Values:    []string{"public", "pseudonymous", "hidden"},
+			},
+		)
+
+		return app.Save(users)
+	}, func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return nil
+		}
+
+		users.Fields.RemoveByName("leaderboardVisibility")
+
+		return app.Save(users)
+	})
+}
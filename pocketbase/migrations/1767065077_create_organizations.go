@@ -0,0 +1,106 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return nil // Users collection doesn't exist yet
+		}
+		licenses, err := app.FindCollectionByNameOrId("licenses")
+		if err != nil {
+			return nil // Licenses collection doesn't exist yet
+		}
+
+		// Create organizations collection (driving schools)
+		organizations := core.NewBaseCollection("organizations")
+		organizations.Fields.Add(
+			&core.TextField{Name: "name", Required: true, Max: 120},
+			// Billing / admin contact at the school
+			&core.EmailField{Name: "contactEmail"},
+			// Code students use to join and take a seat; owners can regenerate it
+			&core.TextField{Name: "joinCode", Required: true},
+			// Admin who set up the organization
+			&core.RelationField{Name: "createdBy", MaxSelect: 1, CollectionId: users.Id},
+			// Timestamps
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+
+		organizations.Indexes = append(organizations.Indexes,
+			"CREATE UNIQUE INDEX idx_organizations_join_code ON organizations (joinCode)",
+		)
+
+		if err := app.Save(organizations); err != nil {
+			return err
+		}
+
+		// Create org_members collection: owners, instructors and students
+		members := core.NewBaseCollection("org_members")
+		members.Fields.Add(
+			&core.RelationField{Name: "organization", MaxSelect: 1, Required: true, CollectionId: organizations.Id, CascadeDelete: true},
+			&core.RelationField{Name: "user", MaxSelect: 1, Required: true, CollectionId: users.Id, CascadeDelete: true},
+			// Students take a seat; owners and instructors don't
+			&core.SelectField{
+				Name:      "role",
+				MaxSelect: 1,
+				Values:    []string{"owner", "instructor", "student"},
+				Required:  true,
+			},
+			// Who added the member (empty when they joined with the code)
+			&core.RelationField{Name: "addedBy", MaxSelect: 1, CollectionId: users.Id},
+			// Joined at
+			&core.AutodateField{Name: "created", OnCreate: true},
+		)
+
+		members.Indexes = append(members.Indexes,
+			"CREATE UNIQUE INDEX idx_org_members_unique ON org_members (organization, user)",
+			"CREATE INDEX idx_org_members_user ON org_members (user)",
+			"CREATE INDEX idx_org_members_role ON org_members (organization, role)",
+		)
+
+		if err := app.Save(members); err != nil {
+			return err
+		}
+
+		// Enterprise licenses belong to an organization and cover a number of students
+		licenses.Fields.Add(
+			&core.RelationField{Name: "organization", MaxSelect: 1, CollectionId: organizations.Id},
+			&core.NumberField{Name: "seats", OnlyInt: true, Min: PtrFloat(0)},
+		)
+		licenses.AddIndex("idx_licenses_organization", false, "organization", "")
+
+		return app.Save(licenses)
+	}, func(app core.App) error {
+		// Down migration - remove license fields and drop collections
+		licenses, err := app.FindCollectionByNameOrId("licenses")
+		if err == nil {
+			licenses.RemoveIndex("idx_licenses_organization")
+			licenses.Fields.RemoveByName("organization")
+			licenses.Fields.RemoveByName("seats")
+			if err := app.Save(licenses); err != nil {
+				return err
+			}
+		}
+
+		collection, err := app.FindCollectionByNameOrId("org_members")
+		if err == nil {
+			if err = app.Delete(collection); err != nil {
+				return err
+			}
+		}
+
+		collection, err = app.FindCollectionByNameOrId("organizations")
+		if err == nil {
+			if err = app.Delete(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
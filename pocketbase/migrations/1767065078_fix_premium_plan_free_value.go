@@ -0,0 +1,16 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// The "free" plan was created as "'free", so downgrading a user to
+		// the free plan failed validation and left them premium
+		return setSelectValues(app, "users", "premiumPlan", []string{"free", "monthly", "yearly", "lifetime"})
+	}, func(app core.App) error {
+		return setSelectValues(app, "users", "premiumPlan", []string{"'free", "monthly", "yearly", "lifetime"})
+	})
+}
@@ -0,0 +1,84 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return nil // Users collection doesn't exist yet
+		}
+		licenses, err := app.FindCollectionByNameOrId("licenses")
+		if err != nil {
+			return nil // Licenses collection doesn't exist yet
+		}
+
+		// Create license_batches collection: named runs of generated keys
+		batches := core.NewBaseCollection("license_batches")
+		batches.Fields.Add(
+			&core.TextField{Name: "name", Required: true, Max: 120},
+			// Partner school or reseller the keys were printed for
+			&core.TextField{Name: "partner", Max: 120},
+			&core.TextField{Name: "notes"},
+			// Terms every key in the batch was generated with
+			&core.SelectField{
+				Name:      "type",
+				MaxSelect: 1,
+				Values:    []string{"lifetime", "enterprise", "promo", "gift"},
+				Required:  true,
+			},
+			&core.SelectField{
+				Name:      "plan",
+				MaxSelect: 1,
+				Values:    []string{"monthly", "yearly", "lifetime"},
+				Required:  true,
+			},
+			&core.NumberField{Name: "count", OnlyInt: true, Min: PtrFloat(1)},
+			// Set once the whole batch has been revoked
+			&core.DateField{Name: "revokedAt"},
+			// Admin who generated the batch
+			&core.RelationField{Name: "createdBy", MaxSelect: 1, CollectionId: users.Id},
+			// Timestamps
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+
+		batches.Indexes = append(batches.Indexes,
+			"CREATE INDEX idx_license_batches_created ON license_batches (created)",
+		)
+
+		if err := app.Save(batches); err != nil {
+			return err
+		}
+
+		// Each license remembers the batch it was generated in
+		licenses.Fields.Add(
+			&core.RelationField{Name: "batch", MaxSelect: 1, CollectionId: batches.Id},
+		)
+		licenses.AddIndex("idx_licenses_batch", false, "batch", "")
+
+		return app.Save(licenses)
+	}, func(app core.App) error {
+		// Down migration - remove license field and drop collection
+		licenses, err := app.FindCollectionByNameOrId("licenses")
+		if err == nil {
+			licenses.RemoveIndex("idx_licenses_batch")
+			licenses.Fields.RemoveByName("batch")
+			if err := app.Save(licenses); err != nil {
+				return err
+			}
+		}
+
+		collection, err := app.FindCollectionByNameOrId("license_batches")
+		if err == nil {
+			if err = app.Delete(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
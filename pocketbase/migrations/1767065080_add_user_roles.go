@@ -0,0 +1,85 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// staffContentCollections are edited by staff with the content edit
+// permission; their rules are narrowed to those roles in a later migration
+var staffContentCollections = []string{"test_blueprints", "badge_definitions"}
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return nil // Users collection doesn't exist yet
+		}
+
+		users.Fields.Add(
+			// Staff roles; only superusers can change them
+			&core.SelectField{
+				Name:      "roles",
+				MaxSelect: 4,
+				Values:    []string{"admin", "content_editor", "license_manager", "support"},
+			},
+		)
+
+		if err := app.Save(users); err != nil {
+			return err
+		}
+
+		// Admin access used to be granted by email domain; keep those staff in.
+		// Only verified addresses count: anyone can sign up with the domain.
+		_, err = app.DB().NewQuery(
+			"UPDATE users SET roles = {:roles} WHERE email LIKE {:domain} AND verified = TRUE",
+		).Bind(dbx.Params{"roles": `["admin"]`, "domain": "%@driveontario.com"}).Execute()
+		if err != nil {
+			return err
+		}
+
+		rule := types.Pointer("@request.auth.collectionName = 'users'")
+		for _, name := range staffContentCollections {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				continue
+			}
+			collection.ListRule = rule
+			collection.ViewRule = rule
+			collection.CreateRule = rule
+			collection.UpdateRule = rule
+			collection.DeleteRule = rule
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		for _, name := range staffContentCollections {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				continue
+			}
+			collection.ListRule = nil
+			collection.ViewRule = nil
+			collection.CreateRule = nil
+			collection.UpdateRule = nil
+			collection.DeleteRule = nil
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return nil
+		}
+
+		users.Fields.RemoveByName("roles")
+
+		return app.Save(users)
+	})
+}
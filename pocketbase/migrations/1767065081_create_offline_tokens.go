@@ -0,0 +1,54 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return nil // Users collection doesn't exist yet
+		}
+
+		// Create offline_tokens collection: every offline token ever issued,
+		// so tokens can be listed per device and revoked server-side
+		tokens := core.NewBaseCollection("offline_tokens")
+		tokens.Fields.Add(
+			// Token ID from the token claims
+			&core.TextField{Name: "jti", Required: true},
+			&core.RelationField{Name: "user", MaxSelect: 1, Required: true, CollectionId: users.Id, CascadeDelete: true},
+			&core.TextField{Name: "deviceFingerprint"},
+			&core.TextField{Name: "deviceName", Max: 120},
+			&core.TextField{Name: "userAgent"},
+			&core.DateField{Name: "expiresAt", Required: true},
+			&core.DateField{Name: "lastValidatedAt"},
+			// Set once the token is revoked; empty means still valid until expiry
+			&core.DateField{Name: "revokedAt"},
+			&core.SelectField{
+				Name:      "revokeReason",
+				MaxSelect: 1,
+				Values:    []string{"user", "replaced", "password_change", "premium_lost"},
+			},
+			// Timestamps
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+
+		tokens.Indexes = append(tokens.Indexes,
+			"CREATE UNIQUE INDEX idx_offline_tokens_jti ON offline_tokens (jti)",
+			"CREATE INDEX idx_offline_tokens_user ON offline_tokens (user, revokedAt)",
+		)
+
+		return app.Save(tokens)
+	}, func(app core.App) error {
+		// Down migration - drop collection
+		collection, err := app.FindCollectionByNameOrId("offline_tokens")
+		if err != nil {
+			return nil
+		}
+
+		return app.Delete(collection)
+	})
+}
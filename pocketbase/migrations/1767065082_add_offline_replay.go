@@ -0,0 +1,51 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		tokens, err := app.FindCollectionByNameOrId("offline_tokens")
+		if err != nil {
+			return nil // Collection doesn't exist yet, skip
+		}
+
+		// Track how much of the token's offline answer log has been replayed
+		tokens.Fields.Add(
+			// Sequence number of the last replayed log entry
+			&core.NumberField{Name: "replayedSeq", OnlyInt: true},
+			// MAC of the last replayed log entry; the next entry must chain from it
+			&core.TextField{Name: "replayHead"},
+			// When the last replayed answer was given (unix ms, device clock)
+			&core.NumberField{Name: "replayedUntil", OnlyInt: true},
+			// XP credited from the log so far
+			&core.NumberField{Name: "replayedXP", OnlyInt: true},
+		)
+		if err := app.Save(tokens); err != nil {
+			return err
+		}
+
+		// Allow answers and XP replayed from offline answer logs
+		if err := setSelectValues(app, "question_attempts", "source", []string{"practice", "test", "offline"}); err != nil {
+			return err
+		}
+		return setSelectValues(app, "xp_transactions", "referenceType", []string{"question", "test", "badge", "streak", "daily_challenge", "correction", "practice", "offline"})
+	}, func(app core.App) error {
+		if tokens, err := app.FindCollectionByNameOrId("offline_tokens"); err == nil {
+			tokens.Fields.RemoveByName("replayedSeq")
+			tokens.Fields.RemoveByName("replayHead")
+			tokens.Fields.RemoveByName("replayedUntil")
+			tokens.Fields.RemoveByName("replayedXP")
+			if err := app.Save(tokens); err != nil {
+				return err
+			}
+		}
+
+		if err := setSelectValues(app, "question_attempts", "source", []string{"practice", "test"}); err != nil {
+			return err
+		}
+		return setSelectValues(app, "xp_transactions", "referenceType", []string{"question", "test", "badge", "streak", "daily_challenge", "correction", "practice"})
+	})
+}
@@ -0,0 +1,63 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		questions, err := app.FindCollectionByNameOrId("questions")
+		if err != nil {
+			return nil // Questions collection doesn't exist yet
+		}
+
+		// Create question_bank_changes collection: one row per change to the
+		// question bank. The highest version is the current bank version.
+		changes := core.NewBaseCollection("question_bank_changes")
+		changes.Fields.Add(
+			// Bank version this change produced, increasing by one per change
+			&core.NumberField{Name: "version", OnlyInt: true, Required: true},
+			// Question record ID; not a relation so deletions keep their row
+			&core.TextField{Name: "question", Required: true},
+			&core.SelectField{Name: "action", MaxSelect: 1, Values: []string{"create", "update", "delete"}, Required: true},
+			&core.AutodateField{Name: "created", OnCreate: true},
+		)
+
+		changes.Indexes = append(changes.Indexes,
+			"CREATE UNIQUE INDEX idx_question_bank_changes_version ON question_bank_changes (version)",
+			"CREATE INDEX idx_question_bank_changes_question ON question_bank_changes (question)",
+		)
+
+		if err := app.Save(changes); err != nil {
+			return err
+		}
+
+		// Backfill: the existing bank is one "create" per question
+		records, err := app.FindAllRecords(questions)
+		if err != nil {
+			return err
+		}
+		for i, record := range records {
+			change := core.NewRecord(changes)
+			change.Set("version", i+1)
+			change.Set("question", record.Id)
+			change.Set("action", "create")
+			if err := app.Save(change); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		// Down migration - drop collection
+		collection, err := app.FindCollectionByNameOrId("question_bank_changes")
+		if err == nil {
+			if err = app.Delete(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
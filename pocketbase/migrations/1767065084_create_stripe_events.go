@@ -0,0 +1,74 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// Create stripe_events collection: every webhook event received, stored
+		// before it's processed so failures can be retried and replayed
+		events := core.NewBaseCollection("stripe_events")
+		events.Fields.Add(
+			// Stripe event ID (evt_...)
+			&core.TextField{Name: "eventId", Required: true},
+			&core.TextField{Name: "type", Required: true},
+			// When Stripe created the event
+			&core.DateField{Name: "eventCreated"},
+			// The event as received
+			&core.JSONField{Name: "payload", MaxSize: 1 << 20},
+			&core.SelectField{
+				Name:      "status",
+				MaxSelect: 1,
+				Values:    []string{"pending", "processing", "processed", "failed", "ignored"},
+				Required:  true,
+			},
+			&core.NumberField{Name: "attempts", OnlyInt: true},
+			&core.TextField{Name: "lastError"},
+			// When the retry worker should try again; empty once attempts run out
+			&core.DateField{Name: "nextAttemptAt"},
+			&core.DateField{Name: "processedAt"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+
+		events.Indexes = append(events.Indexes,
+			"CREATE UNIQUE INDEX idx_stripe_events_event_id ON stripe_events (eventId)",
+			"CREATE INDEX idx_stripe_events_status ON stripe_events (status, nextAttemptAt)",
+		)
+
+		if err := app.Save(events); err != nil {
+			return err
+		}
+
+		// Remember the last event applied to each subscription, so events
+		// delivered out of order can't roll it back
+		subscriptions, err := app.FindCollectionByNameOrId("subscriptions")
+		if err != nil {
+			return nil // Subscriptions collection doesn't exist yet
+		}
+		subscriptions.Fields.Add(&core.DateField{Name: "lastEventAt"})
+		subscriptions.AddIndex("idx_subscriptions_stripe_id", false, "stripeSubscriptionId", "")
+
+		return app.Save(subscriptions)
+	}, func(app core.App) error {
+		if subscriptions, err := app.FindCollectionByNameOrId("subscriptions"); err == nil {
+			subscriptions.Fields.RemoveByName("lastEventAt")
+			subscriptions.RemoveIndex("idx_subscriptions_stripe_id")
+			if err := app.Save(subscriptions); err != nil {
+				return err
+			}
+		}
+
+		// Down migration - drop collection
+		collection, err := app.FindCollectionByNameOrId("stripe_events")
+		if err == nil {
+			if err = app.Delete(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,44 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// Create stripe_reconcile_reports collection: one row per run of the
+		// Stripe subscription reconciliation
+		reports := core.NewBaseCollection("stripe_reconcile_reports")
+		reports.Fields.Add(
+			&core.SelectField{Name: "trigger", MaxSelect: 1, Values: []string{"cron", "cli"}, Required: true},
+			// Whether mismatches were fixed or only reported
+			&core.BoolField{Name: "applied"},
+			&core.NumberField{Name: "checked", OnlyInt: true},
+			&core.NumberField{Name: "mismatched", OnlyInt: true},
+			&core.NumberField{Name: "fixed", OnlyInt: true},
+			&core.NumberField{Name: "errors", OnlyInt: true},
+			&core.DateField{Name: "startedAt"},
+			&core.DateField{Name: "finishedAt"},
+			// Subscriptions that mismatched or failed, with what was wrong
+			&core.JSONField{Name: "items", MaxSize: 5 << 20},
+			&core.AutodateField{Name: "created", OnCreate: true},
+		)
+
+		reports.Indexes = append(reports.Indexes,
+			"CREATE INDEX idx_stripe_reconcile_reports_created ON stripe_reconcile_reports (created)",
+		)
+
+		return app.Save(reports)
+	}, func(app core.App) error {
+		// Down migration - drop collection
+		collection, err := app.FindCollectionByNameOrId("stripe_reconcile_reports")
+		if err == nil {
+			if err = app.Delete(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,92 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return nil // Users collection doesn't exist yet
+		}
+
+		// A Stripe lifetime purchase leaves no subscription behind, so
+		// remember it on the user
+		users.Fields.Add(&core.DateField{Name: "lifetimePurchasedAt"})
+		if err := app.Save(users); err != nil {
+			return err
+		}
+
+		// Backfill: lifetime users who went through Stripe checkout and
+		// don't hold a lifetime license bought it
+		records, err := app.FindRecordsByFilter(
+			users,
+			"isPremium = true && premiumPlan = 'lifetime' && stripeCustomerId != ''",
+			"",
+			0,
+			0,
+		)
+		if err != nil {
+			return err
+		}
+		for _, user := range records {
+			licensed, err := app.CountRecords("licenses", dbx.NewExp(
+				"user = {:userId} AND isRevoked = false AND (type = 'lifetime' OR plan = 'lifetime')",
+				dbx.Params{"userId": user.Id},
+			))
+			if err != nil {
+				return err
+			}
+			if licensed > 0 {
+				continue
+			}
+			user.Set("lifetimePurchasedAt", user.GetDateTime("updated"))
+			if err := app.SaveNoValidate(user); err != nil {
+				return err
+			}
+		}
+
+		// Create premium_downgrades collection: one row each time a user
+		// loses premium, with the reason
+		downgrades := core.NewBaseCollection("premium_downgrades")
+		downgrades.Fields.Add(
+			&core.RelationField{Name: "user", MaxSelect: 1, Required: true, CollectionId: users.Id, CascadeDelete: true},
+			&core.SelectField{
+				Name:      "reason",
+				MaxSelect: 1,
+				Values:    []string{"subscription_ended", "license_expired", "license_revoked", "no_grant"},
+				Required:  true,
+			},
+			// What ended, e.g. the subscription or license ID
+			&core.TextField{Name: "detail"},
+			// The premium the user had
+			&core.TextField{Name: "plan"},
+			&core.DateField{Name: "expiresAt"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+		)
+
+		downgrades.Indexes = append(downgrades.Indexes,
+			"CREATE INDEX idx_premium_downgrades_user ON premium_downgrades (user, created)",
+		)
+
+		return app.Save(downgrades)
+	}, func(app core.App) error {
+		// Down migration - drop collection
+		collection, err := app.FindCollectionByNameOrId("premium_downgrades")
+		if err == nil {
+			if err = app.Delete(collection); err != nil {
+				return err
+			}
+		}
+
+		if users, err := app.FindCollectionByNameOrId("users"); err == nil {
+			users.Fields.RemoveByName("lifetimePurchasedAt")
+			return app.Save(users)
+		}
+
+		return nil
+	})
+}
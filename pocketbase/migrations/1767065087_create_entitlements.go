@@ -0,0 +1,295 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return nil // Users collection doesn't exist yet
+		}
+		subscriptions, err := app.FindCollectionByNameOrId("subscriptions")
+		if err != nil {
+			return nil
+		}
+		licenses, err := app.FindCollectionByNameOrId("licenses")
+		if err != nil {
+			return nil
+		}
+		organizations, err := app.FindCollectionByNameOrId("organizations")
+		if err != nil {
+			return nil
+		}
+
+		// Create entitlements collection: every grant of premium a user has
+		// had. Effective access is the longest-lasting active grant.
+		entitlements := core.NewBaseCollection("entitlements")
+		entitlements.Fields.Add(
+			&core.RelationField{Name: "user", MaxSelect: 1, Required: true, CollectionId: users.Id, CascadeDelete: true},
+			&core.SelectField{
+				Name:      "source",
+				MaxSelect: 1,
+				Values:    []string{"stripe", "license", "promo", "admin"},
+				Required:  true,
+			},
+			&core.SelectField{
+				Name:      "plan",
+				MaxSelect: 1,
+				Values:    []string{"monthly", "yearly", "lifetime"},
+				Required:  true,
+			},
+			&core.DateField{Name: "startsAt"},
+			// Empty when the grant doesn't end
+			&core.DateField{Name: "endsAt"},
+			&core.DateField{Name: "revokedAt"},
+			// What the grant comes from; admin and promo grants made by staff have none
+			&core.RelationField{Name: "subscription", MaxSelect: 1, CollectionId: subscriptions.Id},
+			&core.RelationField{Name: "license", MaxSelect: 1, CollectionId: licenses.Id},
+			// Set for organization seats, whose license can change
+			&core.RelationField{Name: "organization", MaxSelect: 1, CollectionId: organizations.Id, CascadeDelete: true},
+			&core.RelationField{Name: "grantedBy", MaxSelect: 1, CollectionId: users.Id},
+			&core.TextField{Name: "note", Max: 500},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+
+		entitlements.Indexes = append(entitlements.Indexes,
+			"CREATE INDEX idx_entitlements_user ON entitlements (user, endsAt)",
+			"CREATE INDEX idx_entitlements_subscription ON entitlements (subscription)",
+			"CREATE INDEX idx_entitlements_license ON entitlements (license)",
+		)
+
+		if err := app.Save(entitlements); err != nil {
+			return err
+		}
+
+		err = setSelectValues(app, "premium_downgrades", "reason", []string{
+			"subscription_ended", "license_expired", "license_revoked", "seat_ended", "grant_ended", "grant_revoked", "no_grant",
+		})
+		if err != nil {
+			return err
+		}
+
+		return backfillEntitlements(app, entitlements)
+	}, func(app core.App) error {
+		err := setSelectValues(app, "premium_downgrades", "reason", []string{
+			"subscription_ended", "license_expired", "license_revoked", "no_grant",
+		})
+		if err != nil {
+			return err
+		}
+
+		// Down migration - drop collection
+		collection, err := app.FindCollectionByNameOrId("entitlements")
+		if err == nil {
+			if err = app.Delete(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// backfillEntitlements records the grants behind existing premium:
+// subscriptions, lifetime purchases, redeemed licenses and organization seats
+func backfillEntitlements(app core.App, entitlements *core.Collection) error {
+	grant := func(user, source, plan string, startsAt, endsAt, revokedAt types.DateTime, relations map[string]string) error {
+		record := core.NewRecord(entitlements)
+		record.Set("user", user)
+		record.Set("source", source)
+		record.Set("plan", plan)
+		record.Set("startsAt", startsAt)
+		record.Set("endsAt", endsAt)
+		record.Set("revokedAt", revokedAt)
+		for field, id := range relations {
+			record.Set(field, id)
+		}
+		return app.Save(record)
+	}
+
+	subscriptions, err := app.FindAllRecords("subscriptions")
+	if err != nil {
+		return err
+	}
+	for _, sub := range subscriptions {
+		if sub.GetString("plan") == "" {
+			continue
+		}
+		startsAt := sub.GetDateTime("created")
+		endsAt := sub.GetDateTime("currentPeriodEnd")
+		if sub.GetString("status") == "expired" {
+			ended := sub.GetDateTime("lastEventAt")
+			if ended.IsZero() {
+				ended = sub.GetDateTime("updated")
+			}
+			if endsAt.IsZero() || ended.Time().Before(endsAt.Time()) {
+				endsAt = ended
+			}
+		}
+		err := grant(sub.GetString("user"), "stripe", sub.GetString("plan"), startsAt, endsAt, types.DateTime{},
+			map[string]string{"subscription": sub.Id})
+		if err != nil {
+			return err
+		}
+	}
+
+	purchasers, err := app.FindRecordsByFilter("users", "lifetimePurchasedAt != ''", "", 0, 0)
+	if err != nil {
+		return err
+	}
+	for _, user := range purchasers {
+		err := grant(user.Id, "stripe", "lifetime", user.GetDateTime("lifetimePurchasedAt"), types.DateTime{}, types.DateTime{}, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	redeemed, err := app.FindRecordsByFilter("licenses", "user != '' && organization = '' && (isActive = true || isRevoked = true)", "", 0, 0)
+	if err != nil {
+		return err
+	}
+	for _, license := range redeemed {
+		source := "license"
+		if license.GetString("type") == "promo" {
+			source = "promo"
+		}
+		plan := license.GetString("plan")
+		if license.GetString("type") == "lifetime" {
+			plan = "lifetime"
+		}
+
+		startsAt := license.GetDateTime("redeemedAt")
+		if startsAt.IsZero() {
+			startsAt = license.GetDateTime("created")
+		}
+
+		// Keys without an expiry date run one plan period from redemption
+		var endsAt types.DateTime
+		switch {
+		case plan == "lifetime":
+		case !license.GetDateTime("expiresAt").IsZero():
+			endsAt = license.GetDateTime("expiresAt")
+		case plan == "yearly":
+			endsAt, _ = types.ParseDateTime(startsAt.Time().AddDate(1, 0, 0))
+		default:
+			endsAt, _ = types.ParseDateTime(startsAt.Time().AddDate(0, 1, 0))
+		}
+
+		var revokedAt types.DateTime
+		if license.GetBool("isRevoked") {
+			revokedAt = license.GetDateTime("updated")
+		}
+
+		err := grant(license.GetString("user"), source, plan, startsAt, endsAt, revokedAt,
+			map[string]string{"license": license.Id})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Students hold a seat while their organization has an unexpired,
+	// unrevoked license with seats; they get the longest-lasting one's terms
+	students, err := app.FindRecordsByFilter("org_members", "role = 'student'", "", 0, 0)
+	if err != nil {
+		return err
+	}
+	for _, member := range students {
+		orgID := member.GetString("organization")
+		orgLicenses, err := app.FindRecordsByFilter(
+			"licenses",
+			"organization = {:orgId} && isRevoked = false && (expiresAt = '' || expiresAt > {:now})",
+			"",
+			0,
+			0,
+			dbx.Params{"orgId": orgID, "now": types.NowDateTime().String()},
+		)
+		if err != nil {
+			return err
+		}
+
+		seats := 0
+		var best *core.Record
+		for _, license := range orgLicenses {
+			seats += license.GetInt("seats")
+			expiresAt := license.GetDateTime("expiresAt")
+			if best == nil || (!best.GetDateTime("expiresAt").IsZero() &&
+				(expiresAt.IsZero() || expiresAt.Time().After(best.GetDateTime("expiresAt").Time()))) {
+				best = license
+			}
+		}
+		if seats == 0 || best == nil {
+			continue
+		}
+
+		plan := best.GetString("plan")
+		if best.GetString("type") == "lifetime" {
+			plan = "lifetime"
+		}
+		err = grant(member.GetString("user"), "license", plan, member.GetDateTime("created"), best.GetDateTime("expiresAt"), types.DateTime{},
+			map[string]string{"license": best.Id, "organization": orgID})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Premium set by hand (comped accounts) has nothing to derive a grant
+	// from; record it as an admin grant on the same terms so the expiry job
+	// doesn't take it away. Only a lifetime plan gets a grant without an
+	// end: a subscription plan with no expiry (a checkout whose subscription
+	// couldn't be read) gets one more period and a note for staff to review
+	premium, err := app.FindRecordsByFilter("users", "isPremium = true", "", 0, 0)
+	if err != nil {
+		return err
+	}
+	nowTime := types.NowDateTime()
+	now := nowTime.String()
+	for _, user := range premium {
+		active, err := app.CountRecords("entitlements", dbx.NewExp(
+			"user = {:userId} AND revokedAt = '' AND (startsAt = '' OR startsAt <= {:now}) AND (endsAt = '' OR endsAt > {:now})",
+			dbx.Params{"userId": user.Id, "now": now},
+		))
+		if err != nil {
+			return err
+		}
+		if active > 0 {
+			continue
+		}
+
+		endsAt := user.GetDateTime("premiumExpiresAt")
+		note := "Backfilled from isPremium"
+		plan := user.GetString("premiumPlan")
+		if plan != "monthly" && plan != "yearly" && plan != "lifetime" {
+			plan = "monthly"
+		}
+		switch {
+		case plan == "lifetime":
+			endsAt = types.DateTime{}
+		case endsAt.IsZero():
+			months := 1
+			if plan == "yearly" {
+				months = 12
+			}
+			endsAt, _ = types.ParseDateTime(nowTime.Time().AddDate(0, months, 0))
+			note += " without an expiry; review the terms"
+		}
+
+		record := core.NewRecord(entitlements)
+		record.Set("user", user.Id)
+		record.Set("source", "admin")
+		record.Set("plan", plan)
+		record.Set("startsAt", user.GetDateTime("created"))
+		record.Set("endsAt", endsAt)
+		record.Set("note", note)
+		if err := app.Save(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return nil // Users collection doesn't exist yet
+		}
+		organizations, err := app.FindCollectionByNameOrId("organizations")
+		if err != nil {
+			return nil // Organizations collection doesn't exist yet
+		}
+
+		// Create org_invites collection: staff invite an email address and
+		// the account holder joins by accepting
+		invites := core.NewBaseCollection("org_invites")
+		invites.Fields.Add(
+			&core.RelationField{Name: "organization", MaxSelect: 1, Required: true, CollectionId: organizations.Id, CascadeDelete: true},
+			// Lowercased; matched against the verified email of the account that accepts
+			&core.EmailField{Name: "email", Required: true},
+			&core.SelectField{
+				Name:      "role",
+				MaxSelect: 1,
+				Values:    []string{"instructor", "student"},
+				Required:  true,
+			},
+			&core.RelationField{Name: "invitedBy", MaxSelect: 1, CollectionId: users.Id},
+			&core.DateField{Name: "expiresAt", Required: true},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+
+		invites.Indexes = append(invites.Indexes,
+			"CREATE UNIQUE INDEX idx_org_invites_unique ON org_invites (organization, email)",
+			"CREATE INDEX idx_org_invites_email ON org_invites (email)",
+		)
+
+		return app.Save(invites)
+	}, func(app core.App) error {
+		// Down migration - drop collection
+		collection, err := app.FindCollectionByNameOrId("org_invites")
+		if err == nil {
+			if err = app.Delete(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		transactions, err := app.FindCollectionByNameOrId("xp_transactions")
+		if err != nil {
+			return nil // Collection doesn't exist yet, skip
+		}
+
+		// Client-claimed XP from before the ledger was server-side can repeat
+		// a reference. Keep the earliest entry's reference and move the later
+		// ones' into metadata, so balances are unchanged and nothing is lost.
+		_, err = app.DB().NewQuery(`
+			UPDATE xp_transactions
+			SET metadata = json_set(
+					CASE WHEN json_valid(metadata) AND json_type(metadata) = 'object' THEN metadata ELSE '{}' END,
+					'$.duplicateReferenceId', referenceId
+				),
+				referenceId = ''
+			WHERE referenceId != '' AND EXISTS (
+				SELECT 1 FROM xp_transactions earlier
+				WHERE earlier.user = xp_transactions.user
+					AND earlier.reason = xp_transactions.reason
+					AND earlier.referenceId = xp_transactions.referenceId
+					AND (earlier.created < xp_transactions.created
+						OR (earlier.created = xp_transactions.created AND earlier.id < xp_transactions.id))
+			)`).Execute()
+		if err != nil {
+			return err
+		}
+
+		// A reason pays at most once per reference (daily login per day,
+		// daily challenge, mastered flashcard, session), even for
+		// concurrent requests
+		transactions.AddIndex("idx_xp_transactions_reference", true, "user, reason, referenceId", "referenceId != ''")
+
+		return app.Save(transactions)
+	}, func(app core.App) error {
+		transactions, err := app.FindCollectionByNameOrId("xp_transactions")
+		if err != nil {
+			return nil
+		}
+
+		transactions.RemoveIndex("idx_xp_transactions_reference")
+
+		return app.Save(transactions)
+	})
+}
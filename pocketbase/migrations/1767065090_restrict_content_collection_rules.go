@@ -0,0 +1,51 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// The content collections were opened to every signed-in user, with
+		// the content edit permission checked only by request hooks. Put the
+		// roles that grant it in the rules themselves; the hooks stay as a
+		// second check.
+		rule := types.Pointer("@request.auth.collectionName = 'users' && (@request.auth.roles:each ?= 'admin' || @request.auth.roles:each ?= 'content_editor')")
+		for _, name := range staffContentCollections {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				continue
+			}
+			collection.ListRule = rule
+			collection.ViewRule = rule
+			collection.CreateRule = rule
+			collection.UpdateRule = rule
+			collection.DeleteRule = rule
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		rule := types.Pointer("@request.auth.collectionName = 'users'")
+		for _, name := range staffContentCollections {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				continue
+			}
+			collection.ListRule = rule
+			collection.ViewRule = rule
+			collection.CreateRule = rule
+			collection.UpdateRule = rule
+			collection.DeleteRule = rule
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return nil // Collection doesn't exist yet, skip
+		}
+
+		users.Fields.Add(
+			// When the user last moved from one timezone to another; changes
+			// are limited so they can't re-open daily rewards
+			&core.DateField{Name: "timezoneChangedAt"},
+		)
+
+		return app.Save(users)
+	}, func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return nil
+		}
+
+		users.Fields.RemoveByName("timezoneChangedAt")
+
+		return app.Save(users)
+	})
+}
@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return nil // Collection doesn't exist yet, skip
+		}
+
+		users.Fields.Add(
+			// Random secret the user's leaderboard pseudonym is derived from,
+			// so the pseudonym can't be worked out from the user ID
+			&core.TextField{Name: "pseudonymKey", Hidden: true, AutogeneratePattern: "[a-z0-9]{32}"},
+		)
+		if err := app.Save(users); err != nil {
+			return err
+		}
+
+		// Backfill: every existing user gets a key of their own
+		_, err = app.DB().NewQuery("UPDATE users SET pseudonymKey = lower(hex(randomblob(16))) WHERE pseudonymKey = ''").Execute()
+		return err
+	}, func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return nil
+		}
+
+		users.Fields.RemoveByName("pseudonymKey")
+
+		return app.Save(users)
+	})
+}
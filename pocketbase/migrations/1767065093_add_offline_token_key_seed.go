@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		tokens, err := app.FindCollectionByNameOrId("offline_tokens")
+		if err != nil {
+			return nil // Collection doesn't exist yet, skip
+		}
+
+		tokens.Fields.Add(
+			// Random secret the token's content pack and answer log keys are
+			// derived from, so they outlive a rotation of the signing key.
+			// Tokens issued before it existed derive them from the signing key.
+			&core.TextField{Name: "keySeed", Hidden: true},
+		)
+
+		return app.Save(tokens)
+	}, func(app core.App) error {
+		tokens, err := app.FindCollectionByNameOrId("offline_tokens")
+		if err != nil {
+			return nil
+		}
+
+		tokens.Fields.RemoveByName("keySeed")
+
+		return app.Save(tokens)
+	})
+}
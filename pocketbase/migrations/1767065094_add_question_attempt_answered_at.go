@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		attempts, err := app.FindCollectionByNameOrId("question_attempts")
+		if err != nil {
+			return nil // Collection doesn't exist yet, skip
+		}
+
+		attempts.Fields.Add(
+			// When the answer was given (unix ms); the device clock for
+			// offline answers, which are only recorded when replayed
+			&core.NumberField{Name: "answeredAt", OnlyInt: true},
+		)
+		attempts.AddIndex("idx_question_attempts_user_answered", false, "user, source, answeredAt", "")
+
+		return app.Save(attempts)
+	}, func(app core.App) error {
+		attempts, err := app.FindCollectionByNameOrId("question_attempts")
+		if err != nil {
+			return nil
+		}
+
+		attempts.RemoveIndex("idx_question_attempts_user_answered")
+		attempts.Fields.RemoveByName("answeredAt")
+
+		return app.Save(attempts)
+	})
+}
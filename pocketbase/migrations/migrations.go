@@ -1 +1,21 @@
 package migrations
+
+import "github.com/pocketbase/pocketbase/core"
+
+// setSelectValues replaces the options of a select field, if the collection exists
+func setSelectValues(app core.App, collectionName, fieldName string, values []string) error {
+	collection, err := app.FindCollectionByNameOrId(collectionName)
+	if err != nil {
+		return nil
+	}
+
+	for i, field := range collection.Fields {
+		if selectField, ok := field.(*core.SelectField); ok && selectField.Name == fieldName {
+			selectField.Values = values
+			collection.Fields[i] = selectField
+			break
+		}
+	}
+
+	return app.Save(collection)
+}
@@ -0,0 +1,354 @@
+package routes
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Attempt sources
+const (
+	AttemptSourcePractice = "practice"
+	AttemptSourceTest     = "test"
+	AttemptSourceOffline  = "offline"
+)
+
+// Weak-spot analysis settings
+const (
+	WeakSpotWindowDays   = 90 // Only attempts from the last 90 days are analysed
+	WeakSpotHalfLifeDays = 14 // An attempt counts half as much after 14 days
+	WeakSpotMaxAttempts  = 2000
+)
+
+// CategoryWeakSpot is a category ranked by recency-weighted error rate
+type CategoryWeakSpot struct {
+	Category      string  `json:"category"`
+	Attempts      int     `json:"attempts"`
+	Correct       int     `json:"correct"`
+	ErrorRate     float64 `json:"errorRate"`
+	WeightedError float64 `json:"weightedErrorRate"`
+	LastAttemptAt string  `json:"lastAttemptAt"`
+}
+
+// QuestionWeakSpot is a question ranked by recency-weighted error rate
+type QuestionWeakSpot struct {
+	Question      QuestionForClient `json:"question"`
+	Attempts      int               `json:"attempts"`
+	Correct       int               `json:"correct"`
+	ErrorRate     float64           `json:"errorRate"`
+	WeightedError float64           `json:"weightedErrorRate"`
+	LastAttemptAt string            `json:"lastAttemptAt"`
+	LastCorrect   bool              `json:"lastCorrect"`
+}
+
+// weakSpotStats accumulates attempts for one category or question
+type weakSpotStats struct {
+	attempts    int
+	correct     int
+	weight      float64
+	wrongWeight float64
+	lastAt      time.Time
+	lastCorrect bool
+}
+
+func (s *weakSpotStats) add(correct bool, at time.Time, weight float64) {
+	s.attempts++
+	s.weight += weight
+	if correct {
+		s.correct++
+	} else {
+		s.wrongWeight += weight
+	}
+	if at.After(s.lastAt) {
+		s.lastAt = at
+		s.lastCorrect = correct
+	}
+}
+
+func (s *weakSpotStats) errorRate() float64 {
+	if s.attempts == 0 {
+		return 0
+	}
+	return roundRate(float64(s.attempts-s.correct) / float64(s.attempts))
+}
+
+func (s *weakSpotStats) weightedErrorRate() float64 {
+	if s.weight == 0 {
+		return 0
+	}
+	return roundRate(s.wrongWeight / s.weight)
+}
+
+// handleGetWeakSpots ranks the user's categories and questions by error rate,
+// weighting recent attempts more heavily
+func handleGetWeakSpots(app core.App, e *core.RequestEvent) error {
+	authRecord := e.Auth
+	if authRecord == nil {
+		return e.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+
+	limit := 10
+	if l, err := strconv.Atoi(e.Request.URL.Query().Get("limit")); err == nil && l > 0 && l <= 50 {
+		limit = l
+	}
+
+	analysis, err := analyzeWeakSpots(app, authRecord.Id, time.Now().UTC())
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch answer history"})
+	}
+
+	// Only questions the user has got wrong at least once are weak spots
+	type rankedQuestion struct {
+		id    string
+		stats *weakSpotStats
+	}
+	ranked := make([]rankedQuestion, 0, len(analysis.questions))
+	for id, stats := range analysis.questions {
+		if stats.correct < stats.attempts {
+			ranked = append(ranked, rankedQuestion{id: id, stats: stats})
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		wi, wj := ranked[i].stats.weightedErrorRate(), ranked[j].stats.weightedErrorRate()
+		if wi != wj {
+			return wi > wj
+		}
+		return ranked[i].stats.lastAt.After(ranked[j].stats.lastAt)
+	})
+
+	questions := make([]QuestionWeakSpot, 0, limit)
+	for _, rq := range ranked {
+		if len(questions) >= limit {
+			break
+		}
+		record, err := app.FindRecordById("questions", rq.id)
+		if err != nil {
+			continue
+		}
+		q, err := recordToQuestionForClient(record)
+		if err != nil {
+			continue
+		}
+		questions = append(questions, QuestionWeakSpot{
+			Question:      q,
+			Attempts:      rq.stats.attempts,
+			Correct:       rq.stats.correct,
+			ErrorRate:     rq.stats.errorRate(),
+			WeightedError: rq.stats.weightedErrorRate(),
+			LastAttemptAt: rq.stats.lastAt.Format(time.RFC3339),
+			LastCorrect:   rq.stats.lastCorrect,
+		})
+	}
+
+	return e.JSON(http.StatusOK, map[string]interface{}{
+		"categories":    analysis.categories,
+		"questions":     questions,
+		"totalAttempts": analysis.attempts,
+		"windowDays":    WeakSpotWindowDays,
+	})
+}
+
+// weakSpotAnalysis is a user's recent answer history grouped by category and question
+type weakSpotAnalysis struct {
+	categories []CategoryWeakSpot // Weakest first
+	questions  map[string]*weakSpotStats
+	attempts   int
+}
+
+// analyzeWeakSpots groups a user's attempts from the analysis window,
+// weighting recent attempts more heavily
+func analyzeWeakSpots(app core.App, userID string, now time.Time) (*weakSpotAnalysis, error) {
+	since := now.AddDate(0, 0, -WeakSpotWindowDays)
+
+	attempts, err := app.FindRecordsByFilter(
+		"question_attempts",
+		"user = {:userId} && created >= {:since}",
+		"-created",
+		WeakSpotMaxAttempts,
+		0,
+		map[string]any{"userId": userID, "since": since.Format(types.DefaultDateLayout)},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	categoryStats := make(map[string]*weakSpotStats)
+	questionStats := make(map[string]*weakSpotStats)
+
+	for _, attempt := range attempts {
+		at := attempt.GetDateTime("created").Time()
+		ageDays := now.Sub(at).Hours() / 24
+		weight := math.Pow(0.5, ageDays/WeakSpotHalfLifeDays)
+		correct := attempt.GetBool("correct")
+
+		category := attempt.GetString("category")
+		if categoryStats[category] == nil {
+			categoryStats[category] = &weakSpotStats{}
+		}
+		categoryStats[category].add(correct, at, weight)
+
+		questionId := attempt.GetString("question")
+		if questionStats[questionId] == nil {
+			questionStats[questionId] = &weakSpotStats{}
+		}
+		questionStats[questionId].add(correct, at, weight)
+	}
+
+	categories := make([]CategoryWeakSpot, 0, len(categoryStats))
+	for category, stats := range categoryStats {
+		categories = append(categories, CategoryWeakSpot{
+			Category:      category,
+			Attempts:      stats.attempts,
+			Correct:       stats.correct,
+			ErrorRate:     stats.errorRate(),
+			WeightedError: stats.weightedErrorRate(),
+			LastAttemptAt: stats.lastAt.Format(time.RFC3339),
+		})
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if categories[i].WeightedError != categories[j].WeightedError {
+			return categories[i].WeightedError > categories[j].WeightedError
+		}
+		return categories[i].Attempts > categories[j].Attempts
+	})
+
+	return &weakSpotAnalysis{
+		categories: categories,
+		questions:  questionStats,
+		attempts:   len(attempts),
+	}, nil
+}
+
+// logQuestionAttempt records a single answer, given at answeredAt (unix ms),
+// in the question_attempts collection
+func logQuestionAttempt(app core.App, userId string, question Question, source, sessionId string, selectedAnswer, timeSpent int, answeredAt int64, correct bool) error {
+	collection, err := app.FindCollectionByNameOrId("question_attempts")
+	if err != nil {
+		return err // Collection might not exist yet
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("user", userId)
+	record.Set("question", question.ID)
+	record.Set("category", question.Category)
+	record.Set("difficulty", question.Difficulty)
+	record.Set("source", source)
+	if sessionId != "" {
+		record.Set("sessionId", sessionId)
+	}
+	record.Set("selectedAnswer", selectedAnswer)
+	record.Set("correct", correct)
+	record.Set("timeSpent", timeSpent)
+	record.Set("answeredAt", answeredAt)
+
+	return app.Save(record)
+}
+
+// roundRate rounds a ratio to 3 decimal places
+func roundRate(rate float64) float64 {
+	return math.Round(rate*1000) / 1000
+}
+
+// TestHistoryEntry is a completed test as shown in the user's progress
+type TestHistoryEntry struct {
+	ID                string                   `json:"id"`
+	Date              string                   `json:"date"`
+	Score             int                      `json:"score"`
+	TotalQuestions    int                      `json:"totalQuestions"`
+	CategoryBreakdown map[string]CategoryScore `json:"categoryBreakdown"`
+	TimeSpent         int                      `json:"timeSpent"` // seconds
+	Passed            bool                     `json:"passed"`
+	XPEarned          int                      `json:"xpEarned"`
+}
+
+// recordedProgress is a user's answer and test stats as recorded by the
+// server. Only answers scored in a session or an offline replay count: the
+// stateless validate endpoint can be called for the same question over and
+// over.
+type recordedProgress struct {
+	QuestionsCompleted int
+	QuestionsCorrect   int
+	BestCorrectStreak  int // Longest run of correct answers
+	CategoryProgress   map[string]CategoryScore
+	TestHistory        []TestHistoryEntry
+	FastestTestTime    int // Seconds of the fastest passed test; 0 until one is passed
+}
+
+// loadRecordedProgress collects a user's stats from question_attempts and
+// completed test sessions
+func loadRecordedProgress(app core.App, userId string) (recordedProgress, error) {
+	progress := recordedProgress{
+		CategoryProgress: map[string]CategoryScore{},
+		TestHistory:      []TestHistoryEntry{},
+	}
+
+	var attempts []struct {
+		Category string `db:"category"`
+		Correct  bool   `db:"correct"`
+	}
+	err := app.DB().
+		Select("category", "correct").
+		From("question_attempts").
+		Where(dbx.HashExp{"user": userId}).
+		AndWhere(dbx.NewExp("sessionId != ''")).
+		OrderBy("created ASC", "rowid ASC").
+		All(&attempts)
+	if err != nil {
+		return progress, err
+	}
+
+	run := 0
+	for _, a := range attempts {
+		progress.QuestionsCompleted++
+		cs := progress.CategoryProgress[a.Category]
+		cs.Total++
+		if a.Correct {
+			progress.QuestionsCorrect++
+			cs.Correct++
+			run++
+			progress.BestCorrectStreak = max(progress.BestCorrectStreak, run)
+		} else {
+			run = 0
+		}
+		progress.CategoryProgress[a.Category] = cs
+	}
+
+	tests, err := app.FindRecordsByFilter(
+		"question_sessions",
+		"user = {:userId} && sessionType = {:type} && status = 'completed'",
+		"completedAt",
+		0,
+		0,
+		dbx.Params{"userId": userId, "type": SessionTypeTest},
+	)
+	if err != nil {
+		return progress, err
+	}
+	for _, session := range tests {
+		var results TestCompleteResponse
+		if err := session.UnmarshalJSONField("results", &results); err != nil || results.TotalQuestions == 0 {
+			continue
+		}
+		progress.TestHistory = append(progress.TestHistory, TestHistoryEntry{
+			ID:                session.Id,
+			Date:              session.GetString("completedAt"),
+			Score:             results.Score,
+			TotalQuestions:    results.TotalQuestions,
+			CategoryBreakdown: results.CategoryBreakdown,
+			TimeSpent:         results.TimeSpent,
+			Passed:            results.Passed,
+			XPEarned:          results.XPEarned,
+		})
+		if results.Passed && (progress.FastestTestTime == 0 || results.TimeSpent < progress.FastestTestTime) {
+			progress.FastestTestTime = results.TimeSpent
+		}
+	}
+
+	return progress, nil
+}
@@ -0,0 +1,247 @@
+package routes
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	"driveprep/services"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+var ErrBadgeNotFound = errors.New("badge not found")
+
+// BadgeDefinition is a badge loaded from the badge_definitions collection
+type BadgeDefinition struct {
+	ID          string `json:"badgeId"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Icon        string `json:"icon"`
+	Tier        string `json:"tier"`
+	XPReward    int    `json:"xpReward"`
+	Rule        string `json:"rule"`
+}
+
+// BadgeEvaluation explains where a user stands on one badge
+type BadgeEvaluation struct {
+	BadgeDefinition
+	Earned     bool                     `json:"earned"`
+	Eligible   bool                     `json:"eligible"`
+	Conditions []services.RuleCondition `json:"conditions"`
+	Missing    []services.RuleCondition `json:"missing"`
+	Error      string                   `json:"error,omitempty"`
+}
+
+// categorySlugs maps question categories to the keys used in badge rules,
+// e.g. categories.road_signs.accuracy
+var categorySlugs = map[string]string{
+	CategoryRoadSigns:     "road_signs",
+	CategoryRulesOfRoad:   "rules_of_road",
+	CategorySafeDriving:   "safe_driving",
+	CategoryAlcoholDrugs:  "alcohol_drugs",
+	CategoryLicensing:     "licensing",
+	CategoryMiscellaneous: "miscellaneous",
+}
+
+// loadBadgeDefinitions returns all active badges in display order
+func loadBadgeDefinitions(app core.App) ([]BadgeDefinition, error) {
+	records, err := app.FindRecordsByFilter("badge_definitions", "isActive = true", "sortOrder", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	defs := make([]BadgeDefinition, 0, len(records))
+	for _, record := range records {
+		defs = append(defs, recordToBadgeDefinition(record))
+	}
+	return defs, nil
+}
+
+// findBadgeDefinition returns an active badge by its badge ID
+func findBadgeDefinition(app core.App, badgeID string) (BadgeDefinition, error) {
+	record, err := app.FindFirstRecordByFilter(
+		"badge_definitions",
+		"badgeId = {:badgeId} && isActive = true",
+		map[string]any{"badgeId": badgeID},
+	)
+	if err != nil {
+		return BadgeDefinition{}, ErrBadgeNotFound
+	}
+	return recordToBadgeDefinition(record), nil
+}
+
+func recordToBadgeDefinition(record *core.Record) BadgeDefinition {
+	return BadgeDefinition{
+		ID:          record.GetString("badgeId"),
+		Name:        record.GetString("name"),
+		Description: record.GetString("description"),
+		Icon:        record.GetString("icon"),
+		Tier:        record.GetString("tier"),
+		XPReward:    record.GetInt("xpReward"),
+		Rule:        record.GetString("rule"),
+	}
+}
+
+// userBadges returns the badge IDs the user has already earned
+func userBadges(user *core.Record) []string {
+	badgeList := []string{}
+	user.UnmarshalJSONField("badges", &badgeList)
+	return badgeList
+}
+
+// emptyBadgeStats returns every stat badge rules can reference, all zero
+func emptyBadgeStats() map[string]float64 {
+	stats := map[string]float64{
+		"questionsCompleted": 0,
+		"questionsCorrect":   0,
+		"accuracy":           0, // percent
+		"streak":             0,
+		"longestStreak":      0,
+		"xp":                 0,
+		"level":              0,
+		"badges":             0,
+		"hour":               0,
+		"bestCorrectStreak":  0,
+		"tests.taken":        0,
+		"tests.passed":       0,
+		"tests.perfect":      0,
+		// Seconds; 0 until a test has been passed
+		"tests.fastestPassSeconds": 0,
+	}
+	for _, slug := range categorySlugs {
+		stats["categories."+slug+".total"] = 0
+		stats["categories."+slug+".correct"] = 0
+		stats["categories."+slug+".accuracy"] = 0 // percent
+	}
+	return stats
+}
+
+// badgeStats collects the user's stats for badge rules. Answer and test
+// stats come from what the server recorded (see loadRecordedProgress), and
+// streaks, XP and badges from fields only the server writes, so nothing a
+// client submits can earn a badge.
+func badgeStats(app core.App, user *core.Record) (map[string]float64, error) {
+	progress, err := loadRecordedProgress(app, user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := emptyBadgeStats()
+	stats["questionsCompleted"] = float64(progress.QuestionsCompleted)
+	stats["questionsCorrect"] = float64(progress.QuestionsCorrect)
+	stats["accuracy"] = percent(progress.QuestionsCorrect, progress.QuestionsCompleted)
+	stats["streak"] = float64(user.GetInt("streak"))
+	stats["longestStreak"] = float64(user.GetInt("longestStreak"))
+	stats["xp"] = float64(user.GetInt("xp"))
+	stats["level"] = float64(user.GetInt("level"))
+	stats["badges"] = float64(len(userBadges(user)))
+	// Local hour in the user's timezone, for time-of-day badges
+	stats["hour"] = float64(services.LocalHour(time.Now(), userLocation(user)))
+	stats["bestCorrectStreak"] = float64(progress.BestCorrectStreak)
+
+	for category, slug := range categorySlugs {
+		catStats, ok := progress.CategoryProgress[category]
+		if !ok {
+			continue
+		}
+		stats["categories."+slug+".total"] = float64(catStats.Total)
+		stats["categories."+slug+".correct"] = float64(catStats.Correct)
+		stats["categories."+slug+".accuracy"] = percent(catStats.Correct, catStats.Total)
+	}
+
+	for _, test := range progress.TestHistory {
+		stats["tests.taken"]++
+		if test.Passed {
+			stats["tests.passed"]++
+		}
+		if test.TotalQuestions > 0 && test.Score == test.TotalQuestions {
+			stats["tests.perfect"]++
+		}
+	}
+	stats["tests.fastestPassSeconds"] = float64(progress.FastestTestTime)
+
+	return stats, nil
+}
+
+// evaluateBadge evaluates a badge's rule against the user's stats
+func evaluateBadge(def BadgeDefinition, stats map[string]float64) (services.RuleResult, error) {
+	return services.EvaluateRule(def.Rule, stats)
+}
+
+// handleEvaluateBadges explains, for every active badge, whether the user has
+// earned it, whether they qualify now and which conditions are still missing
+func handleEvaluateBadges(app core.App, e *core.RequestEvent) error {
+	authRecord := e.Auth
+	if authRecord == nil {
+		return e.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+
+	defs, err := loadBadgeDefinitions(app)
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load badges"})
+	}
+
+	earned := make(map[string]bool)
+	for _, b := range userBadges(authRecord) {
+		earned[b] = true
+	}
+
+	stats, err := badgeStats(app, authRecord)
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load progress"})
+	}
+
+	evaluations := make([]BadgeEvaluation, 0, len(defs))
+	for _, def := range defs {
+		evaluation := BadgeEvaluation{
+			BadgeDefinition: def,
+			Earned:          earned[def.ID],
+			Conditions:      []services.RuleCondition{},
+			Missing:         []services.RuleCondition{},
+		}
+
+		result, err := evaluateBadge(def, stats)
+		if err != nil {
+			// A broken rule shouldn't hide the other badges
+			app.Logger().Error("Failed to evaluate badge rule", "badgeId", def.ID, "error", err)
+			evaluation.Error = "Badge rule could not be evaluated"
+		} else {
+			evaluation.Eligible = result.Met
+			evaluation.Conditions = result.Conditions
+			if !result.Met {
+				evaluation.Missing = result.Missing()
+			}
+		}
+
+		evaluations = append(evaluations, evaluation)
+	}
+
+	return e.JSON(http.StatusOK, map[string]interface{}{
+		"badges": evaluations,
+		"stats":  stats,
+	})
+}
+
+// RegisterBadgeRuleHooks rejects badge definitions whose rule doesn't
+// parse or references unknown stats
+func RegisterBadgeRuleHooks(app core.App) {
+	app.OnRecordValidate("badge_definitions").BindFunc(func(e *core.RecordEvent) error {
+		if err := services.ValidateRule(e.Record.GetString("rule"), emptyBadgeStats()); err != nil {
+			return validation.Errors{
+				"rule": validation.NewError("validation_invalid_badge_rule", err.Error()),
+			}
+		}
+		return e.Next()
+	})
+}
+
+// percent returns part/total as a percentage rounded to one decimal place
+func percent(part, total int) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return math.Round(float64(part)/float64(total)*1000) / 10
+}
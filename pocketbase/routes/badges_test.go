@@ -0,0 +1,185 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// newTestSessionAnswers records n correct answers given in a practice
+// session, as the session routes would
+func newTestSessionAnswers(tb testing.TB, app core.App, user *core.Record, n int) {
+	tb.Helper()
+
+	question, err := recordToQuestion(newTestQuestion(tb, app))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if err := logQuestionAttempt(app, user.Id, question, AttemptSourcePractice, "session-1", 1, 4000, time.Now().UnixMilli(), true); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+func TestCheckBadgesPaysEachBadgeOnce(t *testing.T) {
+	app := newTestApp(t)
+	mux := newTestRouter(t, app, func(se *core.ServeEvent) {
+		RegisterProgressRoutes(app, se)
+	})
+
+	user := newTestUser(t, app, "collector@example.com", nil)
+	newTestSessionAnswers(t, app, user, 30)
+
+	checkBadges := func() (newBadges []string, xpEarned int) {
+		rec := serveTestRequest(t, mux, user, http.MethodPost, "/api/progress/check-badges", "")
+		if rec.Code != http.StatusOK {
+			t.Errorf("check-badges: %d %s", rec.Code, rec.Body.String())
+			return nil, 0
+		}
+		var response struct {
+			NewBadges     []string `json:"newBadges"`
+			TotalXPEarned int      `json:"totalXPEarned"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Error(err)
+		}
+		return response.NewBadges, response.TotalXPEarned
+	}
+
+	// Concurrent checks pay each badge once between them
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkBadges()
+		}()
+	}
+	wg.Wait()
+
+	var rows []struct {
+		ReferenceID string `db:"referenceId"`
+		Count       int    `db:"n"`
+	}
+	err := app.DB().
+		Select("referenceId", "COUNT(*) AS n").
+		From("xp_transactions").
+		Where(dbx.HashExp{"user": user.Id}).
+		GroupBy("reason", "referenceId").
+		All(&rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) == 0 {
+		t.Fatal("no badge XP credited")
+	}
+	for _, row := range rows {
+		if row.ReferenceID == "" || row.Count != 1 {
+			t.Fatalf("badge %q credited %d times, want once under its badge ID", row.ReferenceID, row.Count)
+		}
+	}
+	paidXP := reload(t, app, user).GetInt("xp")
+	earned := userBadges(reload(t, app, user))
+	if len(earned) != len(rows) {
+		t.Fatalf("badges = %v, want the %d paid for", earned, len(rows))
+	}
+
+	// Badges taken away come back on the next check, without paying again
+	cleared := reload(t, app, user)
+	cleared.Set("badges", []string{})
+	if err := app.Save(cleared); err != nil {
+		t.Fatal(err)
+	}
+	if newBadges, xp := checkBadges(); len(newBadges) != 0 || xp != 0 {
+		t.Fatalf("check after clearing badges: new %v for %d XP, want none", newBadges, xp)
+	}
+	if after := reload(t, app, user); after.GetInt("xp") != paidXP || len(userBadges(after)) != len(earned) {
+		t.Fatalf("xp/badges = %d/%v, want %d/%v", after.GetInt("xp"), userBadges(after), paidXP, earned)
+	}
+}
+
+func TestClientProgressEarnsNoBadges(t *testing.T) {
+	app := newTestApp(t)
+	mux := newTestRouter(t, app, func(se *core.ServeEvent) {
+		RegisterProgressRoutes(app, se)
+	})
+
+	user := newTestUser(t, app, "inflater@example.com", nil)
+	// Answers checked through the stateless validate endpoint don't count
+	question, err := recordToQuestion(newTestQuestion(t, app))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		if err := logQuestionAttempt(app, user.Id, question, AttemptSourcePractice, "", 1, 4000, time.Now().UnixMilli(), true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := `"questionsCompleted":5000,"questionsCorrect":5000,"bestCorrectStreak":500,"fastestTestTime":60,` +
+		`"categoryProgress":{"Road Signs & Signals":{"correct":500,"total":500}},` +
+		`"testHistory":[{"id":"t1","date":"2026-03-01","score":40,"totalQuestions":40,"timeSpent":60,"passed":true}]`
+	for _, req := range []struct{ method, path, body string }{
+		{http.MethodPatch, "/api/progress", "{" + stats + "}"},
+		{http.MethodPost, "/api/progress/sync", `{"forceOverwrite":true,"localProgress":{` + stats + `}}`},
+	} {
+		rec := serveTestRequest(t, mux, user, req.method, req.path, req.body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s: %d %s", req.method, req.path, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := serveTestRequest(t, mux, user, http.MethodPost, "/api/progress/check-badges", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("check-badges: %d %s", rec.Code, rec.Body.String())
+	}
+	credited, err := app.CountRecords("xp_transactions", dbx.HashExp{"user": user.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after := reload(t, app, user); credited != 0 || after.GetInt("xp") != 0 || len(userBadges(after)) != 0 {
+		t.Fatalf("ledger entries/xp/badges = %d/%d/%v, want nothing earned", credited, after.GetInt("xp"), userBadges(after))
+	}
+
+	var progress UserProgressData
+	rec = serveTestRequest(t, mux, user, http.MethodGet, "/api/progress", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &progress); err != nil {
+		t.Fatal(err)
+	}
+	if progress.QuestionsCompleted != 0 || progress.BestCorrectStreak != 0 || progress.FastestTestTime != 0 {
+		t.Fatalf("progress = %+v, want the submitted stats ignored", progress)
+	}
+}
+
+func TestBadgeRuleHooksOutsideServe(t *testing.T) {
+	app := newTestApp(t)
+	RegisterBadgeRuleHooks(app)
+
+	collection, err := app.FindCollectionByNameOrId("badge_definitions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rule, valid := range map[string]bool{
+		"questionsCompleted >= 25":               true,
+		"streak >= 7 && tests.passed >= 1":       true,
+		"questionsCompleted >=":                  false,
+		"unknownStat > 1":                        false,
+		"categories.road_signs.accuracy >= 80.5": true,
+	} {
+		// No server running: an admin command adds a badge
+		badge := core.NewRecord(collection)
+		badge.Set("badgeId", "custom")
+		badge.Set("name", "Custom")
+		badge.Set("tier", "bronze")
+		badge.Set("rule", rule)
+		if err := app.Validate(badge); (err == nil) != valid {
+			t.Errorf("rule %q: validate = %v, want valid %v", rule, err, valid)
+		}
+	}
+}
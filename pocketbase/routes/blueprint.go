@@ -0,0 +1,383 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Question category names
+const (
+	CategoryRoadSigns     = "Road Signs & Signals"
+	CategoryRulesOfRoad   = "Rules of the Road"
+	CategorySafeDriving   = "Safe Driving & Vehicle Handling"
+	CategoryAlcoholDrugs  = "Alcohol/Drugs & Penalties"
+	CategoryLicensing     = "Licensing & Documents"
+	CategoryMiscellaneous = "Miscellaneous"
+)
+
+// DefaultBlueprintSlug is the blueprint used when the client doesn't ask for one
+const DefaultBlueprintSlug = "g1"
+
+var (
+	ErrBlueprintNotFound = errors.New("test blueprint not found")
+	ErrBlueprintInvalid  = errors.New("test blueprint has no valid sections")
+)
+
+// TestSection describes one independently scored section of a test.
+// Empty Categories or Difficulties mean "any".
+type TestSection struct {
+	ID            string   `json:"id"`
+	Name          string   `json:"name"`
+	Categories    []string `json:"categories,omitempty"`
+	Difficulties  []int    `json:"difficulties,omitempty"`
+	QuestionCount int      `json:"questionCount"`
+	PassMark      int      `json:"passMark,omitempty"`    // Minimum correct answers to pass the section (0 = not gated)
+	QuestionIDs   []string `json:"questionIds,omitempty"` // Filled in when a session is created
+}
+
+// TestBlueprint describes how a test is assembled and scored
+type TestBlueprint struct {
+	ID              string        `json:"id"`
+	Slug            string        `json:"slug"`
+	Name            string        `json:"name"`
+	Description     string        `json:"description,omitempty"`
+	TimeLimit       int           `json:"timeLimit"`           // milliseconds
+	PassRatio       float64       `json:"passRatio,omitempty"` // Minimum overall score ratio (0 = not gated)
+	RequiresPremium bool          `json:"requiresPremium"`
+	Sections        []TestSection `json:"sections"`
+}
+
+// TotalQuestions returns the number of questions the blueprint asks for
+func (b TestBlueprint) TotalQuestions() int {
+	total := 0
+	for _, section := range b.Sections {
+		total += section.QuestionCount
+	}
+	return total
+}
+
+// SectionResult represents the score for a single test section
+type SectionResult struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Correct  int    `json:"correct"`
+	Total    int    `json:"total"`
+	PassMark int    `json:"passMark"`
+	Passed   bool   `json:"passed"`
+}
+
+// G1Blueprint mirrors the Ontario G1 knowledge test: 20 road-sign questions and
+// 20 rules-of-the-road questions, with 16/20 required in each section.
+// Used when the test_blueprints collection is missing or has no default.
+var G1Blueprint = TestBlueprint{
+	ID:        DefaultBlueprintSlug,
+	Slug:      DefaultBlueprintSlug,
+	Name:      "G1 Knowledge Test",
+	TimeLimit: MaxTestDuration,
+	Sections: []TestSection{
+		{
+			ID:            "signs",
+			Name:          "Road Signs",
+			Categories:    []string{CategoryRoadSigns},
+			QuestionCount: 20,
+			PassMark:      16,
+		},
+		{
+			ID:   "rules",
+			Name: "Rules of the Road",
+			Categories: []string{
+				CategoryRulesOfRoad,
+				CategorySafeDriving,
+				CategoryAlcoholDrugs,
+				CategoryLicensing,
+				CategoryMiscellaneous,
+			},
+			QuestionCount: 20,
+			PassMark:      16,
+		},
+	},
+}
+
+// RegisterBlueprintRoutes registers test blueprint API routes
+func RegisterBlueprintRoutes(app core.App, se *core.ServeEvent) {
+	// List active test blueprints
+	se.Router.GET("/api/test/blueprints", func(e *core.RequestEvent) error {
+		return handleListBlueprints(app, e)
+	}).Bind(apis.RequireAuth())
+}
+
+func handleListBlueprints(app core.App, e *core.RequestEvent) error {
+	records, err := app.FindRecordsByFilter(
+		"test_blueprints",
+		"isActive = true",
+		"sortOrder,name",
+		0,
+		0,
+		nil,
+	)
+	if err != nil {
+		// Collection might not exist yet, offer the built-in G1 test
+		return e.JSON(http.StatusOK, map[string]interface{}{
+			"blueprints": []TestBlueprint{G1Blueprint},
+		})
+	}
+
+	blueprints := make([]TestBlueprint, 0, len(records))
+	for _, record := range records {
+		blueprint, err := recordToBlueprint(record)
+		if err != nil {
+			continue
+		}
+		blueprints = append(blueprints, blueprint)
+	}
+
+	return e.JSON(http.StatusOK, map[string]interface{}{
+		"blueprints": blueprints,
+	})
+}
+
+// loadBlueprint finds an active blueprint by record ID or slug.
+// An empty idOrSlug loads the default blueprint.
+func loadBlueprint(app core.App, idOrSlug string) (TestBlueprint, error) {
+	var record *core.Record
+	var err error
+
+	if idOrSlug == "" {
+		// The blueprint marked default wins over the one with the default slug
+		records, err := app.FindRecordsByFilter(
+			"test_blueprints",
+			"isActive = true && (isDefault = true || slug = {:slug})",
+			"-isDefault",
+			1,
+			0,
+			map[string]any{"slug": DefaultBlueprintSlug},
+		)
+		if err != nil || len(records) == 0 {
+			return G1Blueprint, nil
+		}
+		record = records[0]
+	} else {
+		record, err = app.FindFirstRecordByFilter(
+			"test_blueprints",
+			"isActive = true && (id = {:key} || slug = {:key})",
+			map[string]any{"key": idOrSlug},
+		)
+		if err != nil {
+			if idOrSlug == DefaultBlueprintSlug {
+				return G1Blueprint, nil
+			}
+			return TestBlueprint{}, ErrBlueprintNotFound
+		}
+	}
+
+	return recordToBlueprint(record)
+}
+
+// recordToBlueprint converts a test_blueprints record to a TestBlueprint
+func recordToBlueprint(record *core.Record) (TestBlueprint, error) {
+	blueprint := TestBlueprint{
+		ID:              record.Id,
+		Slug:            record.GetString("slug"),
+		Name:            record.GetString("name"),
+		Description:     record.GetString("description"),
+		TimeLimit:       record.GetInt("timeLimitMinutes") * 60 * 1000,
+		PassRatio:       record.GetFloat("passRatio"),
+		RequiresPremium: record.GetBool("requiresPremium"),
+	}
+
+	var sections []TestSection
+	if err := json.Unmarshal([]byte(record.GetString("sections")), &sections); err != nil {
+		return blueprint, ErrBlueprintInvalid
+	}
+
+	for _, section := range sections {
+		if section.QuestionCount > 0 {
+			section.QuestionIDs = nil
+			blueprint.Sections = append(blueprint.Sections, section)
+		}
+	}
+	if len(blueprint.Sections) == 0 {
+		return blueprint, ErrBlueprintInvalid
+	}
+
+	if blueprint.TimeLimit <= 0 || blueprint.TimeLimit > MaxTestDuration {
+		blueprint.TimeLimit = MaxTestDuration
+	}
+
+	return blueprint, nil
+}
+
+// categoryBlueprint narrows a blueprint to a single-section test over one category.
+// The section keeps the blueprint's total size and time limit and is scored at 80%.
+func categoryBlueprint(base TestBlueprint, category string) TestBlueprint {
+	return TestBlueprint{
+		ID:              base.ID,
+		Slug:            base.Slug,
+		Name:            category,
+		TimeLimit:       base.TimeLimit,
+		PassRatio:       0.8,
+		RequiresPremium: base.RequiresPremium,
+		Sections: []TestSection{
+			{
+				ID:            "category",
+				Name:          category,
+				Categories:    []string{category},
+				QuestionCount: base.TotalQuestions(),
+			},
+		},
+	}
+}
+
+// drawBlueprintQuestions selects random questions for each section of the blueprint.
+// The returned blueprint is a copy with each section's QuestionIDs filled in.
+func drawBlueprintQuestions(app core.App, blueprint TestBlueprint, includePremium bool) (TestBlueprint, []*core.Record, error) {
+	drawn := blueprint
+	drawn.Sections = make([]TestSection, len(blueprint.Sections))
+
+	seen := make(map[string]bool)
+	selected := []*core.Record{}
+
+	for i, section := range blueprint.Sections {
+		filter := "id != ''"
+		params := map[string]any{}
+		if len(section.Categories) > 0 {
+			filter += " && " + anyOfFilter("category", section.Categories, params)
+		}
+		if len(section.Difficulties) > 0 {
+			filter += " && " + anyOfFilter("difficulty", section.Difficulties, params)
+		}
+		if !includePremium {
+			filter += " && isPremium = false"
+		}
+
+		records, err := app.FindRecordsByFilter("questions", filter, "", 0, 0, params)
+		if err != nil {
+			return drawn, nil, err
+		}
+
+		rand.Shuffle(len(records), func(i, j int) {
+			records[i], records[j] = records[j], records[i]
+		})
+
+		section.QuestionIDs = make([]string, 0, section.QuestionCount)
+		for _, record := range records {
+			if len(section.QuestionIDs) >= section.QuestionCount {
+				break
+			}
+			if seen[record.Id] {
+				continue
+			}
+			seen[record.Id] = true
+			section.QuestionIDs = append(section.QuestionIDs, record.Id)
+			selected = append(selected, record)
+		}
+
+		drawn.Sections[i] = section
+	}
+
+	return drawn, selected, nil
+}
+
+// anyOfFilter builds a "(field = a || field = b ...)" filter expression and adds
+// the placeholder values to params
+func anyOfFilter[T any](field string, values []T, params map[string]any) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		key := fmt.Sprintf("%s%d", field, i)
+		parts[i] = field + " = {:" + key + "}"
+		params[key] = v
+	}
+	return "(" + strings.Join(parts, " || ") + ")"
+}
+
+// sectionSummaries describes the drawn sections for the client
+func sectionSummaries(blueprint TestBlueprint) []TestSectionInfo {
+	summaries := make([]TestSectionInfo, 0, len(blueprint.Sections))
+	for _, section := range blueprint.Sections {
+		summaries = append(summaries, TestSectionInfo{
+			ID:            section.ID,
+			Name:          section.Name,
+			QuestionIDs:   section.QuestionIDs,
+			PassMark:      section.PassMark,
+			QuestionCount: section.QuestionCount,
+		})
+	}
+	return summaries
+}
+
+// scoreBlueprint scores every section of the blueprint independently and applies
+// the overall pass ratio. Unanswered questions count against their section.
+func scoreBlueprint(blueprint TestBlueprint, answers []SessionAnswer) ([]SectionResult, bool) {
+	correctByQuestion := make(map[string]bool, len(answers))
+	for _, a := range answers {
+		correctByQuestion[a.QuestionID] = a.Correct
+	}
+
+	results := make([]SectionResult, 0, len(blueprint.Sections))
+	passed := true
+	score, total := 0, 0
+
+	for _, section := range blueprint.Sections {
+		result := SectionResult{
+			ID:    section.ID,
+			Name:  section.Name,
+			Total: len(section.QuestionIDs),
+		}
+		for _, qid := range section.QuestionIDs {
+			if correctByQuestion[qid] {
+				result.Correct++
+			}
+		}
+
+		// A short section (not enough questions in the bank) must still meet the
+		// same proportion of its pass mark
+		passMark := section.PassMark
+		if section.QuestionCount > 0 && result.Total < section.QuestionCount {
+			passMark = (section.PassMark*result.Total + section.QuestionCount - 1) / section.QuestionCount
+		}
+		result.PassMark = passMark
+		result.Passed = result.Total > 0 && result.Correct >= passMark
+
+		if !result.Passed {
+			passed = false
+		}
+		score += result.Correct
+		total += result.Total
+		results = append(results, result)
+	}
+
+	if blueprint.PassRatio > 0 && (total == 0 || float64(score)/float64(total) < blueprint.PassRatio) {
+		passed = false
+	}
+
+	return results, passed
+}
+
+// sessionBlueprint reads the blueprint stored on a session record
+func sessionBlueprint(session *core.Record) (TestBlueprint, bool) {
+	raw := session.GetString("blueprint")
+	if raw == "" || raw == "null" {
+		return TestBlueprint{}, false
+	}
+
+	var blueprint TestBlueprint
+	if err := json.Unmarshal([]byte(raw), &blueprint); err != nil || len(blueprint.Sections) == 0 {
+		return TestBlueprint{}, false
+	}
+	return blueprint, true
+}
+
+// sessionTimeLimit returns the time limit (ms) that applies to a session
+func sessionTimeLimit(session *core.Record) int {
+	if blueprint, ok := sessionBlueprint(session); ok && blueprint.TimeLimit > 0 {
+		return blueprint.TimeLimit
+	}
+	return MaxTestDuration
+}
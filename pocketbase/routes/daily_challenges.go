@@ -0,0 +1,125 @@
+package routes
+
+import (
+	"errors"
+	"time"
+
+	"driveprep/services"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// creditDailyChallenges credits the XP for today's daily challenges the user
+// has completed and not been paid for yet. It's called after every event
+// that counts towards a challenge; each challenge pays once, referenced by
+// its ID.
+func creditDailyChallenges(app core.App, user *core.Record) error {
+	now := time.Now()
+	loc := userLocation(user)
+	challenges := services.DailyChallengesFor(services.LocalDate(now, loc))
+
+	paid := map[string]bool{}
+	var rows []struct {
+		ReferenceId string `db:"referenceId"`
+	}
+	ids := make([]any, 0, len(challenges))
+	for _, c := range challenges {
+		ids = append(ids, c.ID)
+	}
+	err := app.DB().
+		Select("referenceId").
+		From("xp_transactions").
+		Where(dbx.HashExp{"user": user.Id, "reason": "daily_challenge", "referenceId": ids}).
+		All(&rows)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		paid[row.ReferenceId] = true
+	}
+	if len(paid) == len(challenges) {
+		return nil
+	}
+
+	activity, err := dailyChallengeActivity(app, user.Id, services.LocalDayStart(now, loc))
+	if err != nil {
+		return err
+	}
+
+	for _, c := range challenges {
+		if paid[c.ID] || !c.Completed(activity) {
+			continue
+		}
+		_, err := creditXP(app, user, c.XPReward, "daily_challenge", c.ID, "daily_challenge", "", map[string]interface{}{
+			"type":   c.Type,
+			"target": c.Target,
+		})
+		if err != nil && !errors.Is(err, ErrXPAlreadyAwarded) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dailyChallengeActivity counts what a user has done since the start of
+// their local day. Only answers given in a session count: the stateless
+// validate endpoint can be called for the same question over and over.
+// Flashcards count questions reviewed, however they were answered.
+func dailyChallengeActivity(app core.App, userId string, dayStart time.Time) (services.ChallengeActivity, error) {
+	activity := services.ChallengeActivity{ByCategory: map[string]int{}}
+	since := dayStart.UTC().Format(types.DefaultDateLayout)
+
+	var attempts []struct {
+		Category string `db:"category"`
+		Answers  int    `db:"answers"`
+		Correct  int    `db:"correct"`
+	}
+	err := app.DB().
+		NewQuery(`
+			SELECT category, COUNT(*) AS answers, COALESCE(SUM(correct), 0) AS correct
+			FROM question_attempts
+			WHERE user = {:userId} AND sessionId != '' AND created >= {:since}
+			GROUP BY category`).
+		Bind(dbx.Params{"userId": userId, "since": since}).
+		All(&attempts)
+	if err != nil {
+		return activity, err
+	}
+	for _, a := range attempts {
+		activity.Questions += a.Answers
+		activity.Correct += a.Correct
+		activity.ByCategory[a.Category] += a.Answers
+	}
+
+	tests, err := app.CountRecords("question_sessions", dbx.NewExp(
+		"user = {:userId} AND status = 'completed' AND completedAt >= {:since}",
+		dbx.Params{"userId": userId, "since": since},
+	))
+	if err != nil {
+		return activity, err
+	}
+	activity.Tests = int(tests)
+
+	flashcards, err := app.CountRecords("question_reviews", dbx.NewExp(
+		"user = {:userId} AND lastReviewedAt >= {:since}",
+		dbx.Params{"userId": userId, "since": since},
+	))
+	if err != nil {
+		return activity, err
+	}
+	activity.Flashcards = int(flashcards)
+
+	logins, err := app.CountRecords("xp_transactions", dbx.NewExp(
+		"user = {:userId} AND reason = 'daily_login' AND created >= {:since}",
+		dbx.Params{"userId": userId, "since": since},
+	))
+	if err != nil {
+		return activity, err
+	}
+	activity.LoggedIn = logins > 0
+
+	return activity, nil
+}
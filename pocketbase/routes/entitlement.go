@@ -0,0 +1,743 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Every grant of premium is a row in entitlements with its source, plan,
+// start and end. Rows for Stripe subscriptions and lifetime purchases,
+// redeemed licenses and organization seats are derived from those records
+// by syncEntitlements; staff add admin and promo grants directly. A user's
+// access is the longest-lasting active grant: gates call userHasPremium,
+// never users.isPremium. isPremium, premiumPlan and premiumExpiresAt are
+// kept in step by syncPremium for display, and an hourly job downgrades
+// users whose grants have run out.
+
+// Entitlement sources
+const (
+	EntitlementStripe  = "stripe"
+	EntitlementLicense = "license"
+	EntitlementPromo   = "promo"
+	EntitlementAdmin   = "admin"
+)
+
+// Reasons a user lost premium
+const (
+	DowngradeSubscriptionEnded = "subscription_ended"
+	DowngradeLicenseExpired    = "license_expired"
+	DowngradeLicenseRevoked    = "license_revoked"
+	DowngradeSeatEnded         = "seat_ended"
+	DowngradeGrantEnded        = "grant_ended"
+	DowngradeGrantRevoked      = "grant_revoked"
+	DowngradeNoGrant           = "no_grant"
+)
+
+const premiumExpirySchedule = "15 * * * *"
+
+// premiumUserFields are the users fields only the server writes: the
+// lifetime purchase and Stripe IDs that grants are derived from, and the
+// premium state syncPremium keeps in step with them
+var premiumUserFields = []string{"lifetimePurchasedAt", "isPremium", "premiumPlan", "premiumExpiresAt", "stripeCustomerId", "stripeSubscriptionId"}
+
+// Entitlement is a user's premium access and the grant it rests on
+type Entitlement struct {
+	Premium   bool
+	Plan      string // free when not premium
+	Source    string
+	GrantID   string    // entitlements record ID
+	ExpiresAt time.Time // Zero when it doesn't expire
+}
+
+// EntitlementGrant is an entitlements record as shown to users and staff
+type EntitlementGrant struct {
+	ID           string `json:"id"`
+	Source       string `json:"source"`
+	Plan         string `json:"plan"`
+	StartsAt     string `json:"startsAt,omitempty"`
+	EndsAt       string `json:"endsAt,omitempty"`
+	RevokedAt    string `json:"revokedAt,omitempty"`
+	Active       bool   `json:"active"`
+	Subscription string `json:"subscription,omitempty"`
+	License      string `json:"license,omitempty"`
+	Organization string `json:"organization,omitempty"`
+	Note         string `json:"note,omitempty"`
+}
+
+// endedGrant is a grant that used to give a user premium
+type endedGrant struct {
+	reason  string
+	detail  string
+	endedAt time.Time
+}
+
+// RegisterEntitlementHooks keeps purchases and premium state out of
+// self-service user creates and updates through the records API
+func RegisterEntitlementHooks(app core.App) {
+	guardUserFields(app, premiumUserFields, "Premium access can only be changed by the server")
+}
+
+// RegisterEntitlementRoutes registers the expiry job and the routes that
+// show and manage premium grants
+func RegisterEntitlementRoutes(app core.App, se *core.ServeEvent) {
+	app.Cron().MustAdd("premiumExpiry", premiumExpirySchedule, func() {
+		enforcePremiumExpiry(app)
+	})
+
+	// The current user's premium access and every grant behind it
+	se.Router.GET("/api/me/entitlements", func(e *core.RequestEvent) error {
+		return entitlementsResponse(app, e, e.Auth)
+	}).Bind(RequireAuth(app))
+
+	// Staff: A user's premium access and grants
+	se.Router.GET("/api/admin/users/{id}/entitlements", func(e *core.RequestEvent) error {
+		user, err := app.FindRecordById("users", e.Request.PathValue("id"))
+		if err != nil {
+			return e.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		}
+		return entitlementsResponse(app, e, user)
+	}).Bind(RequireAuth(app), RequirePermission(app, PermissionBilling, PermissionSupport))
+
+	// Staff: Grant a user premium
+	// Body: { source: "admin"|"promo", plan, startsAt?, endsAt?, note? }
+	se.Router.POST("/api/admin/users/{id}/entitlements", func(e *core.RequestEvent) error {
+		user, err := app.FindRecordById("users", e.Request.PathValue("id"))
+		if err != nil {
+			return e.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		}
+
+		var req struct {
+			Source   string `json:"source"`
+			Plan     string `json:"plan"`
+			StartsAt string `json:"startsAt"`
+			EndsAt   string `json:"endsAt"`
+			Note     string `json:"note"`
+		}
+		if err := e.BindBody(&req); err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+		if req.Source == "" {
+			req.Source = EntitlementAdmin
+		}
+		if req.Source != EntitlementAdmin && req.Source != EntitlementPromo {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Source must be admin or promo"})
+		}
+		validPlans := map[string]bool{PlanMonthly: true, PlanYearly: true, PlanLifetime: true}
+		if !validPlans[req.Plan] {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid plan"})
+		}
+
+		startsAt := time.Now().UTC()
+		if req.StartsAt != "" {
+			startsAt, err = time.Parse(time.RFC3339, req.StartsAt)
+			if err != nil {
+				return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid start date format"})
+			}
+		}
+		var endsAt time.Time
+		if req.EndsAt != "" {
+			endsAt, err = time.Parse(time.RFC3339, req.EndsAt)
+			if err != nil {
+				return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid end date format"})
+			}
+			if !endsAt.After(startsAt) {
+				return e.JSON(http.StatusBadRequest, map[string]string{"error": "End date must be after the start date"})
+			}
+		} else if req.Plan != PlanLifetime {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "End date required unless the plan is lifetime"})
+		}
+
+		collection, err := app.FindCollectionByNameOrId("entitlements")
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to grant premium"})
+		}
+
+		record := core.NewRecord(collection)
+		err = app.RunInTransaction(func(txApp core.App) error {
+			record.Set("user", user.Id)
+			record.Set("source", req.Source)
+			record.Set("plan", req.Plan)
+			record.Set("startsAt", startsAt)
+			if !endsAt.IsZero() {
+				record.Set("endsAt", endsAt)
+			}
+			record.Set("grantedBy", actingUserID(e))
+			record.Set("note", req.Note)
+			if err := txApp.Save(record); err != nil {
+				return err
+			}
+			_, err := syncPremium(txApp, user)
+			return err
+		})
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to grant premium"})
+		}
+
+		app.Logger().Info("Premium granted",
+			"userId", user.Id,
+			"entitlementId", record.Id,
+			"source", req.Source,
+			"plan", req.Plan,
+			"by", actingUserID(e),
+		)
+
+		return e.JSON(http.StatusOK, newEntitlementGrant(record, time.Now()))
+	}).Bind(RequireAuth(app), RequirePermission(app, PermissionBilling))
+
+	// Staff: Revoke a grant made by staff. Grants derived from
+	// subscriptions, licenses and seats end with them.
+	se.Router.DELETE("/api/admin/entitlements/{id}", func(e *core.RequestEvent) error {
+		record, err := app.FindRecordById("entitlements", e.Request.PathValue("id"))
+		if err != nil {
+			return e.JSON(http.StatusNotFound, map[string]string{"error": "Entitlement not found"})
+		}
+		if entitlementKey(record) != "" {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "This grant follows a subscription, license or seat; cancel or revoke that instead"})
+		}
+		if !record.GetDateTime("revokedAt").IsZero() {
+			return e.JSON(http.StatusOK, newEntitlementGrant(record, time.Now()))
+		}
+
+		user, err := app.FindRecordById("users", record.GetString("user"))
+		if err != nil {
+			return e.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		}
+
+		err = app.RunInTransaction(func(txApp core.App) error {
+			record.Set("revokedAt", types.NowDateTime())
+			if err := txApp.Save(record); err != nil {
+				return err
+			}
+			_, err := syncPremium(txApp, user)
+			return err
+		})
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to revoke grant"})
+		}
+
+		app.Logger().Info("Premium grant revoked",
+			"userId", user.Id,
+			"entitlementId", record.Id,
+			"by", actingUserID(e),
+		)
+
+		return e.JSON(http.StatusOK, newEntitlementGrant(record, time.Now()))
+	}).Bind(RequireAuth(app), RequirePermission(app, PermissionBilling))
+}
+
+// entitlementsResponse refreshes a user's grants and writes their access
+// and every grant, newest first
+func entitlementsResponse(app core.App, e *core.RequestEvent, user *core.Record) error {
+	if _, err := syncPremium(app, user); err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load entitlements"})
+	}
+
+	entitlement, err := ResolveEntitlement(app, user)
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load entitlements"})
+	}
+
+	records, err := app.FindRecordsByFilter("entitlements", "user = {:userId}", "-startsAt", 0, 0, dbx.Params{"userId": user.Id})
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load entitlements"})
+	}
+
+	now := time.Now()
+	grants := make([]EntitlementGrant, len(records))
+	for i, record := range records {
+		grants[i] = newEntitlementGrant(record, now)
+	}
+
+	expiresAt := ""
+	if !entitlement.ExpiresAt.IsZero() {
+		expiresAt = entitlement.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+
+	return e.JSON(http.StatusOK, map[string]interface{}{
+		"premium":   entitlement.Premium,
+		"plan":      entitlement.Plan,
+		"source":    entitlement.Source,
+		"grantId":   entitlement.GrantID,
+		"expiresAt": expiresAt,
+		"grants":    grants,
+	})
+}
+
+// ResolveEntitlement works out a user's premium access from their active
+// grants. When several are active the one that lasts longest wins.
+func ResolveEntitlement(app core.App, user *core.Record) (Entitlement, error) {
+	entitlement, _, err := resolveEntitlement(app, user)
+	return entitlement, err
+}
+
+// resolveEntitlement is ResolveEntitlement, also returning the grant that
+// ended most recently, if any
+func resolveEntitlement(app core.App, user *core.Record) (Entitlement, *endedGrant, error) {
+	best := Entitlement{Plan: "free"}
+	var lastEnded *endedGrant
+
+	records, err := app.FindRecordsByFilter("entitlements", "user = {:userId}", "", 0, 0, dbx.Params{"userId": user.Id})
+	if err != nil {
+		return best, nil, err
+	}
+
+	now := time.Now()
+	for _, record := range records {
+		if endedAt, ended := entitlementEnded(record, now); ended {
+			if lastEnded == nil || endedAt.After(lastEnded.endedAt) {
+				lastEnded = &endedGrant{reason: downgradeReason(record), detail: grantSourceID(record), endedAt: endedAt}
+			}
+			continue
+		}
+		if !entitlementActive(record, now) {
+			continue // Not started yet
+		}
+
+		candidate := Entitlement{
+			Premium:   true,
+			Plan:      record.GetString("plan"),
+			Source:    record.GetString("source"),
+			GrantID:   record.Id,
+			ExpiresAt: record.GetDateTime("endsAt").Time(),
+		}
+		if !best.Premium || outlastsEntitlement(candidate, best) {
+			best = candidate
+		}
+	}
+
+	return best, lastEnded, nil
+}
+
+// entitlementActive reports whether a grant gives premium at the given time
+func entitlementActive(record *core.Record, at time.Time) bool {
+	if _, ended := entitlementEnded(record, at); ended {
+		return false
+	}
+	startsAt := record.GetDateTime("startsAt")
+	return startsAt.IsZero() || !startsAt.Time().After(at)
+}
+
+// entitlementEnded reports whether a grant was revoked or ran out by the
+// given time, and when
+func entitlementEnded(record *core.Record, at time.Time) (time.Time, bool) {
+	if revokedAt := record.GetDateTime("revokedAt"); !revokedAt.IsZero() {
+		return revokedAt.Time(), true
+	}
+	if endsAt := record.GetDateTime("endsAt"); !endsAt.IsZero() && !endsAt.Time().After(at) {
+		return endsAt.Time(), true
+	}
+	return time.Time{}, false
+}
+
+// downgradeReason is why losing a grant cost a user premium
+func downgradeReason(record *core.Record) string {
+	revoked := !record.GetDateTime("revokedAt").IsZero()
+	switch {
+	case record.GetString("organization") != "":
+		return DowngradeSeatEnded
+	case record.GetString("source") == EntitlementStripe:
+		return DowngradeSubscriptionEnded
+	case record.GetString("license") != "" && revoked:
+		return DowngradeLicenseRevoked
+	case record.GetString("license") != "":
+		return DowngradeLicenseExpired
+	case revoked:
+		return DowngradeGrantRevoked
+	}
+	return DowngradeGrantEnded
+}
+
+// grantSourceID is the ID of what a grant comes from: its subscription,
+// license or organization, or the grant itself when staff made it
+func grantSourceID(record *core.Record) string {
+	for _, field := range []string{"subscription", "license", "organization"} {
+		if id := record.GetString(field); id != "" {
+			return id
+		}
+	}
+	return record.Id
+}
+
+// userHasPremium reports whether a user currently has premium access. A
+// failed lookup counts as no access.
+func userHasPremium(app core.App, user *core.Record) bool {
+	entitlement, err := ResolveEntitlement(app, user)
+	if err != nil {
+		app.Logger().Error("Failed to resolve entitlement", "userId", user.Id, "error", err)
+		return false
+	}
+	return entitlement.Premium
+}
+
+// outlastsEntitlement reports whether entitlement a lasts longer than b
+func outlastsEntitlement(a, b Entitlement) bool {
+	if b.ExpiresAt.IsZero() {
+		return false
+	}
+	return a.ExpiresAt.IsZero() || a.ExpiresAt.After(b.ExpiresAt)
+}
+
+// entitlementKey identifies the record a derived grant follows; it's empty
+// for grants made by staff
+func entitlementKey(record *core.Record) string {
+	switch {
+	case record.GetString("organization") != "":
+		return "organization:" + record.GetString("organization")
+	case record.GetString("subscription") != "":
+		return "subscription:" + record.GetString("subscription")
+	case record.GetString("license") != "":
+		return "license:" + record.GetString("license")
+	case record.GetString("source") == EntitlementStripe:
+		return "purchase"
+	}
+	return ""
+}
+
+// derivedGrant is the grant a subscription, purchase, license or seat
+// should have, as entitlements field values
+type derivedGrant struct {
+	key    string
+	fields map[string]string
+}
+
+// deriveGrants lists the grants a user's subscriptions, lifetime purchase,
+// licenses and organization seats give them
+func deriveGrants(app core.App, user *core.Record) ([]derivedGrant, error) {
+	var grants []derivedGrant
+	date := func(t time.Time) string {
+		dt, _ := types.ParseDateTime(t)
+		return dt.String()
+	}
+
+	subscriptions, err := app.FindRecordsByFilter("subscriptions", "user = {:userId} && plan != ''", "", 0, 0, dbx.Params{"userId": user.Id})
+	if err != nil {
+		return nil, err
+	}
+	for _, sub := range subscriptions {
+		endsAt := sub.GetDateTime("currentPeriodEnd").Time()
+		if sub.GetString("status") == "expired" {
+			// Ended when Stripe said so, if before the period ran out
+			endedAt := sub.GetDateTime("lastEventAt")
+			if endedAt.IsZero() {
+				endedAt = sub.GetDateTime("updated")
+			}
+			if endsAt.IsZero() || endedAt.Time().Before(endsAt) {
+				endsAt = endedAt.Time()
+			}
+		}
+		grants = append(grants, derivedGrant{
+			key: "subscription:" + sub.Id,
+			fields: map[string]string{
+				"source":       EntitlementStripe,
+				"plan":         sub.GetString("plan"),
+				"startsAt":     sub.GetDateTime("created").String(),
+				"endsAt":       date(endsAt),
+				"revokedAt":    "",
+				"subscription": sub.Id,
+			},
+		})
+	}
+
+	if purchasedAt := user.GetDateTime("lifetimePurchasedAt"); !purchasedAt.IsZero() {
+		grants = append(grants, derivedGrant{
+			key: "purchase",
+			fields: map[string]string{
+				"source":    EntitlementStripe,
+				"plan":      PlanLifetime,
+				"startsAt":  purchasedAt.String(),
+				"endsAt":    "",
+				"revokedAt": "",
+			},
+		})
+	}
+
+	licenses, err := app.FindRecordsByFilter(
+		"licenses",
+		"user = {:userId} && organization = '' && (isActive = true || isRevoked = true)",
+		"",
+		0,
+		0,
+		dbx.Params{"userId": user.Id},
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, license := range licenses {
+		source := EntitlementLicense
+		if license.GetString("type") == LicenseTypePromo {
+			source = EntitlementPromo
+		}
+		startsAt := license.GetDateTime("redeemedAt")
+		if startsAt.IsZero() {
+			startsAt = license.GetDateTime("created")
+		}
+		revokedAt := ""
+		if license.GetBool("isRevoked") {
+			revokedAt = license.GetDateTime("updated").String()
+		}
+		grants = append(grants, derivedGrant{
+			key: "license:" + license.Id,
+			fields: map[string]string{
+				"source":    source,
+				"plan":      licensePlan(license),
+				"startsAt":  startsAt.String(),
+				"endsAt":    date(licenseExpiry(license)),
+				"revokedAt": revokedAt,
+				"license":   license.Id,
+			},
+		})
+	}
+
+	memberships, err := app.FindRecordsByFilter(
+		"org_members",
+		"user = {:userId} && role = {:role}",
+		"",
+		0,
+		0,
+		dbx.Params{"userId": user.Id, "role": OrgRoleStudent},
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, membership := range memberships {
+		orgID := membership.GetString("organization")
+		seats, license, err := orgSeats(app, orgID)
+		if err != nil {
+			return nil, err
+		}
+		if seats == 0 || license == nil {
+			continue
+		}
+		grants = append(grants, derivedGrant{
+			key: "organization:" + orgID,
+			fields: map[string]string{
+				"source":       EntitlementLicense,
+				"plan":         licensePlan(license),
+				"startsAt":     membership.GetDateTime("created").String(),
+				"endsAt":       license.GetDateTime("expiresAt").String(),
+				"revokedAt":    "",
+				"license":      license.Id,
+				"organization": orgID,
+			},
+		})
+	}
+
+	return grants, nil
+}
+
+// syncEntitlements brings a user's derived grants in line with their
+// subscriptions, purchase, licenses and seats. Grants whose record is gone
+// are revoked; grants made by staff are left alone.
+func syncEntitlements(app core.App, user *core.Record) error {
+	grants, err := deriveGrants(app, user)
+	if err != nil {
+		return err
+	}
+
+	existing, err := app.FindRecordsByFilter("entitlements", "user = {:userId}", "created", 0, 0, dbx.Params{"userId": user.Id})
+	if err != nil {
+		return err
+	}
+	byKey := map[string]*core.Record{}
+	for _, record := range existing {
+		if key := entitlementKey(record); key != "" {
+			byKey[key] = record
+		}
+	}
+
+	collection, err := app.FindCollectionByNameOrId("entitlements")
+	if err != nil {
+		return err
+	}
+
+	for _, grant := range grants {
+		record, ok := byKey[grant.key]
+		delete(byKey, grant.key)
+		if !ok {
+			record = core.NewRecord(collection)
+			record.Set("user", user.Id)
+		}
+
+		changed := !ok
+		for field, value := range grant.fields {
+			// Keep the original revocation time
+			if field == "revokedAt" && value != "" && record.GetString(field) != "" {
+				continue
+			}
+			if record.GetString(field) != value {
+				record.Set(field, value)
+				changed = true
+			}
+		}
+		if changed {
+			if err := app.Save(record); err != nil {
+				return err
+			}
+		}
+	}
+
+	// What's left follows a record that no longer grants anything, e.g. a
+	// seat in an organization the user left
+	now := time.Now()
+	for _, record := range byKey {
+		if _, ended := entitlementEnded(record, now); ended {
+			continue
+		}
+		record.Set("revokedAt", types.NowDateTime())
+		if err := app.Save(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// licenseExpiry is when a redeemed license stops granting premium, or zero
+// if it never does. Keys without an expiry date run for one plan period from
+// redemption.
+func licenseExpiry(license *core.Record) time.Time {
+	if license.GetString("type") == LicenseTypeLifetime || license.GetString("plan") == PlanLifetime {
+		return time.Time{}
+	}
+	if expiresAt := license.GetDateTime("expiresAt"); !expiresAt.IsZero() {
+		return expiresAt.Time()
+	}
+
+	start := license.GetDateTime("redeemedAt")
+	if start.IsZero() {
+		start = license.GetDateTime("created")
+	}
+	if license.GetString("plan") == PlanYearly {
+		return start.Time().AddDate(1, 0, 0)
+	}
+	return start.Time().AddDate(0, 1, 0)
+}
+
+// licensePlan is the premium plan a license grants
+func licensePlan(license *core.Record) string {
+	if license.GetString("type") == LicenseTypeLifetime {
+		return PlanLifetime
+	}
+	return license.GetString("plan")
+}
+
+// syncPremium refreshes a user's derived grants and brings isPremium,
+// premiumPlan and premiumExpiresAt in line with their entitlement. A user
+// who loses premium gets a premium_downgrades row saying why. It reports
+// whether the user changed.
+func syncPremium(app core.App, user *core.Record) (bool, error) {
+	changed := false
+	err := app.RunInTransaction(func(txApp core.App) error {
+		if err := syncEntitlements(txApp, user); err != nil {
+			return err
+		}
+
+		entitlement, lastEnded, err := resolveEntitlement(txApp, user)
+		if err != nil {
+			return err
+		}
+
+		wasPremium := user.GetBool("isPremium")
+		previousPlan := user.GetString("premiumPlan")
+		if previousPlan == "" {
+			previousPlan = "free"
+		}
+		previousExpiry := user.GetDateTime("premiumExpiresAt")
+		if wasPremium == entitlement.Premium &&
+			previousPlan == entitlement.Plan &&
+			sameInstant(previousExpiry, entitlement.ExpiresAt) {
+			return nil
+		}
+
+		var expiresAt any
+		if !entitlement.ExpiresAt.IsZero() {
+			expiresAt = entitlement.ExpiresAt
+		}
+		user.Set("isPremium", entitlement.Premium)
+		user.Set("premiumPlan", entitlement.Plan)
+		user.Set("premiumExpiresAt", expiresAt)
+		if err := txApp.Save(user); err != nil {
+			return err
+		}
+		changed = true
+
+		if !wasPremium || entitlement.Premium {
+			return nil
+		}
+		return recordPremiumDowngrade(txApp, user.Id, previousPlan, previousExpiry, lastEnded)
+	})
+	return changed, err
+}
+
+// recordPremiumDowngrade saves why a user lost premium
+func recordPremiumDowngrade(app core.App, userID, plan string, expiresAt types.DateTime, lastEnded *endedGrant) error {
+	collection, err := app.FindCollectionByNameOrId("premium_downgrades")
+	if err != nil {
+		return err
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("user", userID)
+	record.Set("plan", plan)
+	record.Set("expiresAt", expiresAt)
+	if lastEnded != nil {
+		record.Set("reason", lastEnded.reason)
+		record.Set("detail", lastEnded.detail)
+	} else {
+		record.Set("reason", DowngradeNoGrant)
+	}
+	return app.Save(record)
+}
+
+// enforcePremiumExpiry syncs every user flagged premium, and everyone with
+// a grant that started since the last run, with their entitlement
+func enforcePremiumExpiry(app core.App) {
+	users, err := app.FindRecordsByFilter(
+		"users",
+		"isPremium = true || entitlements_via_user.startsAt > {:since}",
+		"",
+		0,
+		0,
+		dbx.Params{"since": types.NowDateTime().Add(-2 * time.Hour).String()},
+	)
+	if err != nil {
+		app.Logger().Error("Failed to fetch premium users", "error", err)
+		return
+	}
+
+	downgraded := 0
+	for _, user := range users {
+		wasPremium := user.GetBool("isPremium")
+		if _, err := syncPremium(app, user); err != nil {
+			app.Logger().Error("Failed to sync premium", "userId", user.Id, "error", err)
+			continue
+		}
+		if wasPremium && !user.GetBool("isPremium") {
+			downgraded++
+		}
+	}
+
+	if downgraded > 0 {
+		app.Logger().Info("Expired premium users downgraded", "count", downgraded)
+	}
+}
+
+func newEntitlementGrant(record *core.Record, now time.Time) EntitlementGrant {
+	return EntitlementGrant{
+		ID:           record.Id,
+		Source:       record.GetString("source"),
+		Plan:         record.GetString("plan"),
+		StartsAt:     formatAPIDate(record.GetDateTime("startsAt")),
+		EndsAt:       formatAPIDate(record.GetDateTime("endsAt")),
+		RevokedAt:    formatAPIDate(record.GetDateTime("revokedAt")),
+		Active:       entitlementActive(record, now),
+		Subscription: record.GetString("subscription"),
+		License:      record.GetString("license"),
+		Organization: record.GetString("organization"),
+		Note:         record.GetString("note"),
+	}
+}
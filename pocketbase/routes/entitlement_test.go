@@ -0,0 +1,329 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// newTestGrant saves a staff-made grant; zero times are left empty
+func newTestGrant(tb testing.TB, app core.App, user *core.Record, source, plan string, startsAt, endsAt, revokedAt time.Time) *core.Record {
+	tb.Helper()
+
+	fields := map[string]any{"user": user.Id, "source": source, "plan": plan}
+	for field, value := range map[string]time.Time{"startsAt": startsAt, "endsAt": endsAt, "revokedAt": revokedAt} {
+		if !value.IsZero() {
+			fields[field] = value
+		}
+	}
+	return newTestRecord(tb, app, "entitlements", fields)
+}
+
+func TestResolveEntitlement(t *testing.T) {
+	app := newTestApp(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	past, soon, later := now.AddDate(0, -1, 0), now.AddDate(0, 0, 10), now.AddDate(0, 2, 0)
+
+	type grant struct {
+		source, plan                string
+		startsAt, endsAt, revokedAt time.Time
+	}
+	cases := []struct {
+		name      string
+		grants    []grant
+		want      Entitlement
+		wantEnded string
+	}{
+		{"no grants", nil, Entitlement{Plan: "free"}, ""},
+		{
+			"one grant",
+			[]grant{{EntitlementPromo, PlanMonthly, past, soon, time.Time{}}},
+			Entitlement{Premium: true, Plan: PlanMonthly, Source: EntitlementPromo, ExpiresAt: soon},
+			"",
+		},
+		{
+			"longest-lasting grant wins",
+			[]grant{
+				{EntitlementPromo, PlanMonthly, past, soon, time.Time{}},
+				{EntitlementAdmin, PlanYearly, past, later, time.Time{}},
+			},
+			Entitlement{Premium: true, Plan: PlanYearly, Source: EntitlementAdmin, ExpiresAt: later},
+			"",
+		},
+		{
+			"grant without an end outlasts all",
+			[]grant{
+				{EntitlementAdmin, PlanYearly, past, later, time.Time{}},
+				{EntitlementAdmin, PlanLifetime, past, time.Time{}, time.Time{}},
+			},
+			Entitlement{Premium: true, Plan: PlanLifetime, Source: EntitlementAdmin},
+			"",
+		},
+		{
+			"ended grant",
+			[]grant{{EntitlementAdmin, PlanMonthly, past, now.Add(-time.Hour), time.Time{}}},
+			Entitlement{Plan: "free"},
+			DowngradeGrantEnded,
+		},
+		{
+			"revoked grant",
+			[]grant{{EntitlementAdmin, PlanLifetime, past, time.Time{}, now.Add(-time.Hour)}},
+			Entitlement{Plan: "free"},
+			DowngradeGrantRevoked,
+		},
+		{
+			"grant not started yet",
+			[]grant{{EntitlementPromo, PlanMonthly, soon, later, time.Time{}}},
+			Entitlement{Plan: "free"},
+			"",
+		},
+		{
+			"active grant after an ended one",
+			[]grant{
+				{EntitlementAdmin, PlanYearly, past, now.Add(-time.Hour), time.Time{}},
+				{EntitlementPromo, PlanMonthly, past, soon, time.Time{}},
+			},
+			Entitlement{Premium: true, Plan: PlanMonthly, Source: EntitlementPromo, ExpiresAt: soon},
+			DowngradeGrantEnded,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			user := newTestUser(t, app, fmt.Sprintf("resolve%d@example.com", i), nil)
+			for _, g := range c.grants {
+				newTestGrant(t, app, user, g.source, g.plan, g.startsAt, g.endsAt, g.revokedAt)
+			}
+
+			got, ended, err := resolveEntitlement(app, user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Premium != c.want.Premium || got.Plan != c.want.Plan || got.Source != c.want.Source || !got.ExpiresAt.Equal(c.want.ExpiresAt) {
+				t.Fatalf("entitlement = %+v, want %+v", got, c.want)
+			}
+			gotEnded := ""
+			if ended != nil {
+				gotEnded = ended.reason
+			}
+			if gotEnded != c.wantEnded {
+				t.Fatalf("last ended grant = %q, want %q", gotEnded, c.wantEnded)
+			}
+		})
+	}
+}
+
+func TestSyncPremium(t *testing.T) {
+	app := newTestApp(t)
+	user := newTestUser(t, app, "sync@example.com", nil)
+
+	expiresAt := time.Now().AddDate(0, 6, 0).UTC().Truncate(time.Second)
+	license := newTestRecord(t, app, "licenses", map[string]any{
+		"key":            "SYNC-LICENSE",
+		"type":           "gift",
+		"plan":           PlanYearly,
+		"maxActivations": 1,
+		"expiresAt":      expiresAt,
+		"user":           user.Id,
+		"isActive":       true,
+		"redeemedAt":     time.Now().Add(-time.Minute),
+	})
+
+	// Redeeming derives a grant and makes the user premium
+	changed, err := syncPremium(app, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || !user.GetBool("isPremium") || user.GetString("premiumPlan") != PlanYearly || !sameInstant(user.GetDateTime("premiumExpiresAt"), expiresAt) {
+		t.Fatalf("changed=%v isPremium=%v premiumPlan=%q premiumExpiresAt=%s, want a yearly plan to %s",
+			changed, user.GetBool("isPremium"), user.GetString("premiumPlan"), user.GetDateTime("premiumExpiresAt"), expiresAt)
+	}
+
+	// Nothing to do the second time
+	if changed, err := syncPremium(app, user); err != nil || changed {
+		t.Fatalf("second sync changed=%v err=%v, want no change", changed, err)
+	}
+
+	// Revoking the license revokes its grant and records why premium ended
+	license.Set("isRevoked", true)
+	license.Set("isActive", false)
+	if err := app.Save(license); err != nil {
+		t.Fatal(err)
+	}
+	changed, err = syncPremium(app, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || user.GetBool("isPremium") || user.GetString("premiumPlan") != "free" {
+		t.Fatalf("changed=%v isPremium=%v premiumPlan=%q, want free", changed, user.GetBool("isPremium"), user.GetString("premiumPlan"))
+	}
+
+	downgrade, err := app.FindFirstRecordByData("premium_downgrades", "user", user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason, detail := downgrade.GetString("reason"), downgrade.GetString("detail"); reason != DowngradeLicenseRevoked || detail != license.Id {
+		t.Fatalf("downgrade reason/detail = %q/%q, want %q/%q", reason, detail, DowngradeLicenseRevoked, license.Id)
+	}
+}
+
+func TestEnforcePremiumExpiry(t *testing.T) {
+	app := newTestApp(t)
+	now := time.Now().UTC()
+
+	// Premium set by hand before entitlements existed, backfilled by the
+	// entitlements migration
+	var comped, compedNoTerms *core.Record
+	rerunMigration(t, app, "1767065087_", func() {
+		comped = newTestUser(t, app, "comped@example.com", map[string]any{
+			"isPremium":        true,
+			"premiumPlan":      PlanYearly,
+			"premiumExpiresAt": now.AddDate(0, 3, 0),
+		})
+		compedNoTerms = newTestUser(t, app, "noterms@example.com", map[string]any{"isPremium": true})
+	})
+
+	expired := newTestUser(t, app, "expired@example.com", map[string]any{"isPremium": true, "premiumPlan": PlanMonthly})
+	newTestGrant(t, app, expired, EntitlementPromo, PlanMonthly, now.AddDate(0, -1, 0), now.Add(-time.Hour), time.Time{})
+
+	granted := newTestUser(t, app, "granted@example.com", nil)
+	newTestGrant(t, app, granted, EntitlementAdmin, PlanLifetime, now.Add(-time.Minute), time.Time{}, time.Time{})
+
+	free := newTestUser(t, app, "free@example.com", nil)
+
+	enforcePremiumExpiry(app)
+
+	cases := []struct {
+		name    string
+		user    *core.Record
+		premium bool
+		plan    string
+	}{
+		{"comped with an expiry", comped, true, PlanYearly},
+		{"comped without terms", compedNoTerms, true, PlanMonthly},
+		{"grant ran out", expired, false, "free"},
+		{"grant started since the last run", granted, true, PlanLifetime},
+		{"never premium", free, false, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			user := reload(t, app, c.user)
+			if user.GetBool("isPremium") != c.premium || user.GetString("premiumPlan") != c.plan {
+				t.Fatalf("isPremium/premiumPlan = %v/%q, want %v/%q", user.GetBool("isPremium"), user.GetString("premiumPlan"), c.premium, c.plan)
+			}
+		})
+	}
+
+	downgrades, err := app.FindAllRecords("premium_downgrades")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(downgrades) != 1 || downgrades[0].GetString("user") != expired.Id || downgrades[0].GetString("reason") != DowngradeGrantEnded {
+		t.Fatalf("downgrades = %d, want one grant_ended for the expired user", len(downgrades))
+	}
+}
+
+func TestBackfillEntitlements(t *testing.T) {
+	app := newTestApp(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	expiresAt := now.AddDate(0, 2, 0)
+
+	users := map[string]*core.Record{}
+	rerunMigration(t, app, "1767065087_", func() {
+		for name, fields := range map[string]map[string]any{
+			"lifetime":          {"premiumPlan": PlanLifetime},
+			"yearly with end":   {"premiumPlan": PlanYearly, "premiumExpiresAt": expiresAt},
+			"monthly no end":    {"premiumPlan": PlanMonthly},
+			"yearly no end":     {"premiumPlan": PlanYearly},
+			"no plan with end":  {"premiumExpiresAt": expiresAt},
+			"no plan or expiry": {},
+		} {
+			fields["isPremium"] = true
+			users[name] = newTestUser(t, app, strings.ReplaceAll(name, " ", "-")+"@example.com", fields)
+		}
+	})
+
+	cases := []struct {
+		name     string
+		plan     string
+		endsAt   time.Time
+		reviewed bool
+	}{
+		{"lifetime", PlanLifetime, time.Time{}, false},
+		{"yearly with end", PlanYearly, expiresAt, false},
+		// A subscription plan never gets a grant without an end
+		{"monthly no end", PlanMonthly, now.AddDate(0, 1, 0), true},
+		{"yearly no end", PlanYearly, now.AddDate(1, 0, 0), true},
+		{"no plan with end", PlanMonthly, expiresAt, false},
+		{"no plan or expiry", PlanMonthly, now.AddDate(0, 1, 0), true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			grants, err := app.FindAllRecords("entitlements", dbx.HashExp{"user": users[c.name].Id})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(grants) != 1 {
+				t.Fatalf("grants = %d, want 1", len(grants))
+			}
+			grant := grants[0]
+			if source, plan := grant.GetString("source"), grant.GetString("plan"); source != EntitlementAdmin || plan != c.plan {
+				t.Fatalf("source/plan = %q/%q, want %q/%q", source, plan, EntitlementAdmin, c.plan)
+			}
+
+			endsAt := grant.GetDateTime("endsAt")
+			if c.endsAt.IsZero() != endsAt.IsZero() {
+				t.Fatalf("endsAt = %s, want %s", endsAt, c.endsAt)
+			}
+			// Bounded from the migration run, which is a moment after now
+			if !c.endsAt.IsZero() && endsAt.Time().Sub(c.endsAt).Abs() > time.Minute {
+				t.Fatalf("endsAt = %s, want about %s", endsAt, c.endsAt)
+			}
+			if reviewed := strings.Contains(grant.GetString("note"), "review the terms"); reviewed != c.reviewed {
+				t.Fatalf("note = %q, want review flag %v", grant.GetString("note"), c.reviewed)
+			}
+		})
+	}
+}
+
+func TestEntitlementHooksKeepPremiumOutOfProfiles(t *testing.T) {
+	app := newTestApp(t)
+	RegisterEntitlementHooks(app)
+	mux := newTestRouter(t, app, func(*core.ServeEvent) {})
+
+	user := newTestUser(t, app, "freeloader@example.com", nil)
+	for _, body := range []string{
+		`{"lifetimePurchasedAt":"2026-03-01 00:00:00.000Z"}`,
+		`{"isPremium":true}`,
+		`{"premiumPlan":"lifetime"}`,
+		`{"premiumExpiresAt":"2099-01-01 00:00:00.000Z"}`,
+		`{"stripeCustomerId":"cus_someone_else"}`,
+		`{"stripeSubscriptionId":"sub_someone_else"}`,
+	} {
+		rec := serveTestRequest(t, mux, user, http.MethodPatch, "/api/collections/users/records/"+user.Id, body)
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("PATCH %s: %d %s, want 403", body, rec.Code, rec.Body.String())
+		}
+	}
+	if grants, err := deriveGrants(app, reload(t, app, user)); err != nil || len(grants) != 0 {
+		t.Fatalf("deriveGrants = %d grants, %v; want none", len(grants), err)
+	}
+
+	// Nor can a new account start out premium
+	rec := serveTestRequest(t, mux, nil, http.MethodPost, "/api/collections/users/records",
+		`{"email":"new@example.com","password":"password123","passwordConfirm":"password123","lifetimePurchasedAt":"2026-03-01 00:00:00.000Z"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("sign up with a purchase: %d %s, want 403", rec.Code, rec.Body.String())
+	}
+
+	superuser := newTestSuperuser(t, app, "root@example.com")
+	rec = serveTestRequest(t, mux, superuser, http.MethodPatch, "/api/collections/users/records/"+user.Id, `{"stripeCustomerId":"cus_support"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("superuser update: %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,428 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+// Study groups are private leaderboards: the owner shares an invite code,
+// members join with it, and GET /api/leaderboard?group=<id> ranks the
+// members among themselves using the same period snapshots as the global board.
+
+const (
+	GroupRoleOwner  = "owner"
+	GroupRoleMember = "member"
+
+	// InviteCodeLength is the length of a study group invite code
+	InviteCodeLength = 8
+
+	// DefaultGroupMaxMembers applies when the owner doesn't choose a size
+	DefaultGroupMaxMembers = 50
+	// MaxGroupMembers is the largest group an owner can create (a driving school class)
+	MaxGroupMembers = 200
+	// MaxOwnedGroups is how many groups a single user can own
+	MaxOwnedGroups = 20
+)
+
+var (
+	ErrGroupNotFound     = errors.New("study group not found")
+	ErrNotGroupMember    = errors.New("not a member of this study group")
+	ErrInviteCodeInvalid = errors.New("invalid invite code")
+)
+
+// StudyGroup is a study group as seen by one of its members
+type StudyGroup struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	InviteCode  string `json:"inviteCode,omitempty"` // Only shown to the owner
+	MaxMembers  int    `json:"maxMembers"`
+	MemberCount int    `json:"memberCount"`
+	Role        string `json:"role"`
+	Created     string `json:"created"`
+}
+
+// StudyGroupMember is a member of a study group. Members listed under a
+// pseudonym have no user ID, which would link the pseudonym to them, and
+// are referred to by their membership ID instead.
+type StudyGroupMember struct {
+	MemberID string `json:"memberId"`
+	UserID   string `json:"userId,omitempty"`
+	Name     string `json:"name"`
+	Avatar   string `json:"avatar,omitempty"`
+	Role     string `json:"role"`
+	JoinedAt string `json:"joinedAt"`
+}
+
+// RegisterGroupRoutes registers all study-group API routes
+func RegisterGroupRoutes(app core.App, se *core.ServeEvent) {
+	// Create a group; the creator becomes its owner
+	se.Router.POST("/api/groups", func(e *core.RequestEvent) error {
+		authRecord := e.Auth
+
+		var req struct {
+			Name        string `json:"name"`
+			Description string `json:"description"`
+			MaxMembers  int    `json:"maxMembers"`
+		}
+		if err := e.BindBody(&req); err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" || len(req.Name) > 60 {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Group name is required (max 60 characters)"})
+		}
+		if req.MaxMembers == 0 {
+			req.MaxMembers = DefaultGroupMaxMembers
+		}
+		if req.MaxMembers < 2 || req.MaxMembers > MaxGroupMembers {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "maxMembers must be between 2 and 200"})
+		}
+
+		owned, err := app.CountRecords("study_groups", dbx.HashExp{"owner": authRecord.Id})
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create group"})
+		}
+		if owned >= MaxOwnedGroups {
+			return e.JSON(http.StatusForbidden, map[string]string{"error": "You own the maximum number of groups"})
+		}
+
+		groupsCollection, err := app.FindCollectionByNameOrId("study_groups")
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create group"})
+		}
+		membersCollection, err := app.FindCollectionByNameOrId("study_group_members")
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create group"})
+		}
+
+		group := core.NewRecord(groupsCollection)
+		err = app.RunInTransaction(func(txApp core.App) error {
+			code, err := newInviteCode(txApp)
+			if err != nil {
+				return err
+			}
+
+			group.Set("name", req.Name)
+			group.Set("description", strings.TrimSpace(req.Description))
+			group.Set("owner", authRecord.Id)
+			group.Set("inviteCode", code)
+			group.Set("maxMembers", req.MaxMembers)
+			if err := txApp.Save(group); err != nil {
+				return err
+			}
+
+			member := core.NewRecord(membersCollection)
+			member.Set("studyGroup", group.Id)
+			member.Set("user", authRecord.Id)
+			member.Set("role", GroupRoleOwner)
+			return txApp.Save(member)
+		})
+		if err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Failed to create group"})
+		}
+
+		return e.JSON(http.StatusOK, studyGroupFor(group, GroupRoleOwner, 1))
+	}).Bind(RequireAuth(app))
+
+	// List the groups the user belongs to
+	se.Router.GET("/api/groups", func(e *core.RequestEvent) error {
+		authRecord := e.Auth
+
+		memberships, err := app.FindRecordsByFilter(
+			"study_group_members",
+			"user = {:userId}",
+			"created",
+			0,
+			0,
+			map[string]any{"userId": authRecord.Id},
+		)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch groups"})
+		}
+
+		if errs := app.ExpandRecords(memberships, []string{"studyGroup"}, nil); len(errs) > 0 {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch groups"})
+		}
+
+		groups := make([]StudyGroup, 0, len(memberships))
+		for _, membership := range memberships {
+			group := membership.ExpandedOne("studyGroup")
+			if group == nil {
+				continue
+			}
+			count, _ := groupMemberCount(app, group.Id)
+			groups = append(groups, studyGroupFor(group, membership.GetString("role"), count))
+		}
+
+		return e.JSON(http.StatusOK, groups)
+	}).Bind(RequireAuth(app))
+
+	// Get a group and its members
+	se.Router.GET("/api/groups/{id}", func(e *core.RequestEvent) error {
+		group, membership, ok := groupForMember(app, e)
+		if !ok {
+			return nil
+		}
+
+		records, err := app.FindRecordsByFilter(
+			"study_group_members",
+			"studyGroup = {:groupId}",
+			"created",
+			0,
+			0,
+			map[string]any{"groupId": group.Id},
+		)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch members"})
+		}
+
+		if errs := app.ExpandRecords(records, []string{"user"}, nil); len(errs) > 0 {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch members"})
+		}
+
+		members := make([]StudyGroupMember, 0, len(records))
+		for _, record := range records {
+			user := record.ExpandedOne("user")
+			if user == nil {
+				continue
+			}
+			member := StudyGroupMember{
+				MemberID: record.Id,
+				UserID:   user.Id,
+				Name:     user.GetString("name"),
+				Avatar:   user.GetString("avatar"),
+				Role:     record.GetString("role"),
+				JoinedAt: formatAPIDate(record.GetDateTime("created")),
+			}
+			// Members listed to each other follow their leaderboard setting;
+			// hidden members are listed under their pseudonym
+			if user.Id != e.Auth.Id {
+				var pseudonymous bool
+				member.Name, member.Avatar, pseudonymous = leaderboardIdentity(user.GetString("pseudonymKey"), member.Name, member.Avatar, leaderboardVisibility(user))
+				if pseudonymous {
+					member.UserID = ""
+				}
+			}
+			members = append(members, member)
+		}
+
+		return e.JSON(http.StatusOK, map[string]interface{}{
+			"group":   studyGroupFor(group, membership.GetString("role"), len(members)),
+			"members": members,
+		})
+	}).Bind(RequireAuth(app))
+
+	// Join a group with its invite code
+	se.Router.POST("/api/groups/join", func(e *core.RequestEvent) error {
+		authRecord := e.Auth
+
+		var req struct {
+			InviteCode string `json:"inviteCode"`
+		}
+		if err := e.BindBody(&req); err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+
+		code := strings.ToUpper(strings.TrimSpace(req.InviteCode))
+		if len(code) != InviteCodeLength {
+			return e.JSON(http.StatusNotFound, map[string]string{"error": ErrInviteCodeInvalid.Error()})
+		}
+
+		group, err := app.FindFirstRecordByFilter("study_groups", "inviteCode = {:code}", map[string]any{"code": code})
+		if err != nil {
+			return e.JSON(http.StatusNotFound, map[string]string{"error": ErrInviteCodeInvalid.Error()})
+		}
+
+		if _, err := findGroupMembership(app, group.Id, authRecord.Id); err == nil {
+			return e.JSON(http.StatusConflict, map[string]string{"error": "Already a member of this group"})
+		}
+
+		membersCollection, err := app.FindCollectionByNameOrId("study_group_members")
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to join group"})
+		}
+
+		var count int
+		err = app.RunInTransaction(func(txApp core.App) error {
+			count, err = groupMemberCount(txApp, group.Id)
+			if err != nil {
+				return err
+			}
+			if count >= group.GetInt("maxMembers") {
+				return errGroupFull
+			}
+
+			member := core.NewRecord(membersCollection)
+			member.Set("studyGroup", group.Id)
+			member.Set("user", authRecord.Id)
+			member.Set("role", GroupRoleMember)
+			return txApp.Save(member)
+		})
+		if errors.Is(err, errGroupFull) {
+			return e.JSON(http.StatusForbidden, map[string]string{"error": "This group is full"})
+		}
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to join group"})
+		}
+
+		return e.JSON(http.StatusOK, studyGroupFor(group, GroupRoleMember, count+1))
+	}).Bind(RequireAuth(app))
+
+	// Regenerate the invite code, e.g. after removing someone (owner only)
+	se.Router.POST("/api/groups/{id}/invite-code", func(e *core.RequestEvent) error {
+		group, membership, ok := groupForMember(app, e)
+		if !ok {
+			return nil
+		}
+		if membership.GetString("role") != GroupRoleOwner {
+			return e.JSON(http.StatusForbidden, map[string]string{"error": "Only the group owner can change the invite code"})
+		}
+
+		code, err := newInviteCode(app)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate invite code"})
+		}
+		group.Set("inviteCode", code)
+		if err := app.Save(group); err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate invite code"})
+		}
+
+		return e.JSON(http.StatusOK, map[string]string{"inviteCode": code})
+	}).Bind(RequireAuth(app))
+
+	// Remove a member (owner), or leave the group (the member themselves).
+	// Members are named by user ID, or by membership ID for those listed
+	// under a pseudonym.
+	se.Router.DELETE("/api/groups/{id}/members/{member}", func(e *core.RequestEvent) error {
+		group, membership, ok := groupForMember(app, e)
+		if !ok {
+			return nil
+		}
+
+		target, err := app.FindFirstRecordByFilter(
+			"study_group_members",
+			"studyGroup = {:groupId} && (user = {:member} || id = {:member})",
+			map[string]any{"groupId": group.Id, "member": e.Request.PathValue("member")},
+		)
+		if err != nil {
+			return e.JSON(http.StatusNotFound, map[string]string{"error": "Member not found"})
+		}
+
+		userID := target.GetString("user")
+		isOwner := membership.GetString("role") == GroupRoleOwner
+
+		if userID != e.Auth.Id && !isOwner {
+			return e.JSON(http.StatusForbidden, map[string]string{"error": "Only the group owner can remove members"})
+		}
+		if userID == group.GetString("owner") {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "The owner can't leave the group; delete it instead"})
+		}
+
+		if err := app.Delete(target); err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to remove member"})
+		}
+
+		return e.JSON(http.StatusOK, map[string]bool{"success": true})
+	}).Bind(RequireAuth(app))
+
+	// Delete a group (owner only)
+	se.Router.DELETE("/api/groups/{id}", func(e *core.RequestEvent) error {
+		group, membership, ok := groupForMember(app, e)
+		if !ok {
+			return nil
+		}
+		if membership.GetString("role") != GroupRoleOwner {
+			return e.JSON(http.StatusForbidden, map[string]string{"error": "Only the group owner can delete the group"})
+		}
+
+		// Memberships cascade
+		if err := app.Delete(group); err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete group"})
+		}
+
+		return e.JSON(http.StatusOK, map[string]bool{"success": true})
+	}).Bind(RequireAuth(app))
+}
+
+var errGroupFull = errors.New("study group is full")
+
+// groupForMember loads the {id} group of the request and the caller's
+// membership. It writes the error response itself and returns ok=false on failure.
+func groupForMember(app core.App, e *core.RequestEvent) (*core.Record, *core.Record, bool) {
+	group, membership, err := findGroupForMember(app, e.Request.PathValue("id"), e.Auth.Id)
+	switch {
+	case errors.Is(err, ErrGroupNotFound):
+		e.JSON(http.StatusNotFound, map[string]string{"error": "Group not found"})
+		return nil, nil, false
+	case errors.Is(err, ErrNotGroupMember):
+		e.JSON(http.StatusForbidden, map[string]string{"error": "Not a member of this group"})
+		return nil, nil, false
+	case err != nil:
+		e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load group"})
+		return nil, nil, false
+	}
+	return group, membership, true
+}
+
+// findGroupForMember returns a group and the user's membership in it
+func findGroupForMember(app core.App, groupID, userID string) (*core.Record, *core.Record, error) {
+	group, err := app.FindRecordById("study_groups", groupID)
+	if err != nil {
+		return nil, nil, ErrGroupNotFound
+	}
+
+	membership, err := findGroupMembership(app, group.Id, userID)
+	if err != nil {
+		return nil, nil, ErrNotGroupMember
+	}
+
+	return group, membership, nil
+}
+
+func findGroupMembership(app core.App, groupID, userID string) (*core.Record, error) {
+	return app.FindFirstRecordByFilter(
+		"study_group_members",
+		"studyGroup = {:groupId} && user = {:userId}",
+		map[string]any{"groupId": groupID, "userId": userID},
+	)
+}
+
+func groupMemberCount(app core.App, groupID string) (int, error) {
+	count, err := app.CountRecords("study_group_members", dbx.HashExp{"studyGroup": groupID})
+	return int(count), err
+}
+
+// newInviteCode generates an invite code no other group uses
+func newInviteCode(app core.App) (string, error) {
+	for attempt := 0; attempt < 5; attempt++ {
+		// Same alphabet as license keys, without look-alike characters
+		code := security.RandomStringWithAlphabet(InviteCodeLength, licenseChars)
+		if _, err := app.FindFirstRecordByFilter("study_groups", "inviteCode = {:code}", map[string]any{"code": code}); err != nil {
+			return code, nil
+		}
+	}
+	return "", errors.New("failed to generate a unique invite code")
+}
+
+func studyGroupFor(group *core.Record, role string, memberCount int) StudyGroup {
+	result := StudyGroup{
+		ID:          group.Id,
+		Name:        group.GetString("name"),
+		Description: group.GetString("description"),
+		MaxMembers:  group.GetInt("maxMembers"),
+		MemberCount: memberCount,
+		Role:        role,
+		Created:     formatAPIDate(group.GetDateTime("created")),
+	}
+	if role == GroupRoleOwner {
+		result.InviteCode = group.GetString("inviteCode")
+	}
+	return result
+}
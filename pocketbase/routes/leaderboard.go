@@ -1,41 +1,84 @@
 package routes
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
+	"driveprep/services"
+
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
 )
 
 // LeaderboardEntry represents a single entry in the leaderboard
 type LeaderboardEntry struct {
-	ID            string `json:"id"`
+	ID            string `json:"id"` // User ID; opaque and per board for pseudonymous users
 	Rank          int    `json:"rank"`
 	Name          string `json:"name"`
 	Avatar        string `json:"avatar,omitempty"`
-	XP            int    `json:"xp"`
+	XP            int    `json:"xp"` // XP earned within the period
 	Level         int    `json:"level"`
 	Streak        int    `json:"streak"`
 	Badges        int    `json:"badges"`
 	IsCurrentUser bool   `json:"isCurrentUser,omitempty"`
+	Pseudonymous  bool   `json:"pseudonymous,omitempty"` // Name is a pseudonym, not the user's own
 }
 
 // LeaderboardResponse represents the leaderboard API response
 type LeaderboardResponse struct {
-	Entries    []LeaderboardEntry `json:"entries"`
-	UserRank   int                `json:"userRank,omitempty"`
-	TotalUsers int                `json:"totalUsers"`
+	Entries     []LeaderboardEntry `json:"entries"`
+	UserRank    int                `json:"userRank,omitempty"`
+	TotalUsers  int                `json:"totalUsers"`
+	Period      string             `json:"period"`
+	PeriodKey   string             `json:"periodKey"`
+	Group       string             `json:"group,omitempty"`
+	StartsAt    string             `json:"startsAt,omitempty"`
+	EndsAt      string             `json:"endsAt,omitempty"`
+	RefreshedAt string             `json:"refreshedAt"`
+	Finalized   bool               `json:"finalized"`
+}
+
+// LeaderboardRank is a user's standing in one period
+type LeaderboardRank struct {
+	Rank       int    `json:"rank"` // 0 if the user earned no XP in the period
+	XP         int    `json:"xp"`
+	TotalUsers int    `json:"totalUsers"`
+	Period     string `json:"period"`
+	PeriodKey  string `json:"periodKey"`
+	Group      string `json:"group,omitempty"`
+	Visibility string `json:"visibility,omitempty"` // Only returned for the requesting user
+}
+
+// LeaderboardPeriodSummary is a past period and its winners
+type LeaderboardPeriodSummary struct {
 	Period     string             `json:"period"`
+	PeriodKey  string             `json:"periodKey"`
+	StartsAt   string             `json:"startsAt,omitempty"`
+	EndsAt     string             `json:"endsAt,omitempty"`
+	TotalUsers int                `json:"totalUsers"`
+	Finalized  bool               `json:"finalized"`
+	Winners    []LeaderboardEntry `json:"winners"`
 }
 
 // RegisterLeaderboardRoutes registers all leaderboard-related API routes
 func RegisterLeaderboardRoutes(app core.App, se *core.ServeEvent) {
+	// Keep the current snapshots fresh and finalize ended periods
+	app.Cron().MustAdd("leaderboardSnapshots", leaderboardRefreshSchedule, func() {
+		refreshLeaderboards(app)
+	})
+
 	// Get leaderboard
+	// ?period=weekly|monthly|allTime&key=<periodKey|previous>&limit=&group=<studyGroupId>
 	se.Router.GET("/api/leaderboard", func(e *core.RequestEvent) error {
-		period := e.Request.URL.Query().Get("period")
-		if period == "" {
-			period = "weekly"
+		period, snapshot, ok := leaderboardPeriodFromRequest(app, e, services.PeriodWeekly)
+		if !ok {
+			return nil
+		}
+		board, ok := leaderboardBoardFromRequest(app, e, snapshot)
+		if !ok {
+			return nil
 		}
 
 		limitStr := e.Request.URL.Query().Get("limit")
@@ -52,172 +95,143 @@ func RegisterLeaderboardRoutes(app core.App, se *core.ServeEvent) {
 			currentUserID = e.Auth.Id
 		}
 
-		// Build query based on period
-		var filter string
-		filterParams := map[string]any{}
+		entries, err := leaderboardTop(app, board, limit, currentUserID)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch leaderboard"})
+		}
 
-		if period == "weekly" {
-			// Get start of current week (Monday)
-			now := time.Now()
-			weekday := int(now.Weekday())
-			if weekday == 0 {
-				weekday = 7 // Sunday is 7
+		var userRank int
+		for _, entry := range entries {
+			if entry.IsCurrentUser {
+				userRank = entry.Rank
 			}
-			startOfWeek := now.AddDate(0, 0, -(weekday - 1))
-			startOfWeek = time.Date(startOfWeek.Year(), startOfWeek.Month(), startOfWeek.Day(), 0, 0, 0, 0, startOfWeek.Location())
-
-			filter = "updated >= {:startOfWeek}"
-			filterParams["startOfWeek"] = startOfWeek
 		}
 
-		// Get users sorted by XP
-		var records []*core.Record
-		var err error
-
-		if filter != "" {
-			records, err = app.FindRecordsByFilter(
-				"users",
-				filter,
-				"-xp",
-				limit,
-				0,
-				filterParams,
-			)
-		} else {
-			records, err = app.FindRecordsByFilter(
-				"users",
-				"xp > 0",
-				"-xp",
-				limit,
-				0,
-				nil,
-			)
+		// If user not in top results, look up their snapshot entry
+		if currentUserID != "" && userRank == 0 {
+			if own, err := leaderboardStanding(app, board, currentUserID, currentUserID); err == nil && own != nil {
+				userRank = own.Rank
+			}
 		}
 
+		totalUsers, err := leaderboardTotal(app, board, snapshot)
 		if err != nil {
 			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch leaderboard"})
 		}
 
-		// Get total user count
-		totalRecords, _ := app.FindRecordsByFilter("users", "xp > 0", "", 0, 0, nil)
-		totalUsers := len(totalRecords)
+		response := leaderboardResponse(period, snapshot)
+		response.Entries = entries
+		response.UserRank = userRank
+		response.TotalUsers = totalUsers
+		response.Group = board.GroupID
+		return e.JSON(http.StatusOK, response)
+	})
 
-		// Build response
-		entries := make([]LeaderboardEntry, len(records))
-		var userRank int
+	// List past periods with their top 3
+	// ?period=weekly|monthly&limit=
+	se.Router.GET("/api/leaderboard/periods", func(e *core.RequestEvent) error {
+		periodType := e.Request.URL.Query().Get("period")
+		if periodType == "" {
+			periodType = services.PeriodWeekly
+		}
+		if periodType != services.PeriodWeekly && periodType != services.PeriodMonthly {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "period must be weekly or monthly"})
+		}
 
-		for i, record := range records {
-			badges := record.Get("badges")
-			badgeCount := 0
-			if badges != nil {
-				if badgeSlice, ok := badges.([]interface{}); ok {
-					badgeCount = len(badgeSlice)
-				}
+		limitStr := e.Request.URL.Query().Get("limit")
+		limit := 10
+		if limitStr != "" {
+			if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 52 {
+				limit = l
 			}
+		}
 
-			isCurrentUser := record.Id == currentUserID
-			if isCurrentUser {
-				userRank = i + 1
-			}
+		var currentUserID string
+		if e.Auth != nil {
+			currentUserID = e.Auth.Id
+		}
 
-			entries[i] = LeaderboardEntry{
-				ID:            record.Id,
-				Rank:          i + 1,
-				Name:          record.GetString("name"),
-				Avatar:        record.GetString("avatar"),
-				XP:            record.GetInt("xp"),
-				Level:         record.GetInt("level"),
-				Streak:        record.GetInt("streak"),
-				Badges:        badgeCount,
-				IsCurrentUser: isCurrentUser,
-			}
+		snapshots, err := app.FindRecordsByFilter(
+			"leaderboard_periods",
+			"periodType = {:type} && finalized = true",
+			"-startsAt",
+			limit,
+			0,
+			map[string]any{"type": periodType},
+		)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch leaderboard periods"})
 		}
 
-		// If user not in top results, find their rank
-		if currentUserID != "" && userRank == 0 {
-			// Count users with more XP
-			currentUser, err := app.FindRecordById("users", currentUserID)
-			if err == nil {
-				userXP := currentUser.GetInt("xp")
-				higherRanked, _ := app.FindRecordsByFilter(
-					"users",
-					"xp > {:userXp}",
-					"",
-					0,
-					0,
-					map[string]any{"userXp": userXP},
-				)
-				userRank = len(higherRanked) + 1
+		summaries := make([]LeaderboardPeriodSummary, 0, len(snapshots))
+		for _, snapshot := range snapshots {
+			winners, err := leaderboardWinners(app, leaderboardBoard{PeriodID: snapshot.Id}, currentUserID)
+			if err != nil {
+				return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch leaderboard periods"})
 			}
+
+			summaries = append(summaries, LeaderboardPeriodSummary{
+				Period:     snapshot.GetString("periodType"),
+				PeriodKey:  snapshot.GetString("periodKey"),
+				StartsAt:   formatAPIDate(snapshot.GetDateTime("startsAt")),
+				EndsAt:     formatAPIDate(snapshot.GetDateTime("endsAt")),
+				TotalUsers: snapshot.GetInt("totalUsers"),
+				Finalized:  snapshot.GetBool("finalized"),
+				Winners:    winners,
+			})
 		}
 
-		return e.JSON(http.StatusOK, LeaderboardResponse{
-			Entries:    entries,
-			UserRank:   userRank,
-			TotalUsers: totalUsers,
-			Period:     period,
-		})
+		return e.JSON(http.StatusOK, summaries)
 	})
 
-	// Get user's rank
+	// Get user's rank. Hidden users' ranks are only visible to themselves.
 	se.Router.GET("/api/leaderboard/rank/{userId}", func(e *core.RequestEvent) error {
 		userID := e.Request.PathValue("userId")
-		period := e.Request.URL.Query().Get("period")
-		if period == "" {
-			period = "allTime"
-		}
 
-		user, err := app.FindRecordById("users", userID)
-		if err != nil {
-			return e.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		user, ok := leaderboardUserFromRequest(app, e, userID)
+		if !ok {
+			return nil
 		}
 
-		userXP := user.GetInt("xp")
-
-		// Count users with more XP
-		var filter string
-		filterParams := map[string]any{"userXp": userXP}
-
-		if period == "weekly" {
-			now := time.Now()
-			weekday := int(now.Weekday())
-			if weekday == 0 {
-				weekday = 7
-			}
-			startOfWeek := now.AddDate(0, 0, -(weekday - 1))
-			startOfWeek = time.Date(startOfWeek.Year(), startOfWeek.Month(), startOfWeek.Day(), 0, 0, 0, 0, startOfWeek.Location())
-
-			filter = "xp > {:userXp} && updated >= {:startOfWeek}"
-			filterParams["startOfWeek"] = startOfWeek
-		} else {
-			filter = "xp > {:userXp}"
+		period, snapshot, ok := leaderboardPeriodFromRequest(app, e, services.PeriodAllTime)
+		if !ok {
+			return nil
+		}
+		board, ok := leaderboardBoardFromRequest(app, e, snapshot)
+		if !ok {
+			return nil
 		}
 
-		higherRanked, err := app.FindRecordsByFilter(
-			"users",
-			filter,
-			"",
-			0,
-			0,
-			filterParams,
-		)
-
+		totalUsers, err := leaderboardTotal(app, board, snapshot)
 		if err != nil {
 			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to calculate rank"})
 		}
 
-		rank := len(higherRanked) + 1
+		result := LeaderboardRank{
+			TotalUsers: totalUsers,
+			Period:     period.Type,
+			PeriodKey:  period.Key,
+			Group:      board.GroupID,
+		}
+		if userID == e.Auth.Id {
+			result.Visibility = leaderboardVisibility(user)
+		}
+		own, err := leaderboardStanding(app, board, userID, e.Auth.Id)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to calculate rank"})
+		}
+		if own != nil {
+			result.Rank = own.Rank
+			result.XP = own.XP
+		}
 
-		return e.JSON(http.StatusOK, map[string]int{"rank": rank})
-	})
+		return e.JSON(http.StatusOK, result)
+	}).Bind(RequireAuth(app))
 
-	// Get users near current user
+	// Get users near a user. Hidden users only see the board from their own
+	// position, below everyone ranked.
 	se.Router.GET("/api/leaderboard/nearby/{userId}", func(e *core.RequestEvent) error {
 		userID := e.Request.PathValue("userId")
-		period := e.Request.URL.Query().Get("period")
-		if period == "" {
-			period = "allTime"
-		}
 
 		rangeStr := e.Request.URL.Query().Get("range")
 		rangeSize := 2
@@ -227,112 +241,153 @@ func RegisterLeaderboardRoutes(app core.App, se *core.ServeEvent) {
 			}
 		}
 
-		user, err := app.FindRecordById("users", userID)
-		if err != nil {
-			return e.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		user, ok := leaderboardUserFromRequest(app, e, userID)
+		if !ok {
+			return nil
 		}
 
-		userXP := user.GetInt("xp")
+		_, snapshot, ok := leaderboardPeriodFromRequest(app, e, services.PeriodAllTime)
+		if !ok {
+			return nil
+		}
+		board, ok := leaderboardBoardFromRequest(app, e, snapshot)
+		if !ok {
+			return nil
+		}
 
-		// Get users above
-		aboveUsers, _ := app.FindRecordsByFilter(
-			"users",
-			"xp > {:userXp}",
-			"xp", // ascending to get closest above
-			rangeSize,
-			0,
-			map[string]any{"userXp": userXP},
-		)
+		entries, own, err := leaderboardNearby(app, board, userID, rangeSize, e.Auth.Id)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch nearby users"})
+		}
 
-		// Get users below
-		belowUsers, _ := app.FindRecordsByFilter(
-			"users",
-			"xp < {:userXp}",
-			"-xp", // descending to get closest below
-			rangeSize,
-			0,
-			map[string]any{"userXp": userXP},
-		)
+		// Unranked this period: show the bottom of the board and the user below it
+		if own == nil {
+			entries = append(entries, leaderboardEntry(user, 0, 0, userID == e.Auth.Id))
+		}
 
-		// Calculate ranks
-		allHigher, _ := app.FindRecordsByFilter(
-			"users",
-			"xp > {:userXp}",
-			"",
-			0,
-			0,
-			map[string]any{"userXp": userXP},
-		)
-		userRank := len(allHigher) + 1
-
-		// Build response
-		entries := []LeaderboardEntry{}
-
-		// Add users above (in reverse order)
-		for i := len(aboveUsers) - 1; i >= 0; i-- {
-			record := aboveUsers[i]
-			badges := record.Get("badges")
-			badgeCount := 0
-			if badges != nil {
-				if badgeSlice, ok := badges.([]interface{}); ok {
-					badgeCount = len(badgeSlice)
-				}
-			}
+		return e.JSON(http.StatusOK, entries)
+	}).Bind(RequireAuth(app))
+}
 
-			entries = append(entries, LeaderboardEntry{
-				ID:     record.Id,
-				Rank:   userRank - (i + 1),
-				Name:   record.GetString("name"),
-				Avatar: record.GetString("avatar"),
-				XP:     record.GetInt("xp"),
-				Level:  record.GetInt("level"),
-				Streak: record.GetInt("streak"),
-				Badges: badgeCount,
-			})
+// leaderboardUserFromRequest loads the user whose standing is requested.
+// Other users can only look up public users: a real user ID would tie a
+// pseudonymous or hidden user back to their account, so those get the same
+// 404 as a user that doesn't exist. It writes the error response itself and
+// returns ok=false on failure.
+func leaderboardUserFromRequest(app core.App, e *core.RequestEvent, userID string) (*core.Record, bool) {
+	user, err := app.FindRecordById("users", userID)
+	if err != nil || (userID != e.Auth.Id && leaderboardVisibility(user) != LeaderboardPublic) {
+		e.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		return nil, false
+	}
+	return user, true
+}
+
+// leaderboardPeriodFromRequest resolves the ?period= and ?key= query params
+// and loads the period's snapshot. It writes the error response itself and
+// returns ok=false on failure.
+func leaderboardPeriodFromRequest(app core.App, e *core.RequestEvent, defaultType string) (services.Period, *core.Record, bool) {
+	periodType := e.Request.URL.Query().Get("period")
+	if periodType == "" {
+		periodType = defaultType
+	}
+
+	period, err := resolveLeaderboardPeriod(periodType, e.Request.URL.Query().Get("key"))
+	if err != nil {
+		if errors.Is(err, ErrLeaderboardPeriodNotFound) {
+			e.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		} else {
+			e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid period or period key"})
 		}
+		return period, nil, false
+	}
 
-		// Add current user
-		badges := user.Get("badges")
-		badgeCount := 0
-		if badges != nil {
-			if badgeSlice, ok := badges.([]interface{}); ok {
-				badgeCount = len(badgeSlice)
-			}
+	snapshot, err := loadLeaderboardPeriod(app, period)
+	if err != nil {
+		if errors.Is(err, ErrLeaderboardPeriodNotFound) {
+			e.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		} else {
+			e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load leaderboard"})
 		}
-		entries = append(entries, LeaderboardEntry{
-			ID:            user.Id,
-			Rank:          userRank,
-			Name:          user.GetString("name"),
-			Avatar:        user.GetString("avatar"),
-			XP:            user.GetInt("xp"),
-			Level:         user.GetInt("level"),
-			Streak:        user.GetInt("streak"),
-			Badges:        badgeCount,
-			IsCurrentUser: true,
-		})
-
-		// Add users below
-		for i, record := range belowUsers {
-			badges := record.Get("badges")
-			badgeCount := 0
-			if badges != nil {
-				if badgeSlice, ok := badges.([]interface{}); ok {
-					badgeCount = len(badgeSlice)
-				}
-			}
+		return period, nil, false
+	}
 
-			entries = append(entries, LeaderboardEntry{
-				ID:     record.Id,
-				Rank:   userRank + i + 1,
-				Name:   record.GetString("name"),
-				Avatar: record.GetString("avatar"),
-				XP:     record.GetInt("xp"),
-				Level:  record.GetInt("level"),
-				Streak: record.GetInt("streak"),
-				Badges: badgeCount,
-			})
+	return period, snapshot, true
+}
+
+// leaderboardBoardFromRequest scopes a snapshot to the ?group= study group,
+// which only its members may view. It writes the error response itself and
+// returns ok=false on failure.
+func leaderboardBoardFromRequest(app core.App, e *core.RequestEvent, snapshot *core.Record) (leaderboardBoard, bool) {
+	board := leaderboardBoard{PeriodID: snapshot.Id}
+
+	groupID := e.Request.URL.Query().Get("group")
+	if groupID == "" {
+		return board, true
+	}
+
+	if e.Auth == nil {
+		e.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+		return board, false
+	}
+
+	_, _, err := findGroupForMember(app, groupID, e.Auth.Id)
+	switch {
+	case errors.Is(err, ErrGroupNotFound):
+		e.JSON(http.StatusNotFound, map[string]string{"error": "Group not found"})
+		return board, false
+	case errors.Is(err, ErrNotGroupMember):
+		e.JSON(http.StatusForbidden, map[string]string{"error": "Not a member of this group"})
+		return board, false
+	case err != nil:
+		e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load group"})
+		return board, false
+	}
+
+	board.GroupID = groupID
+	return board, true
+}
+
+// leaderboardEntry builds an entry for a user straight from their record
+func leaderboardEntry(user *core.Record, rank, xp int, isCurrentUser bool) LeaderboardEntry {
+	entry := LeaderboardEntry{
+		ID:            user.Id,
+		Rank:          rank,
+		Name:          user.GetString("name"),
+		Avatar:        user.GetString("avatar"),
+		XP:            xp,
+		Level:         user.GetInt("level"),
+		Streak:        user.GetInt("streak"),
+		Badges:        len(userBadges(user)),
+		IsCurrentUser: isCurrentUser,
+	}
+	if !isCurrentUser {
+		entry.Name, entry.Avatar, entry.Pseudonymous = leaderboardIdentity(user.GetString("pseudonymKey"), entry.Name, entry.Avatar, leaderboardVisibility(user))
+		// Unranked, so there's no entry to derive an ID from
+		if entry.Pseudonymous {
+			entry.ID = ""
 		}
+	}
+	return entry
+}
 
-		return e.JSON(http.StatusOK, entries)
-	})
+func leaderboardResponse(period services.Period, snapshot *core.Record) LeaderboardResponse {
+	return LeaderboardResponse{
+		Entries:     []LeaderboardEntry{},
+		TotalUsers:  snapshot.GetInt("totalUsers"),
+		Period:      period.Type,
+		PeriodKey:   period.Key,
+		StartsAt:    formatAPIDate(snapshot.GetDateTime("startsAt")),
+		EndsAt:      formatAPIDate(snapshot.GetDateTime("endsAt")),
+		RefreshedAt: formatAPIDate(snapshot.GetDateTime("refreshedAt")),
+		Finalized:   snapshot.GetBool("finalized"),
+	}
+}
+
+// formatAPIDate formats a record date as RFC 3339, empty for unset dates
+func formatAPIDate(dt types.DateTime) string {
+	if dt.IsZero() {
+		return ""
+	}
+	return dt.Time().UTC().Format(time.RFC3339)
 }
@@ -0,0 +1,187 @@
+package routes
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"driveprep/services"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// The leaderboard benchmarks seed 100k synthetic users into a test app by
+// default; pass a smaller count for a quicker run, e.g.
+//
+//	go test ./routes -run '^$' -bench Leaderboard -leaderboard.users 10000
+
+var benchLeaderboardUsers = flag.Int("leaderboard.users", 100000, "synthetic users seeded for the leaderboard benchmarks")
+
+var benchPeriodTypes = []string{services.PeriodWeekly, services.PeriodMonthly, services.PeriodAllTime}
+
+func BenchmarkLeaderboardRefresh(b *testing.B) {
+	app := newTestApp(b)
+	seedBenchUsers(b, app, *benchLeaderboardUsers)
+
+	for _, periodType := range benchPeriodTypes {
+		b.Run(periodType, func(b *testing.B) {
+			period, err := services.CurrentPeriod(periodType, time.Now(), leaderboardLocation())
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := RefreshLeaderboard(app, period); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkLeaderboardTop(b *testing.B) {
+	benchLeaderboardEndpoint(b, func(periodType, userID string) string {
+		return "/api/leaderboard?limit=20&period=" + periodType
+	})
+}
+
+func BenchmarkLeaderboardRank(b *testing.B) {
+	benchLeaderboardEndpoint(b, func(periodType, userID string) string {
+		return "/api/leaderboard/rank/" + userID + "?period=" + periodType
+	})
+}
+
+func BenchmarkLeaderboardNearby(b *testing.B) {
+	benchLeaderboardEndpoint(b, func(periodType, userID string) string {
+		return "/api/leaderboard/nearby/" + userID + "?range=5&period=" + periodType
+	})
+}
+
+// benchLeaderboardEndpoint times GET requests through the real router for
+// each period, looking up random users from refreshed snapshots
+func benchLeaderboardEndpoint(b *testing.B, path func(periodType, userID string) string) {
+	app := newTestApp(b)
+	userIDs := seedBenchUsers(b, app, *benchLeaderboardUsers)
+
+	mux := newTestRouter(b, app, func(se *core.ServeEvent) {
+		RegisterLeaderboardRoutes(app, se)
+	})
+	// The snapshot cron job isn't wanted while benchmarking
+	app.Cron().Remove("leaderboardSnapshots")
+
+	// rank and nearby require auth; one user looks up everyone
+	viewer, err := app.FindRecordById("users", userIDs[0])
+	if err != nil {
+		b.Fatal(err)
+	}
+	token, err := viewer.NewAuthToken()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, periodType := range benchPeriodTypes {
+		b.Run(periodType, func(b *testing.B) {
+			period, err := services.CurrentPeriod(periodType, time.Now(), leaderboardLocation())
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := RefreshLeaderboard(app, period); err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				req := httptest.NewRequest(http.MethodGet, path(periodType, userIDs[rand.Intn(len(userIDs))]), nil)
+				req.Header.Set("Authorization", token)
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, req)
+
+				if rec.Code != http.StatusOK {
+					b.Fatalf("GET %s: status %d: %s", req.URL, rec.Code, strings.TrimSpace(rec.Body.String()))
+				}
+			}
+		})
+	}
+}
+
+// seedBenchUsers inserts synthetic users with one to three XP transactions
+// each, all earned this week so every current period ranks them
+func seedBenchUsers(b *testing.B, app core.App, count int) []string {
+	b.Helper()
+
+	week, err := services.CurrentPeriod(services.PeriodWeekly, time.Now(), leaderboardLocation())
+	if err != nil {
+		b.Fatal(err)
+	}
+	window := max(time.Since(week.Start), time.Minute)
+
+	ids := make([]string, 0, count)
+	now := types.NowDateTime().String()
+
+	err = app.RunInTransaction(func(txApp core.App) error {
+		const batchSize = 500
+
+		for start := 0; start < count; start += batchSize {
+			end := min(start+batchSize, count)
+
+			var userValues, txValues []string
+			params := dbx.Params{"now": now}
+
+			for i := start; i < end; i++ {
+				id := core.GenerateDefaultRandomId()
+				ids = append(ids, id)
+
+				p := fmt.Sprintf("u%d", i)
+				params[p+"id"] = id
+				params[p+"email"] = fmt.Sprintf("bench-%d@example.com", i)
+				params[p+"token"] = security.RandomString(50)
+				params[p+"name"] = fmt.Sprintf("Bench User %d", i)
+
+				total := 0
+				for j := 0; j < 1+rand.Intn(3); j++ {
+					amount := 10 + rand.Intn(500)
+					total += amount
+
+					t := fmt.Sprintf("t%d_%d", i, j)
+					params[t+"id"] = core.GenerateDefaultRandomId()
+					params[t+"amount"] = amount
+					params[t+"created"] = types.NowDateTime().Add(-time.Duration(rand.Int63n(int64(window)))).String()
+					txValues = append(txValues, fmt.Sprintf(
+						"({:%[1]sid}, {:%[2]sid}, {:%[1]samount}, 'benchmark', {:%[1]screated})", t, p))
+				}
+
+				params[p+"xp"] = total
+				userValues = append(userValues, fmt.Sprintf(
+					"({:%[1]sid}, {:%[1]semail}, {:%[1]stoken}, {:%[1]sname}, {:%[1]sxp}, {:now}, {:now})", p))
+			}
+
+			if _, err := txApp.DB().NewQuery(
+				"INSERT INTO users (id, email, tokenKey, name, xp, created, updated) VALUES " + strings.Join(userValues, ", "),
+			).Bind(params).Execute(); err != nil {
+				return err
+			}
+
+			if _, err := txApp.DB().NewQuery(
+				"INSERT INTO xp_transactions (id, user, amount, reason, created) VALUES " + strings.Join(txValues, ", "),
+			).Bind(params).Execute(); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return ids
+}
@@ -0,0 +1,53 @@
+package routes
+
+import (
+	"driveprep/services"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Leaderboard visibility settings (users.leaderboardVisibility)
+const (
+	LeaderboardPublic       = "public"       // Name and avatar shown (the default)
+	LeaderboardPseudonymous = "pseudonymous" // Ranked under a stable pseudonym, no avatar
+	LeaderboardHidden       = "hidden"       // Not ranked at all
+)
+
+// leaderboardVisibility returns a user's visibility setting, public if unset
+func leaderboardVisibility(user *core.Record) string {
+	if v := user.GetString("leaderboardVisibility"); v != "" {
+		return v
+	}
+	return LeaderboardPublic
+}
+
+// leaderboardIdentity returns the name and avatar other users see. Names
+// saved before moderation existed are checked again here, so a name that
+// fails the filter is never shown. Pseudonyms come from the user's
+// pseudonymKey.
+func leaderboardIdentity(pseudonymKey, name, avatar, visibility string) (string, string, bool) {
+	if visibility == LeaderboardPublic || visibility == "" {
+		if name != "" && services.ModerateDisplayName(name) == nil {
+			return name, avatar, false
+		}
+	}
+	return services.Pseudonym(pseudonymKey), "", true
+}
+
+// RegisterDisplayNameHooks rejects display names containing contact
+// details or profanity. Only changed names are checked so existing users
+// can still be saved (XP, streaks) until they rename.
+func RegisterDisplayNameHooks(app core.App) {
+	app.OnRecordValidate("users").BindFunc(func(e *core.RecordEvent) error {
+		name := e.Record.GetString("name")
+		if name != "" && (e.Record.IsNew() || name != e.Record.Original().GetString("name")) {
+			if err := services.ModerateDisplayName(name); err != nil {
+				return validation.Errors{
+					"name": validation.NewError("validation_invalid_display_name", err.Error()),
+				}
+			}
+		}
+		return e.Next()
+	})
+}
@@ -0,0 +1,233 @@
+package routes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Leaderboard reads are single indexed queries over a period's snapshot,
+// joined with the users' profile fields. Nothing is counted or sorted in
+// memory: ranks and totals were stored when the snapshot was refreshed, and
+// the nearby window seeks the (period, rank, user) index from the user's row.
+// Study group boards re-rank the members' snapshot entries among themselves.
+// Hidden users are left out of snapshots when they are refreshed, and again
+// when read so that hiding takes effect before the next refresh.
+
+// leaderboardBoard selects the entries of a period snapshot that are ranked:
+// everyone, or only the members of a study group
+type leaderboardBoard struct {
+	PeriodID string
+	GroupID  string
+}
+
+// source returns the board's entries (user, xp, rank) aliased as e, and the
+// condition that restricts them to the period
+func (b leaderboardBoard) source() (string, string) {
+	if b.GroupID == "" {
+		return "leaderboard_entries e", "e.period = {:period}"
+	}
+	return `(
+		SELECT ge.id AS id, ge.user AS user, ge.xp AS xp, RANK() OVER (ORDER BY ge.xp DESC) AS rank
+		FROM leaderboard_entries ge
+		JOIN study_group_members m ON m.user = ge.user AND m.studyGroup = {:group}
+		JOIN users gu ON gu.id = ge.user AND gu.leaderboardVisibility != 'hidden'
+		WHERE ge.period = {:period}
+	) e`, "1 = 1"
+}
+
+// pseudonymousID is the ID shown for a pseudonymous user's entry instead of
+// their user ID, which would link the pseudonym to them. It's derived from
+// the snapshot entry's record ID, which isn't exposed, so it differs per
+// period and per board and can't be computed from the user ID.
+func (b leaderboardBoard) pseudonymousID(entryID string) string {
+	sum := sha256.Sum256([]byte("leaderboard-entry:" + b.GroupID + ":" + entryID))
+	return "anon_" + hex.EncodeToString(sum[:8])
+}
+
+func (b leaderboardBoard) params() dbx.Params {
+	params := dbx.Params{"period": b.PeriodID}
+	if b.GroupID != "" {
+		params["group"] = b.GroupID
+	}
+	return params
+}
+
+// leaderboardColumns selects the profile fields shown on the board
+const leaderboardColumns = `
+	SELECT
+		u.id AS id,
+		e.id AS entryId,
+		e.rank AS rank,
+		e.xp AS xp,
+		u.name AS name,
+		u.avatar AS avatar,
+		COALESCE(u.level, 0) AS level,
+		COALESCE(u.streak, 0) AS streak,
+		CASE WHEN json_valid(u.badges) THEN json_array_length(u.badges) ELSE 0 END AS badges,
+		u.leaderboardVisibility AS visibility,
+		u.pseudonymKey AS pseudonymKey`
+
+type leaderboardRow struct {
+	ID      string `db:"id"`
+	EntryID string `db:"entryId"`
+	Rank    int    `db:"rank"`
+	XP      int    `db:"xp"`
+	Name    string `db:"name"`
+	Avatar  string `db:"avatar"`
+	Level   int    `db:"level"`
+	Streak  int    `db:"streak"`
+	Badges  int    `db:"badges"`
+
+	Visibility   string `db:"visibility"`
+	PseudonymKey string `db:"pseudonymKey"`
+}
+
+// queryLeaderboard selects a board's entries with an extra condition and ordering
+func queryLeaderboard(app core.App, board leaderboardBoard, condition, orderBy string, limit int, extra dbx.Params, currentUserID string) ([]LeaderboardEntry, error) {
+	from, where := board.source()
+	sql := leaderboardColumns + " FROM " + from + " JOIN users u ON u.id = e.user WHERE " + where +
+		" AND u.leaderboardVisibility != 'hidden'"
+
+	params := board.params()
+	for k, v := range extra {
+		params[k] = v
+	}
+
+	if condition != "" {
+		sql += " AND (" + condition + ")"
+	}
+	sql += " ORDER BY " + orderBy
+	if limit > 0 {
+		sql += " LIMIT {:limit}"
+		params["limit"] = limit
+	}
+
+	var rows []leaderboardRow
+	if err := app.DB().NewQuery(sql).Bind(params).All(&rows); err != nil {
+		return nil, err
+	}
+
+	entries := make([]LeaderboardEntry, 0, len(rows))
+	for _, row := range rows {
+		entry := LeaderboardEntry{
+			ID:            row.ID,
+			Rank:          row.Rank,
+			Name:          row.Name,
+			Avatar:        row.Avatar,
+			XP:            row.XP,
+			Level:         row.Level,
+			Streak:        row.Streak,
+			Badges:        row.Badges,
+			IsCurrentUser: row.ID == currentUserID,
+		}
+		// Users always see their own name
+		if !entry.IsCurrentUser {
+			entry.Name, entry.Avatar, entry.Pseudonymous = leaderboardIdentity(row.PseudonymKey, row.Name, row.Avatar, row.Visibility)
+			if entry.Pseudonymous {
+				entry.ID = board.pseudonymousID(row.EntryID)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// leaderboardTop returns the first entries of a period's board. Ties share a
+// rank and are ordered by user ID so pages are stable.
+func leaderboardTop(app core.App, board leaderboardBoard, limit int, currentUserID string) ([]LeaderboardEntry, error) {
+	return queryLeaderboard(app, board, "", "e.rank, e.user", limit, nil, currentUserID)
+}
+
+// leaderboardWinners returns everyone ranked in the top 3 of a board, ties included
+func leaderboardWinners(app core.App, board leaderboardBoard, currentUserID string) ([]LeaderboardEntry, error) {
+	return queryLeaderboard(app, board, "e.rank <= 3", "e.rank, e.user", 0, nil, currentUserID)
+}
+
+// leaderboardStanding returns a user's entry on a board, or nil if they
+// earned no XP in the period
+func leaderboardStanding(app core.App, board leaderboardBoard, userID, currentUserID string) (*LeaderboardEntry, error) {
+	entries, err := queryLeaderboard(app, board, "e.user = {:user}", "e.rank", 1, dbx.Params{"user": userID}, currentUserID)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+	return &entries[0], nil
+}
+
+// leaderboardNearby returns up to rangeSize entries either side of a user's
+// entry, in board order. For users without an entry it returns the bottom of
+// the board and a nil standing.
+func leaderboardNearby(app core.App, board leaderboardBoard, userID string, rangeSize int, currentUserID string) ([]LeaderboardEntry, *LeaderboardEntry, error) {
+	own, err := leaderboardStanding(app, board, userID, currentUserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if own == nil {
+		last, err := queryLeaderboard(app, board, "", "e.rank DESC, e.user DESC", rangeSize, nil, currentUserID)
+		if err != nil {
+			return nil, nil, err
+		}
+		reverseEntries(last)
+		return last, nil, nil
+	}
+
+	// Split ties the same way the board orders them. The row-value comparison
+	// lets SQLite seek the index instead of sorting everyone above the user.
+	above, err := queryLeaderboard(app, board,
+		"(e.rank, e.user) < ({:rank}, {:user})",
+		"e.rank DESC, e.user DESC", // closest above first
+		rangeSize,
+		dbx.Params{"rank": own.Rank, "user": userID},
+		currentUserID,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	below, err := queryLeaderboard(app, board,
+		"(e.rank, e.user) > ({:rank}, {:user})",
+		"e.rank, e.user",
+		rangeSize,
+		dbx.Params{"rank": own.Rank, "user": userID},
+		currentUserID,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reverseEntries(above)
+	window := make([]LeaderboardEntry, 0, len(above)+1+len(below))
+	window = append(window, above...)
+	window = append(window, *own)
+	window = append(window, below...)
+	return window, own, nil
+}
+
+func reverseEntries(entries []LeaderboardEntry) {
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+}
+
+// leaderboardTotal returns how many users are ranked on a board
+func leaderboardTotal(app core.App, board leaderboardBoard, snapshot *core.Record) (int, error) {
+	if board.GroupID == "" {
+		return snapshot.GetInt("totalUsers"), nil
+	}
+
+	var result struct {
+		Total int `db:"total"`
+	}
+	err := app.DB().NewQuery(`
+		SELECT COUNT(*) AS total
+		FROM leaderboard_entries e
+		JOIN study_group_members m ON m.user = e.user AND m.studyGroup = {:group}
+		JOIN users u ON u.id = e.user AND u.leaderboardVisibility != 'hidden'
+		WHERE e.period = {:period}`).
+		Bind(board.params()).
+		One(&result)
+	return result.Total, err
+}
@@ -0,0 +1,190 @@
+package routes
+
+import (
+	"errors"
+	"time"
+
+	"driveprep/services"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Leaderboards are precomputed snapshots: leaderboard_periods holds one record
+// per ranked period and leaderboard_entries the users' XP earned within it,
+// summed from xp_transactions. A cron job keeps the current periods fresh and
+// gives each ended period a final refresh, after which it is never touched.
+
+// leaderboardRefreshSchedule is how often the current snapshots are recomputed
+const leaderboardRefreshSchedule = "*/5 * * * *"
+
+var ErrLeaderboardPeriodNotFound = errors.New("no leaderboard for this period")
+
+// leaderboardLocation is the timezone period boundaries are computed in.
+// Everyone shares one week, so this is the default rather than the user's zone.
+func leaderboardLocation() *time.Location {
+	return services.UserLocation(services.DefaultTimezone)
+}
+
+// resolveLeaderboardPeriod resolves a period type and key from a request.
+// An empty key is the current period, "previous" the one before it.
+func resolveLeaderboardPeriod(periodType, key string) (services.Period, error) {
+	loc := leaderboardLocation()
+
+	current, err := services.CurrentPeriod(periodType, time.Now(), loc)
+	if err != nil {
+		return services.Period{}, err
+	}
+
+	switch key {
+	case "", current.Key:
+		return current, nil
+	case "previous":
+		return services.PreviousPeriod(current, loc)
+	}
+
+	period, err := services.ParsePeriod(periodType, key, loc)
+	if err != nil {
+		return services.Period{}, err
+	}
+	if period.Start.After(current.Start) {
+		return services.Period{}, ErrLeaderboardPeriodNotFound
+	}
+	return period, nil
+}
+
+// findLeaderboardPeriod returns the snapshot record of a period
+func findLeaderboardPeriod(app core.App, period services.Period) (*core.Record, error) {
+	return app.FindFirstRecordByFilter(
+		"leaderboard_periods",
+		"periodType = {:type} && periodKey = {:key}",
+		map[string]any{"type": period.Type, "key": period.Key},
+	)
+}
+
+// loadLeaderboardPeriod returns a period's snapshot. The current and previous
+// periods are computed on demand if the cron job hasn't produced them yet;
+// older periods without a snapshot predate the leaderboard and are not found.
+func loadLeaderboardPeriod(app core.App, period services.Period) (*core.Record, error) {
+	record, err := findLeaderboardPeriod(app, period)
+	if err == nil {
+		return record, nil
+	}
+
+	loc := leaderboardLocation()
+	current, err := services.CurrentPeriod(period.Type, time.Now(), loc)
+	if err != nil {
+		return nil, err
+	}
+	if period.Key != current.Key {
+		previous, err := services.PreviousPeriod(current, loc)
+		if err != nil || period.Key != previous.Key {
+			return nil, ErrLeaderboardPeriodNotFound
+		}
+	}
+
+	return RefreshLeaderboard(app, period)
+}
+
+// RefreshLeaderboard recomputes a period's snapshot from xp_transactions.
+// Ended periods are marked finalized.
+func RefreshLeaderboard(app core.App, period services.Period) (*core.Record, error) {
+	var record *core.Record
+
+	err := app.RunInTransaction(func(txApp core.App) error {
+		var err error
+		record, err = findLeaderboardPeriod(txApp, period)
+		if err != nil {
+			collection, err := txApp.FindCollectionByNameOrId("leaderboard_periods")
+			if err != nil {
+				return err
+			}
+			record = core.NewRecord(collection)
+			record.Set("periodType", period.Type)
+			record.Set("periodKey", period.Key)
+			if !period.IsAllTime() {
+				record.Set("startsAt", period.Start)
+				record.Set("endsAt", period.End)
+			}
+			if err := txApp.Save(record); err != nil {
+				return err
+			}
+		}
+
+		if _, err := txApp.DB().
+			NewQuery("DELETE FROM leaderboard_entries WHERE period = {:period}").
+			Bind(dbx.Params{"period": record.Id}).
+			Execute(); err != nil {
+			return err
+		}
+
+		params := dbx.Params{"period": record.Id}
+		window := ""
+		if !period.IsAllTime() {
+			window = "AND t.created >= {:start} AND t.created < {:end}"
+			params["start"] = period.Start.UTC().Format(types.DefaultDateLayout)
+			params["end"] = period.End.UTC().Format(types.DefaultDateLayout)
+		}
+
+		// Users who earned no XP in the period, or who hid themselves, aren't ranked
+		if _, err := txApp.DB().NewQuery(`
+			INSERT INTO leaderboard_entries (id, period, user, xp, rank)
+			SELECT substr(lower(hex(randomblob(8))), 1, 15), {:period}, user, xp, RANK() OVER (ORDER BY xp DESC)
+			FROM (
+				SELECT t.user AS user, SUM(t.amount) AS xp
+				FROM xp_transactions t
+				JOIN users u ON u.id = t.user
+				WHERE u.leaderboardVisibility != 'hidden' ` + window + `
+				GROUP BY t.user
+				HAVING SUM(t.amount) > 0
+			)`).Bind(params).Execute(); err != nil {
+			return err
+		}
+
+		total, err := txApp.CountRecords("leaderboard_entries", dbx.HashExp{"period": record.Id})
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		record.Set("totalUsers", total)
+		record.Set("refreshedAt", now)
+		record.Set("finalized", !period.IsAllTime() && !now.Before(period.End))
+		return txApp.Save(record)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// refreshLeaderboards is the cron job: it refreshes the current weekly,
+// monthly and all-time snapshots and finalizes the periods that just ended
+func refreshLeaderboards(app core.App) {
+	loc := leaderboardLocation()
+
+	for _, periodType := range []string{services.PeriodWeekly, services.PeriodMonthly, services.PeriodAllTime} {
+		current, err := services.CurrentPeriod(periodType, time.Now(), loc)
+		if err != nil {
+			continue
+		}
+
+		if !current.IsAllTime() {
+			previous, err := services.PreviousPeriod(current, loc)
+			if err == nil {
+				existing, err := findLeaderboardPeriod(app, previous)
+				if err != nil || !existing.GetBool("finalized") {
+					if _, err := RefreshLeaderboard(app, previous); err != nil {
+						app.Logger().Error("Failed to finalize leaderboard", "period", previous.Type, "key", previous.Key, "error", err)
+					}
+				}
+			}
+		}
+
+		if _, err := RefreshLeaderboard(app, current); err != nil {
+			app.Logger().Error("Failed to refresh leaderboard", "period", current.Type, "key", current.Key, "error", err)
+		}
+	}
+}
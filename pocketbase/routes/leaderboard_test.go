@@ -0,0 +1,216 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"driveprep/services"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestLeaderboardHidesPseudonymousUserIDs(t *testing.T) {
+	app := newTestApp(t)
+	mux := newTestRouter(t, app, func(se *core.ServeEvent) {
+		RegisterLeaderboardRoutes(app, se)
+	})
+	app.Cron().Remove("leaderboardSnapshots")
+
+	viewer := newTestUser(t, app, "viewer@example.com", map[string]any{"name": "Viewer"})
+	public := newTestUser(t, app, "public@example.com", map[string]any{"name": "Public Learner"})
+	private := newTestUser(t, app, "private@example.com", map[string]any{"name": "Private Learner", "leaderboardVisibility": LeaderboardPseudonymous})
+	for i, user := range []*core.Record{viewer, public, private} {
+		if err := logXPTransaction(app, user.Id, 100*(i+1), "correct_answer", "", "question", "", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	period, err := services.CurrentPeriod(services.PeriodWeekly, time.Now(), leaderboardLocation())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RefreshLeaderboard(app, period); err != nil {
+		t.Fatal(err)
+	}
+
+	top := func() []LeaderboardEntry {
+		rec := serveTestRequest(t, mux, viewer, http.MethodGet, "/api/leaderboard?period="+services.PeriodWeekly, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("leaderboard: %d %s", rec.Code, rec.Body.String())
+		}
+		var response LeaderboardResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		return response.Entries
+	}
+
+	entries := top()
+	if len(entries) != 3 {
+		t.Fatalf("entries = %d, want 3", len(entries))
+	}
+	var pseudonymousID string
+	for _, entry := range entries {
+		switch {
+		case entry.Pseudonymous:
+			if entry.ID == "" || entry.ID == private.Id || strings.Contains(entry.ID, private.Id) {
+				t.Fatalf("pseudonymous entry ID = %q for user %q", entry.ID, private.Id)
+			}
+			if strings.Contains(entry.Name, "Private") {
+				t.Fatalf("pseudonymous entry name = %q", entry.Name)
+			}
+			pseudonymousID = entry.ID
+		case entry.ID != viewer.Id && entry.ID != public.Id:
+			t.Fatalf("public entry ID = %q, want a user ID", entry.ID)
+		}
+	}
+	if pseudonymousID == "" {
+		t.Fatal("no pseudonymous entry")
+	}
+
+	// Stable within the board, so clients can still key rows on it
+	for _, entry := range top() {
+		if entry.Pseudonymous && entry.ID != pseudonymousID {
+			t.Fatalf("pseudonymous ID changed from %q to %q", pseudonymousID, entry.ID)
+		}
+	}
+}
+
+func TestGroupHidesPseudonymousUserIDs(t *testing.T) {
+	app := newTestApp(t)
+	mux := newTestRouter(t, app, func(se *core.ServeEvent) {
+		RegisterGroupRoutes(app, se)
+	})
+
+	owner := newTestUser(t, app, "owner@example.com", map[string]any{"name": "Owner"})
+	public := newTestUser(t, app, "public@example.com", map[string]any{"name": "Public Learner"})
+	private := newTestUser(t, app, "private@example.com", map[string]any{"name": "Private Learner", "leaderboardVisibility": LeaderboardPseudonymous})
+
+	rec := serveTestRequest(t, mux, owner, http.MethodPost, "/api/groups", `{"name":"Study buddies"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create group: %d %s", rec.Code, rec.Body.String())
+	}
+	var group StudyGroup
+	if err := json.Unmarshal(rec.Body.Bytes(), &group); err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range []*core.Record{public, private} {
+		newTestRecord(t, app, "study_group_members", map[string]any{"studyGroup": group.ID, "user": user.Id, "role": GroupRoleMember})
+	}
+
+	rec = serveTestRequest(t, mux, public, http.MethodGet, "/api/groups/"+group.ID, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("get group: %d %s", rec.Code, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), private.Id) {
+		t.Fatalf("group response contains the pseudonymous member's user ID: %s", rec.Body.String())
+	}
+	var response struct {
+		Members []StudyGroupMember `json:"members"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	var pseudonymous *StudyGroupMember
+	for i, member := range response.Members {
+		if member.MemberID == "" {
+			t.Fatalf("member %+v has no member ID", member)
+		}
+		if member.UserID == "" {
+			pseudonymous = &response.Members[i]
+		}
+	}
+	if pseudonymous == nil {
+		t.Fatal("no member listed without a user ID")
+	}
+	// The pseudonym can't be worked out from the user ID either
+	if strings.Contains(pseudonymous.Name, "Private") || pseudonymous.Name == services.Pseudonym(private.Id) {
+		t.Fatalf("pseudonymous member name = %q", pseudonymous.Name)
+	}
+
+	// Users can't pick their own pseudonym key
+	key := reload(t, app, private).GetString("pseudonymKey")
+	if key == "" {
+		t.Fatal("user has no pseudonym key")
+	}
+	serveTestRequest(t, mux, private, http.MethodPatch, "/api/collections/users/records/"+private.Id, `{"pseudonymKey":"chosen"}`)
+	if got := reload(t, app, private).GetString("pseudonymKey"); got != key {
+		t.Fatalf("pseudonymKey = %q after PATCH, want %q", got, key)
+	}
+
+	// The owner removes them by membership ID
+	rec = serveTestRequest(t, mux, owner, http.MethodDelete, "/api/groups/"+group.ID+"/members/"+pseudonymous.MemberID, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("remove by member ID: %d %s", rec.Code, rec.Body.String())
+	}
+	if _, err := findGroupMembership(app, group.ID, private.Id); err == nil {
+		t.Fatal("pseudonymous member still in the group")
+	}
+}
+
+func TestDisplayNameHooksOutsideServe(t *testing.T) {
+	app := newTestApp(t)
+	RegisterDisplayNameHooks(app)
+
+	// No server running: an admin command renames a user
+	user := newTestUser(t, app, "renamed@example.com", nil)
+	user.Set("name", "Call 555-1234")
+	if err := app.Save(user); err == nil {
+		t.Fatal("saved a display name with a phone number")
+	}
+
+	user = reload(t, app, user)
+	user.Set("name", "Jane Doe")
+	if err := app.Save(user); err != nil {
+		t.Fatalf("rename to a clean name: %v", err)
+	}
+}
+
+func TestLeaderboardLookupOnlyFindsPublicUsers(t *testing.T) {
+	app := newTestApp(t)
+	mux := newTestRouter(t, app, func(se *core.ServeEvent) {
+		RegisterLeaderboardRoutes(app, se)
+	})
+	app.Cron().Remove("leaderboardSnapshots")
+
+	viewer := newTestUser(t, app, "viewer@example.com", map[string]any{"name": "Viewer"})
+	public := newTestUser(t, app, "public@example.com", map[string]any{"name": "Public Learner"})
+	private := newTestUser(t, app, "private@example.com", map[string]any{"name": "Private Learner", "leaderboardVisibility": LeaderboardPseudonymous})
+	hidden := newTestUser(t, app, "hidden@example.com", map[string]any{"name": "Hidden Learner", "leaderboardVisibility": LeaderboardHidden})
+	for _, user := range []*core.Record{viewer, public, private, hidden} {
+		if err := logXPTransaction(app, user.Id, 100, "correct_answer", "", "question", "", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	period, err := services.CurrentPeriod(services.PeriodWeekly, time.Now(), leaderboardLocation())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RefreshLeaderboard(app, period); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		viewer *core.Record
+		target *core.Record
+		want   int
+	}{
+		{viewer, public, http.StatusOK},
+		{viewer, private, http.StatusNotFound},
+		{viewer, hidden, http.StatusNotFound},
+		{private, private, http.StatusOK},
+		{hidden, hidden, http.StatusOK},
+	} {
+		for _, path := range []string{"/api/leaderboard/rank/", "/api/leaderboard/nearby/"} {
+			rec := serveTestRequest(t, mux, c.viewer, http.MethodGet, path+c.target.Id+"?period="+services.PeriodWeekly, "")
+			if rec.Code != c.want {
+				t.Errorf("%s looking up %s via %s: %d %s, want %d", c.viewer.Email(), c.target.Email(), path, rec.Code, rec.Body.String(), c.want)
+			}
+		}
+	}
+}
@@ -86,6 +86,11 @@ func RegisterLicenseRoutes(app core.App, se *core.ServeEvent) {
 
 		license := licenses[0]
 
+		// Organization licenses are used by joining the organization
+		if license.GetString("organization") != "" {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "This license belongs to an organization; join it with the organization's join code"})
+		}
+
 		// Check if license is revoked
 		if license.GetBool("isRevoked") {
 			return e.JSON(http.StatusForbidden, map[string]string{"error": "This license has been revoked"})
@@ -138,30 +143,7 @@ func RegisterLicenseRoutes(app core.App, se *core.ServeEvent) {
 		plan := license.GetString("plan")
 		licenseType := license.GetString("type")
 
-		authRecord.Set("isPremium", true)
-		authRecord.Set("premiumPlan", plan)
-
-		// Set expiration based on license type and plan
-		if licenseType == LicenseTypeLifetime || plan == PlanLifetime {
-			// Lifetime licenses don't expire
-			authRecord.Set("premiumExpiresAt", nil)
-		} else if !expiresAt.IsZero() {
-			authRecord.Set("premiumExpiresAt", expiresAt.Time())
-		} else {
-			// Default expiration based on plan
-			var expiration time.Time
-			switch plan {
-			case PlanMonthly:
-				expiration = time.Now().AddDate(0, 1, 0)
-			case PlanYearly:
-				expiration = time.Now().AddDate(1, 0, 0)
-			default:
-				expiration = time.Now().AddDate(0, 1, 0)
-			}
-			authRecord.Set("premiumExpiresAt", expiration)
-		}
-
-		if err := app.Save(authRecord); err != nil {
+		if _, err := syncPremium(app, authRecord); err != nil {
 			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update user status"})
 		}
 
@@ -194,15 +176,15 @@ func RegisterLicenseRoutes(app core.App, se *core.ServeEvent) {
 		if err != nil || len(licenses) == 0 {
 			return e.JSON(http.StatusOK, map[string]interface{}{
 				"hasLicense": false,
-				"isPremium":  authRecord.GetBool("isPremium"),
+				"isPremium":  userHasPremium(app, authRecord),
 			})
 		}
 
 		// Find the best active license
 		var bestLicense *core.Record
 		for _, lic := range licenses {
-			expiresAt := lic.GetDateTime("expiresAt")
-			if expiresAt.IsZero() || expiresAt.Time().After(time.Now()) {
+			expiresAt := licenseExpiry(lic)
+			if expiresAt.IsZero() || expiresAt.After(time.Now()) {
 				if bestLicense == nil {
 					bestLicense = lic
 				} else {
@@ -218,7 +200,7 @@ func RegisterLicenseRoutes(app core.App, se *core.ServeEvent) {
 		if bestLicense == nil {
 			return e.JSON(http.StatusOK, map[string]interface{}{
 				"hasLicense": false,
-				"isPremium":  authRecord.GetBool("isPremium"),
+				"isPremium":  userHasPremium(app, authRecord),
 			})
 		}
 
@@ -236,41 +218,17 @@ func RegisterLicenseRoutes(app core.App, se *core.ServeEvent) {
 
 	// Admin: Generate new licenses
 	se.Router.POST("/api/license/generate", func(e *core.RequestEvent) error {
-		authRecord := e.Auth
-		if authRecord == nil {
-			return e.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
-		}
-
-		// Check if user is admin (you may want to add an isAdmin field to users)
-		// For now, we'll check if they have a specific email domain or role
-		// In production, use proper admin authentication
-		if !isAdmin(authRecord) {
-			return e.JSON(http.StatusForbidden, map[string]string{"error": "Admin access required"})
-		}
-
 		var req struct {
-			Type           string                 `json:"type"`
-			Plan           string                 `json:"plan"`
-			Count          int                    `json:"count"`
-			MaxActivations int                    `json:"maxActivations"`
-			ExpiresAt      string                 `json:"expiresAt,omitempty"`
-			Notes          string                 `json:"notes,omitempty"`
-			Metadata       map[string]interface{} `json:"metadata,omitempty"`
+			licenseRequest
+			Count int `json:"count"`
 		}
 		if err := e.BindBody(&req); err != nil {
 			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
 		}
 
-		// Validate type
-		validTypes := map[string]bool{LicenseTypeLifetime: true, LicenseTypeEnterprise: true, LicenseTypePromo: true, LicenseTypeGift: true}
-		if !validTypes[req.Type] {
-			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid license type"})
-		}
-
-		// Validate plan
-		validPlans := map[string]bool{PlanMonthly: true, PlanYearly: true, PlanLifetime: true}
-		if !validPlans[req.Plan] {
-			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid plan"})
+		spec, ok := licenseSpecFromRequest(app, e, req.licenseRequest)
+		if !ok {
+			return nil
 		}
 
 		// Validate count
@@ -278,21 +236,6 @@ func RegisterLicenseRoutes(app core.App, se *core.ServeEvent) {
 			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Count must be between 1 and 100"})
 		}
 
-		// Default max activations
-		if req.MaxActivations < 1 {
-			req.MaxActivations = 1
-		}
-
-		// Parse expiration date
-		var expiresAt *time.Time
-		if req.ExpiresAt != "" {
-			parsed, err := time.Parse(time.RFC3339, req.ExpiresAt)
-			if err != nil {
-				return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid expiration date format"})
-			}
-			expiresAt = &parsed
-		}
-
 		// Get licenses collection
 		collection, err := app.FindCollectionByNameOrId("licenses")
 		if err != nil {
@@ -304,24 +247,7 @@ func RegisterLicenseRoutes(app core.App, se *core.ServeEvent) {
 		for i := 0; i < req.Count; i++ {
 			key := GenerateLicenseKey()
 
-			record := core.NewRecord(collection)
-			record.Set("key", key)
-			record.Set("type", req.Type)
-			record.Set("plan", req.Plan)
-			record.Set("maxActivations", req.MaxActivations)
-			record.Set("activations", 0)
-			record.Set("isActive", false)
-			record.Set("isRevoked", false)
-			record.Set("createdBy", authRecord.Id)
-			record.Set("notes", req.Notes)
-
-			if expiresAt != nil {
-				record.Set("expiresAt", *expiresAt)
-			}
-
-			if req.Metadata != nil {
-				record.Set("metadata", req.Metadata)
-			}
+			record := newLicenseRecord(collection, spec, key, actingUserID(e))
 
 			if err := app.Save(record); err != nil {
 				app.Logger().Error("Failed to create license", "error", err)
@@ -336,19 +262,10 @@ func RegisterLicenseRoutes(app core.App, se *core.ServeEvent) {
 			"count":    len(generatedKeys),
 			"licenses": generatedKeys,
 		})
-	}).Bind(RequireAuth(app))
+	}).Bind(RequireAuth(app), RequirePermission(app, PermissionLicenseAdmin))
 
 	// Admin: List licenses
 	se.Router.GET("/api/license/list", func(e *core.RequestEvent) error {
-		authRecord := e.Auth
-		if authRecord == nil {
-			return e.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
-		}
-
-		if !isAdmin(authRecord) {
-			return e.JSON(http.StatusForbidden, map[string]string{"error": "Admin access required"})
-		}
-
 		// Get query params
 		filter := e.Request.URL.Query().Get("filter") // "all", "active", "unused", "revoked"
 		licenseType := e.Request.URL.Query().Get("type")
@@ -367,7 +284,7 @@ func RegisterLicenseRoutes(app core.App, se *core.ServeEvent) {
 		case "active":
 			filterQuery += " && isActive = true && isRevoked = false"
 		case "unused":
-			filterQuery += " && user = '' && isRevoked = false"
+			filterQuery += " && user = '' && organization = '' && isRevoked = false"
 		case "revoked":
 			filterQuery += " && isRevoked = true"
 		}
@@ -377,6 +294,16 @@ func RegisterLicenseRoutes(app core.App, se *core.ServeEvent) {
 			params["type"] = licenseType
 		}
 
+		if organization := e.Request.URL.Query().Get("organization"); organization != "" {
+			filterQuery += " && organization = {:organization}"
+			params["organization"] = organization
+		}
+
+		if batch := e.Request.URL.Query().Get("batch"); batch != "" {
+			filterQuery += " && batch = {:batch}"
+			params["batch"] = batch
+		}
+
 		licenses, err := app.FindRecordsByFilter(
 			"licenses",
 			filterQuery,
@@ -398,6 +325,9 @@ func RegisterLicenseRoutes(app core.App, se *core.ServeEvent) {
 				"type":           lic.GetString("type"),
 				"plan":           lic.GetString("plan"),
 				"user":           lic.GetString("user"),
+				"organization":   lic.GetString("organization"),
+				"seats":          lic.GetInt("seats"),
+				"batch":          lic.GetString("batch"),
 				"isActive":       lic.GetBool("isActive"),
 				"isRevoked":      lic.GetBool("isRevoked"),
 				"activations":    lic.GetInt("activations"),
@@ -412,19 +342,10 @@ func RegisterLicenseRoutes(app core.App, se *core.ServeEvent) {
 			"licenses": result,
 			"count":    len(result),
 		})
-	}).Bind(RequireAuth(app))
+	}).Bind(RequireAuth(app), RequirePermission(app, PermissionLicenseAdmin, PermissionSupport))
 
 	// Admin: Revoke a license
 	se.Router.POST("/api/license/revoke", func(e *core.RequestEvent) error {
-		authRecord := e.Auth
-		if authRecord == nil {
-			return e.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
-		}
-
-		if !isAdmin(authRecord) {
-			return e.JSON(http.StatusForbidden, map[string]string{"error": "Admin access required"})
-		}
-
 		var req struct {
 			LicenseId string `json:"licenseId"`
 			Reason    string `json:"reason,omitempty"`
@@ -438,53 +359,177 @@ func RegisterLicenseRoutes(app core.App, se *core.ServeEvent) {
 			return e.JSON(http.StatusNotFound, map[string]string{"error": "License not found"})
 		}
 
-		license.Set("isRevoked", true)
-		license.Set("isActive", false)
+		if err := revokeLicense(app, license, req.Reason); err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to revoke license"})
+		}
 
-		// Add revocation note
-		notes := license.GetString("notes")
-		if notes != "" {
-			notes += "\n"
+		return e.JSON(http.StatusOK, map[string]interface{}{
+			"success": true,
+			"message": "License revoked successfully",
+		})
+	}).Bind(RequireAuth(app), RequirePermission(app, PermissionLicenseAdmin))
+}
+
+// licenseRequest is the request body shared by single and batch license generation
+type licenseRequest struct {
+	Type           string                 `json:"type"`
+	Plan           string                 `json:"plan"`
+	MaxActivations int                    `json:"maxActivations"`
+	ExpiresAt      string                 `json:"expiresAt,omitempty"`
+	Notes          string                 `json:"notes,omitempty"`
+	Metadata       map[string]interface{} `json:"metadata,omitempty"`
+	Organization   string                 `json:"organization,omitempty"` // Enterprise only
+	Seats          int                    `json:"seats,omitempty"`        // Students covered by an organization license
+}
+
+// licenseSpec holds the validated terms new licenses are generated with
+type licenseSpec struct {
+	Type           string
+	Plan           string
+	MaxActivations int
+	ExpiresAt      *time.Time
+	Notes          string
+	Metadata       map[string]interface{}
+	Organization   string
+	Seats          int
+	Batch          string
+}
+
+// licenseSpecFromRequest validates the license terms in a generate request.
+// It writes the error response itself and reports whether the caller may continue.
+func licenseSpecFromRequest(app core.App, e *core.RequestEvent, req licenseRequest) (*licenseSpec, bool) {
+	// Validate type
+	validTypes := map[string]bool{LicenseTypeLifetime: true, LicenseTypeEnterprise: true, LicenseTypePromo: true, LicenseTypeGift: true}
+	if !validTypes[req.Type] {
+		e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid license type"})
+		return nil, false
+	}
+
+	// Validate plan
+	validPlans := map[string]bool{PlanMonthly: true, PlanYearly: true, PlanLifetime: true}
+	if !validPlans[req.Plan] {
+		e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid plan"})
+		return nil, false
+	}
+
+	// Organization licenses are enterprise licenses with a seat count
+	if req.Organization != "" {
+		if req.Type != LicenseTypeEnterprise {
+			e.JSON(http.StatusBadRequest, map[string]string{"error": "Only enterprise licenses can belong to an organization"})
+			return nil, false
+		}
+		if req.Seats < 1 || req.Seats > MaxOrgSeats {
+			e.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Seats must be between 1 and %d", MaxOrgSeats)})
+			return nil, false
+		}
+		if _, err := app.FindRecordById("organizations", req.Organization); err != nil {
+			e.JSON(http.StatusNotFound, map[string]string{"error": "Organization not found"})
+			return nil, false
 		}
-		notes += fmt.Sprintf("[%s] Revoked by admin: %s", time.Now().Format(time.RFC3339), req.Reason)
-		license.Set("notes", notes)
+	} else if req.Seats != 0 {
+		e.JSON(http.StatusBadRequest, map[string]string{"error": "Seats require an organization"})
+		return nil, false
+	}
 
-		if err := app.Save(license); err != nil {
-			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to revoke license"})
+	spec := &licenseSpec{
+		Type:           req.Type,
+		Plan:           req.Plan,
+		MaxActivations: req.MaxActivations,
+		Notes:          req.Notes,
+		Metadata:       req.Metadata,
+		Organization:   req.Organization,
+		Seats:          req.Seats,
+	}
+
+	// Default max activations
+	if spec.MaxActivations < 1 {
+		spec.MaxActivations = 1
+	}
+
+	// Parse expiration date
+	if req.ExpiresAt != "" {
+		parsed, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil {
+			e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid expiration date format"})
+			return nil, false
 		}
+		spec.ExpiresAt = &parsed
+	}
 
-		// If license was redeemed, update user's premium status
-		userId := license.GetString("user")
-		if userId != "" {
-			user, err := app.FindRecordById("users", userId)
-			if err == nil {
-				// Check if user has other active licenses
-				otherLicenses, _ := app.FindRecordsByFilter(
-					"licenses",
-					"user = {:userId} && isActive = true && isRevoked = false && id != {:licenseId}",
-					"",
-					1,
-					0,
-					map[string]any{"userId": userId, "licenseId": req.LicenseId},
-				)
-
-				if len(otherLicenses) == 0 {
-					// No other licenses, check if they have Stripe subscription
-					if user.GetString("stripeSubscriptionId") == "" {
-						user.Set("isPremium", false)
-						user.Set("premiumPlan", "free")
-						user.Set("premiumExpiresAt", nil)
-						app.Save(user)
-					}
-				}
+	return spec, true
+}
+
+// newLicenseRecord builds an unsaved license record for the given key
+func newLicenseRecord(collection *core.Collection, spec *licenseSpec, key, createdBy string) *core.Record {
+	record := core.NewRecord(collection)
+	record.Set("key", key)
+	record.Set("type", spec.Type)
+	record.Set("plan", spec.Plan)
+	record.Set("maxActivations", spec.MaxActivations)
+	record.Set("activations", 0)
+	record.Set("isActive", false)
+	record.Set("isRevoked", false)
+	record.Set("createdBy", createdBy)
+	record.Set("notes", spec.Notes)
+
+	// Organization licenses are active as soon as they're issued
+	if spec.Organization != "" {
+		record.Set("organization", spec.Organization)
+		record.Set("seats", spec.Seats)
+		record.Set("isActive", true)
+	}
+
+	if spec.Batch != "" {
+		record.Set("batch", spec.Batch)
+	}
+
+	if spec.ExpiresAt != nil {
+		record.Set("expiresAt", *spec.ExpiresAt)
+	}
+
+	if spec.Metadata != nil {
+		record.Set("metadata", spec.Metadata)
+	}
+
+	return record
+}
+
+// revokeLicense revokes a license and takes premium away from whoever it covered
+func revokeLicense(app core.App, license *core.Record, reason string) error {
+	license.Set("isRevoked", true)
+	license.Set("isActive", false)
+
+	// Add revocation note
+	notes := license.GetString("notes")
+	if notes != "" {
+		notes += "\n"
+	}
+	notes += fmt.Sprintf("[%s] Revoked by admin: %s", time.Now().Format(time.RFC3339), reason)
+	license.Set("notes", notes)
+
+	if err := app.Save(license); err != nil {
+		return err
+	}
+
+	// If license was redeemed, update user's premium status
+	userId := license.GetString("user")
+	if userId != "" {
+		user, err := app.FindRecordById("users", userId)
+		if err == nil {
+			if _, err := syncPremium(app, user); err != nil {
+				app.Logger().Error("Failed to update premium after license revoke", "error", err)
 			}
 		}
+	}
 
-		return e.JSON(http.StatusOK, map[string]interface{}{
-			"success": true,
-			"message": "License revoked successfully",
-		})
-	}).Bind(RequireAuth(app))
+	// An organization license takes its seats with it
+	if orgId := license.GetString("organization"); orgId != "" {
+		if err := releaseOrgSeats(app, orgId); err != nil {
+			app.Logger().Error("Failed to update students after organization license revoke", "error", err)
+		}
+	}
+
+	return nil
 }
 
 // GenerateLicenseKey generates a new license key with checksum
@@ -609,19 +654,3 @@ func hashIP(ip string) string {
 	hash := sha256.Sum256([]byte(ip + "DriveOntarioIPSalt"))
 	return hex.EncodeToString(hash[:8]) // Only use first 8 bytes
 }
-
-// isAdmin checks if a user has admin privileges
-func isAdmin(user *core.Record) bool {
-	// Check for admin email domain
-	email := user.GetString("email")
-	if strings.HasSuffix(email, "@driveontario.com") {
-		return true
-	}
-
-	// Check for isAdmin field if it exists
-	if user.GetBool("isAdmin") {
-		return true
-	}
-
-	return false
-}
@@ -0,0 +1,518 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// License batches are named runs of generated keys, usually printed for a
+// partner school or reseller. Every key remembers its batch so a whole run
+// can be exported, revoked or extended at once, and so we can see how many
+// of a partner's keys have actually been redeemed.
+
+const (
+	// MaxLicenseBatchSize is the most keys a single batch can hold
+	MaxLicenseBatchSize = 5000
+	// licenseKeyAttempts is how many keys we try before giving up on a slot
+	licenseKeyAttempts = 3
+)
+
+// License statuses as reported in batch exports
+const (
+	LicenseStatusUnused   = "unused"
+	LicenseStatusRedeemed = "redeemed"
+	LicenseStatusExpired  = "expired"
+	LicenseStatusRevoked  = "revoked"
+)
+
+// LicenseBatchStats summarizes what happened to the keys of a batch
+type LicenseBatchStats struct {
+	Total          int     `json:"total"`
+	Redeemed       int     `json:"redeemed"` // Keys redeemed at some point, including later revoked ones
+	Unused         int     `json:"unused"`   // Keys that can still be redeemed
+	Expired        int     `json:"expired"`  // Keys that expired before anyone redeemed them
+	Revoked        int     `json:"revoked"`
+	Activations    int     `json:"activations"`
+	RedemptionRate float64 `json:"redemptionRate"` // Share of keys redeemed, 0-1
+	LastRedeemedAt string  `json:"lastRedeemedAt,omitempty"`
+}
+
+// LicenseBatch is a batch of license keys as shown to admins
+type LicenseBatch struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Partner   string            `json:"partner,omitempty"`
+	Notes     string            `json:"notes,omitempty"`
+	Type      string            `json:"type"`
+	Plan      string            `json:"plan"`
+	Count     int               `json:"count"`
+	CreatedBy string            `json:"createdBy,omitempty"`
+	RevokedAt string            `json:"revokedAt,omitempty"`
+	Created   string            `json:"created"`
+	Stats     LicenseBatchStats `json:"stats"`
+}
+
+// licenseBatchStatsRow is one row of the per-batch aggregate query
+type licenseBatchStatsRow struct {
+	Batch          string `db:"batch"`
+	Total          int    `db:"total"`
+	Redeemed       int    `db:"redeemed"`
+	Unused         int    `db:"unused"`
+	Expired        int    `db:"expired"`
+	Revoked        int    `db:"revoked"`
+	Activations    int    `db:"activations"`
+	LastRedeemedAt string `db:"lastRedeemedAt"`
+}
+
+var csvFilenameUnsafe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// RegisterLicenseBatchRoutes registers the admin license batch API routes
+func RegisterLicenseBatchRoutes(app core.App, se *core.ServeEvent) {
+	// Admin: generate a named batch of licenses
+	se.Router.POST("/api/license/batches", func(e *core.RequestEvent) error {
+		var req struct {
+			licenseRequest
+			Name    string `json:"name"`
+			Partner string `json:"partner,omitempty"`
+			Count   int    `json:"count"`
+		}
+		if err := e.BindBody(&req); err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		req.Partner = strings.TrimSpace(req.Partner)
+		if req.Name == "" || len(req.Name) > 120 {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Batch name must be 1-120 characters"})
+		}
+		if len(req.Partner) > 120 {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Partner must be at most 120 characters"})
+		}
+
+		spec, ok := licenseSpecFromRequest(app, e, req.licenseRequest)
+		if !ok {
+			return nil
+		}
+
+		if req.Count < 1 || req.Count > MaxLicenseBatchSize {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Count must be between 1 and %d", MaxLicenseBatchSize)})
+		}
+
+		batchesCollection, err := app.FindCollectionByNameOrId("license_batches")
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "License batches collection not found"})
+		}
+		licensesCollection, err := app.FindCollectionByNameOrId("licenses")
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Licenses collection not found"})
+		}
+
+		batch := core.NewRecord(batchesCollection)
+		batch.Set("name", req.Name)
+		batch.Set("partner", req.Partner)
+		batch.Set("notes", req.Notes)
+		batch.Set("type", spec.Type)
+		batch.Set("plan", spec.Plan)
+		batch.Set("count", req.Count)
+		batch.Set("createdBy", actingUserID(e))
+
+		// A batch is all or nothing, so a partner never gets a short print run
+		err = app.RunInTransaction(func(txApp core.App) error {
+			if err := txApp.Save(batch); err != nil {
+				return err
+			}
+			spec.Batch = batch.Id
+
+			for i := 0; i < req.Count; i++ {
+				var saveErr error
+				for attempt := 0; attempt < licenseKeyAttempts; attempt++ {
+					record := newLicenseRecord(licensesCollection, spec, GenerateLicenseKey(), actingUserID(e))
+					if saveErr = txApp.Save(record); saveErr == nil {
+						break
+					}
+				}
+				if saveErr != nil {
+					return saveErr
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			app.Logger().Error("Failed to generate license batch", "error", err)
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate license batch"})
+		}
+
+		result, err := licenseBatchFor(app, batch)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load license batch"})
+		}
+
+		return e.JSON(http.StatusOK, result)
+	}).Bind(RequireAuth(app), RequirePermission(app, PermissionLicenseAdmin))
+
+	// Admin: list batches with their redemption stats
+	se.Router.GET("/api/license/batches", func(e *core.RequestEvent) error {
+		limit := 50
+		if l := parseInt(e.Request.URL.Query().Get("limit")); l > 0 && l <= 200 {
+			limit = l
+		}
+
+		filterQuery := "1=1"
+		params := map[string]any{}
+		if partner := e.Request.URL.Query().Get("partner"); partner != "" {
+			filterQuery += " && partner = {:partner}"
+			params["partner"] = partner
+		}
+
+		batches, err := app.FindRecordsByFilter("license_batches", filterQuery, "-created", limit, 0, params)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch license batches"})
+		}
+
+		ids := make([]string, len(batches))
+		for i, batch := range batches {
+			ids[i] = batch.Id
+		}
+		stats, err := licenseBatchStats(app, ids...)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to calculate batch stats"})
+		}
+
+		result := make([]LicenseBatch, len(batches))
+		for i, batch := range batches {
+			result[i] = licenseBatchFromRecord(batch, stats[batch.Id])
+		}
+
+		return e.JSON(http.StatusOK, map[string]interface{}{
+			"batches": result,
+			"count":   len(result),
+		})
+	}).Bind(RequireAuth(app), RequirePermission(app, PermissionLicenseAdmin, PermissionSupport))
+
+	// Admin: a single batch with its redemption stats
+	se.Router.GET("/api/license/batches/{id}", func(e *core.RequestEvent) error {
+		batch, err := app.FindRecordById("license_batches", e.Request.PathValue("id"))
+		if err != nil {
+			return e.JSON(http.StatusNotFound, map[string]string{"error": "License batch not found"})
+		}
+
+		result, err := licenseBatchFor(app, batch)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to calculate batch stats"})
+		}
+
+		return e.JSON(http.StatusOK, result)
+	}).Bind(RequireAuth(app), RequirePermission(app, PermissionLicenseAdmin, PermissionSupport))
+
+	// Admin: export a batch's keys as CSV for printing
+	se.Router.GET("/api/license/batches/{id}/export.csv", func(e *core.RequestEvent) error {
+		batch, err := app.FindRecordById("license_batches", e.Request.PathValue("id"))
+		if err != nil {
+			return e.JSON(http.StatusNotFound, map[string]string{"error": "License batch not found"})
+		}
+
+		licenses, err := app.FindRecordsByFilter(
+			"licenses",
+			"batch = {:batch}",
+			"created,key",
+			0,
+			0,
+			map[string]any{"batch": batch.Id},
+		)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch licenses"})
+		}
+
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write([]string{"key", "batch", "partner", "type", "plan", "expires_at", "status", "redeemed_at"})
+		now := time.Now()
+		for _, lic := range licenses {
+			w.Write([]string{
+				lic.GetString("key"),
+				batch.GetString("name"),
+				batch.GetString("partner"),
+				lic.GetString("type"),
+				lic.GetString("plan"),
+				formatAPIDate(lic.GetDateTime("expiresAt")),
+				licenseStatus(lic, now),
+				formatAPIDate(lic.GetDateTime("redeemedAt")),
+			})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to export licenses"})
+		}
+
+		e.Response.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, licenseBatchFilename(batch)))
+		return e.Blob(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+	}).Bind(RequireAuth(app), RequirePermission(app, PermissionLicenseAdmin))
+
+	// Admin: revoke every key in a batch
+	se.Router.POST("/api/license/batches/{id}/revoke", func(e *core.RequestEvent) error {
+		var req struct {
+			Reason string `json:"reason,omitempty"`
+		}
+		if err := e.BindBody(&req); err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+
+		batch, err := app.FindRecordById("license_batches", e.Request.PathValue("id"))
+		if err != nil {
+			return e.JSON(http.StatusNotFound, map[string]string{"error": "License batch not found"})
+		}
+
+		revoked := 0
+		err = app.RunInTransaction(func(txApp core.App) error {
+			licenses, err := txApp.FindRecordsByFilter(
+				"licenses",
+				"batch = {:batch} && isRevoked = false",
+				"",
+				0,
+				0,
+				map[string]any{"batch": batch.Id},
+			)
+			if err != nil {
+				return err
+			}
+
+			for _, license := range licenses {
+				if err := revokeLicense(txApp, license, req.Reason); err != nil {
+					return err
+				}
+				revoked++
+			}
+
+			batch.Set("revokedAt", types.NowDateTime())
+			return txApp.Save(batch)
+		})
+		if err != nil {
+			app.Logger().Error("Failed to revoke license batch", "batch", batch.Id, "error", err)
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to revoke license batch"})
+		}
+
+		return e.JSON(http.StatusOK, map[string]interface{}{
+			"success": true,
+			"revoked": revoked,
+		})
+	}).Bind(RequireAuth(app), RequirePermission(app, PermissionLicenseAdmin))
+
+	// Admin: push back the expiry of every key in a batch
+	se.Router.POST("/api/license/batches/{id}/extend", func(e *core.RequestEvent) error {
+		var req struct {
+			ExpiresAt string `json:"expiresAt,omitempty"` // New expiry for every key
+			Days      int    `json:"days,omitempty"`      // Or days added to each key's own expiry
+		}
+		if err := e.BindBody(&req); err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+
+		if (req.ExpiresAt == "") == (req.Days == 0) {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Provide either expiresAt or days"})
+		}
+		if req.Days < 0 || req.Days > 3650 {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Days must be between 1 and 3650"})
+		}
+
+		var newExpiry time.Time
+		if req.ExpiresAt != "" {
+			parsed, err := time.Parse(time.RFC3339, req.ExpiresAt)
+			if err != nil {
+				return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid expiration date format"})
+			}
+			if !parsed.After(time.Now()) {
+				return e.JSON(http.StatusBadRequest, map[string]string{"error": "Expiration date must be in the future"})
+			}
+			newExpiry = parsed
+		}
+
+		batch, err := app.FindRecordById("license_batches", e.Request.PathValue("id"))
+		if err != nil {
+			return e.JSON(http.StatusNotFound, map[string]string{"error": "License batch not found"})
+		}
+
+		extended := 0
+		err = app.RunInTransaction(func(txApp core.App) error {
+			// Keys without an expiry never expire, so there is nothing to extend
+			licenses, err := txApp.FindRecordsByFilter(
+				"licenses",
+				"batch = {:batch} && isRevoked = false && expiresAt != ''",
+				"",
+				0,
+				0,
+				map[string]any{"batch": batch.Id},
+			)
+			if err != nil {
+				return err
+			}
+
+			organizations := map[string]bool{}
+			for _, license := range licenses {
+				current := license.GetDateTime("expiresAt").Time()
+				expiry := newExpiry
+				if req.Days > 0 {
+					expiry = current.AddDate(0, 0, req.Days)
+				}
+				// Extending never shortens a key
+				if !expiry.After(current) {
+					continue
+				}
+
+				license.Set("expiresAt", expiry)
+				if err := txApp.Save(license); err != nil {
+					return err
+				}
+				extended++
+
+				if userId := license.GetString("user"); userId != "" {
+					user, err := txApp.FindRecordById("users", userId)
+					if err == nil {
+						if _, err := syncPremium(txApp, user); err != nil {
+							return err
+						}
+					}
+				}
+				if orgId := license.GetString("organization"); orgId != "" {
+					organizations[orgId] = true
+				}
+			}
+
+			for orgId := range organizations {
+				if err := extendOrgSeats(txApp, orgId); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			app.Logger().Error("Failed to extend license batch", "batch", batch.Id, "error", err)
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to extend license batch"})
+		}
+
+		return e.JSON(http.StatusOK, map[string]interface{}{
+			"success":  true,
+			"extended": extended,
+		})
+	}).Bind(RequireAuth(app), RequirePermission(app, PermissionLicenseAdmin))
+}
+
+// licenseBatchFor loads the stats of a single batch
+func licenseBatchFor(app core.App, batch *core.Record) (LicenseBatch, error) {
+	stats, err := licenseBatchStats(app, batch.Id)
+	if err != nil {
+		return LicenseBatch{}, err
+	}
+	return licenseBatchFromRecord(batch, stats[batch.Id]), nil
+}
+
+func licenseBatchFromRecord(batch *core.Record, stats LicenseBatchStats) LicenseBatch {
+	return LicenseBatch{
+		ID:        batch.Id,
+		Name:      batch.GetString("name"),
+		Partner:   batch.GetString("partner"),
+		Notes:     batch.GetString("notes"),
+		Type:      batch.GetString("type"),
+		Plan:      batch.GetString("plan"),
+		Count:     batch.GetInt("count"),
+		CreatedBy: batch.GetString("createdBy"),
+		RevokedAt: formatAPIDate(batch.GetDateTime("revokedAt")),
+		Created:   formatAPIDate(batch.GetDateTime("created")),
+		Stats:     stats,
+	}
+}
+
+// licenseBatchStats aggregates the keys of the given batches in one query
+func licenseBatchStats(app core.App, batchIDs ...string) (map[string]LicenseBatchStats, error) {
+	result := make(map[string]LicenseBatchStats, len(batchIDs))
+	if len(batchIDs) == 0 {
+		return result, nil
+	}
+
+	ids := make([]interface{}, len(batchIDs))
+	for i, id := range batchIDs {
+		ids[i] = id
+	}
+
+	var rows []licenseBatchStatsRow
+	err := app.DB().
+		Select(
+			"batch",
+			"COUNT(*) AS total",
+			"COALESCE(SUM(user != ''), 0) AS redeemed",
+			"COALESCE(SUM(user = '' AND isRevoked = 0 AND (expiresAt = '' OR expiresAt > {:now})), 0) AS unused",
+			"COALESCE(SUM(user = '' AND isRevoked = 0 AND expiresAt != '' AND expiresAt <= {:now}), 0) AS expired",
+			"COALESCE(SUM(isRevoked = 1), 0) AS revoked",
+			"COALESCE(SUM(activations), 0) AS activations",
+			"COALESCE(MAX(redeemedAt), '') AS lastRedeemedAt",
+		).
+		From("licenses").
+		Where(dbx.In("batch", ids...)).
+		GroupBy("batch").
+		Bind(dbx.Params{"now": types.NowDateTime().String()}).
+		All(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		stats := LicenseBatchStats{
+			Total:       row.Total,
+			Redeemed:    row.Redeemed,
+			Unused:      row.Unused,
+			Expired:     row.Expired,
+			Revoked:     row.Revoked,
+			Activations: row.Activations,
+		}
+		if row.Total > 0 {
+			stats.RedemptionRate = float64(row.Redeemed) / float64(row.Total)
+		}
+		if lastRedeemedAt, err := types.ParseDateTime(row.LastRedeemedAt); err == nil {
+			stats.LastRedeemedAt = formatAPIDate(lastRedeemedAt)
+		}
+		result[row.Batch] = stats
+	}
+	return result, nil
+}
+
+// licenseStatus is the state of a single key as reported in batch exports
+func licenseStatus(license *core.Record, now time.Time) string {
+	switch {
+	case license.GetBool("isRevoked"):
+		return LicenseStatusRevoked
+	case license.GetString("user") != "":
+		return LicenseStatusRedeemed
+	}
+	expiresAt := license.GetDateTime("expiresAt")
+	if !expiresAt.IsZero() && !expiresAt.Time().After(now) {
+		return LicenseStatusExpired
+	}
+	return LicenseStatusUnused
+}
+
+// licenseBatchFilename turns a batch name into a safe CSV file name
+func licenseBatchFilename(batch *core.Record) string {
+	slug := strings.Trim(csvFilenameUnsafe.ReplaceAllString(strings.ToLower(batch.GetString("name")), "-"), "-")
+	if slug == "" {
+		slug = batch.Id
+	}
+	return "licenses-" + slug + ".csv"
+}
+
+// extendOrgSeats gives an organization's students the terms of its
+// longest-lasting license after that license was extended
+func extendOrgSeats(app core.App, orgID string) error {
+	_, best, err := orgSeats(app, orgID)
+	if err != nil || best == nil {
+		return err
+	}
+	return syncOrgStudents(app, orgID)
+}
@@ -1,6 +1,8 @@
 package routes
 
 import (
+	"net/http"
+
 	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/tools/hook"
@@ -10,3 +12,24 @@ import (
 func RequireAuth(app core.App) *hook.Handler[*core.RequestEvent] {
 	return apis.RequireAuth()
 }
+
+// RequirePermission returns a middleware that requires an authenticated
+// user holding at least one of the given permissions. Superusers hold every
+// permission.
+func RequirePermission(app core.App, permissions ...Permission) *hook.Handler[*core.RequestEvent] {
+	return &hook.Handler[*core.RequestEvent]{
+		Func: func(e *core.RequestEvent) error {
+			if e.Auth == nil {
+				return e.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+			}
+
+			for _, permission := range permissions {
+				if hasPermission(e, permission) {
+					return e.Next()
+				}
+			}
+
+			return e.JSON(http.StatusForbidden, map[string]string{"error": "Admin access required"})
+		},
+	}
+}
@@ -1,13 +1,10 @@
 package routes
 
 import (
-	"crypto/hmac"
 	"crypto/rand"
-	"crypto/sha256"
 	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"net/http"
-	"os"
 	"time"
 
 	"driveprep/services"
@@ -20,11 +17,14 @@ const (
 	DefaultOfflineTokenDays = 7
 	// Maximum offline token validity period
 	MaxOfflineTokenDays = 30
+	// Max offline tokens issued to a user in 24 hours
+	MaxOfflineTokensPerDay = 10
 )
 
-// OfflineTokenClaims represents the claims in an offline token
+// OfflineTokenClaims represents the claims in an offline token, which is
+// a compact JWS signed by services.OfflineSigner
 type OfflineTokenClaims struct {
-	UserId       string   `json:"uid"`
+	UserId       string   `json:"sub"`
 	Email        string   `json:"email"`
 	IsPremium    bool     `json:"premium"`
 	Plan         string   `json:"plan"`
@@ -35,14 +35,22 @@ type OfflineTokenClaims struct {
 	TokenId      string   `json:"jti"` // Unique token ID for revocation
 }
 
-// OfflineToken represents the full token with signature
-type OfflineToken struct {
-	Claims    OfflineTokenClaims `json:"claims"`
-	Signature string             `json:"sig"`
-}
+// RegisterOfflineRoutes registers all offline-related API routes. It fails
+// when no offline signing key is configured.
+func RegisterOfflineRoutes(app core.App, se *core.ServeEvent) error {
+	signer, err := services.NewOfflineSigner()
+	if err != nil {
+		return err
+	}
+
+	// Public keys clients verify offline tokens with, by key ID
+	se.Router.GET("/api/offline/keys", func(e *core.RequestEvent) error {
+		e.Response.Header().Set("Cache-Control", "public, max-age=3600")
+		return e.JSON(http.StatusOK, map[string]interface{}{
+			"keys": signer.PublicKeys(),
+		})
+	})
 
-// RegisterOfflineRoutes registers all offline-related API routes
-func RegisterOfflineRoutes(app core.App, se *core.ServeEvent) {
 	// Get offline token for offline access
 	se.Router.POST("/api/offline/token", func(e *core.RequestEvent) error {
 		authRecord := e.Auth
@@ -53,6 +61,7 @@ func RegisterOfflineRoutes(app core.App, se *core.ServeEvent) {
 		var req struct {
 			ValidDays         int    `json:"validDays,omitempty"`
 			DeviceFingerprint string `json:"deviceFingerprint,omitempty"`
+			DeviceName        string `json:"deviceName,omitempty"`
 		}
 		if err := e.BindBody(&req); err != nil {
 			// Use defaults if no body
@@ -68,8 +77,12 @@ func RegisterOfflineRoutes(app core.App, se *core.ServeEvent) {
 		}
 
 		// Check if user is premium (offline mode requires premium)
-		isPremium := authRecord.GetBool("isPremium")
-		plan := authRecord.GetString("premiumPlan")
+		entitlement, err := ResolveEntitlement(app, authRecord)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check premium access"})
+		}
+		isPremium := entitlement.Premium
+		plan := entitlement.Plan
 
 		// Free users get limited offline access
 		maxQuestions := 20                             // Free tier
@@ -105,30 +118,32 @@ func RegisterOfflineRoutes(app core.App, se *core.ServeEvent) {
 		}
 
 		// Sign the token
-		signature, err := signClaims(claims)
+		token, err := signer.Sign(services.OfflineTokenType, claims)
 		if err != nil {
 			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate token"})
 		}
 
-		token := OfflineToken{
-			Claims:    claims,
-			Signature: signature,
+		// Register the token so it can be listed and revoked
+		if len(req.DeviceName) > 120 {
+			req.DeviceName = req.DeviceName[:120]
+		}
+		tokenRecord, err := recordOfflineToken(app, e, claims, req.DeviceFingerprint, req.DeviceName)
+		if errors.Is(err, errOfflineTokenLimit) {
+			return e.JSON(http.StatusTooManyRequests, map[string]string{"error": "Too many offline tokens issued today. Try again later."})
 		}
-
-		// Encode to base64 for easy storage
-		tokenBytes, err := json.Marshal(token)
 		if err != nil {
-			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to encode token"})
+			app.Logger().Error("Failed to record offline token", "error", err)
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate token"})
 		}
 
-		encodedToken := base64.StdEncoding.EncodeToString(tokenBytes)
-
-		// Generate encryption key for client-side storage
-		encryptionKey := generateEncryptionKey(authRecord.Id, req.DeviceFingerprint)
+		// Key the device decrypts its content packs with
+		encryptionKey := generateEncryptionKey(signer, tokenRecord)
 
 		return e.JSON(http.StatusOK, map[string]interface{}{
-			"token":         encodedToken,
+			"token":         token,
+			"keyId":         signer.KeyID(),
 			"encryptionKey": encryptionKey,
+			"logKey":        base64.StdEncoding.EncodeToString(offlineLogKey(signer, tokenRecord)),
 			"expiresAt":     claims.ExpiresAt,
 			"validDays":     req.ValidDays,
 			"maxQuestions":  maxQuestions,
@@ -139,186 +154,72 @@ func RegisterOfflineRoutes(app core.App, se *core.ServeEvent) {
 	// Validate an offline token
 	se.Router.POST("/api/offline/validate", func(e *core.RequestEvent) error {
 		var req struct {
-			Token string `json:"token"`
+			Token             string `json:"token"`
+			DeviceFingerprint string `json:"deviceFingerprint,omitempty"`
 		}
 		if err := e.BindBody(&req); err != nil {
 			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Token required"})
 		}
 
-		// Decode token
-		tokenBytes, err := base64.StdEncoding.DecodeString(req.Token)
-		if err != nil {
-			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid token format"})
-		}
-
-		var token OfflineToken
-		if err := json.Unmarshal(tokenBytes, &token); err != nil {
-			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid token"})
-		}
-
 		// Verify signature
-		expectedSig, err := signClaims(token.Claims)
-		if err != nil || expectedSig != token.Signature {
+		var claims OfflineTokenClaims
+		if err := signer.Verify(services.OfflineTokenType, req.Token, &claims); err != nil {
 			return e.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid token signature"})
 		}
 
 		// Check expiration
-		if time.Now().Unix() > token.Claims.ExpiresAt {
+		if time.Now().Unix() > claims.ExpiresAt {
 			return e.JSON(http.StatusUnauthorized, map[string]string{"error": "Token expired"})
 		}
 
+		// Check revocation
+		if _, err := checkOfflineToken(app, claims, req.DeviceFingerprint); err != nil {
+			if errors.Is(err, errOfflineTokenRevoked) {
+				return e.JSON(http.StatusUnauthorized, map[string]string{"error": "Token revoked"})
+			}
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to validate token"})
+		}
+
 		return e.JSON(http.StatusOK, map[string]interface{}{
 			"valid":        true,
-			"userId":       token.Claims.UserId,
-			"isPremium":    token.Claims.IsPremium,
-			"expiresAt":    token.Claims.ExpiresAt,
-			"categories":   token.Claims.Categories,
-			"maxQuestions": token.Claims.MaxQuestions,
+			"userId":       claims.UserId,
+			"isPremium":    claims.IsPremium,
+			"expiresAt":    claims.ExpiresAt,
+			"categories":   claims.Categories,
+			"maxQuestions": claims.MaxQuestions,
 		})
 	})
 
-	// Get questions for offline caching (with encryption key)
-	se.Router.POST("/api/offline/questions", func(e *core.RequestEvent) error {
+	// Revoke offline tokens (when user logs out), for one device or all of them
+	se.Router.POST("/api/offline/revoke", func(e *core.RequestEvent) error {
 		authRecord := e.Auth
 		if authRecord == nil {
 			return e.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
 		}
 
 		var req struct {
-			Categories        []string `json:"categories,omitempty"`
-			Limit             int      `json:"limit,omitempty"`
-			DeviceFingerprint string   `json:"deviceFingerprint,omitempty"`
-		}
-		if err := e.BindBody(&req); err != nil {
-			// Use defaults
-			req.Limit = 50
-		}
-
-		// Check premium status
-		isPremium := authRecord.GetBool("isPremium")
-
-		// Limit questions for free users
-		maxQuestions := 20
-		allowedCategories := []string{"Road Signs & Signals"}
-
-		if isPremium {
-			maxQuestions = 500
-			allowedCategories = []string{
-				"Road Signs & Signals",
-				"Rules of the Road",
-				"Safe Driving & Vehicle Handling",
-				"Alcohol/Drugs & Penalties",
-				"Licensing & Documents",
-				"Miscellaneous",
-			}
-		}
-
-		if req.Limit <= 0 || req.Limit > maxQuestions {
-			req.Limit = maxQuestions
-		}
-
-		// Filter requested categories to allowed ones
-		categories := req.Categories
-		if len(categories) == 0 {
-			categories = allowedCategories
-		} else {
-			filtered := []string{}
-			allowedSet := make(map[string]bool)
-			for _, c := range allowedCategories {
-				allowedSet[c] = true
-			}
-			for _, c := range categories {
-				if allowedSet[c] {
-					filtered = append(filtered, c)
-				}
-			}
-			categories = filtered
-		}
-
-		if len(categories) == 0 {
-			return e.JSON(http.StatusForbidden, map[string]string{"error": "No access to requested categories"})
-		}
-
-		// Fetch questions
-		questions, err := app.FindRecordsByFilter(
-			"questions",
-			"category IN {:categories}",
-			"",
-			req.Limit,
-			0,
-			map[string]any{"categories": categories},
-		)
-
-		if err != nil {
-			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch questions"})
+			DeviceFingerprint string `json:"deviceFingerprint,omitempty"`
 		}
+		// An empty body revokes every device
+		_ = e.BindBody(&req)
 
-		// Decrypt and prepare questions for offline storage
-		encService, err := services.NewEncryption()
+		revoked, err := revokeOfflineTokens(app, authRecord.Id, req.DeviceFingerprint, OfflineRevokeUser)
 		if err != nil {
-			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch questions"})
-		}
-
-		result := make([]map[string]interface{}, 0, len(questions))
-
-		for _, q := range questions {
-			// Decrypt fields
-			options := q.GetString("options")
-			decryptedOptions, _ := encService.Decrypt(options)
-			if decryptedOptions == "" {
-				decryptedOptions = options // Might not be encrypted
-			}
-
-			correctIndex := q.GetString("correctIndex")
-			decryptedIndex, _ := encService.Decrypt(correctIndex)
-			if decryptedIndex == "" {
-				decryptedIndex = correctIndex
-			}
-
-			explanation := q.GetString("explanation")
-			decryptedExplanation, _ := encService.Decrypt(explanation)
-			if decryptedExplanation == "" {
-				decryptedExplanation = explanation
-			}
-
-			result = append(result, map[string]interface{}{
-				"id":           q.Id,
-				"question":     q.GetString("question"),
-				"options":      decryptedOptions,
-				"correctIndex": decryptedIndex,
-				"explanation":  decryptedExplanation,
-				"category":     q.GetString("category"),
-				"image":        q.GetString("image"),
-				"difficulty":   q.GetInt("difficulty"),
-			})
-		}
-
-		// Generate encryption key for client-side storage
-		encryptionKey := generateEncryptionKey(authRecord.Id, req.DeviceFingerprint)
-
-		return e.JSON(http.StatusOK, map[string]interface{}{
-			"questions":     result,
-			"count":         len(result),
-			"encryptionKey": encryptionKey,
-			"expiresAt":     time.Now().AddDate(0, 0, DefaultOfflineTokenDays).Unix(),
-		})
-	}).Bind(RequireAuth(app))
-
-	// Revoke offline token (when user logs out or changes password)
-	se.Router.POST("/api/offline/revoke", func(e *core.RequestEvent) error {
-		authRecord := e.Auth
-		if authRecord == nil {
-			return e.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to revoke offline tokens"})
 		}
 
-		// In a production system, you would store token IDs and check against them
-		// For now, we just return success as the token signature includes a secret
-
 		return e.JSON(http.StatusOK, map[string]interface{}{
 			"success": true,
+			"revoked": revoked,
 			"message": "Offline tokens revoked",
 		})
 	}).Bind(RequireAuth(app))
+
+	registerOfflineDeviceRoutes(app, se)
+	registerOfflinePackRoutes(app, se, signer)
+	registerOfflineReplayRoutes(app, se, signer)
+
+	return nil
 }
 
 // generateTokenId generates a unique token ID
@@ -328,43 +229,20 @@ func generateTokenId() string {
 	return base64.URLEncoding.EncodeToString(bytes)
 }
 
-// signClaims creates an HMAC signature for the claims
-func signClaims(claims OfflineTokenClaims) (string, error) {
-	secret := getOfflineSecret()
-
-	claimsBytes, err := json.Marshal(claims)
-	if err != nil {
-		return "", err
-	}
-
-	h := hmac.New(sha256.New, []byte(secret))
-	h.Write(claimsBytes)
-	signature := base64.URLEncoding.EncodeToString(h.Sum(nil))
-
-	return signature, nil
-}
-
-// generateEncryptionKey generates a deterministic encryption key for the user
-func generateEncryptionKey(userId, deviceFingerprint string) string {
-	secret := getOfflineSecret()
-
-	// Combine user ID, device fingerprint, and secret
-	data := userId + ":" + deviceFingerprint + ":" + secret
-
-	h := sha256.New()
-	h.Write([]byte(data))
-	hash := h.Sum(nil)
-
+// generateEncryptionKey returns the content pack key of a registered token
+func generateEncryptionKey(signer *services.OfflineSigner, token *core.Record) string {
 	// Return as base64 (32 bytes = 256 bits, suitable for AES-256)
-	return base64.StdEncoding.EncodeToString(hash)
+	return base64.StdEncoding.EncodeToString(offlinePackKey(signer, token))
 }
 
-// getOfflineSecret gets the secret for signing offline tokens
-func getOfflineSecret() string {
-	secret := os.Getenv("OFFLINE_TOKEN_SECRET")
-	if secret == "" {
-		// Fallback to a derived secret (not recommended for production)
-		secret = "DriveOntario-Offline-Secret-2024"
+// offlineTokenKey derives a registered token's key for purpose from the
+// token's key seed, so the keys a device holds keep working after the
+// signing key is rotated. Tokens issued before key seeds derive it from the
+// signing key instead.
+func offlineTokenKey(signer *services.OfflineSigner, token *core.Record, purpose string) []byte {
+	parts := []string{token.GetString("jti"), token.GetString("deviceFingerprint")}
+	if seed := token.GetString("keySeed"); seed != "" {
+		return services.DeriveOfflineKey([]byte(seed), purpose, parts...)
 	}
-	return secret
+	return signer.DeriveKey(purpose, parts...)
 }
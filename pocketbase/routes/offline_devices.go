@@ -0,0 +1,219 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Every offline token is recorded in offline_tokens under its jti, along
+// with the device it was issued to. A device holds one token at a time, so
+// the registry doubles as the user's list of offline devices. Revoking sets
+// revokedAt; /api/offline/validate refuses revoked and unknown tokens.
+
+// Reasons an offline token was revoked
+const (
+	OfflineRevokeUser           = "user"            // Revoked by the user from the device list
+	OfflineRevokeReplaced       = "replaced"        // The device was issued a newer token
+	OfflineRevokePasswordChange = "password_change" // The user changed their password
+	OfflineRevokePremiumLost    = "premium_lost"    // The user lost premium
+)
+
+// errOfflineTokenRevoked is returned for tokens that are revoked or were never issued
+var errOfflineTokenRevoked = errors.New("offline token revoked")
+
+// errOfflineTokenLimit is returned when a user has been issued
+// MaxOfflineTokensPerDay tokens in the last day
+var errOfflineTokenLimit = errors.New("offline token limit reached")
+
+// OfflineDevice is a device holding a valid offline token
+type OfflineDevice struct {
+	ID                string `json:"id"`
+	DeviceFingerprint string `json:"deviceFingerprint,omitempty"`
+	DeviceName        string `json:"deviceName,omitempty"`
+	UserAgent         string `json:"userAgent,omitempty"`
+	IssuedAt          string `json:"issuedAt"`
+	ExpiresAt         string `json:"expiresAt"`
+	LastValidatedAt   string `json:"lastValidatedAt,omitempty"`
+}
+
+// RegisterOfflineTokenHooks revokes a user's offline tokens when they
+// change their password or lose premium. Losing premium is taken from the
+// premium_downgrades row syncPremium writes, not from the isPremium flag.
+func RegisterOfflineTokenHooks(app core.App) {
+	app.OnRecordUpdate("users").BindFunc(func(e *core.RecordEvent) error {
+		passwordChanged := e.Record.Original().GetString("password:hash") != e.Record.GetString("password:hash")
+
+		if err := e.Next(); err != nil {
+			return err
+		}
+		if !passwordChanged {
+			return nil
+		}
+
+		_, err := revokeOfflineTokens(e.App, e.Record.Id, "", OfflineRevokePasswordChange)
+		return err
+	})
+
+	app.OnRecordCreate("premium_downgrades").BindFunc(func(e *core.RecordEvent) error {
+		if err := e.Next(); err != nil {
+			return err
+		}
+
+		_, err := revokeOfflineTokens(e.App, e.Record.GetString("user"), "", OfflineRevokePremiumLost)
+		return err
+	})
+}
+
+// registerOfflineDeviceRoutes registers the offline device registry routes
+func registerOfflineDeviceRoutes(app core.App, se *core.ServeEvent) {
+	// List the user's devices with a valid offline token
+	se.Router.GET("/api/offline/devices", func(e *core.RequestEvent) error {
+		tokens, err := app.FindRecordsByFilter(
+			"offline_tokens",
+			"user = {:userId} && revokedAt = '' && expiresAt > {:now}",
+			"-created",
+			0,
+			0,
+			map[string]any{"userId": e.Auth.Id, "now": types.NowDateTime().String()},
+		)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch devices"})
+		}
+
+		devices := make([]OfflineDevice, len(tokens))
+		for i, token := range tokens {
+			devices[i] = OfflineDevice{
+				ID:                token.Id,
+				DeviceFingerprint: token.GetString("deviceFingerprint"),
+				DeviceName:        token.GetString("deviceName"),
+				UserAgent:         token.GetString("userAgent"),
+				IssuedAt:          formatAPIDate(token.GetDateTime("created")),
+				ExpiresAt:         formatAPIDate(token.GetDateTime("expiresAt")),
+				LastValidatedAt:   formatAPIDate(token.GetDateTime("lastValidatedAt")),
+			}
+		}
+
+		return e.JSON(http.StatusOK, map[string]interface{}{
+			"devices": devices,
+			"count":   len(devices),
+		})
+	}).Bind(RequireAuth(app))
+
+	// Revoke the offline token of one of the user's devices
+	se.Router.DELETE("/api/offline/devices/{id}", func(e *core.RequestEvent) error {
+		token, err := app.FindRecordById("offline_tokens", e.Request.PathValue("id"))
+		if err != nil || token.GetString("user") != e.Auth.Id {
+			return e.JSON(http.StatusNotFound, map[string]string{"error": "Device not found"})
+		}
+
+		if token.GetDateTime("revokedAt").IsZero() {
+			token.Set("revokedAt", types.NowDateTime())
+			token.Set("revokeReason", OfflineRevokeUser)
+			if err := app.Save(token); err != nil {
+				return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to revoke device"})
+			}
+		}
+
+		return e.JSON(http.StatusOK, map[string]interface{}{
+			"success": true,
+		})
+	}).Bind(RequireAuth(app))
+}
+
+// recordOfflineToken registers a newly issued token with a fresh key seed,
+// revoking whatever token the same device held before. Like the XP daily
+// limits, issuance is counted in the same transaction as the new token.
+func recordOfflineToken(app core.App, e *core.RequestEvent, claims OfflineTokenClaims, deviceFingerprint, deviceName string) (*core.Record, error) {
+	collection, err := app.FindCollectionByNameOrId("offline_tokens")
+	if err != nil {
+		return nil, err
+	}
+
+	record := core.NewRecord(collection)
+	err = app.RunInTransaction(func(txApp core.App) error {
+		issued, err := txApp.CountRecords("offline_tokens", dbx.NewExp(
+			"user = {:userId} AND created >= {:since}",
+			dbx.Params{"userId": claims.UserId, "since": time.Now().Add(-24 * time.Hour).UTC().Format(types.DefaultDateLayout)},
+		))
+		if err != nil {
+			return err
+		}
+		if issued >= MaxOfflineTokensPerDay {
+			return errOfflineTokenLimit
+		}
+
+		if deviceFingerprint != "" {
+			if _, err := revokeOfflineTokens(txApp, claims.UserId, deviceFingerprint, OfflineRevokeReplaced); err != nil {
+				return err
+			}
+		}
+
+		record.Set("jti", claims.TokenId)
+		record.Set("user", claims.UserId)
+		record.Set("deviceFingerprint", deviceFingerprint)
+		record.Set("deviceName", deviceName)
+		record.Set("userAgent", e.Request.UserAgent())
+		record.Set("expiresAt", time.Unix(claims.ExpiresAt, 0).UTC())
+		record.Set("keySeed", security.RandomString(32))
+		return txApp.Save(record)
+	})
+	return record, err
+}
+
+// checkOfflineToken verifies that a token with a valid signature is still
+// registered and unrevoked, marks it as seen and returns its record
+func checkOfflineToken(app core.App, claims OfflineTokenClaims, deviceFingerprint string) (*core.Record, error) {
+	token, err := app.FindFirstRecordByFilter(
+		"offline_tokens",
+		"jti = {:jti} && user = {:userId}",
+		dbx.Params{"jti": claims.TokenId, "userId": claims.UserId},
+	)
+	if err != nil || !token.GetDateTime("revokedAt").IsZero() {
+		return nil, errOfflineTokenRevoked
+	}
+
+	// A token copied to another device is as good as revoked. A token bound
+	// to a device must be presented with its fingerprint; leaving the
+	// fingerprint out doesn't skip the check.
+	if registered := token.GetString("deviceFingerprint"); registered != "" && registered != deviceFingerprint {
+		return nil, errOfflineTokenRevoked
+	}
+
+	token.Set("lastValidatedAt", types.NowDateTime())
+	if err := app.Save(token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// revokeOfflineTokens revokes a user's unrevoked offline tokens, optionally
+// only those of one device, and returns how many were revoked
+func revokeOfflineTokens(app core.App, userID, deviceFingerprint, reason string) (int, error) {
+	filter := "user = {:userId} && revokedAt = ''"
+	params := dbx.Params{"userId": userID}
+	if deviceFingerprint != "" {
+		filter += " && deviceFingerprint = {:device}"
+		params["device"] = deviceFingerprint
+	}
+
+	tokens, err := app.FindRecordsByFilter("offline_tokens", filter, "", 0, 0, params)
+	if err != nil {
+		return 0, err
+	}
+
+	now := types.NowDateTime()
+	for _, token := range tokens {
+		token.Set("revokedAt", now)
+		token.Set("revokeReason", reason)
+		if err := app.Save(token); err != nil {
+			return 0, err
+		}
+	}
+	return len(tokens), nil
+}
@@ -0,0 +1,164 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"driveprep/services"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+// newTestOfflineToken registers an offline token for user bound to the
+// given device fingerprint ("" for none)
+func newTestOfflineToken(tb testing.TB, app core.App, user *core.Record, jti, deviceFingerprint string) *core.Record {
+	tb.Helper()
+
+	return newTestRecord(tb, app, "offline_tokens", map[string]any{
+		"jti":               jti,
+		"user":              user.Id,
+		"deviceFingerprint": deviceFingerprint,
+		"expiresAt":         time.Now().Add(24 * time.Hour).UTC(),
+		"keySeed":           security.RandomString(32),
+	})
+}
+
+func TestCheckOfflineToken(t *testing.T) {
+	app := newTestApp(t)
+	user := newTestUser(t, app, "offline@example.com", nil)
+	newTestOfflineToken(t, app, user, "bound", "device-a")
+	newTestOfflineToken(t, app, user, "unbound", "")
+
+	revoked := newTestOfflineToken(t, app, user, "revoked", "device-a")
+	revoked.Set("revokedAt", time.Now().UTC())
+	if err := app.Save(revoked); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		jti    string
+		device string
+		want   error
+	}{
+		{"matching fingerprint", "bound", "device-a", nil},
+		{"other fingerprint", "bound", "device-b", errOfflineTokenRevoked},
+		{"missing fingerprint", "bound", "", errOfflineTokenRevoked},
+		{"unbound token without fingerprint", "unbound", "", nil},
+		{"unbound token with fingerprint", "unbound", "device-a", nil},
+		{"revoked token", "revoked", "device-a", errOfflineTokenRevoked},
+		{"unknown token", "unknown", "device-a", errOfflineTokenRevoked},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			claims := OfflineTokenClaims{UserId: user.Id, TokenId: c.jti}
+			if _, err := checkOfflineToken(app, claims, c.device); !errors.Is(err, c.want) {
+				t.Fatalf("checkOfflineToken(%q, %q) = %v, want %v", c.jti, c.device, err, c.want)
+			}
+		})
+	}
+}
+
+func TestOfflineTokenHooksOutsideServe(t *testing.T) {
+	app := newTestApp(t)
+	RegisterOfflineTokenHooks(app)
+
+	user := newTestUser(t, app, "downgraded@example.com", nil)
+	periodEnd := time.Now().AddDate(0, 0, 20).UTC().Truncate(time.Second)
+	newTestSubscription(t, app, user, "sub_offline", "active", periodEnd)
+	if !reload(t, app, user).GetBool("isPremium") {
+		t.Fatal("user not premium after subscribing")
+	}
+	newTestOfflineToken(t, app, user, "phone", "device-a")
+	newTestOfflineToken(t, app, user, "laptop", "device-b")
+
+	// No server running: stripe reconcile --apply downgrades the user
+	source := StaticSubscriptionSource{"sub_offline": remoteSubscription("sub_offline", "canceled", periodEnd)}
+	if _, err := ReconcileStripeSubscriptions(app, source, true, "cli"); err != nil {
+		t.Fatal(err)
+	}
+	if reload(t, app, user).GetBool("isPremium") {
+		t.Fatal("user still premium after reconcile")
+	}
+
+	for _, jti := range []string{"phone", "laptop"} {
+		token, err := app.FindFirstRecordByData("offline_tokens", "jti", jti)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.GetDateTime("revokedAt").IsZero() || token.GetString("revokeReason") != OfflineRevokePremiumLost {
+			t.Fatalf("token %s revokedAt/reason = %s/%q, want revoked for %q",
+				jti, token.GetDateTime("revokedAt"), token.GetString("revokeReason"), OfflineRevokePremiumLost)
+		}
+		claims := OfflineTokenClaims{UserId: user.Id, TokenId: jti}
+		if _, err := checkOfflineToken(app, claims, token.GetString("deviceFingerprint")); !errors.Is(err, errOfflineTokenRevoked) {
+			t.Fatalf("checkOfflineToken(%q) = %v, want %v", jti, err, errOfflineTokenRevoked)
+		}
+	}
+}
+
+func TestOfflineTokenHooksIgnorePremiumFlag(t *testing.T) {
+	app := newTestApp(t)
+	RegisterOfflineTokenHooks(app)
+
+	// Only a recorded downgrade revokes for lost premium; flipping the flag
+	// by hand is no reason to honour a token's log after revocation
+	user := newTestUser(t, app, "flipper@example.com", map[string]any{"isPremium": true, "premiumPlan": PlanLifetime})
+	newTestOfflineToken(t, app, user, "phone", "device-a")
+
+	user = reload(t, app, user)
+	user.Set("isPremium", false)
+	if err := app.Save(user); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := app.FindFirstRecordByData("offline_tokens", "jti", "phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !token.GetDateTime("revokedAt").IsZero() {
+		t.Fatalf("token revoked for %q after the premium flag changed", token.GetString("revokeReason"))
+	}
+}
+
+func TestOfflineTokenIssueLimit(t *testing.T) {
+	seed, _, _, err := services.GenerateOfflineSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("OFFLINE_SIGNING_KEY", seed)
+	t.Setenv("OFFLINE_VERIFY_KEYS", "")
+
+	app := newTestApp(t)
+	mux := newTestRouter(t, app, func(se *core.ServeEvent) {
+		if err := RegisterOfflineRoutes(app, se); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	user := newTestUser(t, app, "hoarder@example.com", nil)
+	for i := 0; i < MaxOfflineTokensPerDay; i++ {
+		rec := serveTestRequest(t, mux, user, http.MethodPost, "/api/offline/token", fmt.Sprintf(`{"deviceFingerprint":"device-%d"}`, i))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("token %d: %d %s", i, rec.Code, rec.Body.String())
+		}
+	}
+
+	// Replacing a device's token counts too
+	rec := serveTestRequest(t, mux, user, http.MethodPost, "/api/offline/token", `{"deviceFingerprint":"device-0"}`)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("token past the limit: %d %s, want 429", rec.Code, rec.Body.String())
+	}
+
+	// Other users aren't affected
+	other := newTestUser(t, app, "other@example.com", nil)
+	rec = serveTestRequest(t, mux, other, http.MethodPost, "/api/offline/token", `{"deviceFingerprint":"device-0"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("other user: %d %s", rec.Code, rec.Body.String())
+	}
+}
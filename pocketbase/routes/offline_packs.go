@@ -0,0 +1,206 @@
+package routes
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"driveprep/services"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+// An offline content pack is the question set a device may use offline,
+// encrypted by the server with AES-256-GCM under a key derived from the
+// offline token's key seed, jti and device fingerprint. That key is handed out
+// once, with the token, so a pack is useless on any other device or after
+// the token is replaced. The pack carries metadata signed like the token
+// itself (compact JWS); it records the question-bank version, categories
+// and expiry and the hash of the ciphertext, so clients can check a
+// downloaded pack before they decrypt it.
+
+// OfflinePackMetadata is the signed description of a content pack
+type OfflinePackMetadata struct {
+	Format        int      `json:"v"`
+	PackID        string   `json:"pid"`
+	UserID        string   `json:"sub"`
+	TokenID       string   `json:"jti"`
+	Device        string   `json:"dev"` // Hash of the device fingerprint
+	BankVersion   int      `json:"bankVersion"`
+	Categories    []string `json:"categories"`
+	QuestionCount int      `json:"count"`
+	Encryption    string   `json:"enc"`
+	Digest        string   `json:"sha256"` // Of nonce then ciphertext, base64url
+	IssuedAt      int64    `json:"iat"`
+	ExpiresAt     int64    `json:"exp"`
+}
+
+// OfflinePack is a content pack as downloaded by the client. The pack ID
+// is the additional authenticated data of the ciphertext.
+type OfflinePack struct {
+	Metadata   string `json:"metadata"` // Compact JWS of OfflinePackMetadata
+	IV         string `json:"iv"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// OfflineQuestion is a question as stored inside a content pack
+type OfflineQuestion struct {
+	ID           string   `json:"id"`
+	Question     string   `json:"question"`
+	Options      []string `json:"options"`
+	CorrectIndex int      `json:"correctIndex"`
+	Explanation  string   `json:"explanation"`
+	Category     string   `json:"category"`
+	Image        string   `json:"image,omitempty"`
+	Difficulty   int      `json:"difficulty"`
+}
+
+// registerOfflinePackRoutes registers the content pack download route
+func registerOfflinePackRoutes(app core.App, se *core.ServeEvent, signer *services.OfflineSigner) {
+	se.Router.POST("/api/offline/pack", func(e *core.RequestEvent) error {
+		var req struct {
+			Token             string   `json:"token"`
+			DeviceFingerprint string   `json:"deviceFingerprint,omitempty"`
+			Categories        []string `json:"categories,omitempty"`
+		}
+		if err := e.BindBody(&req); err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+
+		var claims OfflineTokenClaims
+		if err := signer.Verify(services.OfflineTokenType, req.Token, &claims); err != nil || claims.UserId != e.Auth.Id {
+			return e.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid offline token"})
+		}
+		if time.Now().Unix() > claims.ExpiresAt {
+			return e.JSON(http.StatusUnauthorized, map[string]string{"error": "Token expired"})
+		}
+		token, err := checkOfflineToken(app, claims, req.DeviceFingerprint)
+		if err != nil {
+			if errors.Is(err, errOfflineTokenRevoked) {
+				return e.JSON(http.StatusUnauthorized, map[string]string{"error": "Token revoked"})
+			}
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to validate token"})
+		}
+
+		// The token decides what the device may take offline
+		categories := claims.Categories
+		if len(req.Categories) > 0 {
+			allowed := make(map[string]bool, len(claims.Categories))
+			for _, c := range claims.Categories {
+				allowed[c] = true
+			}
+			categories = []string{}
+			for _, c := range req.Categories {
+				if allowed[c] {
+					categories = append(categories, c)
+				}
+			}
+		}
+		if len(categories) == 0 {
+			return e.JSON(http.StatusForbidden, map[string]string{"error": "No access to requested categories"})
+		}
+
+		pack, err := buildOfflinePack(app, signer, claims, token, req.DeviceFingerprint, categories)
+		if err != nil {
+			app.Logger().Error("Failed to build offline pack", "error", err)
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to build offline pack"})
+		}
+
+		return e.JSON(http.StatusOK, pack)
+	}).Bind(RequireAuth(app))
+}
+
+// buildOfflinePack encrypts the token's questions into a signed pack
+func buildOfflinePack(app core.App, signer *services.OfflineSigner, claims OfflineTokenClaims, token *core.Record, deviceFingerprint string, categories []string) (*OfflinePack, error) {
+	inCategories := make([]any, len(categories))
+	for i, c := range categories {
+		inCategories[i] = c
+	}
+	query := app.RecordQuery("questions").
+		AndWhere(dbx.In("category", inCategories...)).
+		OrderBy("originalId ASC").
+		Limit(int64(claims.MaxQuestions))
+	if !claims.IsPremium {
+		query.AndWhere(dbx.HashExp{"isPremium": false})
+	}
+
+	records := []*core.Record{}
+	if err := query.All(&records); err != nil {
+		return nil, err
+	}
+
+	questions := make([]OfflineQuestion, 0, len(records))
+	for _, record := range records {
+		q, err := recordToQuestion(record)
+		if err != nil {
+			return nil, fmt.Errorf("question %s: %w", record.Id, err)
+		}
+		questions = append(questions, OfflineQuestion{
+			ID:           q.ID,
+			Question:     q.Question,
+			Options:      q.Options,
+			CorrectIndex: q.CorrectAnswer,
+			Explanation:  q.Explanation,
+			Category:     q.Category,
+			Image:        q.ImageUrl,
+			Difficulty:   q.Difficulty,
+		})
+	}
+
+	bankVersion, err := questionBankVersion(app)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := json.Marshal(questions)
+	if err != nil {
+		return nil, err
+	}
+
+	packID := security.RandomString(16)
+	nonce, ciphertext, err := services.SealOfflinePack(
+		offlinePackKey(signer, token),
+		plaintext,
+		[]byte(packID),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	device := sha256.Sum256([]byte(deviceFingerprint))
+	metadata, err := signer.Sign(services.OfflinePackType, OfflinePackMetadata{
+		Format:        services.OfflinePackFormat,
+		PackID:        packID,
+		UserID:        claims.UserId,
+		TokenID:       claims.TokenId,
+		Device:        hex.EncodeToString(device[:8]),
+		BankVersion:   bankVersion,
+		Categories:    categories,
+		QuestionCount: len(questions),
+		Encryption:    "A256GCM",
+		Digest:        services.OfflinePackDigest(nonce, ciphertext),
+		IssuedAt:      time.Now().Unix(),
+		ExpiresAt:     claims.ExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &OfflinePack{
+		Metadata:   metadata,
+		IV:         base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext: base64.StdEncoding.EncodeToString(ciphertext),
+	}, nil
+}
+
+// offlinePackKey derives the AES-256 key packs for a token are encrypted with
+func offlinePackKey(signer *services.OfflineSigner, token *core.Record) []byte {
+	return offlineTokenKey(signer, token, "offline-pack")
+}
@@ -0,0 +1,354 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	"driveprep/services"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Answers given offline are kept by the device in an offline answer log
+// (see services.OfflineLogEntry), MAC'd with a key bound to the offline
+// token and device. POST /api/offline/replay checks the chain, then judges
+// each new entry against the token and the question bank. Accepted answers
+// go through the same attempt log, review schedule and XP ledger as online
+// answers. The token record remembers where the log was replayed up to, so
+// uploading the same entries again credits nothing.
+
+// Offline replay limits
+const (
+	MaxOfflineReplayEntries = 500             // Max log entries per upload
+	OfflineReplayGraceDays  = 14              // Days after expiry a token's log can still be replayed
+	offlineClockSkew        = 5 * time.Minute // Allowed drift of the device clock
+	offlineAnswerOverlap    = 1000            // ms two answers may overlap by before the timing is impossible
+)
+
+// Outcomes of a replayed log entry
+const (
+	OfflineReplayAccepted  = "accepted"
+	OfflineReplayRejected  = "rejected"
+	OfflineReplayDuplicate = "duplicate"
+)
+
+// errOfflineLogBroken is returned when an uploaded log doesn't chain from
+// what was replayed before, or an entry's MAC doesn't match
+var errOfflineLogBroken = errors.New("offline answer log failed verification")
+
+// OfflineReplayResult is the outcome of one replayed log entry
+type OfflineReplayResult struct {
+	Seq      int    `json:"seq"`
+	Status   string `json:"status"`
+	Reason   string `json:"reason,omitempty"`
+	Correct  bool   `json:"correct,omitempty"`
+	XPEarned int    `json:"xpEarned,omitempty"`
+}
+
+// OfflineReplayResponse summarizes a replayed upload
+type OfflineReplayResponse struct {
+	Accepted    int                   `json:"accepted"`
+	Rejected    int                   `json:"rejected"`
+	Duplicates  int                   `json:"duplicates"`
+	XPEarned    int                   `json:"xpEarned"`
+	ReplayedSeq int                   `json:"replayedSeq"` // Entries up to here can be dropped from the log
+	Results     []OfflineReplayResult `json:"results"`
+	XPBalance
+}
+
+// offlineReplayAnswer is an accepted entry waiting to be recorded
+type offlineReplayAnswer struct {
+	entry    services.OfflineLogEntry
+	question Question
+	correct  bool
+}
+
+// registerOfflineReplayRoutes registers the offline answer log upload route
+func registerOfflineReplayRoutes(app core.App, se *core.ServeEvent, signer *services.OfflineSigner) {
+	se.Router.POST("/api/offline/replay", func(e *core.RequestEvent) error {
+		var req struct {
+			Token             string                     `json:"token"`
+			DeviceFingerprint string                     `json:"deviceFingerprint,omitempty"`
+			Entries           []services.OfflineLogEntry `json:"entries"`
+		}
+		if err := e.BindBody(&req); err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+		if len(req.Entries) == 0 {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "No entries to replay"})
+		}
+		if len(req.Entries) > MaxOfflineReplayEntries {
+			return e.JSON(http.StatusBadRequest, map[string]string{
+				"error": fmt.Sprintf("At most %d entries can be replayed at once", MaxOfflineReplayEntries),
+			})
+		}
+
+		var claims OfflineTokenClaims
+		if err := signer.Verify(services.OfflineTokenType, req.Token, &claims); err != nil || claims.UserId != e.Auth.Id {
+			return e.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid offline token"})
+		}
+		if time.Now().After(time.Unix(claims.ExpiresAt, 0).AddDate(0, 0, OfflineReplayGraceDays)) {
+			return e.JSON(http.StatusUnauthorized, map[string]string{"error": "Token too old to replay"})
+		}
+
+		var response *OfflineReplayResponse
+		err := app.RunInTransaction(func(txApp core.App) error {
+			var err error
+			response, err = replayOfflineLog(txApp, signer, claims, req.DeviceFingerprint, req.Entries)
+			return err
+		})
+		switch {
+		case errors.Is(err, errOfflineTokenRevoked):
+			return e.JSON(http.StatusUnauthorized, map[string]string{"error": "Token revoked"})
+		case errors.Is(err, errOfflineLogBroken):
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Answer log failed verification"})
+		case err != nil:
+			app.Logger().Error("Failed to replay offline answers", "error", err)
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to replay offline answers"})
+		}
+
+		return e.JSON(http.StatusOK, response)
+	}).Bind(RequireAuth(app))
+}
+
+// replayOfflineLog verifies and credits the entries of a token's answer log
+// that haven't been replayed yet. Nothing is written unless the whole upload
+// chains from the last replayed entry.
+func replayOfflineLog(app core.App, signer *services.OfflineSigner, claims OfflineTokenClaims, deviceFingerprint string, entries []services.OfflineLogEntry) (*OfflineReplayResponse, error) {
+	token, err := app.FindFirstRecordByFilter(
+		"offline_tokens",
+		"jti = {:jti} && user = {:userId}",
+		dbx.Params{"jti": claims.TokenId, "userId": claims.UserId},
+	)
+	if err != nil {
+		return nil, errOfflineTokenRevoked
+	}
+	if registered := token.GetString("deviceFingerprint"); registered != deviceFingerprint {
+		return nil, errOfflineTokenRevoked
+	}
+
+	// Answers given before a token was replaced or lost premium still count;
+	// a token revoked by the user or a password change may be in other hands
+	windowEnd := time.Unix(claims.ExpiresAt, 0)
+	if revokedAt := token.GetDateTime("revokedAt"); !revokedAt.IsZero() {
+		switch token.GetString("revokeReason") {
+		case OfflineRevokeReplaced, OfflineRevokePremiumLost:
+			windowEnd = revokedAt.Time()
+		default:
+			return nil, errOfflineTokenRevoked
+		}
+	}
+	windowStart := time.Unix(claims.IssuedAt, 0)
+	if now := time.Now().Add(offlineClockSkew); windowEnd.After(now) {
+		windowEnd = now
+	}
+
+	// Check the chain before judging any answer. Entries replayed before,
+	// or repeated in this upload, are duplicates.
+	response := &OfflineReplayResponse{Results: make([]OfflineReplayResult, 0, len(entries))}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Seq < entries[j].Seq })
+	logKey := offlineLogKey(signer, token)
+	replayedSeq := token.GetInt("replayedSeq")
+	head := token.GetString("replayHead")
+	fresh := make([]services.OfflineLogEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Seq <= replayedSeq {
+			response.Duplicates++
+			response.Results = append(response.Results, OfflineReplayResult{Seq: entry.Seq, Status: OfflineReplayDuplicate})
+			continue
+		}
+		if entry.Seq != replayedSeq+1 || entry.Prev != head || !entry.VerifyMAC(logKey) {
+			return nil, errOfflineLogBroken
+		}
+		replayedSeq = entry.Seq
+		head = entry.MAC
+		fresh = append(fresh, entry)
+	}
+
+	// Answering a question again is re-practice and counts like any other
+	// answer; only the same answer logged under another token (same question,
+	// same time) is a duplicate. Answers replayed from the user's other tokens
+	// are kept to check the timing against, since one person can't answer on
+	// two devices at once.
+	answered := map[offlineAnswerKey]bool{}
+	var previous []struct {
+		Question   string `db:"question"`
+		SessionID  string `db:"sessionId"`
+		AnsweredAt int64  `db:"answeredAt"`
+		TimeSpent  int64  `db:"timeSpent"`
+	}
+	err = app.DB().
+		Select("question", "sessionId", "answeredAt", "timeSpent").
+		From("question_attempts").
+		Where(dbx.HashExp{"user": claims.UserId, "source": AttemptSourceOffline}).
+		All(&previous)
+	if err != nil {
+		return nil, err
+	}
+	var otherTokens []offlineAnswerSpan
+	for _, p := range previous {
+		if p.SessionID != claims.TokenId && p.AnsweredAt > 0 {
+			answered[offlineAnswerKey{p.Question, p.AnsweredAt}] = true
+			otherTokens = append(otherTokens, offlineAnswerSpan{start: p.AnsweredAt - p.TimeSpent, end: p.AnsweredAt})
+		}
+	}
+
+	accepted := []offlineReplayAnswer{}
+	lastAnsweredAt := int64(token.GetInt("replayedUntil"))
+	for _, entry := range fresh {
+		answer, reason := judgeOfflineAnswer(app, claims, entry, answered, otherTokens, lastAnsweredAt, windowStart, windowEnd)
+		// Only answers that were really given move the clock on, so a rejected
+		// entry with a far-future timestamp can't get later answers rejected
+		if reason == "" || reason == "duplicate" {
+			lastAnsweredAt = max(lastAnsweredAt, entry.AnsweredAt)
+		}
+		if reason != "" {
+			status := OfflineReplayRejected
+			if reason == "duplicate" {
+				status = OfflineReplayDuplicate
+				response.Duplicates++
+			} else {
+				response.Rejected++
+			}
+			response.Results = append(response.Results, OfflineReplayResult{Seq: entry.Seq, Status: status, Reason: reason})
+			continue
+		}
+
+		accepted = append(accepted, answer)
+	}
+
+	// XP follows the session rules, within what's left of the user's daily
+	// practice XP
+	user, err := app.FindRecordById("users", claims.UserId)
+	if err != nil {
+		return nil, err
+	}
+	earnedToday, err := dailyXP(app, user, practiceXPReasons...)
+	if err != nil {
+		return nil, err
+	}
+	xpLeft := max(MaxDailyPracticeXP-earnedToday, 0)
+
+	correct := 0
+	for _, answer := range accepted {
+		xpEarned := 0
+		if answer.correct {
+			correct++
+			xpEarned = XPCorrectAnswer
+			if answer.question.Difficulty > 1 {
+				xpEarned += (answer.question.Difficulty - 1) * XPDifficultyBonus
+			}
+		}
+		xpEarned = min(xpEarned+XPQuestionComplete, xpLeft)
+		xpLeft -= xpEarned
+		response.XPEarned += xpEarned
+
+		if err := logQuestionAttempt(app, claims.UserId, answer.question, AttemptSourceOffline, claims.TokenId, answer.entry.SelectedAnswer, answer.entry.TimeSpent, answer.entry.AnsweredAt, answer.correct); err != nil {
+			return nil, err
+		}
+		if err := updateQuestionReview(app, claims.UserId, answer.question.ID, answer.correct, answer.entry.TimeSpent, true); err != nil {
+			return nil, err
+		}
+
+		response.Accepted++
+		response.Results = append(response.Results, OfflineReplayResult{
+			Seq:      answer.entry.Seq,
+			Status:   OfflineReplayAccepted,
+			Correct:  answer.correct,
+			XPEarned: xpEarned,
+		})
+	}
+	sort.SliceStable(response.Results, func(i, j int) bool { return response.Results[i].Seq < response.Results[j].Seq })
+
+	token.Set("replayedSeq", replayedSeq)
+	token.Set("replayHead", head)
+	token.Set("replayedUntil", lastAnsweredAt)
+	token.Set("replayedXP", token.GetInt("replayedXP")+response.XPEarned)
+	if err := app.Save(token); err != nil {
+		return nil, err
+	}
+	response.ReplayedSeq = replayedSeq
+
+	user.Set("questionsCompleted", user.GetInt("questionsCompleted")+len(accepted))
+	user.Set("questionsCorrect", user.GetInt("questionsCorrect")+correct)
+	balance, _, err := creditDailyCappedXP(app, user, response.XPEarned, MaxDailyPracticeXP, practiceXPReasons, "offline_replay", fmt.Sprintf("%s:%d", claims.TokenId, replayedSeq), "offline", "", map[string]interface{}{
+		"answered": len(accepted),
+		"correct":  correct,
+		"toSeq":    replayedSeq,
+	})
+	if err != nil {
+		return nil, err
+	}
+	response.XPBalance = balance
+
+	return response, nil
+}
+
+// offlineAnswerKey identifies an answer across offline logs
+type offlineAnswerKey struct {
+	question   string
+	answeredAt int64
+}
+
+// offlineAnswerSpan is when an accepted offline answer was being worked on
+// (unix ms, device clock)
+type offlineAnswerSpan struct {
+	start, end int64
+}
+
+// judgeOfflineAnswer checks a verified log entry against the token, the
+// user's answers replayed from other tokens and the question bank. It
+// returns the answer, or the reason it was rejected.
+func judgeOfflineAnswer(app core.App, claims OfflineTokenClaims, entry services.OfflineLogEntry, answered map[offlineAnswerKey]bool, otherTokens []offlineAnswerSpan, lastAnsweredAt int64, windowStart, windowEnd time.Time) (offlineReplayAnswer, string) {
+	answeredAt := time.UnixMilli(entry.AnsweredAt)
+	start := entry.AnsweredAt - int64(entry.TimeSpent)
+	switch {
+	case answeredAt.Before(windowStart) || answeredAt.After(windowEnd):
+		return offlineReplayAnswer{}, "outside_token_window"
+	case answered[offlineAnswerKey{entry.QuestionID, entry.AnsweredAt}]:
+		// Already replayed from another token's log
+		return offlineReplayAnswer{}, "duplicate"
+	case entry.TimeSpent < MinTimePerQuestion:
+		return offlineReplayAnswer{}, "too_fast"
+	case start+offlineAnswerOverlap < lastAnsweredAt:
+		// Started before the previous answer was given
+		return offlineReplayAnswer{}, "impossible_timing"
+	case slices.ContainsFunc(otherTokens, func(span offlineAnswerSpan) bool {
+		return start+offlineAnswerOverlap < span.end && span.start+offlineAnswerOverlap < entry.AnsweredAt
+	}):
+		// Worked on while answering on another device
+		return offlineReplayAnswer{}, "impossible_timing"
+	}
+
+	record, err := app.FindRecordById("questions", entry.QuestionID)
+	if err != nil {
+		return offlineReplayAnswer{}, "unknown_question"
+	}
+	if !slices.Contains(claims.Categories, record.GetString("category")) || (record.GetBool("isPremium") && !claims.IsPremium) {
+		return offlineReplayAnswer{}, "not_allowed"
+	}
+
+	question, err := recordToQuestion(record)
+	if err != nil {
+		return offlineReplayAnswer{}, "unknown_question"
+	}
+	if entry.SelectedAnswer < 0 || entry.SelectedAnswer >= len(question.Options) {
+		return offlineReplayAnswer{}, "invalid_answer"
+	}
+
+	return offlineReplayAnswer{
+		entry:    entry,
+		question: question,
+		correct:  entry.SelectedAnswer == question.CorrectAnswer,
+	}, ""
+}
+
+// offlineLogKey derives the key a device MACs its offline answer log with
+func offlineLogKey(signer *services.OfflineSigner, token *core.Record) []byte {
+	return offlineTokenKey(signer, token, "offline-log")
+}
@@ -0,0 +1,387 @@
+package routes
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"driveprep/services"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const testOfflineDevice = "device-a"
+
+// offlineReplayFixture is a user with a registered offline token and a few
+// questions to answer with it
+type offlineReplayFixture struct {
+	app       core.App
+	signer    *services.OfflineSigner
+	claims    OfflineTokenClaims
+	token     *core.Record
+	device    string
+	questions []string
+	issuedAt  time.Time
+}
+
+func newOfflineReplayFixture(t *testing.T) *offlineReplayFixture {
+	t.Helper()
+
+	seed, _, _, err := services.GenerateOfflineSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("OFFLINE_SIGNING_KEY", seed)
+	t.Setenv("OFFLINE_VERIFY_KEYS", "")
+	signer, err := services.NewOfflineSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := newTestApp(t)
+	user := newTestUser(t, app, "offline@example.com", nil)
+	token := newTestOfflineToken(t, app, user, "replay-token", testOfflineDevice)
+
+	var questions []string
+	for i := 0; i < 5; i++ {
+		questions = append(questions, newTestQuestion(t, app).Id)
+	}
+
+	issuedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	return &offlineReplayFixture{
+		app:    app,
+		signer: signer,
+		claims: OfflineTokenClaims{
+			UserId:     user.Id,
+			IsPremium:  true,
+			Categories: []string{"Rules of the Road"},
+			IssuedAt:   issuedAt.Unix(),
+			ExpiresAt:  token.GetDateTime("expiresAt").Time().Unix(),
+			TokenId:    token.GetString("jti"),
+		},
+		token:     token,
+		device:    testOfflineDevice,
+		questions: questions,
+		issuedAt:  issuedAt,
+	}
+}
+
+// onDevice returns the fixture for a second token of the same user, issued
+// at the same time for another device
+func (f *offlineReplayFixture) onDevice(t *testing.T, jti, device string) *offlineReplayFixture {
+	t.Helper()
+
+	user, err := f.app.FindRecordById("users", f.claims.UserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := *f
+	other.token = newTestOfflineToken(t, f.app, user, jti, device)
+	other.device = device
+	other.claims.TokenId = jti
+	return &other
+}
+
+// entry is an answer to question q (correct or not) given at minutes after
+// the token was issued, taking 10 seconds
+func (f *offlineReplayFixture) entry(q int, correct bool, minutes float64) services.OfflineLogEntry {
+	selected := 0
+	if correct {
+		selected = 1
+	}
+	return services.OfflineLogEntry{
+		QuestionID:     f.questions[q],
+		SelectedAnswer: selected,
+		TimeSpent:      10000,
+		AnsweredAt:     f.issuedAt.Add(time.Duration(minutes * float64(time.Minute))).UnixMilli(),
+	}
+}
+
+// chain numbers and MACs entries as a device would, from the start of the log
+func (f *offlineReplayFixture) chain(entries ...services.OfflineLogEntry) []services.OfflineLogEntry {
+	key := offlineLogKey(f.signer, f.token)
+	prev := ""
+	for i := range entries {
+		entries[i].Seq = i + 1
+		entries[i].Prev = prev
+		entries[i].MAC = entries[i].ComputeMAC(key)
+		prev = entries[i].MAC
+	}
+	return entries
+}
+
+func (f *offlineReplayFixture) replay(entries []services.OfflineLogEntry) (*OfflineReplayResponse, error) {
+	var response *OfflineReplayResponse
+	err := f.app.RunInTransaction(func(txApp core.App) error {
+		var err error
+		response, err = replayOfflineLog(txApp, f.signer, f.claims, f.device, entries)
+		return err
+	})
+	return response, err
+}
+
+// statuses returns the status (or rejection reason) of each result by seq
+func statuses(response *OfflineReplayResponse) map[int]string {
+	out := map[int]string{}
+	for _, result := range response.Results {
+		out[result.Seq] = result.Status
+		if result.Reason != "" {
+			out[result.Seq] = result.Reason
+		}
+	}
+	return out
+}
+
+func TestReplayOfflineLogChain(t *testing.T) {
+	f := newOfflineReplayFixture(t)
+	log := f.chain(f.entry(0, true, 1), f.entry(1, true, 2), f.entry(2, true, 3))
+
+	edited := append([]services.OfflineLogEntry{}, log...)
+	edited[1].SelectedAnswer = 2
+
+	otherDevice := append([]services.OfflineLogEntry{}, log...)
+	wrongKey := services.DeriveOfflineKey([]byte(f.token.GetString("keySeed")), "offline-log", f.claims.TokenId, "device-b")
+	for i := range otherDevice {
+		otherDevice[i].MAC = otherDevice[i].ComputeMAC(wrongKey)
+	}
+
+	cases := []struct {
+		name    string
+		entries []services.OfflineLogEntry
+	}{
+		{"edited entry", edited},
+		{"dropped entry", []services.OfflineLogEntry{log[0], log[2]}},
+		{"not from the start", log[1:]},
+		{"wrong key", otherDevice},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := f.replay(c.entries); !errors.Is(err, errOfflineLogBroken) {
+				t.Fatalf("replay = %v, want %v", err, errOfflineLogBroken)
+			}
+		})
+	}
+
+	// Broken uploads don't move the replay position
+	token, err := f.app.FindFirstRecordByData("offline_tokens", "jti", f.claims.TokenId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq := token.GetInt("replayedSeq"); seq != 0 {
+		t.Fatalf("replayedSeq = %d after broken uploads, want 0", seq)
+	}
+
+	response, err := f.replay(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Accepted != 3 || response.ReplayedSeq != 3 {
+		t.Fatalf("accepted %d up to seq %d, want 3 up to 3", response.Accepted, response.ReplayedSeq)
+	}
+}
+
+func TestReplayOfflineLogAfterKeyRotation(t *testing.T) {
+	f := newOfflineReplayFixture(t)
+	log := f.chain(f.entry(0, true, 1), f.entry(1, true, 2))
+	packKey := offlinePackKey(f.signer, f.token)
+
+	// The signing key is rotated while the device is offline
+	seed, _, _, err := services.GenerateOfflineSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("OFFLINE_SIGNING_KEY", seed)
+	f.signer, err = services.NewOfflineSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(offlinePackKey(f.signer, f.token), packKey) {
+		t.Fatal("pack key changed with the signing key")
+	}
+	response, err := f.replay(log)
+	if err != nil {
+		t.Fatalf("replay after rotation: %v", err)
+	}
+	if response.Accepted != 2 {
+		t.Fatalf("accepted %d after rotation, want 2", response.Accepted)
+	}
+}
+
+func TestReplayOfflineLogDuplicates(t *testing.T) {
+	f := newOfflineReplayFixture(t)
+	log := f.chain(
+		f.entry(0, true, 1),
+		f.entry(1, false, 2),
+		f.entry(0, false, 3), // Same question again, practised
+		f.entry(2, true, 4),
+	)
+
+	first, err := f.replay(log[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Accepted != 2 || first.XPEarned == 0 {
+		t.Fatalf("first upload accepted %d for %d XP, want 2 for some XP", first.Accepted, first.XPEarned)
+	}
+
+	// The device uploads the whole log again
+	second, err := f.replay(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]string{
+		1: OfflineReplayDuplicate,
+		2: OfflineReplayDuplicate,
+		3: OfflineReplayAccepted,
+		4: OfflineReplayAccepted,
+	}
+	got := statuses(second)
+	for seq, status := range want {
+		if got[seq] != status {
+			t.Errorf("seq %d: %q, want %q", seq, got[seq], status)
+		}
+	}
+	if second.Accepted != 2 || second.Duplicates != 2 || second.Rejected != 0 {
+		t.Fatalf("accepted/duplicates/rejected = %d/%d/%d, want 2/2/0", second.Accepted, second.Duplicates, second.Rejected)
+	}
+
+	// Nothing is credited twice
+	attempts, err := f.app.CountRecords("question_attempts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 4 {
+		t.Fatalf("attempts = %d, want 4", attempts)
+	}
+
+	third, err := f.replay(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.Accepted != 0 || third.XPEarned != 0 {
+		t.Fatalf("third upload accepted %d for %d XP, want nothing", third.Accepted, third.XPEarned)
+	}
+}
+
+func TestReplayOfflineLogTiming(t *testing.T) {
+	f := newOfflineReplayFixture(t)
+	tooFast := f.entry(3, true, 5)
+	tooFast.TimeSpent = MinTimePerQuestion - 1
+
+	log := f.chain(
+		f.entry(0, true, 1),
+		f.entry(1, true, 1.1),      // Started 4s before the previous answer
+		f.entry(2, true, -10),      // Before the token was issued
+		f.entry(3, true, 60*24*30), // Far in the future
+		tooFast,
+		f.entry(4, true, 6), // Genuine, after the rejected ones
+	)
+
+	response, err := f.replay(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]string{
+		1: OfflineReplayAccepted,
+		2: "impossible_timing",
+		3: "outside_token_window",
+		4: "outside_token_window",
+		5: "too_fast",
+		6: OfflineReplayAccepted,
+	}
+	got := statuses(response)
+	for seq, status := range want {
+		if got[seq] != status {
+			t.Errorf("seq %d: %q, want %q", seq, got[seq], status)
+		}
+	}
+
+	// Rejected entries don't move the replay clock
+	token, err := f.app.FindFirstRecordByData("offline_tokens", "jti", f.claims.TokenId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if until := int64(token.GetInt("replayedUntil")); until != log[5].AnsweredAt {
+		t.Fatalf("replayedUntil = %d, want the last accepted answer %d", until, log[5].AnsweredAt)
+	}
+}
+
+func TestReplayOfflineLogAcrossTokens(t *testing.T) {
+	f := newOfflineReplayFixture(t)
+	phone := f.chain(f.entry(0, true, 10), f.entry(1, true, 20))
+	if _, err := f.replay(phone); err != nil {
+		t.Fatal(err)
+	}
+
+	// The same user on a second device, with a token of its own
+	tablet := f.onDevice(t, "tablet-token", "device-b")
+	log := tablet.chain(
+		phone[0],                     // The phone's answer, logged again
+		tablet.entry(2, true, 10.05), // While answering on the phone
+		tablet.entry(0, false, 30),   // Practising a question from the phone
+		tablet.entry(3, true, 40),
+	)
+	response, err := tablet.replay(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]string{
+		1: OfflineReplayDuplicate,
+		2: "impossible_timing",
+		3: OfflineReplayAccepted,
+		4: OfflineReplayAccepted,
+	}
+	got := statuses(response)
+	for seq, status := range want {
+		if got[seq] != status {
+			t.Errorf("seq %d: %q, want %q", seq, got[seq], status)
+		}
+	}
+
+	// The re-practice is recorded like any other answer
+	attempts, err := f.app.FindAllRecords("question_attempts", dbx.HashExp{"question": f.questions[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 2 {
+		t.Fatalf("attempts at the practised question = %d, want 2", len(attempts))
+	}
+}
+
+func TestReplayOfflineLogDailyXP(t *testing.T) {
+	f := newOfflineReplayFixture(t)
+	user, err := f.app.FindRecordById("users", f.claims.UserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Practice sessions have used up all but 10 XP of today's budget
+	if _, err := creditXP(f.app, user, MaxDailyPracticeXP-10, "practice_complete", "session-1", "practice", "", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := f.replay(f.chain(f.entry(0, true, 1), f.entry(1, true, 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Accepted != 2 || response.XPEarned != 10 {
+		t.Fatalf("accepted %d for %d XP, want 2 for 10", response.Accepted, response.XPEarned)
+	}
+
+	// A second token shares the same budget
+	tablet := f.onDevice(t, "tablet-token", "device-b")
+	response, err = tablet.replay(tablet.chain(tablet.entry(2, true, 3)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Accepted != 1 || response.XPEarned != 0 {
+		t.Fatalf("second token accepted %d for %d XP, want 1 for none", response.Accepted, response.XPEarned)
+	}
+	if xp := reload(t, f.app, user).GetInt("xp"); xp != MaxDailyPracticeXP {
+		t.Fatalf("xp = %d, want the daily cap of %d", xp, MaxDailyPracticeXP)
+	}
+}
@@ -0,0 +1,751 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Organizations are driving schools. An admin creates the organization with
+// an owner and issues it enterprise licenses with a number of seats. Students
+// take a seat by joining with the organization's code (or accepting an
+// instructor's invite) and get premium for as long as a license covers the
+// organization. Owners and instructors see their students' progress.
+
+const (
+	OrgRoleOwner      = "owner"      // Manages instructors and the join code
+	OrgRoleInstructor = "instructor" // Adds students and sees their progress
+	OrgRoleStudent    = "student"    // Takes a seat
+
+	// OrgJoinCodeLength is the length of an organization join code
+	OrgJoinCodeLength = 8
+
+	// MaxOrgSeats is the most seats a single license can cover
+	MaxOrgSeats = 5000
+
+	// OrgTestHistoryLimit is how many recent tests the student detail shows
+	OrgTestHistoryLimit = 50
+	// OrgWeakCategoryLimit is how many weak categories the student detail shows
+	OrgWeakCategoryLimit = 5
+)
+
+// Organization is an organization as seen by one of its members
+type Organization struct {
+	ID               string `json:"id"`
+	Name             string `json:"name"`
+	ContactEmail     string `json:"contactEmail,omitempty"` // Only shown to owners and instructors
+	JoinCode         string `json:"joinCode,omitempty"`     // Only shown to owners and instructors
+	Role             string `json:"role"`
+	Seats            int    `json:"seats"`
+	SeatsUsed        int    `json:"seatsUsed"`
+	LicenseExpiresAt string `json:"licenseExpiresAt,omitempty"`
+	Created          string `json:"created"`
+}
+
+// OrgMember is a member of an organization, as listed to its staff
+type OrgMember struct {
+	UserID   string `json:"userId"`
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+	JoinedAt string `json:"joinedAt"`
+}
+
+// OrgStudentSummary is one row of the instructor dashboard
+type OrgStudentSummary struct {
+	UserID             string  `json:"userId"`
+	Name               string  `json:"name"`
+	Email              string  `json:"email"`
+	Avatar             string  `json:"avatar,omitempty"`
+	JoinedAt           string  `json:"joinedAt"`
+	XP                 int     `json:"xp"`
+	Level              int     `json:"level"`
+	Streak             int     `json:"streak"`
+	QuestionsCompleted int     `json:"questionsCompleted"`
+	Accuracy           float64 `json:"accuracy"` // Share of answers correct, 0-1
+	TestsTaken         int     `json:"testsTaken"`
+	TestsPassed        int     `json:"testsPassed"`
+	LastActiveAt       string  `json:"lastActiveAt,omitempty"`
+}
+
+// OrgTestResult is one completed mock test in a student's history
+type OrgTestResult struct {
+	SessionID         string                   `json:"sessionId"`
+	CompletedAt       string                   `json:"completedAt"`
+	Score             int                      `json:"score"`
+	TotalQuestions    int                      `json:"totalQuestions"`
+	Passed            bool                     `json:"passed"`
+	TimeSpent         int                      `json:"timeSpent"` // seconds
+	Blueprint         string                   `json:"blueprint,omitempty"`
+	CategoryBreakdown map[string]CategoryScore `json:"categoryBreakdown"`
+	Flagged           bool                     `json:"flagged,omitempty"`
+}
+
+// OrgStudentDetail is a student's progress as shown to their instructors
+type OrgStudentDetail struct {
+	Student          OrgStudentSummary  `json:"student"`
+	CategoryProgress interface{}        `json:"categoryProgress"`
+	TestHistory      []OrgTestResult    `json:"testHistory"`
+	WeakCategories   []CategoryWeakSpot `json:"weakCategories"`
+}
+
+// RegisterOrgRoutes registers the organization API routes
+func RegisterOrgRoutes(app core.App, se *core.ServeEvent) {
+	// Admin: create an organization with its owner
+	se.Router.POST("/api/org", func(e *core.RequestEvent) error {
+		var req struct {
+			Name         string `json:"name"`
+			ContactEmail string `json:"contactEmail"`
+			OwnerEmail   string `json:"ownerEmail"`
+		}
+		if err := e.BindBody(&req); err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" || len(req.Name) > 120 {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Organization name is required (max 120 characters)"})
+		}
+
+		owner, err := app.FindAuthRecordByEmail("users", strings.TrimSpace(req.OwnerEmail))
+		if err != nil {
+			return e.JSON(http.StatusNotFound, map[string]string{"error": "Owner must have an account"})
+		}
+
+		orgsCollection, err := app.FindCollectionByNameOrId("organizations")
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create organization"})
+		}
+		membersCollection, err := app.FindCollectionByNameOrId("org_members")
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create organization"})
+		}
+
+		org := core.NewRecord(orgsCollection)
+		err = app.RunInTransaction(func(txApp core.App) error {
+			code, err := newOrgJoinCode(txApp)
+			if err != nil {
+				return err
+			}
+
+			org.Set("name", req.Name)
+			org.Set("contactEmail", strings.TrimSpace(req.ContactEmail))
+			org.Set("joinCode", code)
+			org.Set("createdBy", actingUserID(e))
+			if err := txApp.Save(org); err != nil {
+				return err
+			}
+
+			member := core.NewRecord(membersCollection)
+			member.Set("organization", org.Id)
+			member.Set("user", owner.Id)
+			member.Set("role", OrgRoleOwner)
+			member.Set("addedBy", actingUserID(e))
+			return txApp.Save(member)
+		})
+		if err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Failed to create organization"})
+		}
+
+		return e.JSON(http.StatusOK, Organization{
+			ID:           org.Id,
+			Name:         org.GetString("name"),
+			ContactEmail: org.GetString("contactEmail"),
+			JoinCode:     org.GetString("joinCode"),
+			Role:         OrgRoleOwner,
+			Created:      formatAPIDate(org.GetDateTime("created")),
+		})
+	}).Bind(RequireAuth(app), RequirePermission(app, PermissionLicenseAdmin))
+
+	// List the organizations the user belongs to
+	se.Router.GET("/api/org", func(e *core.RequestEvent) error {
+		memberships, err := app.FindRecordsByFilter(
+			"org_members",
+			"user = {:userId}",
+			"created",
+			0,
+			0,
+			map[string]any{"userId": e.Auth.Id},
+		)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch organizations"})
+		}
+
+		if errs := app.ExpandRecords(memberships, []string{"organization"}, nil); len(errs) > 0 {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch organizations"})
+		}
+
+		orgs := make([]Organization, 0, len(memberships))
+		for _, membership := range memberships {
+			org := membership.ExpandedOne("organization")
+			if org == nil {
+				continue
+			}
+			result, err := organizationFor(app, org, membership.GetString("role"))
+			if err != nil {
+				return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch organizations"})
+			}
+			orgs = append(orgs, result)
+		}
+
+		return e.JSON(http.StatusOK, orgs)
+	}).Bind(RequireAuth(app))
+
+	// Get an organization
+	se.Router.GET("/api/org/{id}", func(e *core.RequestEvent) error {
+		org, membership, ok := orgForMember(app, e)
+		if !ok {
+			return nil
+		}
+
+		result, err := organizationFor(app, org, membership.GetString("role"))
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load organization"})
+		}
+		return e.JSON(http.StatusOK, result)
+	}).Bind(RequireAuth(app))
+
+	// Join as a student with the organization's code, taking a seat
+	se.Router.POST("/api/org/join", func(e *core.RequestEvent) error {
+		var req struct {
+			JoinCode string `json:"joinCode"`
+		}
+		if err := e.BindBody(&req); err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+
+		code := strings.ToUpper(strings.TrimSpace(req.JoinCode))
+		if len(code) != OrgJoinCodeLength {
+			return e.JSON(http.StatusNotFound, map[string]string{"error": "Invalid join code"})
+		}
+
+		org, err := app.FindFirstRecordByFilter("organizations", "joinCode = {:code}", map[string]any{"code": code})
+		if err != nil {
+			return e.JSON(http.StatusNotFound, map[string]string{"error": "Invalid join code"})
+		}
+
+		if !addOrgMember(app, e, org, e.Auth, OrgRoleStudent, "") {
+			return nil
+		}
+
+		result, err := organizationFor(app, org, OrgRoleStudent)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load organization"})
+		}
+		return e.JSON(http.StatusOK, result)
+	}).Bind(RequireAuth(app))
+
+	// Regenerate the join code (owner only)
+	se.Router.POST("/api/org/{id}/join-code", func(e *core.RequestEvent) error {
+		org, membership, ok := orgForMember(app, e)
+		if !ok {
+			return nil
+		}
+		if membership.GetString("role") != OrgRoleOwner {
+			return e.JSON(http.StatusForbidden, map[string]string{"error": "Only the organization owner can change the join code"})
+		}
+
+		code, err := newOrgJoinCode(app)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate join code"})
+		}
+		org.Set("joinCode", code)
+		if err := app.Save(org); err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate join code"})
+		}
+
+		return e.JSON(http.StatusOK, map[string]string{"joinCode": code})
+	}).Bind(RequireAuth(app))
+
+	// List members (owners and instructors)
+	// ?role=owner|instructor|student
+	se.Router.GET("/api/org/{id}/members", func(e *core.RequestEvent) error {
+		org, membership, ok := orgForMember(app, e)
+		if !ok {
+			return nil
+		}
+		if !isOrgStaff(membership.GetString("role")) {
+			return e.JSON(http.StatusForbidden, map[string]string{"error": "Instructor access required"})
+		}
+
+		filter := "organization = {:orgId}"
+		params := map[string]any{"orgId": org.Id}
+		if role := e.Request.URL.Query().Get("role"); role != "" {
+			filter += " && role = {:role}"
+			params["role"] = role
+		}
+
+		records, err := app.FindRecordsByFilter("org_members", filter, "created", 0, 0, params)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch members"})
+		}
+		if errs := app.ExpandRecords(records, []string{"user"}, nil); len(errs) > 0 {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch members"})
+		}
+
+		members := make([]OrgMember, 0, len(records))
+		for _, record := range records {
+			user := record.ExpandedOne("user")
+			if user == nil {
+				continue
+			}
+			members = append(members, OrgMember{
+				UserID:   user.Id,
+				Name:     user.GetString("name"),
+				Email:    user.Email(),
+				Role:     record.GetString("role"),
+				JoinedAt: formatAPIDate(record.GetDateTime("created")),
+			})
+		}
+
+		return e.JSON(http.StatusOK, members)
+	}).Bind(RequireAuth(app))
+
+	// Remove a member (owner: anyone, instructor: students), or leave the
+	// organization (the member themselves). Students give up their seat.
+	se.Router.DELETE("/api/org/{id}/members/{userId}", func(e *core.RequestEvent) error {
+		org, membership, ok := orgForMember(app, e)
+		if !ok {
+			return nil
+		}
+
+		userID := e.Request.PathValue("userId")
+		target, err := findOrgMembership(app, org.Id, userID)
+		if err != nil {
+			return e.JSON(http.StatusNotFound, map[string]string{"error": "Member not found"})
+		}
+
+		role := membership.GetString("role")
+		targetRole := target.GetString("role")
+		switch {
+		case targetRole == OrgRoleOwner:
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "The owner can't be removed from the organization"})
+		case userID == e.Auth.Id:
+			// Leaving
+		case role == OrgRoleOwner:
+		case role == OrgRoleInstructor && targetRole == OrgRoleStudent:
+		default:
+			return e.JSON(http.StatusForbidden, map[string]string{"error": "Not allowed to remove this member"})
+		}
+
+		if err := app.Delete(target); err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to remove member"})
+		}
+
+		if targetRole == OrgRoleStudent {
+			if user, err := app.FindRecordById("users", userID); err == nil {
+				if _, err := syncPremium(app, user); err != nil {
+					app.Logger().Error("Failed to update premium after leaving organization", "error", err)
+				}
+			}
+		}
+
+		return e.JSON(http.StatusOK, map[string]bool{"success": true})
+	}).Bind(RequireAuth(app))
+
+	// Instructor dashboard: every student with their headline progress
+	se.Router.GET("/api/org/{id}/students", func(e *core.RequestEvent) error {
+		org, membership, ok := orgForMember(app, e)
+		if !ok {
+			return nil
+		}
+		if !isOrgStaff(membership.GetString("role")) {
+			return e.JSON(http.StatusForbidden, map[string]string{"error": "Instructor access required"})
+		}
+
+		students, err := orgStudentSummaries(app, org.Id, "")
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch students"})
+		}
+
+		return e.JSON(http.StatusOK, students)
+	}).Bind(RequireAuth(app))
+
+	// Instructor dashboard: one student's progress, test history and weak categories
+	se.Router.GET("/api/org/{id}/students/{userId}", func(e *core.RequestEvent) error {
+		org, membership, ok := orgForMember(app, e)
+		if !ok {
+			return nil
+		}
+		if !isOrgStaff(membership.GetString("role")) {
+			return e.JSON(http.StatusForbidden, map[string]string{"error": "Instructor access required"})
+		}
+
+		userID := e.Request.PathValue("userId")
+		summaries, err := orgStudentSummaries(app, org.Id, userID)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch student"})
+		}
+		if len(summaries) == 0 {
+			return e.JSON(http.StatusNotFound, map[string]string{"error": "Student not found"})
+		}
+
+		detail := OrgStudentDetail{Student: summaries[0]}
+
+		if progress, err := app.FindFirstRecordByFilter("user_progress", "user = {:userId}", map[string]any{"userId": userID}); err == nil {
+			detail.CategoryProgress = progress.Get("categoryProgress")
+		}
+
+		detail.TestHistory, err = orgTestHistory(app, userID)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch test history"})
+		}
+
+		analysis, err := analyzeWeakSpots(app, userID, time.Now().UTC())
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch answer history"})
+		}
+		detail.WeakCategories = analysis.categories
+		if len(detail.WeakCategories) > OrgWeakCategoryLimit {
+			detail.WeakCategories = detail.WeakCategories[:OrgWeakCategoryLimit]
+		}
+
+		return e.JSON(http.StatusOK, detail)
+	}).Bind(RequireAuth(app))
+
+	registerOrgInviteRoutes(app, se)
+}
+
+var errOrgNoSeats = errors.New("no seats available")
+
+// addOrgMember adds a user to an organization. Students take a seat, which
+// is checked in the same transaction, and are granted premium. It writes the
+// error response itself and returns ok=false on failure.
+func addOrgMember(app core.App, e *core.RequestEvent, org, user *core.Record, role, addedBy string) bool {
+	if _, err := findOrgMembership(app, org.Id, user.Id); err == nil {
+		e.JSON(http.StatusConflict, map[string]string{"error": "Already a member of this organization"})
+		return false
+	}
+
+	membersCollection, err := app.FindCollectionByNameOrId("org_members")
+	if err != nil {
+		e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to add member"})
+		return false
+	}
+
+	var license *core.Record
+	err = app.RunInTransaction(func(txApp core.App) error {
+		if role == OrgRoleStudent {
+			var seats int
+			seats, license, err = orgSeats(txApp, org.Id)
+			if err != nil {
+				return err
+			}
+			used, err := orgStudentCount(txApp, org.Id)
+			if err != nil {
+				return err
+			}
+			if used >= seats {
+				return errOrgNoSeats
+			}
+		}
+
+		member := core.NewRecord(membersCollection)
+		member.Set("organization", org.Id)
+		member.Set("user", user.Id)
+		member.Set("role", role)
+		member.Set("addedBy", addedBy)
+		return txApp.Save(member)
+	})
+	if errors.Is(err, errOrgNoSeats) {
+		e.JSON(http.StatusForbidden, map[string]string{"error": "This organization has no free seats"})
+		return false
+	}
+	if err != nil {
+		e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to add member"})
+		return false
+	}
+
+	if license != nil {
+		if _, err := syncPremium(app, user); err != nil {
+			app.Logger().Error("Failed to grant organization premium", "error", err)
+		}
+	}
+	return true
+}
+
+// orgSeats returns how many seats an organization's current licenses cover,
+// and the license whose terms students get (the one that lasts longest)
+func orgSeats(app core.App, orgID string) (int, *core.Record, error) {
+	licenses, err := app.FindRecordsByFilter(
+		"licenses",
+		"organization = {:orgId} && isRevoked = false && (expiresAt = '' || expiresAt > {:now})",
+		"",
+		0,
+		0,
+		map[string]any{"orgId": orgID, "now": types.NowDateTime().String()},
+	)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	seats := 0
+	var best *core.Record
+	for _, license := range licenses {
+		seats += license.GetInt("seats")
+		if best == nil || outlasts(license, best) {
+			best = license
+		}
+	}
+	return seats, best, nil
+}
+
+// outlasts reports whether license a expires after license b
+func outlasts(a, b *core.Record) bool {
+	aExpiry, bExpiry := a.GetDateTime("expiresAt"), b.GetDateTime("expiresAt")
+	if bExpiry.IsZero() {
+		return false
+	}
+	return aExpiry.IsZero() || aExpiry.Time().After(bExpiry.Time())
+}
+
+// releaseOrgSeats downgrades an organization's students once no license
+// covers it any more. Students keep their seats while any license does.
+func releaseOrgSeats(app core.App, orgID string) error {
+	seats, _, err := orgSeats(app, orgID)
+	if err != nil || seats > 0 {
+		return err
+	}
+	return syncOrgStudents(app, orgID)
+}
+
+// syncOrgStudents recomputes premium for every student of an organization
+// from the licenses that currently cover it
+func syncOrgStudents(app core.App, orgID string) error {
+	memberships, err := app.FindRecordsByFilter(
+		"org_members",
+		"organization = {:orgId} && role = {:role}",
+		"",
+		0,
+		0,
+		map[string]any{"orgId": orgID, "role": OrgRoleStudent},
+	)
+	if err != nil {
+		return err
+	}
+	if errs := app.ExpandRecords(memberships, []string{"user"}, nil); len(errs) > 0 {
+		return errors.New("failed to load organization students")
+	}
+
+	for _, membership := range memberships {
+		if user := membership.ExpandedOne("user"); user != nil {
+			if _, err := syncPremium(app, user); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func orgStudentCount(app core.App, orgID string) (int, error) {
+	count, err := app.CountRecords("org_members", dbx.HashExp{"organization": orgID, "role": OrgRoleStudent})
+	return int(count), err
+}
+
+func isOrgStaff(role string) bool {
+	return role == OrgRoleOwner || role == OrgRoleInstructor
+}
+
+// orgForMember loads the {id} organization of the request and the caller's
+// membership. It writes the error response itself and returns ok=false on failure.
+func orgForMember(app core.App, e *core.RequestEvent) (*core.Record, *core.Record, bool) {
+	org, err := app.FindRecordById("organizations", e.Request.PathValue("id"))
+	if err != nil {
+		e.JSON(http.StatusNotFound, map[string]string{"error": "Organization not found"})
+		return nil, nil, false
+	}
+
+	membership, err := findOrgMembership(app, org.Id, e.Auth.Id)
+	if err != nil {
+		e.JSON(http.StatusForbidden, map[string]string{"error": "Not a member of this organization"})
+		return nil, nil, false
+	}
+
+	return org, membership, true
+}
+
+func findOrgMembership(app core.App, orgID, userID string) (*core.Record, error) {
+	return app.FindFirstRecordByFilter(
+		"org_members",
+		"organization = {:orgId} && user = {:userId}",
+		map[string]any{"orgId": orgID, "userId": userID},
+	)
+}
+
+// newOrgJoinCode generates a join code no other organization uses
+func newOrgJoinCode(app core.App) (string, error) {
+	for attempt := 0; attempt < 5; attempt++ {
+		code := security.RandomStringWithAlphabet(OrgJoinCodeLength, licenseChars)
+		if _, err := app.FindFirstRecordByFilter("organizations", "joinCode = {:code}", map[string]any{"code": code}); err != nil {
+			return code, nil
+		}
+	}
+	return "", errors.New("failed to generate a unique join code")
+}
+
+func organizationFor(app core.App, org *core.Record, role string) (Organization, error) {
+	seats, license, err := orgSeats(app, org.Id)
+	if err != nil {
+		return Organization{}, err
+	}
+	used, err := orgStudentCount(app, org.Id)
+	if err != nil {
+		return Organization{}, err
+	}
+
+	result := Organization{
+		ID:        org.Id,
+		Name:      org.GetString("name"),
+		Role:      role,
+		Seats:     seats,
+		SeatsUsed: used,
+		Created:   formatAPIDate(org.GetDateTime("created")),
+	}
+	if license != nil {
+		result.LicenseExpiresAt = formatAPIDate(license.GetDateTime("expiresAt"))
+	}
+	if isOrgStaff(role) {
+		result.ContactEmail = org.GetString("contactEmail")
+		result.JoinCode = org.GetString("joinCode")
+	}
+	return result, nil
+}
+
+// orgStudentSummaries loads the dashboard rows for an organization's
+// students, or for a single student when userID is set. Test counts and last
+// activity are aggregated in SQL rather than per student.
+func orgStudentSummaries(app core.App, orgID, userID string) ([]OrgStudentSummary, error) {
+	params := dbx.Params{"org": orgID, "role": OrgRoleStudent}
+	where := ""
+	if userID != "" {
+		where = " AND m.user = {:user}"
+		params["user"] = userID
+	}
+
+	var rows []struct {
+		UserID             string `db:"userId"`
+		Name               string `db:"name"`
+		Email              string `db:"email"`
+		Avatar             string `db:"avatar"`
+		JoinedAt           string `db:"joinedAt"`
+		XP                 int    `db:"xp"`
+		Level              int    `db:"level"`
+		Streak             int    `db:"streak"`
+		QuestionsCompleted int    `db:"questionsCompleted"`
+		QuestionsCorrect   int    `db:"questionsCorrect"`
+		TestsTaken         int    `db:"testsTaken"`
+		TestsPassed        int    `db:"testsPassed"`
+		LastActiveAt       string `db:"lastActiveAt"`
+	}
+	err := app.DB().NewQuery(`
+		SELECT
+			u.id AS userId,
+			u.name AS name,
+			u.email AS email,
+			u.avatar AS avatar,
+			m.created AS joinedAt,
+			COALESCE(u.xp, 0) AS xp,
+			COALESCE(u.level, 0) AS level,
+			COALESCE(u.streak, 0) AS streak,
+			COALESCE(u.questionsCompleted, 0) AS questionsCompleted,
+			COALESCE(u.questionsCorrect, 0) AS questionsCorrect,
+			COALESCE(t.taken, 0) AS testsTaken,
+			COALESCE(t.passed, 0) AS testsPassed,
+			COALESCE(a.lastAt, '') AS lastActiveAt
+		FROM org_members m
+		JOIN users u ON u.id = m.user
+		LEFT JOIN (
+			SELECT s.user AS user, COUNT(*) AS taken,
+				SUM(CASE WHEN json_valid(s.results) AND json_extract(s.results, '$.passed') THEN 1 ELSE 0 END) AS passed
+			FROM question_sessions s
+			JOIN org_members sm ON sm.user = s.user AND sm.organization = {:org} AND sm.role = {:role}
+			WHERE s.sessionType = 'test' AND s.status = 'completed'
+			GROUP BY s.user
+		) t ON t.user = m.user
+		LEFT JOIN (
+			SELECT qa.user AS user, MAX(qa.created) AS lastAt
+			FROM question_attempts qa
+			JOIN org_members am ON am.user = qa.user AND am.organization = {:org} AND am.role = {:role}
+			GROUP BY qa.user
+		) a ON a.user = m.user
+		WHERE m.organization = {:org} AND m.role = {:role}` + where).
+		Bind(params).
+		All(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	students := make([]OrgStudentSummary, 0, len(rows))
+	for _, row := range rows {
+		student := OrgStudentSummary{
+			UserID:             row.UserID,
+			Name:               row.Name,
+			Email:              row.Email,
+			Avatar:             row.Avatar,
+			XP:                 row.XP,
+			Level:              row.Level,
+			Streak:             row.Streak,
+			QuestionsCompleted: row.QuestionsCompleted,
+			TestsTaken:         row.TestsTaken,
+			TestsPassed:        row.TestsPassed,
+		}
+		if row.QuestionsCompleted > 0 {
+			student.Accuracy = roundRate(float64(row.QuestionsCorrect) / float64(row.QuestionsCompleted))
+		}
+		if joined, err := types.ParseDateTime(row.JoinedAt); err == nil {
+			student.JoinedAt = formatAPIDate(joined)
+		}
+		if last, err := types.ParseDateTime(row.LastActiveAt); err == nil {
+			student.LastActiveAt = formatAPIDate(last)
+		}
+		students = append(students, student)
+	}
+
+	sort.Slice(students, func(i, j int) bool {
+		return strings.ToLower(students[i].Name) < strings.ToLower(students[j].Name)
+	})
+	return students, nil
+}
+
+// orgTestHistory returns a student's most recent completed mock tests
+func orgTestHistory(app core.App, userID string) ([]OrgTestResult, error) {
+	sessions, err := app.FindRecordsByFilter(
+		"question_sessions",
+		"user = {:userId} && sessionType = 'test' && status = 'completed'",
+		"-completedAt",
+		OrgTestHistoryLimit,
+		0,
+		map[string]any{"userId": userID},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]OrgTestResult, 0, len(sessions))
+	for _, session := range sessions {
+		var results TestCompleteResponse
+		if err := json.Unmarshal([]byte(session.GetString("results")), &results); err != nil {
+			continue
+		}
+		history = append(history, OrgTestResult{
+			SessionID:         session.Id,
+			CompletedAt:       formatAPIDate(session.GetDateTime("completedAt")),
+			Score:             results.Score,
+			TotalQuestions:    results.TotalQuestions,
+			Passed:            results.Passed,
+			TimeSpent:         results.TimeSpent,
+			Blueprint:         results.Blueprint,
+			CategoryBreakdown: results.CategoryBreakdown,
+			Flagged:           results.Flagged,
+		})
+	}
+	return history, nil
+}
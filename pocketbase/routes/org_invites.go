@@ -0,0 +1,276 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Staff don't add people to an organization directly: they invite an email
+// address, and whoever holds a verified account with that address joins by
+// accepting. Inviting answers the same whether or not the address has an
+// account, so the endpoint can't be used to find out who is registered.
+
+// OrgInviteTTL is how long an invite can be accepted
+const OrgInviteTTL = 14 * 24 * time.Hour
+
+// OrgInvite is a pending invite, as listed to the organization's staff
+type OrgInvite struct {
+	ID        string `json:"id"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	InvitedAt string `json:"invitedAt"`
+	ExpiresAt string `json:"expiresAt"`
+}
+
+// ReceivedOrgInvite is a pending invite, as listed to the invitee
+type ReceivedOrgInvite struct {
+	ID               string `json:"id"`
+	OrganizationID   string `json:"organizationId"`
+	OrganizationName string `json:"organizationName"`
+	Role             string `json:"role"`
+	ExpiresAt        string `json:"expiresAt"`
+}
+
+// registerOrgInviteRoutes registers the organization invite routes
+func registerOrgInviteRoutes(app core.App, se *core.ServeEvent) {
+	// Invite an email address. Owners invite instructors and students,
+	// instructors invite students. Inviting again renews the invite.
+	se.Router.POST("/api/org/{id}/invites", func(e *core.RequestEvent) error {
+		org, membership, ok := orgForMember(app, e)
+		if !ok {
+			return nil
+		}
+
+		var req struct {
+			Email string `json:"email"`
+			Role  string `json:"role"`
+		}
+		if err := e.BindBody(&req); err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+		if req.Role == "" {
+			req.Role = OrgRoleStudent
+		}
+
+		switch {
+		case req.Role != OrgRoleStudent && req.Role != OrgRoleInstructor:
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "role must be student or instructor"})
+		case req.Role == OrgRoleInstructor && membership.GetString("role") != OrgRoleOwner:
+			return e.JSON(http.StatusForbidden, map[string]string{"error": "Only the organization owner can invite instructors"})
+		case !isOrgStaff(membership.GetString("role")):
+			return e.JSON(http.StatusForbidden, map[string]string{"error": "Instructor access required"})
+		}
+
+		email := strings.ToLower(strings.TrimSpace(req.Email))
+		if email == "" || !strings.Contains(email, "@") {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "A valid email address is required"})
+		}
+
+		// Existing members aren't invited again, but the response doesn't say
+		// so: it would tell the caller the address has an account
+		if user, err := app.FindAuthRecordByEmail("users", email); err == nil {
+			if _, err := findOrgMembership(app, org.Id, user.Id); err == nil {
+				return e.JSON(http.StatusAccepted, map[string]string{"status": "invited", "email": email})
+			}
+		}
+
+		invite, err := app.FindFirstRecordByFilter(
+			"org_invites",
+			"organization = {:orgId} && email = {:email}",
+			map[string]any{"orgId": org.Id, "email": email},
+		)
+		if err != nil {
+			collection, err := app.FindCollectionByNameOrId("org_invites")
+			if err != nil {
+				return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create invite"})
+			}
+			invite = core.NewRecord(collection)
+			invite.Set("organization", org.Id)
+			invite.Set("email", email)
+		}
+		invite.Set("role", req.Role)
+		invite.Set("invitedBy", e.Auth.Id)
+		invite.Set("expiresAt", time.Now().UTC().Add(OrgInviteTTL))
+		if err := app.Save(invite); err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create invite"})
+		}
+
+		return e.JSON(http.StatusAccepted, map[string]string{"status": "invited", "email": email})
+	}).Bind(RequireAuth(app))
+
+	// List pending invites (owners and instructors)
+	se.Router.GET("/api/org/{id}/invites", func(e *core.RequestEvent) error {
+		org, membership, ok := orgForMember(app, e)
+		if !ok {
+			return nil
+		}
+		if !isOrgStaff(membership.GetString("role")) {
+			return e.JSON(http.StatusForbidden, map[string]string{"error": "Instructor access required"})
+		}
+
+		records, err := app.FindRecordsByFilter(
+			"org_invites",
+			"organization = {:orgId} && expiresAt > {:now}",
+			"-created",
+			0,
+			0,
+			map[string]any{"orgId": org.Id, "now": types.NowDateTime().String()},
+		)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch invites"})
+		}
+
+		invites := make([]OrgInvite, 0, len(records))
+		for _, record := range records {
+			invites = append(invites, OrgInvite{
+				ID:        record.Id,
+				Email:     record.GetString("email"),
+				Role:      record.GetString("role"),
+				InvitedAt: formatAPIDate(record.GetDateTime("updated")),
+				ExpiresAt: formatAPIDate(record.GetDateTime("expiresAt")),
+			})
+		}
+
+		return e.JSON(http.StatusOK, invites)
+	}).Bind(RequireAuth(app))
+
+	// Withdraw an invite (owner: any, instructor: student invites)
+	se.Router.DELETE("/api/org/{id}/invites/{inviteId}", func(e *core.RequestEvent) error {
+		org, membership, ok := orgForMember(app, e)
+		if !ok {
+			return nil
+		}
+
+		invite, err := app.FindFirstRecordByFilter(
+			"org_invites",
+			"id = {:id} && organization = {:orgId}",
+			map[string]any{"id": e.Request.PathValue("inviteId"), "orgId": org.Id},
+		)
+		if err != nil {
+			return e.JSON(http.StatusNotFound, map[string]string{"error": "Invite not found"})
+		}
+
+		switch role := membership.GetString("role"); {
+		case role == OrgRoleOwner:
+		case role == OrgRoleInstructor && invite.GetString("role") == OrgRoleStudent:
+		default:
+			return e.JSON(http.StatusForbidden, map[string]string{"error": "Not allowed to withdraw this invite"})
+		}
+
+		if err := app.Delete(invite); err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to withdraw invite"})
+		}
+
+		return e.JSON(http.StatusOK, map[string]bool{"success": true})
+	}).Bind(RequireAuth(app))
+
+	// List the invites addressed to the current user's verified email
+	se.Router.GET("/api/org/invites", func(e *core.RequestEvent) error {
+		if !e.Auth.Verified() {
+			return e.JSON(http.StatusOK, []ReceivedOrgInvite{})
+		}
+
+		records, err := app.FindRecordsByFilter(
+			"org_invites",
+			"email = {:email} && expiresAt > {:now}",
+			"-created",
+			0,
+			0,
+			map[string]any{"email": strings.ToLower(e.Auth.Email()), "now": types.NowDateTime().String()},
+		)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch invites"})
+		}
+		if errs := app.ExpandRecords(records, []string{"organization"}, nil); len(errs) > 0 {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch invites"})
+		}
+
+		invites := make([]ReceivedOrgInvite, 0, len(records))
+		for _, record := range records {
+			org := record.ExpandedOne("organization")
+			if org == nil {
+				continue
+			}
+			invites = append(invites, ReceivedOrgInvite{
+				ID:               record.Id,
+				OrganizationID:   org.Id,
+				OrganizationName: org.GetString("name"),
+				Role:             record.GetString("role"),
+				ExpiresAt:        formatAPIDate(record.GetDateTime("expiresAt")),
+			})
+		}
+
+		return e.JSON(http.StatusOK, invites)
+	}).Bind(RequireAuth(app))
+
+	// Accept an invite, joining the organization (students take a seat)
+	se.Router.POST("/api/org/invites/{inviteId}/accept", func(e *core.RequestEvent) error {
+		invite, ok := receivedOrgInvite(app, e)
+		if !ok {
+			return nil
+		}
+
+		org, err := app.FindRecordById("organizations", invite.GetString("organization"))
+		if err != nil {
+			return e.JSON(http.StatusNotFound, map[string]string{"error": "Invite not found"})
+		}
+
+		role := invite.GetString("role")
+		if !addOrgMember(app, e, org, e.Auth, role, invite.GetString("invitedBy")) {
+			return nil
+		}
+		if err := app.Delete(invite); err != nil {
+			app.Logger().Error("Failed to delete accepted invite", "error", err)
+		}
+
+		result, err := organizationFor(app, org, role)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load organization"})
+		}
+		return e.JSON(http.StatusOK, result)
+	}).Bind(RequireAuth(app))
+
+	// Decline an invite
+	se.Router.POST("/api/org/invites/{inviteId}/decline", func(e *core.RequestEvent) error {
+		invite, ok := receivedOrgInvite(app, e)
+		if !ok {
+			return nil
+		}
+
+		if err := app.Delete(invite); err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to decline invite"})
+		}
+
+		return e.JSON(http.StatusOK, map[string]bool{"success": true})
+	}).Bind(RequireAuth(app))
+}
+
+// receivedOrgInvite loads the {inviteId} invite if it is pending and
+// addressed to the caller's verified email. It writes the error response
+// itself and returns ok=false on failure.
+func receivedOrgInvite(app core.App, e *core.RequestEvent) (*core.Record, bool) {
+	if !e.Auth.Verified() {
+		e.JSON(http.StatusForbidden, map[string]string{"error": "Verify your email address to accept invites"})
+		return nil, false
+	}
+
+	invite, err := app.FindFirstRecordByFilter(
+		"org_invites",
+		"id = {:id} && email = {:email} && expiresAt > {:now}",
+		map[string]any{
+			"id":    e.Request.PathValue("inviteId"),
+			"email": strings.ToLower(e.Auth.Email()),
+			"now":   types.NowDateTime().String(),
+		},
+	)
+	if err != nil {
+		e.JSON(http.StatusNotFound, map[string]string{"error": "Invite not found"})
+		return nil, false
+	}
+
+	return invite, true
+}
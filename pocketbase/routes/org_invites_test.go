@@ -0,0 +1,194 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// newTestOrg creates an organization owned by owner with a license
+// covering the given number of seats
+func newTestOrg(tb testing.TB, app core.App, owner *core.Record, seats int) *core.Record {
+	tb.Helper()
+
+	org := newTestRecord(tb, app, "organizations", map[string]any{"name": "Test Driving School", "joinCode": "TESTCODE"})
+	newTestRecord(tb, app, "org_members", map[string]any{"organization": org.Id, "user": owner.Id, "role": OrgRoleOwner})
+	newTestRecord(tb, app, "licenses", map[string]any{
+		"key":            "TEST-LICENSE",
+		"type":           "enterprise",
+		"plan":           "yearly",
+		"maxActivations": seats,
+		"isActive":       true,
+		"organization":   org.Id,
+		"seats":          seats,
+	})
+	return org
+}
+
+func TestOrgInviteDoesNotRevealAccounts(t *testing.T) {
+	app := newTestApp(t)
+	owner := newTestUser(t, app, "owner@example.com", nil)
+	newTestUser(t, app, "student@example.com", nil)
+	org := newTestOrg(t, app, owner, 5)
+
+	mux := newTestRouter(t, app, func(se *core.ServeEvent) {
+		RegisterOrgRoutes(app, se)
+	})
+
+	path := "/api/org/" + org.Id + "/invites"
+	existing := serveTestRequest(t, mux, owner, http.MethodPost, path, `{"email":"student@example.com"}`)
+	missing := serveTestRequest(t, mux, owner, http.MethodPost, path, `{"email":"nobody@example.com"}`)
+	member := serveTestRequest(t, mux, owner, http.MethodPost, path, `{"email":"owner@example.com"}`)
+
+	for _, rec := range []struct {
+		email string
+		code  int
+		body  string
+	}{
+		{"student@example.com", existing.Code, strings.TrimSpace(existing.Body.String())},
+		{"nobody@example.com", missing.Code, strings.TrimSpace(missing.Body.String())},
+		{"owner@example.com", member.Code, strings.TrimSpace(member.Body.String())},
+	} {
+		want := `{"email":"` + rec.email + `","status":"invited"}`
+		if rec.code != http.StatusAccepted || rec.body != want {
+			t.Errorf("invite %s: %d %s, want %d %s", rec.email, rec.code, rec.body, http.StatusAccepted, want)
+		}
+	}
+
+	// Nobody joins until they accept
+	if _, err := findOrgMembership(app, org.Id, owner.Id); err != nil {
+		t.Fatal(err)
+	}
+	count, err := orgStudentCount(app, org.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("students = %d before anyone accepted, want 0", count)
+	}
+
+	// The existing member isn't invited
+	invites, err := app.FindAllRecords("org_invites")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invites) != 2 {
+		t.Fatalf("invites = %d, want 2", len(invites))
+	}
+}
+
+func TestOrgInviteAccept(t *testing.T) {
+	app := newTestApp(t)
+	owner := newTestUser(t, app, "owner@example.com", nil)
+	student := newTestUser(t, app, "student@example.com", nil)
+	other := newTestUser(t, app, "other@example.com", map[string]any{"verified": true})
+	org := newTestOrg(t, app, owner, 5)
+
+	mux := newTestRouter(t, app, func(se *core.ServeEvent) {
+		RegisterOrgRoutes(app, se)
+	})
+
+	rec := serveTestRequest(t, mux, owner, http.MethodPost, "/api/org/"+org.Id+"/invites", `{"email":"Student@Example.com"}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("invite: %d %s", rec.Code, rec.Body.String())
+	}
+	invite, err := app.FindFirstRecordByData("org_invites", "email", "student@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acceptPath := "/api/org/invites/" + invite.Id + "/accept"
+
+	// Unverified addresses can't accept
+	if rec := serveTestRequest(t, mux, student, http.MethodPost, acceptPath, ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("unverified accept: %d %s, want 403", rec.Code, rec.Body.String())
+	}
+
+	// Nor can anyone else
+	if rec := serveTestRequest(t, mux, other, http.MethodPost, acceptPath, ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("accept by another user: %d %s, want 404", rec.Code, rec.Body.String())
+	}
+
+	student.SetVerified(true)
+	if err := app.Save(student); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := serveTestRequest(t, mux, student, http.MethodGet, "/api/org/invites", ""); rec.Code != http.StatusOK ||
+		!containsAll(rec.Body.String(), invite.Id, "Test Driving School") {
+		t.Fatalf("received invites: %d %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := serveTestRequest(t, mux, student, http.MethodPost, acceptPath, ""); rec.Code != http.StatusOK {
+		t.Fatalf("accept: %d %s", rec.Code, rec.Body.String())
+	}
+
+	membership, err := findOrgMembership(app, org.Id, student.Id)
+	if err != nil {
+		t.Fatalf("student isn't a member after accepting: %v", err)
+	}
+	if role := membership.GetString("role"); role != OrgRoleStudent {
+		t.Fatalf("role = %q, want %q", role, OrgRoleStudent)
+	}
+	if addedBy := membership.GetString("addedBy"); addedBy != owner.Id {
+		t.Fatalf("addedBy = %q, want the inviter %q", addedBy, owner.Id)
+	}
+	if _, err := app.FindRecordById("org_invites", invite.Id); err == nil {
+		t.Fatal("accepted invite wasn't deleted")
+	}
+
+	// The invite can't be used twice
+	if rec := serveTestRequest(t, mux, student, http.MethodPost, acceptPath, ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("second accept: %d %s, want 404", rec.Code, rec.Body.String())
+	}
+}
+
+func TestOrgInviteRoles(t *testing.T) {
+	app := newTestApp(t)
+	owner := newTestUser(t, app, "owner@example.com", nil)
+	instructor := newTestUser(t, app, "instructor@example.com", nil)
+	student := newTestUser(t, app, "student@example.com", nil)
+	org := newTestOrg(t, app, owner, 5)
+
+	for user, role := range map[*core.Record]string{instructor: OrgRoleInstructor, student: OrgRoleStudent} {
+		newTestRecord(t, app, "org_members", map[string]any{"organization": org.Id, "user": user.Id, "role": role})
+	}
+
+	mux := newTestRouter(t, app, func(se *core.ServeEvent) {
+		RegisterOrgRoutes(app, se)
+	})
+	path := "/api/org/" + org.Id + "/invites"
+
+	cases := []struct {
+		name string
+		user *core.Record
+		body string
+		want int
+	}{
+		{"owner invites an instructor", owner, `{"email":"a@example.com","role":"instructor"}`, http.StatusAccepted},
+		{"instructor invites a student", instructor, `{"email":"b@example.com"}`, http.StatusAccepted},
+		{"instructor invites an instructor", instructor, `{"email":"c@example.com","role":"instructor"}`, http.StatusForbidden},
+		{"student invites a student", student, `{"email":"d@example.com"}`, http.StatusForbidden},
+		{"owner invites an owner", owner, `{"email":"e@example.com","role":"owner"}`, http.StatusBadRequest},
+		{"invalid email", owner, `{"email":"not-an-email"}`, http.StatusBadRequest},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if rec := serveTestRequest(t, mux, c.user, http.MethodPost, path, c.body); rec.Code != c.want {
+				t.Fatalf("status %d %s, want %d", rec.Code, rec.Body.String(), c.want)
+			}
+		})
+	}
+}
+
+// containsAll reports whether s contains every one of the substrings
+func containsAll(s string, substrings ...string) bool {
+	for _, sub := range substrings {
+		if !strings.Contains(s, sub) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,84 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/stripe/stripe-go/v76"
+)
+
+// Checkout, the billing portal, cancelling and resuming subscriptions and
+// webhook verification go through a PaymentProvider. PAYMENT_PROVIDER picks
+// it: "stripe" (the default) talks to Stripe, "fake" keeps everything in
+// memory so the purchase flow can run without Stripe, e.g. in integration
+// tests. Webhook events are stored and applied in Stripe's event format
+// whatever the provider; a provider for another processor translates its
+// events into it.
+
+var (
+	// ErrPlanNotConfigured is returned by CreateCheckout for plans with no
+	// price configured
+	ErrPlanNotConfigured = errors.New("price not configured for this plan")
+	// ErrWebhookSignature is returned by VerifyWebhook for payloads that
+	// weren't signed by the provider
+	ErrWebhookSignature = errors.New("invalid webhook signature")
+)
+
+// CheckoutParams describes a checkout for one plan. The user and plan come
+// from the server, never the client.
+type CheckoutParams struct {
+	UserID     string
+	Email      string
+	CustomerID string // Existing customer, if any
+	Plan       string
+	SuccessURL string
+	CancelURL  string
+}
+
+// PaymentCheckout is a checkout session the user is sent to
+type PaymentCheckout struct {
+	ID  string
+	URL string
+}
+
+// PaymentProvider is the payment processor behind checkout and subscriptions
+type PaymentProvider interface {
+	SubscriptionSource
+
+	// Name identifies the provider in logs
+	Name() string
+	// CreateCheckout starts a checkout. Completing it delivers a
+	// checkout.session.completed event with the user ID and plan in its
+	// metadata.
+	CreateCheckout(params CheckoutParams) (*PaymentCheckout, error)
+	// CreatePortalSession returns the URL of the customer's billing portal
+	CreatePortalSession(customerID, returnURL string) (string, error)
+	// CancelSubscription cancels a subscription at the end of its period
+	CancelSubscription(subscriptionID string) error
+	// ResumeSubscription undoes CancelSubscription
+	ResumeSubscription(subscriptionID string) error
+	// VerifyWebhook checks a webhook's signature and parses its event
+	VerifyWebhook(payload []byte, header http.Header) (stripe.Event, error)
+}
+
+// NewPaymentProvider returns the provider PAYMENT_PROVIDER names. The fake
+// grants premium to anyone who opens a checkout URL, so it's refused unless
+// the app runs in dev mode (--dev) or PAYMENT_PROVIDER_ALLOW_FAKE=true is
+// set for an integration test environment.
+func NewPaymentProvider(app core.App) (PaymentProvider, error) {
+	switch name := os.Getenv("PAYMENT_PROVIDER"); name {
+	case "", "stripe":
+		return NewStripePaymentProvider(), nil
+	case "fake":
+		if !app.IsDev() && os.Getenv("PAYMENT_PROVIDER_ALLOW_FAKE") != "true" {
+			return nil, errors.New("PAYMENT_PROVIDER=fake gives premium away: it needs --dev or PAYMENT_PROVIDER_ALLOW_FAKE=true")
+		}
+		app.Logger().Warn("PAYMENT_PROVIDER=fake: checkouts grant premium without payment. Never run this in production.")
+		return NewFakePaymentProvider(), nil
+	default:
+		return nil, fmt.Errorf("unknown PAYMENT_PROVIDER %q: use stripe or fake", name)
+	}
+}
@@ -0,0 +1,299 @@
+package routes
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"github.com/stripe/stripe-go/v76"
+	"github.com/stripe/stripe-go/v76/webhook"
+)
+
+// The fake provider keeps checkouts and subscriptions in memory and signs
+// Stripe-format webhook events with a per-process secret, so a purchase
+// runs end to end without Stripe: checkout URLs point at a local route that
+// completes the checkout, delivers checkout.session.completed through the
+// normal event pipeline and redirects to the success URL. Nothing is
+// charged and everything is forgotten on restart. Never enable it in
+// production.
+
+// ErrFakeCheckoutNotFound is returned for checkouts the fake provider didn't create
+var ErrFakeCheckoutNotFound = errors.New("checkout not found")
+
+// FakeWebhook is a signed webhook delivery from the fake provider
+type FakeWebhook struct {
+	Payload []byte
+	Header  http.Header
+}
+
+// FakePaymentProvider is an in-memory PaymentProvider
+type FakePaymentProvider struct {
+	mu            sync.Mutex
+	secret        string
+	baseURL       string // Prefix of checkout URLs, e.g. the app URL
+	checkouts     map[string]*fakeCheckout
+	subscriptions map[string]*RemoteSubscription
+}
+
+type fakeCheckout struct {
+	params    CheckoutParams
+	completed bool
+}
+
+// NewFakePaymentProvider returns an empty in-memory PaymentProvider
+func NewFakePaymentProvider() *FakePaymentProvider {
+	secret := make([]byte, 16)
+	rand.Read(secret)
+
+	return &FakePaymentProvider{
+		secret:        "whsec_fake_" + hex.EncodeToString(secret),
+		checkouts:     map[string]*fakeCheckout{},
+		subscriptions: map[string]*RemoteSubscription{},
+	}
+}
+
+func (p *FakePaymentProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakePaymentProvider) CreateCheckout(params CheckoutParams) (*PaymentCheckout, error) {
+	if params.Plan != PlanMonthly && params.Plan != PlanYearly && params.Plan != PlanLifetime {
+		return nil, ErrPlanNotConfigured
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	id := p.newID("cs_fake")
+	p.checkouts[id] = &fakeCheckout{params: params}
+	return &PaymentCheckout{ID: id, URL: p.baseURL + "/api/payments/fake/checkout/" + id}, nil
+}
+
+func (p *FakePaymentProvider) CreatePortalSession(customerID, returnURL string) (string, error) {
+	// There's no portal to show; go straight back
+	return returnURL, nil
+}
+
+func (p *FakePaymentProvider) CancelSubscription(subscriptionID string) error {
+	return p.setCancelAtPeriodEnd(subscriptionID, true)
+}
+
+func (p *FakePaymentProvider) ResumeSubscription(subscriptionID string) error {
+	return p.setCancelAtPeriodEnd(subscriptionID, false)
+}
+
+func (p *FakePaymentProvider) GetSubscription(id string) (*RemoteSubscription, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sub, ok := p.subscriptions[id]
+	if !ok {
+		return nil, ErrRemoteSubscriptionNotFound
+	}
+	copied := *sub
+	return &copied, nil
+}
+
+func (p *FakePaymentProvider) VerifyWebhook(payload []byte, header http.Header) (stripe.Event, error) {
+	event, err := webhook.ConstructEvent(payload, header.Get("Stripe-Signature"), p.secret)
+	if err != nil {
+		return event, fmt.Errorf("%w: %v", ErrWebhookSignature, err)
+	}
+	return event, nil
+}
+
+// SetBaseURL sets the server URL checkout URLs start with
+func (p *FakePaymentProvider) SetBaseURL(baseURL string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.baseURL = strings.TrimSuffix(baseURL, "/")
+}
+
+// Checkout returns the parameters a checkout was created with
+func (p *FakePaymentProvider) Checkout(id string) (CheckoutParams, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	checkout, ok := p.checkouts[id]
+	if !ok {
+		return CheckoutParams{}, false
+	}
+	return checkout.params, true
+}
+
+// CompleteCheckout pays for a checkout, creating its subscription for
+// monthly and yearly plans, and returns the checkout.session.completed
+// webhook. A checkout can only be completed once.
+func (p *FakePaymentProvider) CompleteCheckout(id string) (FakeWebhook, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	checkout, ok := p.checkouts[id]
+	if !ok {
+		return FakeWebhook{}, ErrFakeCheckoutNotFound
+	}
+	if checkout.completed {
+		return FakeWebhook{}, fmt.Errorf("checkout %s already completed", id)
+	}
+	checkout.completed = true
+
+	customerID := checkout.params.CustomerID
+	if customerID == "" {
+		customerID = p.newID("cus_fake")
+	}
+
+	session := map[string]any{
+		"id":       id,
+		"object":   "checkout.session",
+		"customer": customerID,
+		"mode":     string(stripe.CheckoutSessionModePayment),
+		"metadata": map[string]string{
+			"userId": checkout.params.UserID,
+			"plan":   checkout.params.Plan,
+		},
+	}
+
+	if checkout.params.Plan != PlanLifetime {
+		now := time.Now().UTC().Truncate(time.Second)
+		periodEnd := now.AddDate(0, 1, 0)
+		if checkout.params.Plan == PlanYearly {
+			periodEnd = now.AddDate(1, 0, 0)
+		}
+
+		sub := &RemoteSubscription{
+			ID:                 p.newID("sub_fake"),
+			Status:             string(stripe.SubscriptionStatusActive),
+			CurrentPeriodStart: now,
+			CurrentPeriodEnd:   periodEnd,
+		}
+		p.subscriptions[sub.ID] = sub
+
+		session["mode"] = string(stripe.CheckoutSessionModeSubscription)
+		session["subscription"] = sub.ID
+	}
+
+	return p.event("checkout.session.completed", session)
+}
+
+// EndSubscription ends a subscription immediately, as when its payments
+// stop, and returns the customer.subscription.deleted webhook
+func (p *FakePaymentProvider) EndSubscription(id string) (FakeWebhook, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sub, ok := p.subscriptions[id]
+	if !ok {
+		return FakeWebhook{}, ErrRemoteSubscriptionNotFound
+	}
+	sub.Status = string(stripe.SubscriptionStatusCanceled)
+
+	return p.event("customer.subscription.deleted", map[string]any{
+		"id":                   sub.ID,
+		"object":               "subscription",
+		"status":               sub.Status,
+		"cancel_at_period_end": sub.CancelAtPeriodEnd,
+		"current_period_start": sub.CurrentPeriodStart.Unix(),
+		"current_period_end":   sub.CurrentPeriodEnd.Unix(),
+	})
+}
+
+func (p *FakePaymentProvider) setCancelAtPeriodEnd(id string, cancel bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sub, ok := p.subscriptions[id]
+	if !ok {
+		return ErrRemoteSubscriptionNotFound
+	}
+	sub.CancelAtPeriodEnd = cancel
+	return nil
+}
+
+// event builds and signs a webhook event. The caller holds the lock.
+func (p *FakePaymentProvider) event(eventType string, object map[string]any) (FakeWebhook, error) {
+	now := time.Now()
+	payload, err := json.Marshal(map[string]any{
+		"id":          p.newID("evt_fake"),
+		"object":      "event",
+		"api_version": stripe.APIVersion,
+		"type":        eventType,
+		"created":     now.Unix(),
+		"data":        map[string]any{"object": object},
+	})
+	if err != nil {
+		return FakeWebhook{}, err
+	}
+
+	signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+		Payload:   payload,
+		Secret:    p.secret,
+		Timestamp: now,
+	})
+	header := http.Header{}
+	header.Set("Stripe-Signature", signed.Header)
+	return FakeWebhook{Payload: payload, Header: header}, nil
+}
+
+// newID returns a random ID with the given prefix. IDs are random rather
+// than counted so they don't repeat across restarts, when the database still
+// holds the IDs an earlier process handed out.
+func (p *FakePaymentProvider) newID(prefix string) string {
+	return prefix + "_" + security.RandomString(24)
+}
+
+// registerFakePaymentRoutes registers the routes that stand in for the
+// payment processor's hosted pages and dashboard
+func registerFakePaymentRoutes(app core.App, se *core.ServeEvent, fake *FakePaymentProvider) {
+	fake.SetBaseURL(app.Settings().Meta.AppURL)
+
+	// Hosted checkout: pay, deliver the webhook and return to the app
+	se.Router.GET("/api/payments/fake/checkout/{id}", func(e *core.RequestEvent) error {
+		id := e.Request.PathValue("id")
+		params, ok := fake.Checkout(id)
+		if !ok {
+			return e.JSON(http.StatusNotFound, map[string]string{"error": "Checkout not found"})
+		}
+
+		delivery, err := fake.CompleteCheckout(id)
+		if err != nil {
+			return e.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		if err := deliverFakeWebhook(app, fake, delivery); err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to deliver event"})
+		}
+
+		return e.Redirect(http.StatusSeeOther, params.SuccessURL)
+	})
+
+	// Staff: End a subscription, as when its payments stop
+	se.Router.POST("/api/payments/fake/subscriptions/{id}/end", func(e *core.RequestEvent) error {
+		delivery, err := fake.EndSubscription(e.Request.PathValue("id"))
+		if err != nil {
+			return e.JSON(http.StatusNotFound, map[string]string{"error": "Subscription not found"})
+		}
+		if err := deliverFakeWebhook(app, fake, delivery); err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to deliver event"})
+		}
+
+		return e.JSON(http.StatusOK, map[string]string{"status": "ended"})
+	}).Bind(RequireAuth(app), RequirePermission(app, PermissionBilling))
+}
+
+// deliverFakeWebhook verifies and receives a webhook as if the processor
+// had sent it
+func deliverFakeWebhook(app core.App, fake *FakePaymentProvider, delivery FakeWebhook) error {
+	event, err := fake.VerifyWebhook(delivery.Payload, delivery.Header)
+	if err != nil {
+		return err
+	}
+	return receiveStripeEvent(app, fake, event, delivery.Payload)
+}
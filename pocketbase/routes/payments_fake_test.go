@@ -0,0 +1,295 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+// newFakePaymentsRouter returns a fake provider and a router with the
+// payment routes using it
+func newFakePaymentsRouter(tb testing.TB, app core.App) (*FakePaymentProvider, http.Handler) {
+	tb.Helper()
+
+	fake := NewFakePaymentProvider()
+	mux := newTestRouter(tb, app, func(se *core.ServeEvent) {
+		RegisterStripeRoutes(app, se, fake)
+	})
+	return fake, mux
+}
+
+// buyWithFakeCheckout buys plan as user through the fake hosted checkout and
+// returns the user's subscription record (nil for lifetime)
+func buyWithFakeCheckout(tb testing.TB, app core.App, mux http.Handler, user *core.Record, plan string) *core.Record {
+	tb.Helper()
+
+	rec := serveTestRequest(tb, mux, user, http.MethodPost, "/api/stripe/create-checkout",
+		`{"plan":"`+plan+`","successUrl":"https://app.example.com/success","cancelUrl":"https://app.example.com/cancel"}`)
+	if rec.Code != http.StatusOK {
+		tb.Fatalf("create checkout: %d %s", rec.Code, rec.Body.String())
+	}
+	var checkout CheckoutResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &checkout); err != nil {
+		tb.Fatal(err)
+	}
+	checkoutURL, err := url.Parse(checkout.URL)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	rec = serveTestRequest(tb, mux, nil, http.MethodGet, checkoutURL.Path, "")
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "https://app.example.com/success" {
+		tb.Fatalf("checkout page: %d %s, want a redirect to the success URL", rec.Code, rec.Header().Get("Location"))
+	}
+
+	if plan == PlanLifetime {
+		return nil
+	}
+	sub, err := app.FindFirstRecordByData("subscriptions", "user", user.Id)
+	if err != nil {
+		tb.Fatalf("no subscription after checkout: %v", err)
+	}
+	return sub
+}
+
+// postFakeWebhook sends a webhook delivery to the webhook route
+func postFakeWebhook(mux http.Handler, delivery FakeWebhook) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/stripe/webhook", bytes.NewReader(delivery.Payload))
+	for key, values := range delivery.Header {
+		req.Header[key] = values
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestFakePaymentsCheckout(t *testing.T) {
+	app := newTestApp(t)
+	user := newTestUser(t, app, "buyer@example.com", nil)
+	fake, mux := newFakePaymentsRouter(t, app)
+
+	sub := buyWithFakeCheckout(t, app, mux, user, PlanYearly)
+
+	if status := sub.GetString("status"); status != "active" {
+		t.Fatalf("subscription status = %q, want active", status)
+	}
+	remote, err := fake.GetSubscription(sub.GetString("stripeSubscriptionId"))
+	if err != nil {
+		t.Fatalf("fake provider doesn't know the subscription: %v", err)
+	}
+	if !sameInstant(sub.GetDateTime("currentPeriodEnd"), remote.CurrentPeriodEnd) {
+		t.Fatalf("currentPeriodEnd = %s, want %s", sub.GetDateTime("currentPeriodEnd"), remote.CurrentPeriodEnd)
+	}
+
+	user = reload(t, app, user)
+	if !user.GetBool("isPremium") || user.GetString("premiumPlan") != PlanYearly {
+		t.Fatalf("isPremium/premiumPlan = %v/%q, want true/yearly", user.GetBool("isPremium"), user.GetString("premiumPlan"))
+	}
+	if !strings.HasPrefix(user.GetString("stripeCustomerId"), "cus_fake_") {
+		t.Fatalf("stripeCustomerId = %q, want a fake customer", user.GetString("stripeCustomerId"))
+	}
+}
+
+func TestFakePaymentsCancelResume(t *testing.T) {
+	app := newTestApp(t)
+	user := newTestUser(t, app, "cancel@example.com", nil)
+	fake, mux := newFakePaymentsRouter(t, app)
+	sub := buyWithFakeCheckout(t, app, mux, user, PlanMonthly)
+	subID := sub.GetString("stripeSubscriptionId")
+
+	if rec := serveTestRequest(t, mux, user, http.MethodPost, "/api/stripe/cancel-subscription", ""); rec.Code != http.StatusOK {
+		t.Fatalf("cancel: %d %s", rec.Code, rec.Body.String())
+	}
+	if remote, _ := fake.GetSubscription(subID); !remote.CancelAtPeriodEnd {
+		t.Fatal("provider subscription not set to cancel at period end")
+	}
+	if status := reload(t, app, sub).GetString("status"); status != "cancelled" {
+		t.Fatalf("status = %q after cancelling, want cancelled", status)
+	}
+	if !reload(t, app, user).GetBool("isPremium") {
+		t.Fatal("user lost premium before the cancelled period ended")
+	}
+
+	if rec := serveTestRequest(t, mux, user, http.MethodPost, "/api/stripe/resume-subscription", ""); rec.Code != http.StatusOK {
+		t.Fatalf("resume: %d %s", rec.Code, rec.Body.String())
+	}
+	if remote, _ := fake.GetSubscription(subID); remote.CancelAtPeriodEnd {
+		t.Fatal("provider subscription still set to cancel at period end")
+	}
+	if status := reload(t, app, sub).GetString("status"); status != "active" {
+		t.Fatalf("status = %q after resuming, want active", status)
+	}
+}
+
+func TestFakePaymentsEndSubscription(t *testing.T) {
+	app := newTestApp(t)
+	user := newTestUser(t, app, "ended@example.com", nil)
+	fake, mux := newFakePaymentsRouter(t, app)
+	sub := buyWithFakeCheckout(t, app, mux, user, PlanMonthly)
+
+	delivery, err := fake.EndSubscription(sub.GetString("stripeSubscriptionId"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := postFakeWebhook(mux, delivery); rec.Code != http.StatusOK {
+		t.Fatalf("webhook: %d %s", rec.Code, rec.Body.String())
+	}
+
+	if status := reload(t, app, sub).GetString("status"); status != "expired" {
+		t.Fatalf("status = %q, want expired", status)
+	}
+	user = reload(t, app, user)
+	if user.GetBool("isPremium") || user.GetString("premiumPlan") != "free" {
+		t.Fatalf("isPremium/premiumPlan = %v/%q, want false/free", user.GetBool("isPremium"), user.GetString("premiumPlan"))
+	}
+	downgrade, err := app.FindFirstRecordByData("premium_downgrades", "user", user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason := downgrade.GetString("reason"); reason != DowngradeSubscriptionEnded {
+		t.Fatalf("downgrade reason = %q, want %q", reason, DowngradeSubscriptionEnded)
+	}
+}
+
+func TestFakePaymentsWebhookSignature(t *testing.T) {
+	app := newTestApp(t)
+	user := newTestUser(t, app, "signature@example.com", nil)
+	fake, mux := newFakePaymentsRouter(t, app)
+	sub := buyWithFakeCheckout(t, app, mux, user, PlanMonthly)
+
+	before, err := app.CountRecords("stripe_events")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	delivery, err := fake.EndSubscription(sub.GetString("stripeSubscriptionId"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := delivery
+	tampered.Payload = bytes.Replace(delivery.Payload, []byte(`"customer.subscription.deleted"`), []byte(`"customer.subscription.updated"`), 1)
+
+	// Another provider has another secret
+	other := NewFakePaymentProvider()
+	otherSub := fakeCheckoutID(t, other, user)
+	foreign, err := other.EndSubscription(otherSub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unsigned := delivery
+	unsigned.Header = http.Header{}
+
+	for name, d := range map[string]FakeWebhook{"tampered payload": tampered, "other secret": foreign, "no signature": unsigned} {
+		t.Run(name, func(t *testing.T) {
+			if rec := postFakeWebhook(mux, d); rec.Code != http.StatusBadRequest {
+				t.Fatalf("webhook: %d %s, want 400", rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	after, err := app.CountRecords("stripe_events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after != before {
+		t.Fatalf("stored %d events with bad signatures", after-before)
+	}
+	if !reload(t, app, user).GetBool("isPremium") {
+		t.Fatal("user downgraded by a webhook with a bad signature")
+	}
+}
+
+func TestFakePaymentsIDsAreRandom(t *testing.T) {
+	// A restarted process must not hand out IDs the database already holds
+	first, second := NewFakePaymentProvider(), NewFakePaymentProvider()
+	params := CheckoutParams{UserID: "user", Plan: PlanMonthly}
+
+	a, err := first.CreateCheckout(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := second.CreateCheckout(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ID == b.ID {
+		t.Fatalf("two providers both created checkout %s", a.ID)
+	}
+}
+
+// fakeCheckoutID completes a monthly checkout with the provider alone and
+// returns the subscription ID
+func fakeCheckoutID(tb testing.TB, fake *FakePaymentProvider, user *core.Record) string {
+	tb.Helper()
+
+	checkout, err := fake.CreateCheckout(CheckoutParams{UserID: user.Id, Plan: PlanMonthly})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	delivery, err := fake.CompleteCheckout(checkout.ID)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	var event struct {
+		Data struct {
+			Object struct {
+				Subscription string `json:"subscription"`
+			} `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(delivery.Payload, &event); err != nil {
+		tb.Fatal(err)
+	}
+	return event.Data.Object.Subscription
+}
+
+func TestNewPaymentProviderRefusesFake(t *testing.T) {
+	devApp, err := tests.NewTestAppWithConfig(core.BaseAppConfig{DataDir: t.TempDir(), IsDev: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(devApp.Cleanup)
+	prodApp := newTestApp(t)
+
+	cases := []struct {
+		name     string
+		app      core.App
+		allow    string
+		wantFake bool
+	}{
+		{"production", prodApp, "", false},
+		{"production with the flag off", prodApp, "false", false},
+		{"production with the test flag", prodApp, "true", true},
+		{"dev mode", devApp, "", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Setenv("PAYMENT_PROVIDER", "fake")
+			t.Setenv("PAYMENT_PROVIDER_ALLOW_FAKE", c.allow)
+
+			provider, err := NewPaymentProvider(c.app)
+			if !c.wantFake {
+				if err == nil {
+					t.Fatalf("got %T, want the fake refused", provider)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := provider.(*FakePaymentProvider); !ok {
+				t.Fatalf("got %T, want the fake", provider)
+			}
+		})
+	}
+}
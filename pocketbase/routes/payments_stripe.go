@@ -0,0 +1,118 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/stripe/stripe-go/v76"
+	"github.com/stripe/stripe-go/v76/billingportal/session"
+	checkoutsession "github.com/stripe/stripe-go/v76/checkout/session"
+	"github.com/stripe/stripe-go/v76/subscription"
+	"github.com/stripe/stripe-go/v76/webhook"
+)
+
+func init() {
+	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
+}
+
+// stripePaymentProvider is the PaymentProvider backed by the Stripe API
+type stripePaymentProvider struct {
+	stripeSubscriptionSource
+
+	// Stripe price IDs - ONLY set via environment variables (never from client)
+	prices        map[string]string
+	webhookSecret string
+}
+
+// NewStripePaymentProvider returns a PaymentProvider backed by the Stripe
+// API, configured from the STRIPE_* environment variables
+func NewStripePaymentProvider() PaymentProvider {
+	return &stripePaymentProvider{
+		prices: map[string]string{
+			PlanMonthly:  os.Getenv("STRIPE_PRICE_MONTHLY"),
+			PlanYearly:   os.Getenv("STRIPE_PRICE_YEARLY"),
+			PlanLifetime: os.Getenv("STRIPE_PRICE_LIFETIME"),
+		},
+		webhookSecret: os.Getenv("STRIPE_WEBHOOK_SECRET"),
+	}
+}
+
+func (p *stripePaymentProvider) Name() string {
+	return "stripe"
+}
+
+func (p *stripePaymentProvider) CreateCheckout(params CheckoutParams) (*PaymentCheckout, error) {
+	priceID := p.prices[params.Plan]
+	if priceID == "" {
+		return nil, ErrPlanNotConfigured
+	}
+
+	mode := stripe.CheckoutSessionModeSubscription
+	if params.Plan == PlanLifetime {
+		mode = stripe.CheckoutSessionModePayment
+	}
+
+	sessionParams := &stripe.CheckoutSessionParams{
+		Mode:       stripe.String(string(mode)),
+		SuccessURL: stripe.String(params.SuccessURL),
+		CancelURL:  stripe.String(params.CancelURL),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{
+			{
+				Price:    stripe.String(priceID),
+				Quantity: stripe.Int64(1),
+			},
+		},
+		// Store user info in metadata for webhook processing
+		Metadata: map[string]string{
+			"userId": params.UserID,
+			"plan":   params.Plan,
+		},
+	}
+
+	// Use existing customer or set email for new customer
+	if params.CustomerID != "" {
+		sessionParams.Customer = stripe.String(params.CustomerID)
+	} else {
+		sessionParams.CustomerEmail = stripe.String(params.Email)
+	}
+
+	sess, err := checkoutsession.New(sessionParams)
+	if err != nil {
+		return nil, err
+	}
+	return &PaymentCheckout{ID: sess.ID, URL: sess.URL}, nil
+}
+
+func (p *stripePaymentProvider) CreatePortalSession(customerID, returnURL string) (string, error) {
+	sess, err := session.New(&stripe.BillingPortalSessionParams{
+		Customer:  stripe.String(customerID),
+		ReturnURL: stripe.String(returnURL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return sess.URL, nil
+}
+
+func (p *stripePaymentProvider) CancelSubscription(subscriptionID string) error {
+	_, err := subscription.Update(subscriptionID, &stripe.SubscriptionParams{
+		CancelAtPeriodEnd: stripe.Bool(true),
+	})
+	return err
+}
+
+func (p *stripePaymentProvider) ResumeSubscription(subscriptionID string) error {
+	_, err := subscription.Update(subscriptionID, &stripe.SubscriptionParams{
+		CancelAtPeriodEnd: stripe.Bool(false),
+	})
+	return err
+}
+
+func (p *stripePaymentProvider) VerifyWebhook(payload []byte, header http.Header) (stripe.Event, error) {
+	event, err := webhook.ConstructEvent(payload, header.Get("Stripe-Signature"), p.webhookSecret)
+	if err != nil {
+		return event, fmt.Errorf("%w: %v", ErrWebhookSignature, err)
+	}
+	return event, nil
+}
@@ -0,0 +1,293 @@
+package routes
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Practice session constants
+const (
+	DefaultPracticeSize  = 20
+	MaxPracticeSize      = 50
+	MaxPracticeSessionXP = 300  // XP cap per practice session
+	MaxDailyPracticeXP   = 1500 // XP cap per local day across practice sessions
+)
+
+// practiceXPReasons are the ledger reasons counted against MaxDailyPracticeXP,
+// which answers replayed from offline logs share with practice sessions
+var practiceXPReasons = []string{"practice_complete", "offline_replay"}
+
+// PracticeStartRequest represents a practice start request
+type PracticeStartRequest struct {
+	Category string `json:"category,omitempty"`
+	Limit    int    `json:"limit,omitempty"`
+}
+
+// PracticeStartResponse represents a practice start response
+type PracticeStartResponse struct {
+	SessionID string              `json:"sessionId"`
+	Questions []QuestionForClient `json:"questions"`
+	Count     int                 `json:"count"`
+	MaxXP     int                 `json:"maxXP"`
+}
+
+// PracticeCompleteResponse represents the practice session results
+type PracticeCompleteResponse struct {
+	Answered          int                      `json:"answered"`
+	Correct           int                      `json:"correct"`
+	TotalQuestions    int                      `json:"totalQuestions"`
+	TimeSpent         int                      `json:"timeSpent"` // seconds
+	XPEarned          int                      `json:"xpEarned"`
+	CategoryBreakdown map[string]CategoryScore `json:"categoryBreakdown"`
+}
+
+// RegisterPracticeRoutes registers practice session API routes
+func RegisterPracticeRoutes(app core.App, se *core.ServeEvent) {
+	// Start a new practice session
+	se.Router.POST("/api/practice/start", func(e *core.RequestEvent) error {
+		return handlePracticeStart(app, e)
+	}).Bind(apis.RequireAuth())
+
+	// Submit an answer during a practice session
+	se.Router.POST("/api/practice/answer", func(e *core.RequestEvent) error {
+		return handleSessionAnswer(app, e, SessionTypePractice)
+	}).Bind(apis.RequireAuth())
+
+	// Complete a practice session and credit XP
+	se.Router.POST("/api/practice/complete", func(e *core.RequestEvent) error {
+		return handlePracticeComplete(app, e)
+	}).Bind(apis.RequireAuth())
+}
+
+func handlePracticeStart(app core.App, e *core.RequestEvent) error {
+	authRecord := e.Auth
+	if authRecord == nil {
+		return e.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+
+	var req PracticeStartRequest
+	e.BindBody(&req) // Optional category and limit
+
+	limit := DefaultPracticeSize
+	if req.Limit > 0 && req.Limit <= MaxPracticeSize {
+		limit = req.Limit
+	}
+
+	sessionCollection, err := app.FindCollectionByNameOrId("question_sessions")
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Practice sessions not available",
+		})
+	}
+
+	// Abandon any existing active practice sessions for this user
+	existingSessions, _ := app.FindRecordsByFilter(
+		sessionCollection.Id,
+		"user = {:userId} && sessionType = 'practice' && status = 'active'",
+		"", 0, 0,
+		map[string]interface{}{"userId": authRecord.Id},
+	)
+	for _, s := range existingSessions {
+		s.Set("status", "abandoned")
+		app.Save(s)
+	}
+
+	// Build filter (exclude premium for free users)
+	filter := "id != ''"
+	params := map[string]any{}
+	if req.Category != "" {
+		filter += " && category = {:category}"
+		params["category"] = req.Category
+	}
+	if !userHasPremium(app, authRecord) {
+		filter += " && isPremium = false"
+	}
+
+	records, err := app.FindRecordsByFilter("questions", filter, "", 0, 0, params)
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to fetch questions",
+		})
+	}
+
+	// Shuffle and limit
+	rand.Shuffle(len(records), func(i, j int) {
+		records[i], records[j] = records[j], records[i]
+	})
+	if len(records) > limit {
+		records = records[:limit]
+	}
+
+	questions := make([]QuestionForClient, 0, len(records))
+	questionIds := make([]string, 0, len(records))
+	for _, record := range records {
+		q, err := recordToQuestionForClient(record)
+		if err != nil {
+			continue
+		}
+		questions = append(questions, q)
+		questionIds = append(questionIds, record.Id)
+	}
+
+	if len(questionIds) == 0 {
+		return e.JSON(http.StatusNotFound, map[string]string{
+			"error": "No questions available",
+		})
+	}
+
+	// Create session
+	session := core.NewRecord(sessionCollection)
+	session.Set("user", authRecord.Id)
+	session.Set("sessionType", SessionTypePractice)
+	questionIdsJSON, _ := json.Marshal(questionIds)
+	session.Set("questionIds", string(questionIdsJSON))
+	session.Set("currentIndex", 0)
+	session.Set("answers", "[]")
+	session.Set("status", "active")
+	session.Set("startedAt", time.Now().UTC())
+	if req.Category != "" {
+		session.Set("category", req.Category)
+	}
+
+	if err := app.Save(session); err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to create practice session",
+		})
+	}
+
+	return e.JSON(http.StatusOK, PracticeStartResponse{
+		SessionID: session.Id,
+		Questions: questions,
+		Count:     len(questions),
+		MaxXP:     MaxPracticeSessionXP,
+	})
+}
+
+func handlePracticeComplete(app core.App, e *core.RequestEvent) error {
+	authRecord := e.Auth
+	if authRecord == nil {
+		return e.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+
+	var req TestCompleteRequest
+	if err := e.BindBody(&req); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	session, err := app.FindRecordById("question_sessions", req.SessionID)
+	if err != nil {
+		return e.JSON(http.StatusNotFound, map[string]string{
+			"error": "Practice session not found",
+		})
+	}
+
+	// Verify session belongs to user
+	if session.GetString("user") != authRecord.Id {
+		return e.JSON(http.StatusForbidden, map[string]string{
+			"error": "Session does not belong to user",
+		})
+	}
+
+	if session.GetString("sessionType") != SessionTypePractice {
+		return e.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Not a practice session",
+		})
+	}
+
+	// Return cached results if already completed
+	if session.GetString("status") == "completed" {
+		var results PracticeCompleteResponse
+		if err := json.Unmarshal([]byte(session.GetString("results")), &results); err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "Failed to parse results",
+			})
+		}
+		return e.JSON(http.StatusOK, results)
+	}
+
+	// Abandoned sessions were replaced by a newer one; their XP is forfeited.
+	// Timed-out sessions still pay out what was earned before the limit.
+	if status := session.GetString("status"); status != "active" && status != "timeout" {
+		return e.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Practice session is not active",
+		})
+	}
+
+	var answers []SessionAnswer
+	json.Unmarshal([]byte(session.GetString("answers")), &answers)
+
+	var questionIds []string
+	json.Unmarshal([]byte(session.GetString("questionIds")), &questionIds)
+
+	correct := 0
+	totalXP := 0
+	categoryBreakdown := make(map[string]CategoryScore)
+	for _, answer := range answers {
+		if answer.Correct {
+			correct++
+		}
+		totalXP += answer.XPEarned
+
+		if record, err := app.FindRecordById("questions", answer.QuestionID); err == nil {
+			category := record.GetString("category")
+			cs := categoryBreakdown[category]
+			cs.Total++
+			if answer.Correct {
+				cs.Correct++
+			}
+			categoryBreakdown[category] = cs
+		}
+	}
+
+	// Per-answer XP is already capped, but never trust a stored total above the cap
+	totalXP = min(totalXP, MaxPracticeSessionXP)
+
+	startedAt := session.GetDateTime("startedAt").Time()
+	results := PracticeCompleteResponse{
+		Answered:          len(answers),
+		Correct:           correct,
+		TotalQuestions:    len(questionIds),
+		TimeSpent:         int(time.Since(startedAt).Seconds()),
+		XPEarned:          totalXP,
+		CategoryBreakdown: categoryBreakdown,
+	}
+
+	// Complete the session and credit XP through the ledger in one
+	// transaction, so a retry can't pay twice and the saved results show
+	// what the daily cap left of the session's XP
+	authRecord.Set("questionsCompleted", authRecord.GetInt("questionsCompleted")+len(answers))
+	authRecord.Set("questionsCorrect", authRecord.GetInt("questionsCorrect")+correct)
+	err = app.RunInTransaction(func(txApp core.App) error {
+		_, credited, err := creditDailyCappedXP(txApp, authRecord, totalXP, MaxDailyPracticeXP, practiceXPReasons, "practice_complete", session.Id, "practice", session.Id, map[string]interface{}{
+			"answered": len(answers),
+			"correct":  correct,
+		})
+		if err != nil {
+			return err
+		}
+		results.XPEarned = credited
+
+		resultsJSON, _ := json.Marshal(results)
+		session.Set("status", "completed")
+		session.Set("completedAt", time.Now().UTC())
+		session.Set("results", string(resultsJSON))
+		return txApp.Save(session)
+	})
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to complete practice session",
+		})
+	}
+	if err := creditDailyChallenges(app, authRecord); err != nil {
+		app.Logger().Error("Failed to credit daily challenges", "error", err)
+	}
+
+	return e.JSON(http.StatusOK, results)
+}
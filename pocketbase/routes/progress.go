@@ -1,44 +1,18 @@
 package routes
 
 import (
+	"errors"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
+	"driveprep/services"
+
+	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/core"
 )
 
-// Badge definitions for server-side verification
-type BadgeDefinition struct {
-	ID       string
-	Tier     string
-	XPReward int
-}
-
-var badgeDefinitions = map[string]BadgeDefinition{
-	// Bronze tier
-	"first_steps":   {ID: "first_steps", Tier: "bronze", XPReward: 50},
-	"early_bird":    {ID: "early_bird", Tier: "bronze", XPReward: 75},
-	"night_owl":     {ID: "night_owl", Tier: "bronze", XPReward: 75},
-	"quick_learner": {ID: "quick_learner", Tier: "bronze", XPReward: 100},
-	// Silver tier
-	"sign_master":  {ID: "sign_master", Tier: "silver", XPReward: 200},
-	"road_scholar": {ID: "road_scholar", Tier: "silver", XPReward: 250},
-	"sharpshooter": {ID: "sharpshooter", Tier: "silver", XPReward: 200},
-	"speed_demon":  {ID: "speed_demon", Tier: "silver", XPReward: 250},
-	"consistent":   {ID: "consistent", Tier: "silver", XPReward: 300},
-	// Gold tier
-	"perfect_score":     {ID: "perfect_score", Tier: "gold", XPReward: 500},
-	"category_champion": {ID: "category_champion", Tier: "gold", XPReward: 750},
-	"dedicated_driver":  {ID: "dedicated_driver", Tier: "gold", XPReward: 500},
-	"marathon_runner":   {ID: "marathon_runner", Tier: "gold", XPReward: 500},
-	// Platinum tier
-	"diamond_streak": {ID: "diamond_streak", Tier: "platinum", XPReward: 1000},
-	"test_master":    {ID: "test_master", Tier: "platinum", XPReward: 750},
-	"perfectionist":  {ID: "perfectionist", Tier: "platinum", XPReward: 1000},
-	// Legendary tier
-	"g1_legend": {ID: "g1_legend", Tier: "legendary", XPReward: 2000},
-}
-
 // UserProgressData represents the user's progress data
 type UserProgressData struct {
 	XP                 int         `json:"xp"`
@@ -79,47 +53,9 @@ func RegisterProgressRoutes(app core.App, se *core.ServeEvent) {
 			return e.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
 		}
 
-		// Get user progress record
-		progressRecords, err := app.FindRecordsByFilter(
-			"user_progress",
-			"user = {:userId}",
-			"-updated",
-			1,
-			0,
-			map[string]any{"userId": authRecord.Id},
-		)
-
-		var progress UserProgressData
-
-		// Get user-level data
-		progress.XP = authRecord.GetInt("xp")
-		progress.Level = authRecord.GetInt("level")
-		progress.Streak = authRecord.GetInt("streak")
-		progress.LongestStreak = authRecord.GetInt("longestStreak")
-		progress.QuestionsCompleted = authRecord.GetInt("questionsCompleted")
-		progress.QuestionsCorrect = authRecord.GetInt("questionsCorrect")
-
-		badges := authRecord.Get("badges")
-		if badges != nil {
-			if badgeSlice, ok := badges.([]interface{}); ok {
-				progress.Badges = make([]string, len(badgeSlice))
-				for i, b := range badgeSlice {
-					progress.Badges[i] = b.(string)
-				}
-			}
-		} else {
-			progress.Badges = []string{}
-		}
-
-		// Get detailed progress from user_progress collection
-		if err == nil && len(progressRecords) > 0 {
-			record := progressRecords[0]
-			progress.CategoryProgress = record.Get("categoryProgress")
-			progress.TestHistory = record.Get("testHistory")
-			progress.DailyChallenges = record.Get("dailyChallenges")
-			progress.DailyChallengeDate = record.GetString("dailyChallengeDate")
-			progress.FastestTestTime = record.GetInt("fastestTestTime")
-			progress.BestCorrectStreak = record.GetInt("bestCorrectStreak")
+		progress, err := serverProgress(app, authRecord)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load progress"})
 		}
 
 		return e.JSON(http.StatusOK, progress)
@@ -139,46 +75,21 @@ func RegisterProgressRoutes(app core.App, se *core.ServeEvent) {
 
 		local := req.LocalProgress
 
-		// Get server progress
-		serverXP := authRecord.GetInt("xp")
-		serverStreak := authRecord.GetInt("streak")
-		serverLongestStreak := authRecord.GetInt("longestStreak")
-		serverQuestionsCompleted := authRecord.GetInt("questionsCompleted")
-		serverQuestionsCorrect := authRecord.GetInt("questionsCorrect")
-
-		// Merge strategy: take the higher values
-		merged := UserProgressData{
-			XP:                 max(local.XP, serverXP),
-			Streak:             max(local.Streak, serverStreak),
-			LongestStreak:      max(local.LongestStreak, serverLongestStreak),
-			QuestionsCompleted: max(local.QuestionsCompleted, serverQuestionsCompleted),
-			QuestionsCorrect:   max(local.QuestionsCorrect, serverQuestionsCorrect),
-			FastestTestTime:    local.FastestTestTime,
-			BestCorrectStreak:  local.BestCorrectStreak,
-		}
-
-		// Calculate level from XP
-		merged.Level = calculateLevel(merged.XP)
-
-		// Merge badges (union of both sets)
-		serverBadges := authRecord.Get("badges")
-		badgeSet := make(map[string]bool)
-		if serverBadges != nil {
-			if badgeSlice, ok := serverBadges.([]interface{}); ok {
-				for _, b := range badgeSlice {
-					badgeSet[b.(string)] = true
-				}
-			}
-		}
-		for _, b := range local.Badges {
-			badgeSet[b] = true
+		// Everything but the daily challenge list comes from the server: XP
+		// from the ledger, streaks from login days, badges from the badge
+		// routes, and answer and test stats from recorded sessions. Local
+		// values for those are ignored.
+		merged, err := serverProgress(app, authRecord)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load progress"})
 		}
-		merged.Badges = make([]string, 0, len(badgeSet))
-		for badge := range badgeSet {
-			merged.Badges = append(merged.Badges, badge)
+		var conflicts []string
+		if local.XP != merged.XP {
+			conflicts = append(conflicts, "xp")
 		}
+		merged.DailyChallenges = local.DailyChallenges
+		merged.DailyChallengeDate = local.DailyChallengeDate
 
-		// Use local data for complex fields if force overwrite or server is empty
 		progressRecords, _ := app.FindRecordsByFilter(
 			"user_progress",
 			"user = {:userId}",
@@ -188,46 +99,6 @@ func RegisterProgressRoutes(app core.App, se *core.ServeEvent) {
 			map[string]any{"userId": authRecord.Id},
 		)
 
-		if req.ForceOverwrite || len(progressRecords) == 0 {
-			merged.CategoryProgress = local.CategoryProgress
-			merged.TestHistory = local.TestHistory
-			merged.DailyChallenges = local.DailyChallenges
-			merged.DailyChallengeDate = local.DailyChallengeDate
-		} else if len(progressRecords) > 0 {
-			serverProgress := progressRecords[0]
-			// Merge test history (combine and dedupe by date)
-			merged.TestHistory = mergeTestHistory(
-				local.TestHistory,
-				serverProgress.Get("testHistory"),
-			)
-			merged.CategoryProgress = local.CategoryProgress // Local wins for category progress
-			merged.DailyChallenges = local.DailyChallenges
-			merged.DailyChallengeDate = local.DailyChallengeDate
-
-			// Take best times
-			serverFastest := serverProgress.GetInt("fastestTestTime")
-			if serverFastest > 0 && (merged.FastestTestTime == 0 || serverFastest < merged.FastestTestTime) {
-				merged.FastestTestTime = serverFastest
-			}
-			serverBestStreak := serverProgress.GetInt("bestCorrectStreak")
-			if serverBestStreak > merged.BestCorrectStreak {
-				merged.BestCorrectStreak = serverBestStreak
-			}
-		}
-
-		// Update user record
-		authRecord.Set("xp", merged.XP)
-		authRecord.Set("level", merged.Level)
-		authRecord.Set("streak", merged.Streak)
-		authRecord.Set("longestStreak", merged.LongestStreak)
-		authRecord.Set("questionsCompleted", merged.QuestionsCompleted)
-		authRecord.Set("questionsCorrect", merged.QuestionsCorrect)
-		authRecord.Set("badges", merged.Badges)
-
-		if err := app.Save(authRecord); err != nil {
-			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save user progress"})
-		}
-
 		// Update or create user_progress record
 		var progressRecord *core.Record
 		if len(progressRecords) > 0 {
@@ -241,12 +112,8 @@ func RegisterProgressRoutes(app core.App, se *core.ServeEvent) {
 			progressRecord.Set("user", authRecord.Id)
 		}
 
-		progressRecord.Set("categoryProgress", merged.CategoryProgress)
-		progressRecord.Set("testHistory", merged.TestHistory)
 		progressRecord.Set("dailyChallenges", merged.DailyChallenges)
 		progressRecord.Set("dailyChallengeDate", merged.DailyChallengeDate)
-		progressRecord.Set("fastestTestTime", merged.FastestTestTime)
-		progressRecord.Set("bestCorrectStreak", merged.BestCorrectStreak)
 
 		if err := app.Save(progressRecord); err != nil {
 			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save detailed progress"})
@@ -255,6 +122,7 @@ func RegisterProgressRoutes(app core.App, se *core.ServeEvent) {
 		return e.JSON(http.StatusOK, SyncProgressResponse{
 			MergedProgress: merged,
 			SyncedAt:       progressRecord.GetDateTime("updated").String(),
+			Conflicts:      conflicts,
 		})
 	}).Bind(RequireAuth(app))
 
@@ -270,37 +138,28 @@ func RegisterProgressRoutes(app core.App, se *core.ServeEvent) {
 			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
 		}
 
-		// Allowed fields to update on user record
-		userFields := map[string]bool{
-			"xp":                 true,
-			"level":              true,
-			"streak":             true,
-			"longestStreak":      true,
-			"questionsCompleted": true,
-			"questionsCorrect":   true,
-			"badges":             true,
-		}
-
-		// Allowed fields to update on progress record
+		// Allowed fields to update on progress record. Stats are derived by
+		// the server (see serverProgress), so they can't be set directly.
 		progressFields := map[string]bool{
-			"categoryProgress":   true,
-			"testHistory":        true,
 			"dailyChallenges":    true,
 			"dailyChallengeDate": true,
-			"fastestTestTime":    true,
-			"bestCorrectStreak":  true,
 		}
 
-		// Update user record
-		for field, value := range updates {
-			if userFields[field] {
-				authRecord.Set(field, value)
+		if tz, ok := updates["timezone"]; ok {
+			name, _ := tz.(string)
+			if _, err := services.ParseTimezone(name); err != nil {
+				return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 			}
+			if err := setUserTimezone(authRecord, name, time.Now()); err != nil {
+				return e.JSON(http.StatusTooManyRequests, map[string]string{"error": err.Error()})
+			}
+			delete(updates, "timezone")
 		}
 
-		// Recalculate level if XP was updated
-		if _, hasXP := updates["xp"]; hasXP {
-			authRecord.Set("level", calculateLevel(authRecord.GetInt("xp")))
+		for _, field := range []string{"xp", "level"} {
+			if _, ok := updates[field]; ok {
+				return e.JSON(http.StatusBadRequest, map[string]string{"error": "XP can only be changed through the XP ledger"})
+			}
 		}
 
 		if err := app.Save(authRecord); err != nil {
@@ -352,7 +211,8 @@ func RegisterProgressRoutes(app core.App, se *core.ServeEvent) {
 		return e.JSON(http.StatusOK, map[string]string{"status": "updated"})
 	}).Bind(RequireAuth(app))
 
-	// Add XP endpoint (for gamification events) - with transaction logging
+	// Add XP for client-side events. Only reasons listed in clientXPReasons
+	// are accepted.
 	se.Router.POST("/api/progress/add-xp", func(e *core.RequestEvent) error {
 		authRecord := e.Auth
 		if authRecord == nil {
@@ -360,48 +220,32 @@ func RegisterProgressRoutes(app core.App, se *core.ServeEvent) {
 		}
 
 		var req struct {
-			Amount        int                    `json:"amount"`
-			Reason        string                 `json:"reason"`
-			ReferenceId   string                 `json:"referenceId,omitempty"`
-			ReferenceType string                 `json:"referenceType,omitempty"`
-			SessionId     string                 `json:"sessionId,omitempty"`
-			Metadata      map[string]interface{} `json:"metadata,omitempty"`
+			Amount      int                    `json:"amount"`
+			Reason      string                 `json:"reason"`
+			ReferenceId string                 `json:"referenceId,omitempty"`
+			SessionId   string                 `json:"sessionId,omitempty"`
+			Metadata    map[string]interface{} `json:"metadata,omitempty"`
 		}
 		if err := e.BindBody(&req); err != nil {
 			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
 		}
 
-		if req.Amount <= 0 || req.Amount > 1000 {
-			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid XP amount"})
-		}
-
 		if req.Reason == "" {
 			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Reason required"})
 		}
 
-		currentXP := authRecord.GetInt("xp")
-		newXP := currentXP + req.Amount
-		newLevel := calculateLevel(newXP)
-		oldLevel := authRecord.GetInt("level")
-
-		authRecord.Set("xp", newXP)
-		authRecord.Set("level", newLevel)
-
-		if err := app.Save(authRecord); err != nil {
+		// Only reasons known to the server can be claimed, for the server-defined amount
+		balance, err := claimClientXP(app, authRecord, req.Amount, req.Reason, req.ReferenceId, req.SessionId, req.Metadata)
+		switch {
+		case errors.Is(err, ErrUnknownXPReason), errors.Is(err, ErrXPAmountMismatch):
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		case errors.Is(err, ErrXPAlreadyAwarded), errors.Is(err, ErrXPDailyLimit):
+			return e.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		case err != nil:
 			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to add XP"})
 		}
 
-		// Log XP transaction
-		if err := logXPTransaction(app, authRecord.Id, req.Amount, req.Reason, req.ReferenceId, req.ReferenceType, req.SessionId, req.Metadata); err != nil {
-			// Log error but don't fail the request - XP was already added
-			app.Logger().Error("Failed to log XP transaction", "error", err)
-		}
-
-		return e.JSON(http.StatusOK, map[string]interface{}{
-			"newXP":     newXP,
-			"newLevel":  newLevel,
-			"leveledUp": newLevel > oldLevel,
-		})
+		return e.JSON(http.StatusOK, balance)
 	}).Bind(RequireAuth(app))
 
 	// Get XP transaction history
@@ -449,6 +293,11 @@ func RegisterProgressRoutes(app core.App, se *core.ServeEvent) {
 		})
 	}).Bind(RequireAuth(app))
 
+	// Get weakest categories and questions from answer history
+	se.Router.GET("/api/progress/weak-spots", func(e *core.RequestEvent) error {
+		return handleGetWeakSpots(app, e)
+	}).Bind(RequireAuth(app))
+
 	// Award badge endpoint - with server-side verification
 	se.Router.POST("/api/progress/award-badge", func(e *core.RequestEvent) error {
 		authRecord := e.Auth
@@ -469,21 +318,13 @@ func RegisterProgressRoutes(app core.App, se *core.ServeEvent) {
 		}
 
 		// Verify badge exists
-		badgeDef, exists := badgeDefinitions[req.BadgeID]
-		if !exists {
+		badgeDef, err := findBadgeDefinition(app, req.BadgeID)
+		if err != nil {
 			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid badge ID"})
 		}
 
 		// Get current badges
-		badges := authRecord.Get("badges")
-		badgeList := []string{}
-		if badges != nil {
-			if badgeSlice, ok := badges.([]interface{}); ok {
-				for _, b := range badgeSlice {
-					badgeList = append(badgeList, b.(string))
-				}
-			}
-		}
+		badgeList := userBadges(authRecord)
 
 		// Check if already has badge
 		for _, b := range badgeList {
@@ -496,7 +337,7 @@ func RegisterProgressRoutes(app core.App, se *core.ServeEvent) {
 		}
 
 		// Verify badge conditions based on user stats
-		verified, verificationReason := verifyBadgeCondition(app, authRecord, req.BadgeID, req.VerificationData)
+		verified, verificationReason := verifyBadgeCondition(app, authRecord, badgeDef)
 		if !verified {
 			return e.JSON(http.StatusOK, map[string]interface{}{
 				"awarded": false,
@@ -508,24 +349,12 @@ func RegisterProgressRoutes(app core.App, se *core.ServeEvent) {
 		badgeList = append(badgeList, req.BadgeID)
 		authRecord.Set("badges", badgeList)
 
-		// Award XP for badge
-		currentXP := authRecord.GetInt("xp")
-		newXP := currentXP + badgeDef.XPReward
-		newLevel := calculateLevel(newXP)
-		oldLevel := authRecord.GetInt("level")
-
-		authRecord.Set("xp", newXP)
-		authRecord.Set("level", newLevel)
-
-		if err := app.Save(authRecord); err != nil {
+		// Award XP for badge (the badge list is saved in the same transaction)
+		balance, err := creditXP(app, authRecord, badgeDef.XPReward, "badge_earned", req.BadgeID, "badge", "", req.VerificationData)
+		if err != nil {
 			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to award badge"})
 		}
 
-		// Log XP transaction for badge award
-		if err := logXPTransaction(app, authRecord.Id, badgeDef.XPReward, "badge_earned", req.BadgeID, "badge", "", req.VerificationData); err != nil {
-			app.Logger().Error("Failed to log badge XP transaction", "error", err)
-		}
-
 		// Log badge award in badge_awards collection
 		if err := logBadgeAward(app, authRecord.Id, req.BadgeID, badgeDef.Tier, badgeDef.XPReward, req.VerificationData); err != nil {
 			app.Logger().Error("Failed to log badge award", "error", err)
@@ -534,9 +363,9 @@ func RegisterProgressRoutes(app core.App, se *core.ServeEvent) {
 		return e.JSON(http.StatusOK, map[string]interface{}{
 			"awarded":     true,
 			"xpAwarded":   badgeDef.XPReward,
-			"newXP":       newXP,
-			"newLevel":    newLevel,
-			"leveledUp":   newLevel > oldLevel,
+			"newXP":       balance.XP,
+			"newLevel":    balance.Level,
+			"leveledUp":   balance.LeveledUp,
 			"totalBadges": len(badgeList),
 		})
 	}).Bind(RequireAuth(app))
@@ -548,78 +377,81 @@ func RegisterProgressRoutes(app core.App, se *core.ServeEvent) {
 			return e.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
 		}
 
-		// Get current badges
-		badges := authRecord.Get("badges")
-		currentBadges := make(map[string]bool)
-		if badges != nil {
-			if badgeSlice, ok := badges.([]interface{}); ok {
-				for _, b := range badgeSlice {
-					currentBadges[b.(string)] = true
-				}
-			}
+		defs, err := loadBadgeDefinitions(app)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load badges"})
 		}
 
 		// Check all badges user doesn't have
+		badgeList := userBadges(authRecord)
 		newBadges := []string{}
 		totalXP := 0
+		stats, err := badgeStats(app, authRecord)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load progress"})
+		}
 
-		for badgeID, badgeDef := range badgeDefinitions {
-			if currentBadges[badgeID] {
+		for _, badgeDef := range defs {
+			if slices.Contains(badgeList, badgeDef.ID) {
 				continue
 			}
 
-			verified, _ := verifyBadgeCondition(app, authRecord, badgeID, nil)
-			if verified {
-				newBadges = append(newBadges, badgeID)
-				totalXP += badgeDef.XPReward
+			result, err := evaluateBadge(badgeDef, stats)
+			if err != nil {
+				app.Logger().Error("Failed to evaluate badge rule", "badgeId", badgeDef.ID, "error", err)
+				continue
+			}
+			if !result.Met {
+				continue
+			}
 
-				// Log badge award
-				if err := logBadgeAward(app, authRecord.Id, badgeID, badgeDef.Tier, badgeDef.XPReward, nil); err != nil {
-					app.Logger().Error("Failed to log badge award", "error", err)
+			// Each badge pays once, under its own reference, in the same
+			// transaction that adds it to the user's badges
+			authRecord.Set("badges", append(slices.Clone(badgeList), badgeDef.ID))
+			_, err = creditXP(app, authRecord, badgeDef.XPReward, "badge_earned", badgeDef.ID, "badge", "", nil)
+			if errors.Is(err, ErrXPAlreadyAwarded) {
+				// Paid before, by a concurrent check or before the badge was
+				// taken away: keep the badge without paying for it again
+				if authRecord, err = app.FindRecordById("users", authRecord.Id); err != nil {
+					return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save badges"})
+				}
+				badgeList = userBadges(authRecord)
+				if !slices.Contains(badgeList, badgeDef.ID) {
+					badgeList = append(badgeList, badgeDef.ID)
+					authRecord.Set("badges", badgeList)
+					if err := app.Save(authRecord); err != nil {
+						return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save badges"})
+					}
 				}
+				continue
 			}
-		}
-
-		if len(newBadges) == 0 {
-			return e.JSON(http.StatusOK, map[string]interface{}{
-				"newBadges":     []string{},
-				"totalXPEarned": 0,
-			})
-		}
-
-		// Update user with new badges and XP
-		badgeList := make([]string, 0, len(currentBadges)+len(newBadges))
-		for b := range currentBadges {
-			badgeList = append(badgeList, b)
-		}
-		badgeList = append(badgeList, newBadges...)
-
-		currentXP := authRecord.GetInt("xp")
-		newXP := currentXP + totalXP
-		newLevel := calculateLevel(newXP)
-
-		authRecord.Set("badges", badgeList)
-		authRecord.Set("xp", newXP)
-		authRecord.Set("level", newLevel)
-
-		if err := app.Save(authRecord); err != nil {
-			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save badges"})
-		}
+			if err != nil {
+				return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save badges"})
+			}
+			badgeList = append(badgeList, badgeDef.ID)
+			newBadges = append(newBadges, badgeDef.ID)
+			totalXP += badgeDef.XPReward
 
-		// Log XP transaction for all badges at once
-		if err := logXPTransaction(app, authRecord.Id, totalXP, "badges_earned", "", "badge", "", map[string]interface{}{"badges": newBadges}); err != nil {
-			app.Logger().Error("Failed to log badges XP transaction", "error", err)
+			// Log badge award
+			if err := logBadgeAward(app, authRecord.Id, badgeDef.ID, badgeDef.Tier, badgeDef.XPReward, nil); err != nil {
+				app.Logger().Error("Failed to log badge award", "error", err)
+			}
 		}
 
 		return e.JSON(http.StatusOK, map[string]interface{}{
 			"newBadges":     newBadges,
 			"totalXPEarned": totalXP,
-			"newXP":         newXP,
-			"newLevel":      newLevel,
+			"newXP":         authRecord.GetInt("xp"),
+			"newLevel":      authRecord.GetInt("level"),
 			"totalBadges":   len(badgeList),
 		})
 	}).Bind(RequireAuth(app))
 
+	// Explain which badge conditions the user is still missing
+	se.Router.GET("/api/progress/badges/evaluate", func(e *core.RequestEvent) error {
+		return handleEvaluateBadges(app, e)
+	}).Bind(RequireAuth(app))
+
 	// Get badge awards history
 	se.Router.GET("/api/progress/badges", func(e *core.RequestEvent) error {
 		authRecord := e.Auth
@@ -665,26 +497,12 @@ func RegisterProgressRoutes(app core.App, se *core.ServeEvent) {
 			return e.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
 		}
 
-		// Get user progress record
-		progressRecords, _ := app.FindRecordsByFilter(
-			"user_progress",
-			"user = {:userId}",
-			"-updated",
-			1,
-			0,
-			map[string]any{"userId": authRecord.Id},
-		)
-
-		today := time.Now().Format("2006-01-02")
-		yesterday := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
-
-		var lastActiveDate string
-		if len(progressRecords) > 0 {
-			lastActiveDate = progressRecords[0].GetString("dailyChallengeDate")
-		}
+		// Days roll over at midnight in the user's own timezone
+		now := time.Now()
+		today := services.LocalDate(now, userLocation(authRecord))
 
 		// Already logged in today
-		if lastActiveDate == today {
+		if authRecord.GetString("lastStreakDate") == today {
 			return e.JSON(http.StatusOK, map[string]interface{}{
 				"streak":   authRecord.GetInt("streak"),
 				"xpEarned": 0,
@@ -692,58 +510,92 @@ func RegisterProgressRoutes(app core.App, se *core.ServeEvent) {
 			})
 		}
 
-		currentStreak := authRecord.GetInt("streak")
-		longestStreak := authRecord.GetInt("longestStreak")
-		var newStreak int
-		xpEarned := 50 // Daily login XP
-
-		if lastActiveDate == yesterday {
-			newStreak = currentStreak + 1
-			// Streak milestones
-			if newStreak == 7 {
-				xpEarned += 300
-			} else if newStreak == 14 {
-				xpEarned += 500
-			} else if newStreak == 30 {
-				xpEarned += 1000
-			}
-		} else {
-			newStreak = 1
+		// The streak and its milestones count only the login days recorded
+		// in the XP ledger
+		loginDays, err := loginStreak(app, authRecord, now)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update streak"})
 		}
+		currentStreak := authRecord.GetInt("streak")
+		newStreak := loginDays + 1
+		longestStreak := max(authRecord.GetInt("longestStreak"), newStreak)
 
-		if newStreak > longestStreak {
-			longestStreak = newStreak
+		xpEarned := 50 // Daily login XP
+		switch newStreak {
+		case 7:
+			xpEarned += 300
+		case 14:
+			xpEarned += 500
+		case 30:
+			xpEarned += 1000
 		}
 
-		currentXP := authRecord.GetInt("xp")
-		newXP := currentXP + xpEarned
-		newLevel := calculateLevel(newXP)
-
 		authRecord.Set("streak", newStreak)
 		authRecord.Set("longestStreak", longestStreak)
-		authRecord.Set("xp", newXP)
-		authRecord.Set("level", newLevel)
+		authRecord.Set("lastStreakDate", today)
 
-		if err := app.Save(authRecord); err != nil {
+		balance, err := creditXP(app, authRecord, xpEarned, "daily_login", today, "streak", "", map[string]interface{}{"streak": newStreak})
+		if errors.Is(err, ErrXPAlreadyAwarded) {
+			// A concurrent request logged today in first
+			return e.JSON(http.StatusOK, map[string]interface{}{
+				"streak":   currentStreak,
+				"xpEarned": 0,
+				"newLogin": false,
+			})
+		}
+		if err != nil {
 			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update streak"})
 		}
 
-		// Log XP transaction
-		if err := logXPTransaction(app, authRecord.Id, xpEarned, "daily_login", "", "streak", "", map[string]interface{}{"streak": newStreak}); err != nil {
-			app.Logger().Error("Failed to log streak XP transaction", "error", err)
+		if err := creditDailyChallenges(app, authRecord); err != nil {
+			app.Logger().Error("Failed to credit daily challenges", "error", err)
 		}
 
 		return e.JSON(http.StatusOK, map[string]interface{}{
 			"streak":        newStreak,
 			"longestStreak": longestStreak,
 			"xpEarned":      xpEarned,
-			"newXP":         newXP,
-			"newLevel":      newLevel,
+			"newXP":         balance.XP,
+			"newLevel":      balance.Level,
 			"newLogin":      true,
 		})
 	}).Bind(RequireAuth(app))
 }
 
+// loginStreak counts the days in a row, ending yesterday in the user's
+// timezone, with a daily login in the XP ledger
+func loginStreak(app core.App, user *core.Record, now time.Time) (int, error) {
+	var days []string
+	err := app.DB().
+		Select("referenceId").
+		From("xp_transactions").
+		Where(dbx.HashExp{"user": user.Id, "reason": "daily_login"}).
+		OrderBy("referenceId DESC").
+		Column(&days)
+	if err != nil {
+		return 0, err
+	}
+
+	loc := userLocation(user)
+	day := services.PreviousLocalDate(now, loc)
+	streak := 0
+	for _, d := range days {
+		if d > day {
+			continue // Today
+		}
+		if d != day {
+			break
+		}
+		streak++
+		t, err := time.ParseInLocation(services.LocalDateLayout, day, loc)
+		if err != nil {
+			break
+		}
+		day = services.PreviousLocalDate(t, loc)
+	}
+	return streak, nil
+}
+
 // logXPTransaction logs an XP transaction to the xp_transactions collection
 func logXPTransaction(app core.App, userId string, amount int, reason, referenceId, referenceType, sessionId string, metadata map[string]interface{}) error {
 	collection, err := app.FindCollectionByNameOrId("xp_transactions")
@@ -790,197 +642,28 @@ func logBadgeAward(app core.App, userId, badgeId, tier string, xpAwarded int, ve
 	return app.Save(record)
 }
 
-// verifyBadgeCondition checks if a user meets the conditions for a badge
-func verifyBadgeCondition(app core.App, authRecord *core.Record, badgeID string, verificationData map[string]interface{}) (bool, string) {
-	questionsCompleted := authRecord.GetInt("questionsCompleted")
-	questionsCorrect := authRecord.GetInt("questionsCorrect")
-	streak := authRecord.GetInt("streak")
-
-	// Get user progress for category stats
-	progressRecords, _ := app.FindRecordsByFilter(
-		"user_progress",
-		"user = {:userId}",
-		"-updated",
-		1,
-		0,
-		map[string]any{"userId": authRecord.Id},
-	)
-
-	var categoryProgress map[string]interface{}
-	var testHistory []interface{}
-	var bestCorrectStreak int
-
-	if len(progressRecords) > 0 {
-		record := progressRecords[0]
-		if cp := record.Get("categoryProgress"); cp != nil {
-			categoryProgress, _ = cp.(map[string]interface{})
-		}
-		if th := record.Get("testHistory"); th != nil {
-			testHistory, _ = th.([]interface{})
-		}
-		bestCorrectStreak = record.GetInt("bestCorrectStreak")
+// verifyBadgeCondition checks if a user meets the conditions for a badge.
+// The returned reason lists the unmet conditions.
+func verifyBadgeCondition(app core.App, authRecord *core.Record, def BadgeDefinition) (bool, string) {
+	stats, err := badgeStats(app, authRecord)
+	if err != nil {
+		app.Logger().Error("Failed to load badge stats", "error", err)
+		return false, "Progress could not be loaded"
 	}
-
-	switch badgeID {
-	case "first_steps":
-		if questionsCompleted >= 1 {
-			return true, ""
-		}
-		return false, "Complete at least 1 question"
-
-	case "early_bird":
-		hour := time.Now().Hour()
-		if hour < 8 && questionsCompleted > 0 {
-			return true, ""
-		}
-		return false, "Study before 8 AM"
-
-	case "night_owl":
-		hour := time.Now().Hour()
-		if hour >= 22 && questionsCompleted > 0 {
-			return true, ""
-		}
-		return false, "Study after 10 PM"
-
-	case "quick_learner":
-		if questionsCompleted >= 25 {
-			return true, ""
-		}
-		return false, "Complete 25 questions"
-
-	case "sign_master":
-		if categoryProgress != nil {
-			if signStats, ok := categoryProgress["Road Signs & Signals"].(map[string]interface{}); ok {
-				total, _ := signStats["total"].(float64)
-				correct, _ := signStats["correct"].(float64)
-				if total >= 20 && correct/total >= 0.8 {
-					return true, ""
-				}
-			}
-		}
-		return false, "80%+ accuracy on 20+ road sign questions"
-
-	case "road_scholar":
-		if questionsCompleted >= 100 {
-			return true, ""
-		}
-		return false, "Complete 100 questions"
-
-	case "sharpshooter":
-		if bestCorrectStreak >= 10 {
-			return true, ""
-		}
-		return false, "Get 10 correct answers in a row"
-
-	case "speed_demon":
-		for _, t := range testHistory {
-			if test, ok := t.(map[string]interface{}); ok {
-				passed, _ := test["passed"].(bool)
-				timeSpent, _ := test["timeSpent"].(float64)
-				if passed && timeSpent < 900 {
-					return true, ""
-				}
-			}
-		}
-		return false, "Pass a test in under 15 minutes"
-
-	case "consistent":
-		if streak >= 7 {
-			return true, ""
-		}
-		return false, "Maintain a 7-day streak"
-
-	case "perfect_score":
-		for _, t := range testHistory {
-			if test, ok := t.(map[string]interface{}); ok {
-				score, _ := test["score"].(float64)
-				total, _ := test["totalQuestions"].(float64)
-				if score == total && total > 0 {
-					return true, ""
-				}
-			}
-		}
-		return false, "Score 100% on a test"
-
-	case "category_champion":
-		categories := []string{"Road Signs & Signals", "Rules of the Road", "Safe Driving & Vehicle Handling",
-			"Alcohol/Drugs & Penalties", "Licensing & Documents", "Miscellaneous"}
-		for _, cat := range categories {
-			if categoryProgress != nil {
-				if stats, ok := categoryProgress[cat].(map[string]interface{}); ok {
-					total, _ := stats["total"].(float64)
-					correct, _ := stats["correct"].(float64)
-					if total < 10 || correct/total < 0.8 {
-						return false, "Master all 6 categories (80%+ on 10+ questions each)"
-					}
-				} else {
-					return false, "Master all 6 categories (80%+ on 10+ questions each)"
-				}
-			} else {
-				return false, "Master all 6 categories (80%+ on 10+ questions each)"
-			}
-		}
+	result, err := evaluateBadge(def, stats)
+	if err != nil {
+		app.Logger().Error("Failed to evaluate badge rule", "badgeId", def.ID, "error", err)
+		return false, "Badge rule could not be evaluated"
+	}
+	if result.Met {
 		return true, ""
-
-	case "dedicated_driver":
-		if questionsCompleted >= 250 {
-			return true, ""
-		}
-		return false, "Complete 250 questions"
-
-	case "marathon_runner":
-		if streak >= 14 {
-			return true, ""
-		}
-		return false, "Maintain a 14-day streak"
-
-	case "diamond_streak":
-		if streak >= 30 {
-			return true, ""
-		}
-		return false, "Maintain a 30-day streak"
-
-	case "test_master":
-		passedCount := 0
-		for _, t := range testHistory {
-			if test, ok := t.(map[string]interface{}); ok {
-				if passed, _ := test["passed"].(bool); passed {
-					passedCount++
-				}
-			}
-		}
-		if passedCount >= 10 {
-			return true, ""
-		}
-		return false, "Pass 10 tests"
-
-	case "perfectionist":
-		perfectCount := 0
-		for _, t := range testHistory {
-			if test, ok := t.(map[string]interface{}); ok {
-				score, _ := test["score"].(float64)
-				total, _ := test["totalQuestions"].(float64)
-				if score == total && total > 0 {
-					perfectCount++
-				}
-			}
-		}
-		if perfectCount >= 3 {
-			return true, ""
-		}
-		return false, "Get 3 perfect scores"
-
-	case "g1_legend":
-		if questionsCompleted >= 500 && questionsCorrect > 0 {
-			accuracy := float64(questionsCorrect) / float64(questionsCompleted)
-			if accuracy >= 0.9 {
-				return true, ""
-			}
-		}
-		return false, "Complete 500+ questions with 90%+ accuracy"
 	}
 
-	return false, "Unknown badge"
+	messages := make([]string, 0, len(result.Conditions))
+	for _, c := range result.Missing() {
+		messages = append(messages, c.Message)
+	}
+	return false, strings.Join(messages, "; ")
 }
 
 // parseInt helper to parse string to int
@@ -1006,49 +689,40 @@ func calculateLevel(xp int) int {
 	return level
 }
 
-// mergeTestHistory merges test history from local and server
-func mergeTestHistory(local, server interface{}) interface{} {
-	if local == nil {
-		return server
-	}
-	if server == nil {
-		return local
-	}
-
-	// Simple merge: prefer local if both exist
-	// In production, you'd want to merge by date and dedupe
-	localSlice, localOk := local.([]interface{})
-	serverSlice, serverOk := server.([]interface{})
-
-	if !localOk {
-		return server
-	}
-	if !serverOk {
-		return local
+// serverProgress returns a user's progress as the server records it, with
+// the daily challenge list the client last synced
+func serverProgress(app core.App, user *core.Record) (UserProgressData, error) {
+	recorded, err := loadRecordedProgress(app, user.Id)
+	if err != nil {
+		return UserProgressData{}, err
 	}
 
-	// Create a map of tests by date to dedupe
-	testMap := make(map[string]interface{})
-	for _, test := range serverSlice {
-		if testMap, ok := test.(map[string]interface{}); ok {
-			if date, ok := testMap["date"].(string); ok {
-				testMap[date] = test
-			}
-		}
-	}
-	for _, test := range localSlice {
-		if testMap, ok := test.(map[string]interface{}); ok {
-			if date, ok := testMap["date"].(string); ok {
-				testMap[date] = test
-			}
-		}
+	progress := UserProgressData{
+		XP:                 user.GetInt("xp"),
+		Level:              user.GetInt("level"),
+		Streak:             user.GetInt("streak"),
+		LongestStreak:      user.GetInt("longestStreak"),
+		QuestionsCompleted: recorded.QuestionsCompleted,
+		QuestionsCorrect:   recorded.QuestionsCorrect,
+		Badges:             userBadges(user),
+		CategoryProgress:   recorded.CategoryProgress,
+		TestHistory:        recorded.TestHistory,
+		FastestTestTime:    recorded.FastestTestTime,
+		BestCorrectStreak:  recorded.BestCorrectStreak,
 	}
 
-	// Convert back to slice
-	result := make([]interface{}, 0, len(testMap))
-	for _, test := range testMap {
-		result = append(result, test)
+	progressRecords, err := app.FindRecordsByFilter(
+		"user_progress",
+		"user = {:userId}",
+		"-updated",
+		1,
+		0,
+		map[string]any{"userId": user.Id},
+	)
+	if err == nil && len(progressRecords) > 0 {
+		progress.DailyChallenges = progressRecords[0].Get("dailyChallenges")
+		progress.DailyChallengeDate = progressRecords[0].GetString("dailyChallengeDate")
 	}
 
-	return result
+	return progress, nil
 }
@@ -0,0 +1,165 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Every create, update and delete of a question is recorded in
+// question_bank_changes under the next bank version, in the same
+// transaction as the change itself. The bank version is the highest
+// recorded version, so it only ever goes up, and clients holding an older
+// version can ask which questions changed since.
+
+// Question bank change actions
+const (
+	QuestionBankCreate = "create"
+	QuestionBankUpdate = "update"
+	QuestionBankDelete = "delete"
+)
+
+// QuestionBankChanges lists the questions that changed between two bank versions
+type QuestionBankChanges struct {
+	Version int      `json:"version"` // Current bank version
+	Since   int      `json:"since"`
+	Added   []string `json:"added"`
+	Changed []string `json:"changed"`
+	Removed []string `json:"removed"`
+}
+
+// RegisterQuestionBankHooks bumps the question bank version on every
+// question change and records what changed
+func RegisterQuestionBankHooks(app core.App) {
+	bindQuestionBankHook := func(action string) func(e *core.RecordEvent) error {
+		return func(e *core.RecordEvent) error {
+			return e.App.RunInTransaction(func(txApp core.App) error {
+				e.App = txApp
+				if err := e.Next(); err != nil {
+					return err
+				}
+				return recordQuestionBankChange(txApp, e.Record.Id, action)
+			})
+		}
+	}
+	app.OnRecordCreate("questions").BindFunc(bindQuestionBankHook(QuestionBankCreate))
+	app.OnRecordUpdate("questions").BindFunc(bindQuestionBankHook(QuestionBankUpdate))
+	app.OnRecordDelete("questions").BindFunc(bindQuestionBankHook(QuestionBankDelete))
+}
+
+// registerQuestionBankRoutes registers the delta sync route
+func registerQuestionBankRoutes(app core.App, se *core.ServeEvent) {
+	// Public: Questions added, changed and removed since a bank version
+	se.Router.GET("/api/questions/changes", func(e *core.RequestEvent) error {
+		since, err := strconv.Atoi(e.Request.URL.Query().Get("since"))
+		if err != nil || since < 0 {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "since must be a question bank version"})
+		}
+
+		changes, err := questionBankChangesSince(app, since)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch question changes"})
+		}
+		if since > changes.Version {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Unknown question bank version"})
+		}
+
+		return e.JSON(http.StatusOK, changes)
+	})
+}
+
+// recordQuestionBankChange records a question change under the next bank version
+func recordQuestionBankChange(app core.App, questionID, action string) error {
+	collection, err := app.FindCollectionByNameOrId("question_bank_changes")
+	if err != nil {
+		return nil // Collection might not exist yet
+	}
+
+	version, err := questionBankVersion(app)
+	if err != nil {
+		return err
+	}
+
+	change := core.NewRecord(collection)
+	change.Set("version", version+1)
+	change.Set("question", questionID)
+	change.Set("action", action)
+	return app.Save(change)
+}
+
+// questionBankVersion returns the current question bank version
+func questionBankVersion(app core.App) (int, error) {
+	var row struct {
+		Version int `db:"version"`
+	}
+	err := app.DB().NewQuery("SELECT COALESCE(MAX(version), 0) AS version FROM question_bank_changes").One(&row)
+	return row.Version, err
+}
+
+// questionBankChangesSince returns the changes from a bank version up to
+// the current one. The version is read first and bounds the changes, so a
+// change committed in between is left for the next sync instead of being
+// covered by a version the client would skip it with.
+func questionBankChangesSince(app core.App, since int) (*QuestionBankChanges, error) {
+	version, err := questionBankVersion(app)
+	if err != nil {
+		return nil, err
+	}
+	return questionBankChangesBetween(app, since, version)
+}
+
+// questionBankChangesBetween folds the changes after since and up to version
+// into the net effect on each question: a question created and deleted in
+// between isn't reported at all
+func questionBankChangesBetween(app core.App, since, version int) (*QuestionBankChanges, error) {
+	var rows []struct {
+		Version  int    `db:"version"`
+		Question string `db:"question"`
+		Action   string `db:"action"`
+	}
+	err := app.DB().
+		Select("version", "question", "action").
+		From("question_bank_changes").
+		Where(dbx.NewExp("version > {:since} AND version <= {:version}", dbx.Params{"since": since, "version": version})).
+		OrderBy("version ASC").
+		All(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := &QuestionBankChanges{
+		Version: version,
+		Since:   since,
+		Added:   []string{},
+		Changed: []string{},
+		Removed: []string{},
+	}
+
+	first := map[string]string{}
+	last := map[string]string{}
+	order := []string{}
+	for _, row := range rows {
+		if _, ok := first[row.Question]; !ok {
+			first[row.Question] = row.Action
+			order = append(order, row.Question)
+		}
+		last[row.Question] = row.Action
+	}
+
+	for _, id := range order {
+		switch {
+		case last[id] == QuestionBankDelete && first[id] == QuestionBankCreate:
+			// Came and went
+		case last[id] == QuestionBankDelete:
+			changes.Removed = append(changes.Removed, id)
+		case first[id] == QuestionBankCreate:
+			changes.Added = append(changes.Added, id)
+		default:
+			changes.Changed = append(changes.Changed, id)
+		}
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,84 @@
+package routes
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestQuestionBankHooks(t *testing.T) {
+	app := newTestApp(t)
+	RegisterQuestionBankHooks(app)
+
+	start, err := questionBankVersion(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// No server running: changes are made straight through the app, as an
+	// admin command would
+	kept, edited, removed := newTestQuestion(t, app), newTestQuestion(t, app), newTestQuestion(t, app)
+	afterCreate, err := questionBankVersion(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edited.Set("explanation", "Because, really")
+	if err := app.Save(edited); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Delete(removed); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := questionBankChangesSince(app, afterCreate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes.Version != start+5 {
+		t.Fatalf("version = %d, want %d after five changes", changes.Version, start+5)
+	}
+	if !slices.Equal(changes.Changed, []string{edited.Id}) || !slices.Equal(changes.Removed, []string{removed.Id}) || len(changes.Added) != 0 {
+		t.Fatalf("changes since %d = %+v, want %s changed and %s removed", afterCreate, changes, edited.Id, removed.Id)
+	}
+
+	changes, err = questionBankChangesSince(app, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(changes.Added, []string{kept.Id, edited.Id}) {
+		t.Fatalf("added since %d = %v, want %v", start, changes.Added, []string{kept.Id, edited.Id})
+	}
+}
+
+func TestQuestionBankChangesBoundedByVersion(t *testing.T) {
+	app := newTestApp(t)
+	RegisterQuestionBankHooks(app)
+
+	question := newTestQuestion(t, app)
+
+	// The version a sync reads before a change commits
+	version, err := questionBankVersion(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Delete(question); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := questionBankChangesBetween(app, 0, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes.Version != version || !slices.Equal(changes.Added, []string{question.Id}) || len(changes.Removed) != 0 {
+		t.Fatalf("changes up to %d = %+v, want only %s added", version, changes, question.Id)
+	}
+
+	// The next sync picks the later change up
+	changes, err = questionBankChangesSince(app, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes.Version != version+1 || !slices.Equal(changes.Removed, []string{question.Id}) {
+		t.Fatalf("changes since %d = %+v, want %s removed", version, changes, question.Id)
+	}
+}
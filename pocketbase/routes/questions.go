@@ -84,11 +84,16 @@ func RegisterQuestionRoutes(app core.App, se *core.ServeEvent) {
 		return handleGetPracticeQuestions(app, e)
 	}).Bind(apis.RequireAuth())
 
-	// Auth required: Get test questions (40 random questions)
+	// Auth required: Get test questions (drawn from the default blueprint)
 	se.Router.GET("/api/questions/test", func(e *core.RequestEvent) error {
 		return handleGetTestQuestions(app, e)
 	}).Bind(apis.RequireAuth())
 
+	// Auth required: Get questions due for spaced-repetition review
+	se.Router.GET("/api/questions/review", func(e *core.RequestEvent) error {
+		return handleGetReviewQuestions(app, e)
+	}).Bind(apis.RequireAuth())
+
 	// Auth required: Validate answer
 	se.Router.POST("/api/questions/validate", func(e *core.RequestEvent) error {
 		return handleValidateAnswer(app, e)
@@ -98,6 +103,8 @@ func RegisterQuestionRoutes(app core.App, se *core.ServeEvent) {
 	se.Router.GET("/api/questions/{id}", func(e *core.RequestEvent) error {
 		return handleGetQuestion(app, e)
 	}).Bind(apis.RequireAuth())
+
+	registerQuestionBankRoutes(app, se)
 }
 
 func handleGetCategories(app core.App, e *core.RequestEvent) error {
@@ -159,7 +166,7 @@ func handleGetPracticeQuestions(app core.App, e *core.RequestEvent) error {
 	}
 
 	// Check if user is premium
-	isPremium := authRecord.GetBool("isPremium")
+	isPremium := userHasPremium(app, authRecord)
 
 	collection, err := app.FindCollectionByNameOrId("questions")
 	if err != nil {
@@ -225,44 +232,23 @@ func handleGetTestQuestions(app core.App, e *core.RequestEvent) error {
 	}
 
 	// Check if user is premium
-	isPremium := authRecord.GetBool("isPremium")
+	isPremium := userHasPremium(app, authRecord)
 
-	collection, err := app.FindCollectionByNameOrId("questions")
+	// Draw questions from the default blueprint (like the real G1 test)
+	blueprint, err := loadBlueprint(app, "")
 	if err != nil {
 		return e.JSON(http.StatusInternalServerError, map[string]string{
 			"error": "Questions not available",
 		})
 	}
 
-	// Get questions (exclude premium for free users)
-	filter := ""
-	if !isPremium {
-		filter = "isPremium = false"
-	}
-
-	var records []*core.Record
-	if filter != "" {
-		records, err = app.FindRecordsByFilter(collection.Id, filter, "", 0, 0, nil)
-	} else {
-		records, err = app.FindAllRecords(collection)
-	}
-
+	blueprint, records, err := drawBlueprintQuestions(app, blueprint, isPremium)
 	if err != nil {
 		return e.JSON(http.StatusInternalServerError, map[string]string{
 			"error": "Failed to fetch questions",
 		})
 	}
 
-	// Shuffle and select 40 questions (like the real G1 test)
-	rand.Shuffle(len(records), func(i, j int) {
-		records[i], records[j] = records[j], records[i]
-	})
-	testSize := 40
-	if len(records) < testSize {
-		testSize = len(records)
-	}
-	records = records[:testSize]
-
 	// Convert to client format
 	questions := make([]QuestionForClient, 0, len(records))
 	questionIds := make([]string, 0, len(records))
@@ -287,6 +273,8 @@ func handleGetTestQuestions(app core.App, e *core.RequestEvent) error {
 		session.Set("answers", "{}")
 		session.Set("status", "active")
 		session.Set("startedAt", time.Now().UTC().Format(time.RFC3339))
+		blueprintJSON, _ := json.Marshal(blueprint)
+		session.Set("blueprint", string(blueprintJSON))
 		app.Save(session)
 
 		return e.JSON(http.StatusOK, map[string]interface{}{
@@ -332,7 +320,7 @@ func handleValidateAnswer(app core.App, e *core.RequestEvent) error {
 	}
 
 	// Check if premium question and user is not premium
-	if question.IsPremium && !authRecord.GetBool("isPremium") {
+	if question.IsPremium && !userHasPremium(app, authRecord) {
 		return e.JSON(http.StatusForbidden, map[string]string{
 			"error": "Premium question - upgrade required",
 		})
@@ -341,24 +329,22 @@ func handleValidateAnswer(app core.App, e *core.RequestEvent) error {
 	// Validate the answer
 	correct := req.SelectedAnswer == question.CorrectAnswer
 
-	// Calculate XP earned (only if correct and reasonable time spent)
-	xpEarned := 0
-	if correct {
-		// Minimum 2 seconds per question to prevent cheating
-		if req.TimeSpent >= 2000 {
-			xpEarned = 10 // Base XP for correct answer
-			// Bonus for difficulty
-			xpEarned += (question.Difficulty - 1) * 5
-		}
+	// Record the attempt and update the spaced-repetition schedule
+	if err := logQuestionAttempt(app, authRecord.Id, question, AttemptSourcePractice, "", req.SelectedAnswer, req.TimeSpent, time.Now().UnixMilli(), correct); err != nil {
+		app.Logger().Error("Failed to log question attempt", "error", err)
+	}
+	if err := updateQuestionReview(app, authRecord.Id, question.ID, correct, req.TimeSpent, false); err != nil {
+		app.Logger().Error("Failed to update review schedule", "error", err)
 	}
 
-	// TODO: Update user XP in Phase 4 (Progress Authority)
-
+	// No XP here, not even for mastering the question: this endpoint is
+	// stateless and can be called for any question over and over. Practice XP
+	// is only credited through /api/practice sessions.
 	return e.JSON(http.StatusOK, ValidateResponse{
 		Correct:       correct,
 		CorrectAnswer: question.CorrectAnswer,
 		Explanation:   question.Explanation,
-		XPEarned:      xpEarned,
+		XPEarned:      0,
 	})
 }
 
@@ -383,7 +369,7 @@ func handleGetQuestion(app core.App, e *core.RequestEvent) error {
 	}
 
 	// Check premium access
-	if record.GetBool("isPremium") && !authRecord.GetBool("isPremium") {
+	if record.GetBool("isPremium") && !userHasPremium(app, authRecord) {
 		return e.JSON(http.StatusForbidden, map[string]string{
 			"error": "Premium question - upgrade required",
 		})
@@ -417,7 +403,7 @@ func recordToQuestion(record *core.Record) (Question, error) {
 		}
 		q.Question = questionText
 
-		optionsJSON, err := encryption.Decrypt(record.GetString("options"))
+		optionsJSON, err := encryption.Decrypt(encryptedJSONValue(record, "options"))
 		if err != nil {
 			return q, err
 		}
@@ -470,7 +456,7 @@ func recordToQuestionForClient(record *core.Record) (QuestionForClient, error) {
 		}
 		q.Question = questionText
 
-		optionsJSON, err := encryption.Decrypt(record.GetString("options"))
+		optionsJSON, err := encryption.Decrypt(encryptedJSONValue(record, "options"))
 		if err != nil {
 			return q, err
 		}
@@ -488,3 +474,14 @@ func recordToQuestionForClient(record *core.Record) (QuestionForClient, error) {
 
 	return q, nil
 }
+
+// encryptedJSONValue returns the ciphertext stored in a JSON field.
+// Encrypted values aren't valid JSON, so PocketBase stores them as a JSON string.
+func encryptedJSONValue(record *core.Record, field string) string {
+	raw := record.GetString(field)
+	var value string
+	if err := json.Unmarshal([]byte(raw), &value); err == nil {
+		return value
+	}
+	return raw
+}
@@ -0,0 +1,204 @@
+package routes
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"driveprep/services"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ReviewQuestion is a question returned by the review endpoint with its schedule
+type ReviewQuestion struct {
+	QuestionForClient
+	IsNew       bool   `json:"isNew"`
+	DueAt       string `json:"dueAt,omitempty"`
+	Repetitions int    `json:"repetitions"`
+	Lapses      int    `json:"lapses"`
+}
+
+// handleGetReviewQuestions returns the user's due questions (most overdue first),
+// topped up with questions they have never seen
+func handleGetReviewQuestions(app core.App, e *core.RequestEvent) error {
+	authRecord := e.Auth
+	if authRecord == nil {
+		return e.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+
+	// Get query parameters
+	category := e.Request.URL.Query().Get("category")
+	limitStr := e.Request.URL.Query().Get("limit")
+	limit := 20 // default
+	if limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 50 {
+			limit = l
+		}
+	}
+	includeNew := e.Request.URL.Query().Get("includeNew") != "false"
+
+	isPremium := userHasPremium(app, authRecord)
+
+	// Due reviews, filtered through the question relation
+	filter := "user = {:userId} && dueAt <= @now"
+	params := map[string]any{"userId": authRecord.Id}
+	if category != "" {
+		filter += " && question.category = {:category}"
+		params["category"] = category
+	}
+	if !isPremium {
+		filter += " && question.isPremium = false"
+	}
+
+	dueReviews, err := app.FindRecordsByFilter("question_reviews", filter, "dueAt", limit, 0, params)
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to fetch review schedule",
+		})
+	}
+
+	questions := make([]ReviewQuestion, 0, limit)
+	for _, review := range dueReviews {
+		record, err := app.FindRecordById("questions", review.GetString("question"))
+		if err != nil {
+			continue
+		}
+		q, err := recordToQuestionForClient(record)
+		if err != nil {
+			continue
+		}
+		questions = append(questions, ReviewQuestion{
+			QuestionForClient: q,
+			DueAt:             review.GetDateTime("dueAt").String(),
+			Repetitions:       review.GetInt("repetitions"),
+			Lapses:            review.GetInt("lapses"),
+		})
+	}
+	dueCount := len(questions)
+
+	// Top up with questions the user has never reviewed
+	if includeNew && len(questions) < limit {
+		reviewed, _ := app.FindRecordsByFilter(
+			"question_reviews",
+			"user = {:userId}",
+			"",
+			0,
+			0,
+			map[string]any{"userId": authRecord.Id},
+		)
+		seen := make(map[string]bool, len(reviewed))
+		for _, r := range reviewed {
+			seen[r.GetString("question")] = true
+		}
+
+		questionFilter := "id != ''"
+		questionParams := map[string]any{}
+		if category != "" {
+			questionFilter += " && category = {:category}"
+			questionParams["category"] = category
+		}
+		if !isPremium {
+			questionFilter += " && isPremium = false"
+		}
+
+		candidates, err := app.FindRecordsByFilter("questions", questionFilter, "", 0, 0, questionParams)
+		if err == nil {
+			rand.Shuffle(len(candidates), func(i, j int) {
+				candidates[i], candidates[j] = candidates[j], candidates[i]
+			})
+			for _, record := range candidates {
+				if len(questions) >= limit {
+					break
+				}
+				if seen[record.Id] {
+					continue
+				}
+				q, err := recordToQuestionForClient(record)
+				if err != nil {
+					continue
+				}
+				questions = append(questions, ReviewQuestion{QuestionForClient: q, IsNew: true})
+			}
+		}
+	}
+
+	return e.JSON(http.StatusOK, map[string]interface{}{
+		"questions": questions,
+		"count":     len(questions),
+		"dueCount":  dueCount,
+		"newCount":  len(questions) - dueCount,
+	})
+}
+
+// updateQuestionReview applies an answer to the user's review schedule for
+// a question. Mastery XP is only credited when creditMastery is set, for
+// answers scored by the server in a session or an offline replay.
+func updateQuestionReview(app core.App, userId, questionId string, correct bool, timeSpent int, creditMastery bool) error {
+	record, err := app.FindFirstRecordByFilter(
+		"question_reviews",
+		"user = {:userId} && question = {:questionId}",
+		map[string]any{"userId": userId, "questionId": questionId},
+	)
+	if err != nil {
+		collection, err := app.FindCollectionByNameOrId("question_reviews")
+		if err != nil {
+			return err // Collection might not exist yet
+		}
+		record = core.NewRecord(collection)
+		record.Set("user", userId)
+		record.Set("question", questionId)
+	}
+
+	state := services.NewReviewState()
+	if !record.IsNew() {
+		state = services.ReviewState{
+			EaseFactor:     record.GetFloat("easeFactor"),
+			IntervalDays:   record.GetFloat("intervalDays"),
+			Repetitions:    record.GetInt("repetitions"),
+			Lapses:         record.GetInt("lapses"),
+			DueAt:          record.GetDateTime("dueAt").Time(),
+			LastReviewedAt: record.GetDateTime("lastReviewedAt").Time(),
+		}
+	}
+
+	now := time.Now().UTC()
+	next := state.Review(services.GradeAnswer(correct, timeSpent), now)
+
+	record.Set("easeFactor", next.EaseFactor)
+	record.Set("intervalDays", next.IntervalDays)
+	record.Set("repetitions", next.Repetitions)
+	record.Set("lapses", next.Lapses)
+	record.Set("dueAt", next.DueAt)
+	record.Set("lastReviewedAt", next.LastReviewedAt)
+	record.Set("lastCorrect", correct)
+
+	if err := app.Save(record); err != nil {
+		return err
+	}
+
+	// Answers before the question is due still move its schedule, but only a
+	// review on time can earn the mastery XP
+	if creditMastery && next.Mastered() && !now.Before(state.DueAt) {
+		return creditFlashcardMastered(app, userId, questionId)
+	}
+	return nil
+}
+
+// creditFlashcardMastered credits the XP for mastering a question. Each
+// question pays once, so reviewing it again or mastering it again after a
+// lapse earns nothing.
+func creditFlashcardMastered(app core.App, userId, questionId string) error {
+	user, err := app.FindRecordById("users", userId)
+	if err != nil {
+		return err
+	}
+
+	_, err = creditRewardXP(app, user, flashcardMasteredReward, "flashcard_mastered", questionId, "", nil)
+	if errors.Is(err, ErrXPAlreadyAwarded) || errors.Is(err, ErrXPDailyLimit) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,71 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestValidateAnswerDoesNotPayMastery(t *testing.T) {
+	app := newTestApp(t)
+	// Only the handler: RegisterQuestionRoutes would set up question
+	// encryption for every test in the package
+	mux := newTestRouter(t, app, func(se *core.ServeEvent) {
+		se.Router.POST("/api/questions/validate", func(e *core.RequestEvent) error {
+			return handleValidateAnswer(app, e)
+		}).Bind(apis.RequireAuth())
+	})
+
+	user := newTestUser(t, app, "reviewer@example.com", nil)
+	question := newTestQuestion(t, app)
+
+	// One more on-time correct review takes the question past mastery
+	newTestRecord(t, app, "question_reviews", map[string]any{
+		"user":         user.Id,
+		"question":     question.Id,
+		"easeFactor":   2.5,
+		"intervalDays": 15,
+		"repetitions":  3,
+		"dueAt":        time.Now().Add(-time.Hour).UTC(),
+	})
+
+	body := fmt.Sprintf(`{"questionId":%q,"selectedAnswer":1,"timeSpent":4000}`, question.Id)
+	rec := serveTestRequest(t, mux, user, http.MethodPost, "/api/questions/validate", body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("validate: %d %s", rec.Code, rec.Body.String())
+	}
+
+	review, err := app.FindFirstRecordByFilter("question_reviews", "user = {:user} && question = {:question}",
+		dbx.Params{"user": user.Id, "question": question.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if review.GetFloat("intervalDays") < 21 {
+		t.Fatalf("intervalDays = %v, want the schedule to still move to mastery", review.GetFloat("intervalDays"))
+	}
+	if xp := reload(t, app, user).GetInt("xp"); xp != 0 {
+		t.Fatalf("xp = %d after validating answers, want 0", xp)
+	}
+
+	// A server-scored answer masters the next question and pays once
+	other := newTestQuestion(t, app)
+	newTestRecord(t, app, "question_reviews", map[string]any{
+		"user":         user.Id,
+		"question":     other.Id,
+		"easeFactor":   2.5,
+		"intervalDays": 15,
+		"repetitions":  3,
+		"dueAt":        time.Now().Add(-time.Hour).UTC(),
+	})
+	if err := updateQuestionReview(app, user.Id, other.Id, true, 4000, true); err != nil {
+		t.Fatal(err)
+	}
+	if xp := reload(t, app, user).GetInt("xp"); xp != flashcardMasteredReward.Amount {
+		t.Fatalf("xp = %d after a scored mastery, want %d", xp, flashcardMasteredReward.Amount)
+	}
+}
@@ -0,0 +1,138 @@
+package routes
+
+import (
+	"slices"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Staff roles are stored on users in the "roles" field and can only be
+// changed by a superuser (from the dashboard or the "roles" command). Each
+// role grants a fixed set of permissions, and admin routes check
+// permissions rather than roles.
+
+// Permission is something an admin route can require
+type Permission string
+
+const (
+	PermissionSeed         Permission = "seed"          // Import question banks
+	PermissionLicenseAdmin Permission = "license_admin" // Generate, revoke and extend licenses; create organizations
+	PermissionContentEdit  Permission = "content_edit"  // Edit test blueprints and badge definitions
+	PermissionSupport      Permission = "support"       // Look up licenses and batches for customers
+	PermissionBilling      Permission = "billing"       // Replay Stripe webhook events
+)
+
+const (
+	RoleAdmin          = "admin"
+	RoleContentEditor  = "content_editor"
+	RoleLicenseManager = "license_manager"
+	RoleSupport        = "support"
+)
+
+// rolePermissions lists the permissions each role grants
+var rolePermissions = map[string][]Permission{
+	RoleAdmin:          {PermissionSeed, PermissionLicenseAdmin, PermissionContentEdit, PermissionSupport, PermissionBilling},
+	RoleContentEditor:  {PermissionSeed, PermissionContentEdit},
+	RoleLicenseManager: {PermissionLicenseAdmin, PermissionSupport},
+	RoleSupport:        {PermissionSupport},
+}
+
+// contentCollections are edited through the regular records API by
+// users with the content edit permission. Their API rules name the roles
+// that grant it, so keep those in step with rolePermissions.
+var contentCollections = []string{"test_blueprints", "badge_definitions"}
+
+// Roles lists every staff role
+func Roles() []string {
+	return []string{RoleAdmin, RoleContentEditor, RoleLicenseManager, RoleSupport}
+}
+
+// IsRole reports whether role is a known staff role
+func IsRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// userHasPermission reports whether any of a user's roles grants permission
+func userHasPermission(user *core.Record, permission Permission) bool {
+	if user == nil || user.Collection().Name != "users" {
+		return false
+	}
+	for _, role := range user.GetStringSlice("roles") {
+		if slices.Contains(rolePermissions[role], permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPermission reports whether the caller of a request holds permission
+func hasPermission(e *core.RequestEvent, permission Permission) bool {
+	return e.HasSuperuserAuth() || userHasPermission(e.Auth, permission)
+}
+
+// actingUserID is the users record behind a staff request, for createdBy
+// style fields. Superusers aren't users records, so it's empty for them.
+func actingUserID(e *core.RequestEvent) string {
+	if e.Auth == nil || e.Auth.Collection().Name != "users" {
+		return ""
+	}
+	return e.Auth.Id
+}
+
+// RegisterRoleHooks keeps roles out of self-service profile updates and
+// gates the content collections on the content edit permission
+func RegisterRoleHooks(app core.App) {
+	app.OnRecordCreateRequest("users").BindFunc(func(e *core.RecordRequestEvent) error {
+		if !e.HasSuperuserAuth() && len(e.Record.GetStringSlice("roles")) > 0 {
+			return apis.NewForbiddenError("Only superusers can assign roles", nil)
+		}
+		return e.Next()
+	})
+
+	app.OnRecordUpdateRequest("users").BindFunc(func(e *core.RecordRequestEvent) error {
+		if !e.HasSuperuserAuth() && !slices.Equal(e.Record.GetStringSlice("roles"), e.Record.Original().GetStringSlice("roles")) {
+			return apis.NewForbiddenError("Only superusers can assign roles", nil)
+		}
+		return e.Next()
+	})
+
+	requireContentEdit := func(e *core.RequestEvent) error {
+		if !hasPermission(e, PermissionContentEdit) {
+			return apis.NewForbiddenError("Content edit permission required", nil)
+		}
+		return nil
+	}
+
+	app.OnRecordsListRequest(contentCollections...).BindFunc(func(e *core.RecordsListRequestEvent) error {
+		if err := requireContentEdit(e.RequestEvent); err != nil {
+			return err
+		}
+		return e.Next()
+	})
+	app.OnRecordViewRequest(contentCollections...).BindFunc(func(e *core.RecordRequestEvent) error {
+		if err := requireContentEdit(e.RequestEvent); err != nil {
+			return err
+		}
+		return e.Next()
+	})
+	app.OnRecordCreateRequest(contentCollections...).BindFunc(func(e *core.RecordRequestEvent) error {
+		if err := requireContentEdit(e.RequestEvent); err != nil {
+			return err
+		}
+		return e.Next()
+	})
+	app.OnRecordUpdateRequest(contentCollections...).BindFunc(func(e *core.RecordRequestEvent) error {
+		if err := requireContentEdit(e.RequestEvent); err != nil {
+			return err
+		}
+		return e.Next()
+	})
+	app.OnRecordDeleteRequest(contentCollections...).BindFunc(func(e *core.RecordRequestEvent) error {
+		if err := requireContentEdit(e.RequestEvent); err != nil {
+			return err
+		}
+		return e.Next()
+	})
+}
@@ -0,0 +1,137 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// newTestSuperuser creates a superuser with the given email
+func newTestSuperuser(tb testing.TB, app core.App, email string) *core.Record {
+	tb.Helper()
+
+	return newTestRecord(tb, app, core.CollectionNameSuperusers, map[string]any{
+		"email":    email,
+		"password": "password123",
+	})
+}
+
+func TestRequirePermission(t *testing.T) {
+	app := newTestApp(t)
+	mux := newTestRouter(t, app, func(se *core.ServeEvent) {
+		se.Router.GET("/api/test/support", func(e *core.RequestEvent) error {
+			return e.NoContent(http.StatusNoContent)
+		}).Bind(RequireAuth(app), RequirePermission(app, PermissionBilling, PermissionSupport))
+	})
+
+	cases := []struct {
+		name string
+		user *core.Record
+		want int
+	}{
+		{"guest", nil, http.StatusUnauthorized},
+		{"no roles", newTestUser(t, app, "student@example.com", nil), http.StatusForbidden},
+		{"role without the permissions", newTestUser(t, app, "editor@example.com", map[string]any{"roles": []string{RoleContentEditor}}), http.StatusForbidden},
+		{"role with one of the permissions", newTestUser(t, app, "support@example.com", map[string]any{"roles": []string{RoleSupport}}), http.StatusNoContent},
+		{"one of several roles", newTestUser(t, app, "both@example.com", map[string]any{"roles": []string{RoleContentEditor, RoleLicenseManager}}), http.StatusNoContent},
+		{"admin", newTestUser(t, app, "admin@example.com", map[string]any{"roles": []string{RoleAdmin}}), http.StatusNoContent},
+		{"superuser", newTestSuperuser(t, app, "root@example.com"), http.StatusNoContent},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if rec := serveTestRequest(t, mux, c.user, http.MethodGet, "/api/test/support", ""); rec.Code != c.want {
+				t.Fatalf("status = %d %s, want %d", rec.Code, rec.Body.String(), c.want)
+			}
+		})
+	}
+}
+
+func TestContentCollectionRules(t *testing.T) {
+	for _, hooks := range []bool{false, true} {
+		name := "rules alone"
+		if hooks {
+			name = "rules and role hooks"
+		}
+		t.Run(name, func(t *testing.T) {
+			app := newTestApp(t)
+			if hooks {
+				RegisterRoleHooks(app)
+			}
+			mux := newTestRouter(t, app, func(*core.ServeEvent) {})
+
+			blueprint, err := app.FindFirstRecordByFilter("test_blueprints", "id != ''")
+			if err != nil {
+				t.Fatal(err)
+			}
+			student := newTestUser(t, app, "student@example.com", nil)
+			support := newTestUser(t, app, "support@example.com", map[string]any{"roles": []string{RoleSupport}})
+			editor := newTestUser(t, app, "editor@example.com", map[string]any{"roles": []string{RoleContentEditor}})
+			admin := newTestUser(t, app, "admin@example.com", map[string]any{"roles": []string{RoleAdmin}})
+
+			for _, c := range []struct {
+				user    *core.Record
+				allowed bool
+			}{
+				{student, false},
+				{support, false},
+				{editor, true},
+				{admin, true},
+			} {
+				t.Run(c.user.GetString("name"), func(t *testing.T) {
+					for _, collection := range contentCollections {
+						rec := serveTestRequest(t, mux, c.user, http.MethodGet, "/api/collections/"+collection+"/records", "")
+						var list struct {
+							TotalItems int `json:"totalItems"`
+						}
+						_ = json.Unmarshal(rec.Body.Bytes(), &list)
+						if listed := rec.Code == http.StatusOK && list.TotalItems > 0; listed != c.allowed {
+							t.Fatalf("list %s: %d %s, want allowed=%v", collection, rec.Code, rec.Body.String(), c.allowed)
+						}
+					}
+
+					rec := serveTestRequest(t, mux, c.user, http.MethodGet, "/api/collections/test_blueprints/records/"+blueprint.Id, "")
+					if viewed := rec.Code == http.StatusOK; viewed != c.allowed {
+						t.Fatalf("view: %d %s, want allowed=%v", rec.Code, rec.Body.String(), c.allowed)
+					}
+
+					rec = serveTestRequest(t, mux, c.user, http.MethodPatch, "/api/collections/test_blueprints/records/"+blueprint.Id, `{"name":"Edited by `+c.user.GetString("name")+`"}`)
+					if updated := rec.Code == http.StatusOK; updated != c.allowed {
+						t.Fatalf("update: %d %s, want allowed=%v", rec.Code, rec.Body.String(), c.allowed)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestRoleHooksKeepRolesOutOfProfiles(t *testing.T) {
+	app := newTestApp(t)
+	RegisterRoleHooks(app)
+	mux := newTestRouter(t, app, func(*core.ServeEvent) {})
+
+	user := newTestUser(t, app, "climber@example.com", nil)
+	rec := serveTestRequest(t, mux, user, http.MethodPatch, "/api/collections/users/records/"+user.Id, `{"roles":["admin"]}`)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("self-assigning a role: %d %s, want 403", rec.Code, rec.Body.String())
+	}
+	if roles := reload(t, app, user).GetStringSlice("roles"); len(roles) != 0 {
+		t.Fatalf("roles = %v, want none", roles)
+	}
+
+	// Other profile fields still update
+	rec = serveTestRequest(t, mux, user, http.MethodPatch, "/api/collections/users/records/"+user.Id, `{"name":"Renamed"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("profile update: %d %s", rec.Code, rec.Body.String())
+	}
+
+	superuser := newTestSuperuser(t, app, "root@example.com")
+	rec = serveTestRequest(t, mux, superuser, http.MethodPatch, "/api/collections/users/records/"+user.Id, `{"roles":["support"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("superuser assigning a role: %d %s", rec.Code, rec.Body.String())
+	}
+	if roles := reload(t, app, user).GetStringSlice("roles"); len(roles) != 1 || roles[0] != RoleSupport {
+		t.Fatalf("roles = %v, want [support]", roles)
+	}
+}
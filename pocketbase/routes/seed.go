@@ -7,7 +7,6 @@ import (
 
 	"driveprep/services"
 
-	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
 )
 
@@ -24,41 +23,12 @@ type SeedQuestion struct {
 	Difficulty    int      `json:"difficulty,omitempty"`
 }
 
-// RegisterSeedRoutes registers the seed API route (admin only)
+// RegisterSeedRoutes registers the seed API route (seed permission only)
 func RegisterSeedRoutes(app core.App, se *core.ServeEvent) {
 	// Admin only: Seed questions from JSON
 	se.Router.POST("/api/admin/seed-questions", func(e *core.RequestEvent) error {
 		return handleSeedQuestions(app, e)
-	}).Bind(apis.RequireAuth()).BindFunc(requireAdmin(app))
-}
-
-// requireAdmin is a middleware that checks if user is admin
-func requireAdmin(app core.App) func(e *core.RequestEvent) error {
-	return func(e *core.RequestEvent) error {
-		authRecord := e.Auth
-		if authRecord == nil {
-			return apis.NewForbiddenError("Admin access required", nil)
-		}
-
-		// Check if user is in _superusers collection or has admin role
-		// For simplicity, check if they're a superuser
-		superusers, err := app.FindCollectionByNameOrId("_superusers")
-		if err == nil {
-			_, err = app.FindRecordById(superusers.Id, authRecord.Id)
-			if err == nil {
-				return e.Next()
-			}
-		}
-
-		// Alternatively check admin flag on user
-		if authRecord.Collection().Name == "users" {
-			// Allow if user has a specific email domain or role
-			// For now, any authenticated user can seed (for development)
-			return e.Next()
-		}
-
-		return apis.NewForbiddenError("Admin access required", nil)
-	}
+	}).Bind(RequireAuth(app), RequirePermission(app, PermissionSeed))
 }
 
 func handleSeedQuestions(app core.App, e *core.RequestEvent) error {
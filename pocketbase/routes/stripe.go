@@ -1,32 +1,17 @@
 package routes
 
 import (
-	"encoding/json"
+	"database/sql"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/stripe/stripe-go/v76"
-	"github.com/stripe/stripe-go/v76/billingportal/session"
-	checkoutsession "github.com/stripe/stripe-go/v76/checkout/session"
-	"github.com/stripe/stripe-go/v76/subscription"
-	"github.com/stripe/stripe-go/v76/webhook"
 )
 
-// Stripe price IDs - ONLY set via environment variables (never from client)
-var (
-	priceMonthly  = os.Getenv("STRIPE_PRICE_MONTHLY")
-	priceYearly   = os.Getenv("STRIPE_PRICE_YEARLY")
-	priceLifetime = os.Getenv("STRIPE_PRICE_LIFETIME")
-	webhookSecret = os.Getenv("STRIPE_WEBHOOK_SECRET")
-)
-
-func init() {
-	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
-}
-
 // CheckoutRequest represents the request body for creating a checkout session
 // Note: No priceId or userId - these are determined server-side for security
 type CheckoutRequest struct {
@@ -54,8 +39,14 @@ type CustomerPortalRequest struct {
 	ReturnURL string `json:"returnUrl"`
 }
 
-// RegisterStripeRoutes registers all Stripe-related API routes
-func RegisterStripeRoutes(app core.App, se *core.ServeEvent) {
+// RegisterStripeRoutes registers all Stripe-related API routes, served by
+// the given payment provider
+func RegisterStripeRoutes(app core.App, se *core.ServeEvent, payments PaymentProvider) {
+	if fake, ok := payments.(*FakePaymentProvider); ok {
+		app.Logger().Warn("Payments use the in-memory fake provider; nothing is charged")
+		registerFakePaymentRoutes(app, se, fake)
+	}
+
 	// Create checkout session
 	// POST /api/stripe/create-checkout
 	// Body: { plan: "monthly"|"yearly"|"lifetime", successUrl, cancelUrl }
@@ -71,70 +62,37 @@ func RegisterStripeRoutes(app core.App, se *core.ServeEvent) {
 			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
 		}
 
-		// Get the price ID from SERVER config based on plan (never from client)
-		var priceID string
-		var mode stripe.CheckoutSessionMode
-
+		// The price comes from SERVER config based on plan (never from client)
 		switch req.Plan {
-		case "monthly":
-			priceID = priceMonthly
-			mode = stripe.CheckoutSessionModeSubscription
-		case "yearly":
-			priceID = priceYearly
-			mode = stripe.CheckoutSessionModeSubscription
-		case "lifetime":
-			priceID = priceLifetime
-			mode = stripe.CheckoutSessionModePayment
+		case PlanMonthly, PlanYearly, PlanLifetime:
 		default:
 			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid plan"})
 		}
 
-		if priceID == "" {
-			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Price not configured for this plan"})
-		}
-
 		// Validate URLs (basic security check)
 		if req.SuccessURL == "" || req.CancelURL == "" {
 			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Success and cancel URLs required"})
 		}
 
-		// Check if user already has a Stripe customer ID
-		customerID := authRecord.GetString("stripeCustomerId")
-
-		// Create checkout session params
-		params := &stripe.CheckoutSessionParams{
-			Mode:       stripe.String(string(mode)),
-			SuccessURL: stripe.String(req.SuccessURL),
-			CancelURL:  stripe.String(req.CancelURL),
-			LineItems: []*stripe.CheckoutSessionLineItemParams{
-				{
-					Price:    stripe.String(priceID),
-					Quantity: stripe.Int64(1),
-				},
-			},
-			// Store user info in metadata for webhook processing
-			Metadata: map[string]string{
-				"userId": authRecord.Id,
-				"plan":   req.Plan,
-			},
-		}
-
-		// Use existing customer or set email for new customer
-		if customerID != "" {
-			params.Customer = stripe.String(customerID)
-		} else {
-			params.CustomerEmail = stripe.String(authRecord.Email())
+		checkout, err := payments.CreateCheckout(CheckoutParams{
+			UserID:     authRecord.Id,
+			Email:      authRecord.Email(),
+			CustomerID: authRecord.GetString("stripeCustomerId"),
+			Plan:       req.Plan,
+			SuccessURL: req.SuccessURL,
+			CancelURL:  req.CancelURL,
+		})
+		if errors.Is(err, ErrPlanNotConfigured) {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Price not configured for this plan"})
 		}
-
-		// Create the session
-		sess, err := checkoutsession.New(params)
 		if err != nil {
+			app.Logger().Error("Failed to create checkout", "provider", payments.Name(), "error", err)
 			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create checkout session"})
 		}
 
 		return e.JSON(http.StatusOK, CheckoutResponse{
-			SessionID: sess.ID,
-			URL:       sess.URL,
+			SessionID: checkout.ID,
+			URL:       checkout.URL,
 		})
 	}).Bind(RequireAuth(app))
 
@@ -158,11 +116,11 @@ func RegisterStripeRoutes(app core.App, se *core.ServeEvent) {
 		)
 
 		if err != nil || len(subscriptions) == 0 {
-			// Check if user has premium flag (for lifetime purchases)
-			if authRecord.GetBool("isPremium") {
+			// Lifetime purchases and licenses have no subscription
+			if entitlement, err := ResolveEntitlement(app, authRecord); err == nil && entitlement.Premium {
 				return e.JSON(http.StatusOK, SubscriptionStatus{
 					Active:            true,
-					Plan:              authRecord.GetString("premiumPlan"),
+					Plan:              entitlement.Plan,
 					CancelAtPeriodEnd: false,
 				})
 			}
@@ -208,11 +166,8 @@ func RegisterStripeRoutes(app core.App, se *core.ServeEvent) {
 		stripeSubID := sub.GetString("stripeSubscriptionId")
 
 		if stripeSubID != "" {
-			// Cancel at period end in Stripe
-			_, err = subscription.Update(stripeSubID, &stripe.SubscriptionParams{
-				CancelAtPeriodEnd: stripe.Bool(true),
-			})
-			if err != nil {
+			// Cancel at period end with the payment processor
+			if err := payments.CancelSubscription(stripeSubID); err != nil {
 				return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to cancel subscription"})
 			}
 		}
@@ -253,11 +208,8 @@ func RegisterStripeRoutes(app core.App, se *core.ServeEvent) {
 		stripeSubID := sub.GetString("stripeSubscriptionId")
 
 		if stripeSubID != "" {
-			// Resume subscription in Stripe
-			_, err = subscription.Update(stripeSubID, &stripe.SubscriptionParams{
-				CancelAtPeriodEnd: stripe.Bool(false),
-			})
-			if err != nil {
+			// Resume subscription with the payment processor
+			if err := payments.ResumeSubscription(stripeSubID); err != nil {
 				return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to resume subscription"})
 			}
 		}
@@ -269,9 +221,7 @@ func RegisterStripeRoutes(app core.App, se *core.ServeEvent) {
 		}
 
 		// Update user premium status
-		authRecord.Set("isPremium", true)
-		authRecord.Set("premiumPlan", sub.GetString("plan"))
-		if err := app.Save(authRecord); err != nil {
+		if _, err := syncPremium(app, authRecord); err != nil {
 			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update user"})
 		}
 
@@ -303,17 +253,12 @@ func RegisterStripeRoutes(app core.App, se *core.ServeEvent) {
 		}
 
 		// Create billing portal session
-		params := &stripe.BillingPortalSessionParams{
-			Customer:  stripe.String(customerID),
-			ReturnURL: stripe.String(req.ReturnURL),
-		}
-
-		sess, err := session.New(params)
+		url, err := payments.CreatePortalSession(customerID, req.ReturnURL)
 		if err != nil {
 			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create portal session"})
 		}
 
-		return e.JSON(http.StatusOK, map[string]string{"url": sess.URL})
+		return e.JSON(http.StatusOK, map[string]string{"url": url})
 	}).Bind(RequireAuth(app))
 
 	// Stripe webhook handler
@@ -326,114 +271,115 @@ func RegisterStripeRoutes(app core.App, se *core.ServeEvent) {
 		}
 
 		// Verify webhook signature
-		sigHeader := e.Request.Header.Get("Stripe-Signature")
-		event, err := webhook.ConstructEvent(body, sigHeader, webhookSecret)
+		event, err := payments.VerifyWebhook(body, e.Request.Header)
 		if err != nil {
 			return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid signature"})
 		}
 
-		// Handle different event types
-		switch event.Type {
-		case "checkout.session.completed":
-			var session stripe.CheckoutSession
-			if err := json.Unmarshal(event.Data.Raw, &session); err != nil {
-				return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid session data"})
-			}
-			handleCheckoutComplete(app, &session)
-
-		case "customer.subscription.updated":
-			var sub stripe.Subscription
-			if err := json.Unmarshal(event.Data.Raw, &sub); err != nil {
-				return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid subscription data"})
-			}
-			handleSubscriptionUpdate(app, &sub)
-
-		case "customer.subscription.deleted":
-			var sub stripe.Subscription
-			if err := json.Unmarshal(event.Data.Raw, &sub); err != nil {
-				return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid subscription data"})
-			}
-			handleSubscriptionCancelled(app, &sub)
-
-		case "invoice.payment_failed":
-			var invoice stripe.Invoice
-			if err := json.Unmarshal(event.Data.Raw, &invoice); err != nil {
-				return e.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid invoice data"})
-			}
-			handlePaymentFailed(app, &invoice)
+		// If the event can't be stored, Stripe will deliver it again
+		if err := receiveStripeEvent(app, payments, event, body); err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to store event"})
 		}
 
 		return e.JSON(http.StatusOK, map[string]string{"received": "true"})
 	})
+
+	registerStripeEventRoutes(app, se, payments)
+	registerStripeReconcileJob(app, payments)
+}
+
+// errStripeSubscriptionUnknown is returned for events about a subscription
+// we have no record of yet, typically because checkout.session.completed
+// hasn't been processed; the event is retried
+var errStripeSubscriptionUnknown = errors.New("unknown stripe subscription")
+
+// checkoutSubscription fetches the subscription a checkout session created, if any
+func checkoutSubscription(payments PaymentProvider, session *stripe.CheckoutSession) (*RemoteSubscription, error) {
+	if session.Metadata["plan"] == "lifetime" || session.Subscription == nil {
+		return nil, nil
+	}
+	sub, err := payments.GetSubscription(session.Subscription.ID)
+	if err != nil {
+		return nil, fmt.Errorf("fetch subscription %s: %w", session.Subscription.ID, err)
+	}
+	return sub, nil
 }
 
 // handleCheckoutComplete processes successful checkout sessions
-func handleCheckoutComplete(app core.App, session *stripe.CheckoutSession) {
+func handleCheckoutComplete(app core.App, session *stripe.CheckoutSession, sub *RemoteSubscription, eventAt time.Time) error {
 	userID := session.Metadata["userId"]
 	plan := session.Metadata["plan"]
 
 	if userID == "" {
-		return
+		return nil // Not one of our checkouts
 	}
 
 	// Find user
 	user, err := app.FindRecordById("users", userID)
 	if err != nil {
-		return
+		return fmt.Errorf("user %s: %w", userID, err)
 	}
 
 	// Update user with Stripe customer ID
-	user.Set("stripeCustomerId", session.Customer.ID)
-	user.Set("isPremium", true)
-	user.Set("premiumPlan", plan)
-
-	// Set expiration for subscriptions
-	if plan != "lifetime" && session.Subscription != nil {
-		// Get subscription details
-		sub, err := subscription.Get(session.Subscription.ID, nil)
-		if err == nil {
-			user.Set("premiumExpiresAt", time.Unix(sub.CurrentPeriodEnd, 0))
-
-			// Create subscription record
-			subscriptionCollection, _ := app.FindCollectionByNameOrId("subscriptions")
-			if subscriptionCollection != nil {
-				subRecord := core.NewRecord(subscriptionCollection)
-				subRecord.Set("user", userID)
-				subRecord.Set("stripeSubscriptionId", session.Subscription.ID)
-				subRecord.Set("stripeCustomerId", session.Customer.ID)
-				subRecord.Set("plan", plan)
-				subRecord.Set("status", "active")
-				subRecord.Set("currentPeriodStart", time.Unix(sub.CurrentPeriodStart, 0))
-				subRecord.Set("currentPeriodEnd", time.Unix(sub.CurrentPeriodEnd, 0))
-				app.Save(subRecord)
+	customerID := ""
+	if session.Customer != nil {
+		customerID = session.Customer.ID
+		user.Set("stripeCustomerId", customerID)
+	}
+	if plan == PlanLifetime && user.GetDateTime("lifetimePurchasedAt").IsZero() {
+		user.Set("lifetimePurchasedAt", eventAt)
+	}
+	if err := app.Save(user); err != nil {
+		return err
+	}
+
+	// Record the subscription; the user's premium follows from it
+	if sub != nil {
+		// A redelivered checkout updates the subscription it created
+		subRecord, err := findSubscriptionRecord(app, sub.ID)
+		if errors.Is(err, errStripeSubscriptionUnknown) {
+			subscriptionCollection, err := app.FindCollectionByNameOrId("subscriptions")
+			if err != nil {
+				return err
+			}
+			subRecord = core.NewRecord(subscriptionCollection)
+		} else if err != nil {
+			return err
+		}
+
+		if !subscriptionEventIsStale(subRecord, eventAt) {
+			subRecord.Set("user", userID)
+			subRecord.Set("stripeSubscriptionId", sub.ID)
+			subRecord.Set("stripeCustomerId", customerID)
+			subRecord.Set("plan", plan)
+			subRecord.Set("status", "active")
+			subRecord.Set("currentPeriodStart", sub.CurrentPeriodStart)
+			subRecord.Set("currentPeriodEnd", sub.CurrentPeriodEnd)
+			subRecord.Set("lastEventAt", eventAt)
+			if err := app.Save(subRecord); err != nil {
+				return err
 			}
 		}
 	}
 
-	app.Save(user)
+	_, err = syncPremium(app, user)
+	return err
 }
 
 // handleSubscriptionUpdate processes subscription updates
-func handleSubscriptionUpdate(app core.App, sub *stripe.Subscription) {
-	// Find subscription record by Stripe ID
-	subscriptions, err := app.FindRecordsByFilter(
-		"subscriptions",
-		"stripeSubscriptionId = {:subId}",
-		"",
-		1,
-		0,
-		map[string]any{"subId": sub.ID},
-	)
-
-	if err != nil || len(subscriptions) == 0 {
-		return
+func handleSubscriptionUpdate(app core.App, sub *stripe.Subscription, eventAt time.Time) error {
+	record, err := findSubscriptionRecord(app, sub.ID)
+	if err != nil {
+		return err
+	}
+	if subscriptionEventIsStale(record, eventAt) {
+		return nil
 	}
-
-	record := subscriptions[0]
 
 	// Update subscription details
 	record.Set("currentPeriodStart", time.Unix(sub.CurrentPeriodStart, 0))
 	record.Set("currentPeriodEnd", time.Unix(sub.CurrentPeriodEnd, 0))
+	record.Set("lastEventAt", eventAt)
 
 	if sub.CancelAtPeriodEnd {
 		record.Set("status", "cancelled")
@@ -441,70 +387,79 @@ func handleSubscriptionUpdate(app core.App, sub *stripe.Subscription) {
 		record.Set("status", "active")
 	}
 
-	app.Save(record)
-
-	// Update user record
-	userID := record.GetString("user")
-	user, err := app.FindRecordById("users", userID)
-	if err == nil {
-		user.Set("premiumExpiresAt", time.Unix(sub.CurrentPeriodEnd, 0))
-		user.Set("isPremium", !sub.CancelAtPeriodEnd)
-		app.Save(user)
+	if err := app.Save(record); err != nil {
+		return err
 	}
+
+	return syncSubscriptionUser(app, record)
 }
 
 // handleSubscriptionCancelled processes subscription cancellations
-func handleSubscriptionCancelled(app core.App, sub *stripe.Subscription) {
-	// Find subscription record
-	subscriptions, err := app.FindRecordsByFilter(
-		"subscriptions",
-		"stripeSubscriptionId = {:subId}",
-		"",
-		1,
-		0,
-		map[string]any{"subId": sub.ID},
-	)
-
-	if err != nil || len(subscriptions) == 0 {
-		return
+func handleSubscriptionCancelled(app core.App, sub *stripe.Subscription, eventAt time.Time) error {
+	record, err := findSubscriptionRecord(app, sub.ID)
+	if err != nil {
+		return err
+	}
+	if subscriptionEventIsStale(record, eventAt) {
+		return nil
 	}
 
-	record := subscriptions[0]
 	record.Set("status", "expired")
-	app.Save(record)
+	record.Set("lastEventAt", eventAt)
+	if err := app.Save(record); err != nil {
+		return err
+	}
+
+	return syncSubscriptionUser(app, record)
+}
 
-	// Update user
+// syncSubscriptionUser brings a subscription's user in line with their
+// entitlement after the subscription changed
+func syncSubscriptionUser(app core.App, record *core.Record) error {
 	userID := record.GetString("user")
 	user, err := app.FindRecordById("users", userID)
-	if err == nil {
-		user.Set("isPremium", false)
-		user.Set("premiumPlan", "free")
-		user.Set("premiumExpiresAt", nil)
-		app.Save(user)
+	if err != nil {
+		return fmt.Errorf("user %s: %w", userID, err)
 	}
+	_, err = syncPremium(app, user)
+	return err
 }
 
 // handlePaymentFailed processes failed payments
-func handlePaymentFailed(app core.App, invoice *stripe.Invoice) {
+func handlePaymentFailed(app core.App, invoice *stripe.Invoice, eventAt time.Time) error {
 	if invoice.Subscription == nil {
-		return
+		return nil
 	}
 
-	// Find subscription record
-	subscriptions, err := app.FindRecordsByFilter(
+	record, err := findSubscriptionRecord(app, invoice.Subscription.ID)
+	if err != nil {
+		return err
+	}
+	if subscriptionEventIsStale(record, eventAt) {
+		return nil
+	}
+
+	record.Set("status", "past_due")
+	record.Set("lastEventAt", eventAt)
+	return app.Save(record)
+}
+
+// findSubscriptionRecord finds a subscription record by Stripe subscription ID
+func findSubscriptionRecord(app core.App, stripeSubscriptionID string) (*core.Record, error) {
+	record, err := app.FindFirstRecordByFilter(
 		"subscriptions",
 		"stripeSubscriptionId = {:subId}",
-		"",
-		1,
-		0,
-		map[string]any{"subId": invoice.Subscription.ID},
+		map[string]any{"subId": stripeSubscriptionID},
 	)
-
-	if err != nil || len(subscriptions) == 0 {
-		return
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", errStripeSubscriptionUnknown, stripeSubscriptionID)
 	}
+	return record, err
+}
 
-	record := subscriptions[0]
-	record.Set("status", "past_due")
-	app.Save(record)
+// subscriptionEventIsStale reports whether a newer event has already been
+// applied to a subscription
+func subscriptionEventIsStale(record *core.Record, eventAt time.Time) bool {
+	lastEventAt := record.GetDateTime("lastEventAt")
+	return !lastEventAt.IsZero() && eventAt.Before(lastEventAt.Time())
 }
@@ -0,0 +1,380 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/stripe/stripe-go/v76"
+)
+
+// Every verified webhook event is stored in stripe_events before anything
+// is done with it. Processing claims the event, then applies it and marks
+// it processed in a single transaction, so a redelivery of a processed event
+// is a no-op. A failed event keeps its error and is retried by a cron
+// worker with exponential backoff until StripeEventMaxAttempts; staff can
+// replay any event from the admin API.
+
+// Stripe event statuses
+const (
+	StripeEventPending    = "pending"
+	StripeEventProcessing = "processing"
+	StripeEventProcessed  = "processed"
+	StripeEventFailed     = "failed"
+	StripeEventIgnored    = "ignored" // Event types we don't handle
+)
+
+const (
+	StripeEventMaxAttempts    = 10
+	stripeEventRetrySchedule  = "* * * * *"
+	stripeEventMaxBackoff     = 6 * time.Hour
+	stripeEventProcessTimeout = 10 * time.Minute // A claim older than this was abandoned
+)
+
+// errStripeEventBusy is returned when an event is already being processed
+// or no longer needs to be
+var errStripeEventBusy = errors.New("stripe event is not pending")
+
+// StripeEvent is a stored webhook event as shown to staff
+type StripeEvent struct {
+	ID            string `json:"id"`
+	EventID       string `json:"eventId"`
+	Type          string `json:"type"`
+	Status        string `json:"status"`
+	Attempts      int    `json:"attempts"`
+	LastError     string `json:"lastError,omitempty"`
+	EventCreated  string `json:"eventCreated,omitempty"`
+	NextAttemptAt string `json:"nextAttemptAt,omitempty"`
+	ProcessedAt   string `json:"processedAt,omitempty"`
+	Created       string `json:"created"`
+}
+
+// registerStripeEventRoutes registers the retry worker and the staff routes
+// for inspecting and replaying webhook events
+func registerStripeEventRoutes(app core.App, se *core.ServeEvent, payments PaymentProvider) {
+	app.Cron().MustAdd("stripeEventRetry", stripeEventRetrySchedule, func() {
+		retryStripeEvents(app, payments)
+	})
+
+	// Staff: List webhook events
+	// ?status=&type=&limit=
+	se.Router.GET("/api/admin/stripe-events", func(e *core.RequestEvent) error {
+		query := e.Request.URL.Query()
+
+		filter := "id != ''"
+		params := dbx.Params{}
+		if status := query.Get("status"); status != "" {
+			filter += " && status = {:status}"
+			params["status"] = status
+		}
+		if eventType := query.Get("type"); eventType != "" {
+			filter += " && type = {:type}"
+			params["type"] = eventType
+		}
+
+		limit := 50
+		if l, err := strconv.Atoi(query.Get("limit")); err == nil && l > 0 && l <= 500 {
+			limit = l
+		}
+
+		records, err := app.FindRecordsByFilter("stripe_events", filter, "-created", limit, 0, params)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch events"})
+		}
+
+		events := make([]StripeEvent, len(records))
+		for i, record := range records {
+			events[i] = newStripeEvent(record)
+		}
+
+		return e.JSON(http.StatusOK, map[string]interface{}{
+			"events": events,
+			"count":  len(events),
+		})
+	}).Bind(RequireAuth(app), RequirePermission(app, PermissionBilling, PermissionSupport))
+
+	// Staff: Process an event again, whatever its status
+	se.Router.POST("/api/admin/stripe-events/{id}/replay", func(e *core.RequestEvent) error {
+		record, err := app.FindFirstRecordByFilter(
+			"stripe_events",
+			"id = {:id} || eventId = {:id}",
+			dbx.Params{"id": e.Request.PathValue("id")},
+		)
+		if err != nil {
+			return e.JSON(http.StatusNotFound, map[string]string{"error": "Event not found"})
+		}
+		if record.GetString("status") == StripeEventProcessing {
+			return e.JSON(http.StatusConflict, map[string]string{"error": "Event is being processed"})
+		}
+
+		record.Set("status", StripeEventPending)
+		record.Set("nextAttemptAt", nil)
+		if err := app.Save(record); err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to replay event"})
+		}
+
+		processErr := processStripeEvent(app, payments, record.Id)
+		if errors.Is(processErr, errStripeEventBusy) {
+			return e.JSON(http.StatusConflict, map[string]string{"error": "Event is being processed"})
+		}
+
+		record, err = app.FindRecordById("stripe_events", record.Id)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to replay event"})
+		}
+		app.Logger().Info("Stripe event replayed",
+			"eventId", record.GetString("eventId"),
+			"status", record.GetString("status"),
+			"by", actingUserID(e),
+		)
+
+		return e.JSON(http.StatusOK, newStripeEvent(record))
+	}).Bind(RequireAuth(app), RequirePermission(app, PermissionBilling))
+}
+
+// receiveStripeEvent stores a verified webhook event before processing it,
+// so it's never lost. Redeliveries of handled events are no-ops; failures
+// are retried by the worker, not by the sender. The error is only for an
+// event that couldn't be stored.
+func receiveStripeEvent(app core.App, payments PaymentProvider, event stripe.Event, payload []byte) error {
+	record, err := storeStripeEvent(app, event, payload)
+	if err != nil {
+		app.Logger().Error("Failed to store Stripe event", "eventId", event.ID, "error", err)
+		return err
+	}
+
+	if err := processStripeEvent(app, payments, record.Id); err != nil && !errors.Is(err, errStripeEventBusy) {
+		app.Logger().Error("Failed to process Stripe event", "eventId", event.ID, "type", event.Type, "error", err)
+	}
+	return nil
+}
+
+// storeStripeEvent records a verified webhook event. Redeliveries of an event
+// already stored return the existing record.
+func storeStripeEvent(app core.App, event stripe.Event, payload []byte) (*core.Record, error) {
+	existing, err := app.FindFirstRecordByFilter("stripe_events", "eventId = {:eventId}", dbx.Params{"eventId": event.ID})
+	if err == nil {
+		return existing, nil
+	}
+
+	collection, err := app.FindCollectionByNameOrId("stripe_events")
+	if err != nil {
+		return nil, err
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("eventId", event.ID)
+	record.Set("type", string(event.Type))
+	record.Set("eventCreated", time.Unix(event.Created, 0).UTC())
+	record.Set("payload", types.JSONRaw(payload))
+	record.Set("status", StripeEventPending)
+	if err := app.Save(record); err != nil {
+		// Lost a race with a concurrent delivery of the same event
+		if existing, findErr := app.FindFirstRecordByFilter("stripe_events", "eventId = {:eventId}", dbx.Params{"eventId": event.ID}); findErr == nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+	return record, nil
+}
+
+// processStripeEvent claims a pending or failed event and applies it. The
+// outcome is saved on the event: a processed or ignored status in the same
+// transaction as the changes it made, so an applied event can never be left
+// claimed and applied again; a failure after that transaction rolled back.
+// The returned error is the processing error, if any.
+func processStripeEvent(app core.App, payments PaymentProvider, id string) error {
+	if err := claimStripeEvent(app, id); err != nil {
+		return err
+	}
+
+	record, err := app.FindRecordById("stripe_events", id)
+	if err != nil {
+		return err
+	}
+
+	var event stripe.Event
+	var apply func(txApp core.App) error
+	processErr := json.Unmarshal([]byte(record.GetString("payload")), &event)
+	if processErr == nil {
+		apply, processErr = stripeEventHandler(payments, &event)
+	}
+
+	attempts := record.GetInt("attempts") + 1
+	if processErr == nil {
+		processErr = app.RunInTransaction(func(txApp core.App) error {
+			status := StripeEventIgnored
+			if apply != nil {
+				if err := apply(txApp); err != nil {
+					return err
+				}
+				status = StripeEventProcessed
+				record.Set("processedAt", types.NowDateTime())
+			}
+			record.Set("attempts", attempts)
+			record.Set("status", status)
+			record.Set("lastError", "")
+			record.Set("nextAttemptAt", nil)
+			if err := txApp.Save(record); err != nil {
+				return fmt.Errorf("save stripe event %s: %w", record.GetString("eventId"), err)
+			}
+			return nil
+		})
+		if processErr == nil {
+			return nil
+		}
+	}
+
+	record.Set("attempts", attempts)
+	record.Set("status", StripeEventFailed)
+	record.Set("lastError", processErr.Error())
+	record.Set("processedAt", nil)
+	if attempts < StripeEventMaxAttempts {
+		record.Set("nextAttemptAt", time.Now().Add(stripeEventBackoff(attempts)).UTC())
+	} else {
+		record.Set("nextAttemptAt", nil)
+	}
+	if err := app.Save(record); err != nil {
+		return fmt.Errorf("save stripe event %s: %w", record.GetString("eventId"), err)
+	}
+	return processErr
+}
+
+// claimStripeEvent marks an event as processing, unless another worker has
+// it or it no longer needs processing
+func claimStripeEvent(app core.App, id string) error {
+	now := types.NowDateTime()
+	result, err := app.DB().NewQuery(`
+		UPDATE stripe_events SET status = {:processing}, updated = {:now}
+		WHERE id = {:id} AND (
+			status IN ({:pending}, {:failed}) OR
+			(status = {:processing} AND updated < {:stale})
+		)`).
+		Bind(dbx.Params{
+			"id":         id,
+			"now":        now.String(),
+			"stale":      now.Add(-stripeEventProcessTimeout).String(),
+			"processing": StripeEventProcessing,
+			"pending":    StripeEventPending,
+			"failed":     StripeEventFailed,
+		}).
+		Execute()
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errStripeEventBusy
+	}
+	return nil
+}
+
+// stripeEventHandler returns the function that applies an event inside a
+// transaction, or nil for event types we don't handle. Anything that calls
+// the payment provider runs here, before the transaction, not inside it.
+func stripeEventHandler(payments PaymentProvider, event *stripe.Event) (func(txApp core.App) error, error) {
+	eventAt := time.Unix(event.Created, 0).UTC()
+
+	switch event.Type {
+	case "checkout.session.completed":
+		var session stripe.CheckoutSession
+		if err := json.Unmarshal(event.Data.Raw, &session); err != nil {
+			return nil, fmt.Errorf("invalid session data: %w", err)
+		}
+		sub, err := checkoutSubscription(payments, &session)
+		if err != nil {
+			return nil, err
+		}
+		return func(txApp core.App) error {
+			return handleCheckoutComplete(txApp, &session, sub, eventAt)
+		}, nil
+
+	case "customer.subscription.updated":
+		var sub stripe.Subscription
+		if err := json.Unmarshal(event.Data.Raw, &sub); err != nil {
+			return nil, fmt.Errorf("invalid subscription data: %w", err)
+		}
+		return func(txApp core.App) error {
+			return handleSubscriptionUpdate(txApp, &sub, eventAt)
+		}, nil
+
+	case "customer.subscription.deleted":
+		var sub stripe.Subscription
+		if err := json.Unmarshal(event.Data.Raw, &sub); err != nil {
+			return nil, fmt.Errorf("invalid subscription data: %w", err)
+		}
+		return func(txApp core.App) error {
+			return handleSubscriptionCancelled(txApp, &sub, eventAt)
+		}, nil
+
+	case "invoice.payment_failed":
+		var invoice stripe.Invoice
+		if err := json.Unmarshal(event.Data.Raw, &invoice); err != nil {
+			return nil, fmt.Errorf("invalid invoice data: %w", err)
+		}
+		return func(txApp core.App) error {
+			return handlePaymentFailed(txApp, &invoice, eventAt)
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// retryStripeEvents processes the failed events that are due, and pending
+// events whose processing never finished
+func retryStripeEvents(app core.App, payments PaymentProvider) {
+	now := types.NowDateTime()
+	records, err := app.FindRecordsByFilter(
+		"stripe_events",
+		"(status = 'failed' && nextAttemptAt != '' && nextAttemptAt <= {:now}) || "+
+			"(status = 'pending' && created <= {:stale}) || "+
+			"(status = 'processing' && updated <= {:stale})",
+		"created",
+		100,
+		0,
+		dbx.Params{"now": now.String(), "stale": now.Add(-stripeEventProcessTimeout).String()},
+	)
+	if err != nil {
+		app.Logger().Error("Failed to fetch Stripe events to retry", "error", err)
+		return
+	}
+
+	for _, record := range records {
+		err := processStripeEvent(app, payments, record.Id)
+		if err != nil && !errors.Is(err, errStripeEventBusy) {
+			app.Logger().Warn("Stripe event retry failed",
+				"eventId", record.GetString("eventId"),
+				"attempts", record.GetInt("attempts")+1,
+				"error", err,
+			)
+		}
+	}
+}
+
+// stripeEventBackoff is the delay before the next attempt after attempts failures
+func stripeEventBackoff(attempts int) time.Duration {
+	if attempts > 10 {
+		return stripeEventMaxBackoff
+	}
+	return min(time.Minute<<(attempts-1), stripeEventMaxBackoff)
+}
+
+func newStripeEvent(record *core.Record) StripeEvent {
+	return StripeEvent{
+		ID:            record.Id,
+		EventID:       record.GetString("eventId"),
+		Type:          record.GetString("type"),
+		Status:        record.GetString("status"),
+		Attempts:      record.GetInt("attempts"),
+		LastError:     record.GetString("lastError"),
+		EventCreated:  formatAPIDate(record.GetDateTime("eventCreated")),
+		NextAttemptAt: formatAPIDate(record.GetDateTime("nextAttemptAt")),
+		ProcessedAt:   formatAPIDate(record.GetDateTime("processedAt")),
+		Created:       formatAPIDate(record.GetDateTime("created")),
+	}
+}
@@ -0,0 +1,158 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/stripe/stripe-go/v76"
+)
+
+// newTestStripeEvent stores a webhook event with the given payload
+func newTestStripeEvent(tb testing.TB, app core.App, id string, eventType stripe.EventType, payload string) *core.Record {
+	tb.Helper()
+
+	record, err := storeStripeEvent(app, stripe.Event{ID: id, Type: eventType, Created: time.Now().Unix()}, []byte(payload))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return record
+}
+
+func TestClaimStripeEvent(t *testing.T) {
+	app := newTestApp(t)
+	stale := time.Now().Add(-stripeEventProcessTimeout - time.Minute).UTC()
+
+	cases := []struct {
+		name    string
+		status  string
+		updated time.Time
+		want    error
+	}{
+		{"pending", StripeEventPending, time.Now(), nil},
+		{"failed", StripeEventFailed, time.Now(), nil},
+		{"being processed", StripeEventProcessing, time.Now(), errStripeEventBusy},
+		{"abandoned claim", StripeEventProcessing, stale, nil},
+		{"processed", StripeEventProcessed, stale, errStripeEventBusy},
+		{"ignored", StripeEventIgnored, stale, errStripeEventBusy},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			record := newTestStripeEvent(t, app, "evt_claim_"+c.status+c.updated.Format("150405"), "invoice.paid", `{}`)
+			_, err := app.DB().Update("stripe_events",
+				dbx.Params{"status": c.status, "updated": c.updated.Format("2006-01-02 15:04:05.000Z")},
+				dbx.HashExp{"id": record.Id},
+			).Execute()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := claimStripeEvent(app, record.Id); !errors.Is(err, c.want) {
+				t.Fatalf("claim = %v, want %v", err, c.want)
+			}
+			if c.want == nil {
+				if status := reload(t, app, record).GetString("status"); status != StripeEventProcessing {
+					t.Fatalf("status = %q after claiming, want processing", status)
+				}
+				// Only one worker gets it
+				if err := claimStripeEvent(app, record.Id); !errors.Is(err, errStripeEventBusy) {
+					t.Fatalf("second claim = %v, want %v", err, errStripeEventBusy)
+				}
+			}
+		})
+	}
+}
+
+func TestStripeEventRedelivery(t *testing.T) {
+	app := newTestApp(t)
+	user := newTestUser(t, app, "redelivered@example.com", nil)
+	fake, mux := newFakePaymentsRouter(t, app)
+	sub := buyWithFakeCheckout(t, app, mux, user, PlanMonthly)
+
+	delivery, err := fake.EndSubscription(sub.GetString("stripeSubscriptionId"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if rec := postFakeWebhook(mux, delivery); rec.Code != http.StatusOK {
+			t.Fatalf("delivery %d: %d %s", i+1, rec.Code, rec.Body.String())
+		}
+	}
+
+	events, err := app.FindAllRecords("stripe_events", dbx.HashExp{"type": "customer.subscription.deleted"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("stored %d events, want 1", len(events))
+	}
+	event := events[0]
+	if event.GetString("status") != StripeEventProcessed || event.GetInt("attempts") != 1 || event.GetDateTime("processedAt").IsZero() {
+		t.Fatalf("status/attempts/processedAt = %q/%d/%s, want processed once",
+			event.GetString("status"), event.GetInt("attempts"), event.GetDateTime("processedAt"))
+	}
+	if countDowngrades(t, app) != 1 {
+		t.Fatalf("downgrades = %d, want 1", countDowngrades(t, app))
+	}
+
+	// A processed event can't be claimed again, even by the retry worker
+	retryStripeEvents(app, fake)
+	if attempts := reload(t, app, event).GetInt("attempts"); attempts != 1 {
+		t.Fatalf("attempts = %d after a retry run, want 1", attempts)
+	}
+}
+
+func TestStripeEventFailure(t *testing.T) {
+	app := newTestApp(t)
+	fake := NewFakePaymentProvider()
+	record := newTestStripeEvent(t, app, "evt_bad", "customer.subscription.updated",
+		`{"id":"evt_bad","type":"customer.subscription.updated","data":{"object":{"id":5}}}`)
+
+	if err := processStripeEvent(app, fake, record.Id); err == nil {
+		t.Fatal("processed an event with invalid data")
+	}
+
+	record = reload(t, app, record)
+	if record.GetString("status") != StripeEventFailed || record.GetInt("attempts") != 1 || record.GetString("lastError") == "" {
+		t.Fatalf("status/attempts/lastError = %q/%d/%q, want failed once with an error",
+			record.GetString("status"), record.GetInt("attempts"), record.GetString("lastError"))
+	}
+	if !record.GetDateTime("processedAt").IsZero() {
+		t.Fatal("failed event has a processedAt")
+	}
+	next := record.GetDateTime("nextAttemptAt").Time()
+	if want := time.Now().Add(stripeEventBackoff(1)); next.Sub(want).Abs() > 5*time.Second {
+		t.Fatalf("nextAttemptAt = %s, want about %s", next, want)
+	}
+
+	// Not due yet
+	retryStripeEvents(app, fake)
+	if attempts := reload(t, app, record).GetInt("attempts"); attempts != 1 {
+		t.Fatalf("attempts = %d, retried before the backoff", attempts)
+	}
+}
+
+func TestStripeEventBackoff(t *testing.T) {
+	cases := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{5, 16 * time.Minute},
+		{8, 128 * time.Minute},
+		{9, 256 * time.Minute},
+		{10, stripeEventMaxBackoff},
+		{11, stripeEventMaxBackoff},
+		{64, stripeEventMaxBackoff},
+	}
+	for _, c := range cases {
+		if got := stripeEventBackoff(c.attempts); got != c.want {
+			t.Errorf("stripeEventBackoff(%d) = %s, want %s", c.attempts, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/stripe/stripe-go/v76"
+	"github.com/stripe/stripe-go/v76/subscription"
+)
+
+// Reconciliation re-checks every live subscription record against Stripe
+// and repairs the record and the user's premium fields when they drifted,
+// e.g. because a webhook was missed. It runs nightly as a cron job and on
+// demand from the "stripe reconcile" command; each run is saved in
+// stripe_reconcile_reports. Stripe is reached through a SubscriptionSource
+// so runs can be made against a fixed set of subscriptions instead.
+
+const stripeReconcileSchedule = "30 3 * * *"
+
+// ErrRemoteSubscriptionNotFound is returned by a SubscriptionSource for
+// subscriptions the processor doesn't know
+var ErrRemoteSubscriptionNotFound = errors.New("subscription not found at payment processor")
+
+// RemoteSubscription is a subscription as the payment processor sees it
+type RemoteSubscription struct {
+	ID                 string    `json:"id"`
+	Status             string    `json:"status"` // Stripe subscription status
+	CancelAtPeriodEnd  bool      `json:"cancelAtPeriodEnd"`
+	CurrentPeriodStart time.Time `json:"currentPeriodStart"`
+	CurrentPeriodEnd   time.Time `json:"currentPeriodEnd"`
+}
+
+// SubscriptionSource looks subscriptions up at the payment processor
+type SubscriptionSource interface {
+	GetSubscription(id string) (*RemoteSubscription, error)
+}
+
+// NewStripeSubscriptionSource returns a SubscriptionSource backed by the Stripe API
+func NewStripeSubscriptionSource() SubscriptionSource {
+	return stripeSubscriptionSource{}
+}
+
+type stripeSubscriptionSource struct{}
+
+func (stripeSubscriptionSource) GetSubscription(id string) (*RemoteSubscription, error) {
+	sub, err := subscription.Get(id, nil)
+	if err != nil {
+		var stripeErr *stripe.Error
+		if errors.As(err, &stripeErr) && stripeErr.HTTPStatusCode == 404 {
+			return nil, ErrRemoteSubscriptionNotFound
+		}
+		return nil, err
+	}
+	return &RemoteSubscription{
+		ID:                 sub.ID,
+		Status:             string(sub.Status),
+		CancelAtPeriodEnd:  sub.CancelAtPeriodEnd,
+		CurrentPeriodStart: time.Unix(sub.CurrentPeriodStart, 0).UTC(),
+		CurrentPeriodEnd:   time.Unix(sub.CurrentPeriodEnd, 0).UTC(),
+	}, nil
+}
+
+// StaticSubscriptionSource is a SubscriptionSource over a fixed set of
+// subscriptions by ID, such as an export from the Stripe dashboard
+type StaticSubscriptionSource map[string]*RemoteSubscription
+
+func (s StaticSubscriptionSource) GetSubscription(id string) (*RemoteSubscription, error) {
+	sub, ok := s[id]
+	if !ok {
+		return nil, ErrRemoteSubscriptionNotFound
+	}
+	return sub, nil
+}
+
+// StripeReconcileItem is a subscription whose local state differed from Stripe
+type StripeReconcileItem struct {
+	SubscriptionID       string   `json:"subscriptionId"`
+	StripeSubscriptionID string   `json:"stripeSubscriptionId"`
+	UserID               string   `json:"userId"`
+	Email                string   `json:"email,omitempty"`
+	Issues               []string `json:"issues"`
+	Fixed                bool     `json:"fixed"`
+	Error                string   `json:"error,omitempty"`
+}
+
+// StripeReconcileReport is the outcome of a reconciliation run
+type StripeReconcileReport struct {
+	ID         string                `json:"id,omitempty"`
+	Trigger    string                `json:"trigger"` // cron or cli
+	Applied    bool                  `json:"applied"`
+	Checked    int                   `json:"checked"`
+	Mismatched int                   `json:"mismatched"`
+	Fixed      int                   `json:"fixed"`
+	Errors     int                   `json:"errors"`
+	StartedAt  time.Time             `json:"startedAt"`
+	FinishedAt time.Time             `json:"finishedAt"`
+	Items      []StripeReconcileItem `json:"items"`
+}
+
+// registerStripeReconcileJob schedules the nightly reconciliation against
+// the payment provider, unless it's Stripe without an API key
+func registerStripeReconcileJob(app core.App, payments PaymentProvider) {
+	if _, ok := payments.(*stripePaymentProvider); ok && stripe.Key == "" {
+		return
+	}
+	app.Cron().MustAdd("stripeReconcile", stripeReconcileSchedule, func() {
+		report, err := ReconcileStripeSubscriptions(app, payments, true, "cron")
+		if err != nil {
+			app.Logger().Error("Stripe reconciliation failed", "error", err)
+			return
+		}
+		app.Logger().Info("Stripe reconciliation finished",
+			"checked", report.Checked,
+			"mismatched", report.Mismatched,
+			"fixed", report.Fixed,
+			"errors", report.Errors,
+		)
+	})
+}
+
+// ReconcileStripeSubscriptions compares every active, cancelled and past
+// due subscription with the source and reports the differences. With apply
+// set, subscription records and users are repaired to match. The report
+// is saved either way.
+func ReconcileStripeSubscriptions(app core.App, source SubscriptionSource, apply bool, trigger string) (*StripeReconcileReport, error) {
+	report := &StripeReconcileReport{
+		Trigger:   trigger,
+		Applied:   apply,
+		StartedAt: time.Now().UTC(),
+		Items:     []StripeReconcileItem{},
+	}
+
+	records, err := app.FindRecordsByFilter(
+		"subscriptions",
+		"status = 'active' || status = 'cancelled' || status = 'past_due'",
+		"created",
+		0,
+		0,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range records {
+		report.Checked++
+
+		item, err := reconcileStripeSubscription(app, source, record, apply)
+		if err != nil {
+			item.Error = err.Error()
+			report.Errors++
+		}
+		if len(item.Issues) == 0 && item.Error == "" {
+			continue
+		}
+		if len(item.Issues) > 0 {
+			report.Mismatched++
+		}
+		if item.Fixed {
+			report.Fixed++
+		}
+		report.Items = append(report.Items, item)
+	}
+
+	report.FinishedAt = time.Now().UTC()
+	if err := saveStripeReconcileReport(app, report); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// reconcileStripeSubscription checks one subscription record and, with
+// apply set, repairs it and its user in a transaction
+func reconcileStripeSubscription(app core.App, source SubscriptionSource, record *core.Record, apply bool) (StripeReconcileItem, error) {
+	item := StripeReconcileItem{
+		SubscriptionID:       record.Id,
+		StripeSubscriptionID: record.GetString("stripeSubscriptionId"),
+		UserID:               record.GetString("user"),
+		Issues:               []string{},
+	}
+
+	user, err := app.FindRecordById("users", item.UserID)
+	if err != nil {
+		return item, fmt.Errorf("user %s: %w", item.UserID, err)
+	}
+	item.Email = user.Email()
+
+	if item.StripeSubscriptionID == "" {
+		item.Issues = append(item.Issues, "no Stripe subscription ID")
+		return item, nil
+	}
+
+	remote, err := source.GetSubscription(item.StripeSubscriptionID)
+	if errors.Is(err, ErrRemoteSubscriptionNotFound) {
+		// Never downgrade on a lookup we can't explain; leave it to staff
+		item.Issues = append(item.Issues, "missing in Stripe")
+		return item, nil
+	}
+	if err != nil {
+		return item, err
+	}
+
+	// What the records should say, given Stripe
+	status := localSubscriptionStatus(remote)
+	entitled := status != "expired" && remote.CurrentPeriodEnd.After(time.Now())
+
+	if local := record.GetString("status"); local != status {
+		item.Issues = append(item.Issues, fmt.Sprintf("status is %s, Stripe says %s", local, status))
+	}
+	if !sameInstant(record.GetDateTime("currentPeriodEnd"), remote.CurrentPeriodEnd) {
+		item.Issues = append(item.Issues, fmt.Sprintf("currentPeriodEnd is %s, Stripe says %s",
+			formatAPIDate(record.GetDateTime("currentPeriodEnd")), remote.CurrentPeriodEnd.Format(time.RFC3339)))
+	}
+
+	lifetime := user.GetString("premiumPlan") == PlanLifetime
+	otherPremium, err := hasOtherActiveSubscription(app, user.Id, record.Id)
+	if err != nil {
+		return item, err
+	}
+	// A lifetime plan or another paid subscription keeps the user premium
+	// whatever this subscription says; only a missing grant is an issue then
+	elsewhere := lifetime || otherPremium
+	fixUser := false
+	switch {
+	case entitled && !user.GetBool("isPremium"):
+		item.Issues = append(item.Issues, "user is not premium, Stripe subscription is paid")
+		fixUser = true
+	case elsewhere:
+	case entitled && !sameInstant(user.GetDateTime("premiumExpiresAt"), remote.CurrentPeriodEnd):
+		item.Issues = append(item.Issues, fmt.Sprintf("premiumExpiresAt is %s, Stripe says %s",
+			formatAPIDate(user.GetDateTime("premiumExpiresAt")), remote.CurrentPeriodEnd.Format(time.RFC3339)))
+		fixUser = true
+	case !entitled && user.GetBool("isPremium"):
+		item.Issues = append(item.Issues, "user is premium, Stripe subscription is not paid")
+		fixUser = true
+	}
+
+	if len(item.Issues) == 0 || !apply {
+		return item, nil
+	}
+
+	err = app.RunInTransaction(func(txApp core.App) error {
+		record.Set("status", status)
+		record.Set("currentPeriodStart", remote.CurrentPeriodStart)
+		record.Set("currentPeriodEnd", remote.CurrentPeriodEnd)
+		// Webhook events from before now are older than what we just applied
+		record.Set("lastEventAt", types.NowDateTime())
+		if err := txApp.Save(record); err != nil {
+			return err
+		}
+
+		if !fixUser {
+			return nil
+		}
+		_, err := syncPremium(txApp, user)
+		return err
+	})
+	if err != nil {
+		return item, err
+	}
+
+	item.Fixed = true
+	return item, nil
+}
+
+// localSubscriptionStatus maps a Stripe subscription to our subscription status
+func localSubscriptionStatus(remote *RemoteSubscription) string {
+	switch stripe.SubscriptionStatus(remote.Status) {
+	case stripe.SubscriptionStatusActive, stripe.SubscriptionStatusTrialing:
+		if remote.CancelAtPeriodEnd {
+			return "cancelled"
+		}
+		return "active"
+	case stripe.SubscriptionStatusPastDue, stripe.SubscriptionStatusUnpaid, stripe.SubscriptionStatusIncomplete, stripe.SubscriptionStatusPaused:
+		return "past_due"
+	default:
+		return "expired"
+	}
+}
+
+// hasOtherActiveSubscription reports whether a user has a paid-up
+// subscription other than the given one
+func hasOtherActiveSubscription(app core.App, userID, excludeID string) (bool, error) {
+	count, err := app.CountRecords("subscriptions", dbx.NewExp(
+		"user = {:userId} AND id != {:id} AND status IN ('active', 'cancelled', 'past_due') AND currentPeriodEnd > {:now}",
+		dbx.Params{"userId": userID, "id": excludeID, "now": types.NowDateTime().String()},
+	))
+	return count > 0, err
+}
+
+// sameInstant reports whether a stored date and a time agree to the second
+func sameInstant(dt types.DateTime, t time.Time) bool {
+	if dt.IsZero() || t.IsZero() {
+		return dt.IsZero() == t.IsZero()
+	}
+	return dt.Time().Truncate(time.Second).Equal(t.Truncate(time.Second))
+}
+
+// saveStripeReconcileReport records a reconciliation run
+func saveStripeReconcileReport(app core.App, report *StripeReconcileReport) error {
+	collection, err := app.FindCollectionByNameOrId("stripe_reconcile_reports")
+	if err != nil {
+		return err
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("trigger", report.Trigger)
+	record.Set("applied", report.Applied)
+	record.Set("checked", report.Checked)
+	record.Set("mismatched", report.Mismatched)
+	record.Set("fixed", report.Fixed)
+	record.Set("errors", report.Errors)
+	record.Set("startedAt", report.StartedAt)
+	record.Set("finishedAt", report.FinishedAt)
+	record.Set("items", report.Items)
+	if err := app.Save(record); err != nil {
+		return err
+	}
+
+	report.ID = record.Id
+	return nil
+}
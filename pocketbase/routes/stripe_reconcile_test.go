@@ -0,0 +1,283 @@
+package routes
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// newTestSubscription saves a monthly subscription for user with the given
+// local status and period end, then syncs the user's premium fields to it
+func newTestSubscription(tb testing.TB, app core.App, user *core.Record, stripeID, status string, periodEnd time.Time) *core.Record {
+	tb.Helper()
+
+	sub := newTestRecord(tb, app, "subscriptions", map[string]any{
+		"user":                 user.Id,
+		"stripeSubscriptionId": stripeID,
+		"plan":                 PlanMonthly,
+		"status":               status,
+		"currentPeriodStart":   periodEnd.AddDate(0, -1, 0),
+		"currentPeriodEnd":     periodEnd,
+	})
+
+	if _, err := syncPremium(app, user); err != nil {
+		tb.Fatal(err)
+	}
+	return sub
+}
+
+// remoteSubscription is a Stripe subscription for the period ending at end
+func remoteSubscription(id, status string, end time.Time) *RemoteSubscription {
+	return &RemoteSubscription{
+		ID:                 id,
+		Status:             status,
+		CurrentPeriodStart: end.AddDate(0, -1, 0),
+		CurrentPeriodEnd:   end,
+	}
+}
+
+// reconcileItem returns the report item for a subscription record, if any
+func reconcileItem(report *StripeReconcileReport, subscriptionID string) (StripeReconcileItem, bool) {
+	for _, item := range report.Items {
+		if item.SubscriptionID == subscriptionID {
+			return item, true
+		}
+	}
+	return StripeReconcileItem{}, false
+}
+
+// hasIssue reports whether any of an item's issues starts with prefix
+func hasIssue(item StripeReconcileItem, prefix string) bool {
+	return slices.ContainsFunc(item.Issues, func(issue string) bool { return strings.HasPrefix(issue, prefix) })
+}
+
+func reload(tb testing.TB, app core.App, record *core.Record) *core.Record {
+	tb.Helper()
+
+	fresh, err := app.FindRecordById(record.Collection().Name, record.Id)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return fresh
+}
+
+func countDowngrades(tb testing.TB, app core.App) int64 {
+	tb.Helper()
+
+	count, err := app.CountRecords("premium_downgrades")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return count
+}
+
+func TestReconcileStripeStatusDrift(t *testing.T) {
+	app := newTestApp(t)
+	user := newTestUser(t, app, "status@example.com", nil)
+	periodEnd := time.Now().AddDate(0, 0, 20).UTC().Truncate(time.Second)
+	sub := newTestSubscription(t, app, user, "sub_status", "active", periodEnd)
+
+	// Cancelled in Stripe, but the webhook never arrived
+	remote := remoteSubscription("sub_status", "active", periodEnd)
+	remote.CancelAtPeriodEnd = true
+	source := StaticSubscriptionSource{"sub_status": remote}
+
+	report, err := ReconcileStripeSubscriptions(app, source, true, "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, ok := reconcileItem(report, sub.Id)
+	if !ok || !hasIssue(item, "status is active, Stripe says cancelled") || !item.Fixed {
+		t.Fatalf("item = %+v, want a fixed status issue", item)
+	}
+	if status := reload(t, app, sub).GetString("status"); status != "cancelled" {
+		t.Fatalf("status = %q after applying, want cancelled", status)
+	}
+	if !reload(t, app, user).GetBool("isPremium") {
+		t.Fatal("user lost premium while the cancelled period is still paid")
+	}
+}
+
+func TestReconcileStripePeriodDrift(t *testing.T) {
+	app := newTestApp(t)
+	user := newTestUser(t, app, "period@example.com", nil)
+	oldEnd := time.Now().AddDate(0, 0, 2).UTC().Truncate(time.Second)
+	sub := newTestSubscription(t, app, user, "sub_period", "active", oldEnd)
+
+	// Renewed in Stripe, but the webhook never arrived
+	newEnd := oldEnd.AddDate(0, 1, 0)
+	source := StaticSubscriptionSource{"sub_period": remoteSubscription("sub_period", "active", newEnd)}
+
+	report, err := ReconcileStripeSubscriptions(app, source, true, "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, ok := reconcileItem(report, sub.Id)
+	if !ok || !hasIssue(item, "currentPeriodEnd is") || !hasIssue(item, "premiumExpiresAt is") || !item.Fixed {
+		t.Fatalf("item = %+v, want fixed period and premiumExpiresAt issues", item)
+	}
+	if end := reload(t, app, sub).GetDateTime("currentPeriodEnd"); !sameInstant(end, newEnd) {
+		t.Fatalf("currentPeriodEnd = %s, want %s", end, newEnd)
+	}
+	if expires := reload(t, app, user).GetDateTime("premiumExpiresAt"); !sameInstant(expires, newEnd) {
+		t.Fatalf("premiumExpiresAt = %s, want %s", expires, newEnd)
+	}
+}
+
+func TestReconcileStripeEnded(t *testing.T) {
+	app := newTestApp(t)
+	user := newTestUser(t, app, "ended@example.com", nil)
+	periodEnd := time.Now().AddDate(0, 0, 20).UTC().Truncate(time.Second)
+	sub := newTestSubscription(t, app, user, "sub_ended", "active", periodEnd)
+
+	source := StaticSubscriptionSource{"sub_ended": remoteSubscription("sub_ended", "canceled", periodEnd)}
+	report, err := ReconcileStripeSubscriptions(app, source, true, "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, ok := reconcileItem(report, sub.Id)
+	if !ok || !hasIssue(item, "user is premium, Stripe subscription is not paid") || !item.Fixed {
+		t.Fatalf("item = %+v, want a fixed premium issue", item)
+	}
+	if reload(t, app, user).GetBool("isPremium") {
+		t.Fatal("user still premium after Stripe ended the subscription")
+	}
+	if countDowngrades(t, app) != 1 {
+		t.Fatal("downgrade wasn't recorded")
+	}
+}
+
+func TestReconcileStripeMissing(t *testing.T) {
+	app := newTestApp(t)
+	user := newTestUser(t, app, "missing@example.com", nil)
+	sub := newTestSubscription(t, app, user, "sub_missing", "active", time.Now().AddDate(0, 0, 20))
+
+	report, err := ReconcileStripeSubscriptions(app, StaticSubscriptionSource{}, true, "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, ok := reconcileItem(report, sub.Id)
+	if !ok || !slices.Equal(item.Issues, []string{"missing in Stripe"}) || item.Fixed {
+		t.Fatalf("item = %+v, want an unfixed missing issue", item)
+	}
+	if report.Mismatched != 1 || report.Fixed != 0 {
+		t.Fatalf("mismatched/fixed = %d/%d, want 1/0", report.Mismatched, report.Fixed)
+	}
+
+	// Left to staff: nothing changes
+	if status := reload(t, app, sub).GetString("status"); status != "active" {
+		t.Fatalf("status = %q, want active", status)
+	}
+	if !reload(t, app, user).GetBool("isPremium") {
+		t.Fatal("user downgraded over a subscription missing in Stripe")
+	}
+	if countDowngrades(t, app) != 0 {
+		t.Fatal("downgrade recorded for a subscription missing in Stripe")
+	}
+}
+
+func TestReconcileStripePremiumElsewhere(t *testing.T) {
+	app := newTestApp(t)
+	periodEnd := time.Now().AddDate(0, 0, 20).UTC().Truncate(time.Second)
+
+	lifetime := newTestUser(t, app, "lifetime@example.com", map[string]any{"lifetimePurchasedAt": time.Now().AddDate(0, -1, 0)})
+	lifetimeSub := newTestSubscription(t, app, lifetime, "sub_lifetime", "active", periodEnd)
+
+	twoSubs := newTestUser(t, app, "two@example.com", nil)
+	endedSub := newTestSubscription(t, app, twoSubs, "sub_ended", "active", periodEnd)
+	newTestSubscription(t, app, twoSubs, "sub_paid", "active", periodEnd.AddDate(0, 0, 5))
+
+	source := StaticSubscriptionSource{
+		"sub_lifetime": remoteSubscription("sub_lifetime", "canceled", periodEnd),
+		"sub_ended":    remoteSubscription("sub_ended", "canceled", periodEnd),
+		"sub_paid":     remoteSubscription("sub_paid", "active", periodEnd.AddDate(0, 0, 5)),
+	}
+
+	report, err := ReconcileStripeSubscriptions(app, source, true, "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name string
+		user *core.Record
+		sub  *core.Record
+		plan string
+	}{
+		{"lifetime holder", lifetime, lifetimeSub, PlanLifetime},
+		{"holder of another subscription", twoSubs, endedSub, PlanMonthly},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			item, ok := reconcileItem(report, c.sub.Id)
+			if !ok || !hasIssue(item, "status is active, Stripe says expired") || !item.Fixed {
+				t.Fatalf("item = %+v, want a fixed status issue", item)
+			}
+			if hasIssue(item, "user is premium") {
+				t.Fatalf("item = %+v, flags premium the user holds elsewhere", item)
+			}
+			if status := reload(t, app, c.sub).GetString("status"); status != "expired" {
+				t.Fatalf("status = %q, want expired", status)
+			}
+			user := reload(t, app, c.user)
+			if !user.GetBool("isPremium") || user.GetString("premiumPlan") != c.plan {
+				t.Fatalf("isPremium/premiumPlan = %v/%q, want true/%q", user.GetBool("isPremium"), user.GetString("premiumPlan"), c.plan)
+			}
+		})
+	}
+
+	if countDowngrades(t, app) != 0 {
+		t.Fatal("downgrade recorded for a user premium elsewhere")
+	}
+}
+
+func TestReconcileStripeDryRun(t *testing.T) {
+	app := newTestApp(t)
+	user := newTestUser(t, app, "dryrun@example.com", nil)
+	periodEnd := time.Now().AddDate(0, 0, 20).UTC().Truncate(time.Second)
+	sub := newTestSubscription(t, app, user, "sub_dryrun", "active", periodEnd)
+	source := StaticSubscriptionSource{"sub_dryrun": remoteSubscription("sub_dryrun", "past_due", periodEnd)}
+
+	dryRun, err := ReconcileStripeSubscriptions(app, source, false, "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dryRun.Applied || dryRun.Checked != 1 || dryRun.Mismatched != 1 || dryRun.Fixed != 0 {
+		t.Fatalf("dry run applied/checked/mismatched/fixed = %v/%d/%d/%d, want false/1/1/0",
+			dryRun.Applied, dryRun.Checked, dryRun.Mismatched, dryRun.Fixed)
+	}
+	if status := reload(t, app, sub).GetString("status"); status != "active" {
+		t.Fatalf("dry run changed status to %q", status)
+	}
+
+	applied, err := ReconcileStripeSubscriptions(app, source, true, "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !applied.Applied || applied.Mismatched != 1 || applied.Fixed != 1 {
+		t.Fatalf("apply applied/mismatched/fixed = %v/%d/%d, want true/1/1", applied.Applied, applied.Mismatched, applied.Fixed)
+	}
+	if status := reload(t, app, sub).GetString("status"); status != "past_due" {
+		t.Fatalf("status = %q after applying, want past_due", status)
+	}
+
+	// Nothing left to fix
+	again, err := ReconcileStripeSubscriptions(app, source, true, "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Mismatched != 0 || len(again.Items) != 0 {
+		t.Fatalf("second apply mismatched %d: %+v", again.Mismatched, again.Items)
+	}
+
+	// Every run is saved, dry runs included
+	reports, err := app.FindAllRecords("stripe_reconcile_reports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 3 {
+		t.Fatalf("saved reports = %d, want 3", len(reports))
+	}
+}
@@ -3,16 +3,23 @@ package routes
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
 )
 
+// Session types
+const (
+	SessionTypePractice = "practice"
+	SessionTypeTest     = "test"
+)
+
 // Test session constants
 const (
 	MinTimePerQuestion = 2000           // 2 seconds minimum per question
-	MaxTestDuration    = 60 * 60 * 1000 // 60 minutes max for a test
+	MaxTestDuration    = 60 * 60 * 1000 // 60 minutes max for a test (caps blueprint time limits)
 	MaxAnswersPerMin   = 30             // Max answers per minute (anti-bot)
 	SuspiciousPerfect  = 10             // Flag if >10 perfect answers in a row under 3s each
 )
@@ -29,7 +36,8 @@ const (
 
 // TestStartRequest represents a test start request
 type TestStartRequest struct {
-	Category string `json:"category,omitempty"`
+	BlueprintID string `json:"blueprintId,omitempty"` // Record ID or slug; default blueprint if empty
+	Category    string `json:"category,omitempty"`
 }
 
 // TestStartResponse represents a test start response
@@ -38,6 +46,17 @@ type TestStartResponse struct {
 	Questions []QuestionForClient `json:"questions"`
 	Count     int                 `json:"count"`
 	TimeLimit int                 `json:"timeLimit"` // milliseconds
+	Blueprint string              `json:"blueprint"`
+	Sections  []TestSectionInfo   `json:"sections"`
+}
+
+// TestSectionInfo tells the client which questions belong to each section
+type TestSectionInfo struct {
+	ID            string   `json:"id"`
+	Name          string   `json:"name"`
+	QuestionIDs   []string `json:"questionIds"`
+	PassMark      int      `json:"passMark"`
+	QuestionCount int      `json:"questionCount"`
 }
 
 // TestAnswerRequest represents an answer submission
@@ -71,6 +90,8 @@ type TestCompleteResponse struct {
 	TimeSpent         int                      `json:"timeSpent"` // seconds
 	XPEarned          int                      `json:"xpEarned"`
 	CategoryBreakdown map[string]CategoryScore `json:"categoryBreakdown"`
+	Blueprint         string                   `json:"blueprint,omitempty"`
+	Sections          []SectionResult          `json:"sections,omitempty"`
 	Flagged           bool                     `json:"flagged,omitempty"`
 	FlagReason        string                   `json:"flagReason,omitempty"`
 }
@@ -122,7 +143,27 @@ func handleTestStart(app core.App, e *core.RequestEvent) error {
 	}
 
 	var req TestStartRequest
-	e.BindBody(&req) // Optional category
+	e.BindBody(&req) // Optional blueprint and category
+
+	// Resolve the blueprint before touching any existing sessions
+	blueprint, err := loadBlueprint(app, req.BlueprintID)
+	if err != nil {
+		return e.JSON(http.StatusNotFound, map[string]string{
+			"error": "Test blueprint not found",
+		})
+	}
+
+	isPremium := userHasPremium(app, authRecord)
+	if blueprint.RequiresPremium && !isPremium {
+		return e.JSON(http.StatusForbidden, map[string]string{
+			"error": "Premium test - upgrade required",
+		})
+	}
+
+	// Narrow to a single-section test when the user asked for a specific category
+	if req.Category != "" {
+		blueprint = categoryBlueprint(blueprint, req.Category)
+	}
 
 	// Check for existing active session
 	sessionCollection, err := app.FindCollectionByNameOrId("question_sessions")
@@ -144,50 +185,14 @@ func handleTestStart(app core.App, e *core.RequestEvent) error {
 		app.Save(s)
 	}
 
-	// Get questions
-	isPremium := authRecord.GetBool("isPremium")
-	questionCollection, err := app.FindCollectionByNameOrId("questions")
-	if err != nil {
-		return e.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Questions not available",
-		})
-	}
-
-	// Build filter
-	filter := ""
-	filterParams := map[string]interface{}{}
-	if req.Category != "" {
-		filter = "category = {:category}"
-		filterParams["category"] = req.Category
-	}
-	if !isPremium {
-		if filter != "" {
-			filter += " && "
-		}
-		filter += "isPremium = false"
-	}
-
-	var records []*core.Record
-	if filter != "" {
-		records, err = app.FindRecordsByFilter(questionCollection.Id, filter, "", 0, 0, filterParams)
-	} else {
-		records, err = app.FindAllRecords(questionCollection)
-	}
-
+	// Draw questions per section (exclude premium for free users)
+	blueprint, records, err := drawBlueprintQuestions(app, blueprint, isPremium)
 	if err != nil {
 		return e.JSON(http.StatusInternalServerError, map[string]string{
 			"error": "Failed to fetch questions",
 		})
 	}
 
-	// Shuffle and select 40 questions
-	shuffleRecords(records)
-	testSize := 40
-	if len(records) < testSize {
-		testSize = len(records)
-	}
-	records = records[:testSize]
-
 	// Convert to client format and collect IDs
 	questions := make([]QuestionForClient, 0, len(records))
 	questionIds := make([]string, 0, len(records))
@@ -203,7 +208,7 @@ func handleTestStart(app core.App, e *core.RequestEvent) error {
 	// Create session
 	session := core.NewRecord(sessionCollection)
 	session.Set("user", authRecord.Id)
-	session.Set("sessionType", "test")
+	session.Set("sessionType", SessionTypeTest)
 	questionIdsJSON, _ := json.Marshal(questionIds)
 	session.Set("questionIds", string(questionIdsJSON))
 	session.Set("currentIndex", 0)
@@ -213,6 +218,8 @@ func handleTestStart(app core.App, e *core.RequestEvent) error {
 	if req.Category != "" {
 		session.Set("category", req.Category)
 	}
+	blueprintJSON, _ := json.Marshal(blueprint)
+	session.Set("blueprint", string(blueprintJSON))
 
 	if err := app.Save(session); err != nil {
 		return e.JSON(http.StatusInternalServerError, map[string]string{
@@ -224,11 +231,19 @@ func handleTestStart(app core.App, e *core.RequestEvent) error {
 		SessionID: session.Id,
 		Questions: questions,
 		Count:     len(questions),
-		TimeLimit: MaxTestDuration,
+		TimeLimit: blueprint.TimeLimit,
+		Blueprint: blueprint.ID,
+		Sections:  sectionSummaries(blueprint),
 	})
 }
 
 func handleTestAnswer(app core.App, e *core.RequestEvent) error {
+	return handleSessionAnswer(app, e, SessionTypeTest)
+}
+
+// handleSessionAnswer validates and records an answer for a test or practice session.
+// Both session types share the same ownership, timing and anti-cheat checks.
+func handleSessionAnswer(app core.App, e *core.RequestEvent, sessionType string) error {
 	authRecord := e.Auth
 	if authRecord == nil {
 		return e.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
@@ -245,7 +260,7 @@ func handleTestAnswer(app core.App, e *core.RequestEvent) error {
 	session, err := app.FindRecordById("question_sessions", req.SessionID)
 	if err != nil {
 		return e.JSON(http.StatusNotFound, map[string]string{
-			"error": "Test session not found",
+			"error": sessionLabel(sessionType) + " session not found",
 		})
 	}
 
@@ -256,20 +271,27 @@ func handleTestAnswer(app core.App, e *core.RequestEvent) error {
 		})
 	}
 
+	// Verify session type matches the endpoint
+	if session.GetString("sessionType") != sessionType {
+		return e.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Not a " + strings.ToLower(sessionLabel(sessionType)) + " session",
+		})
+	}
+
 	// Check session status
 	if session.GetString("status") != "active" {
 		return e.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Test session is not active",
+			"error": sessionLabel(sessionType) + " session is not active",
 		})
 	}
 
-	// Check if test has timed out
-	startedAt, _ := time.Parse(time.RFC3339, session.GetString("startedAt"))
-	if time.Since(startedAt).Milliseconds() > MaxTestDuration {
+	// Check if session has timed out
+	startedAt := session.GetDateTime("startedAt").Time()
+	if time.Since(startedAt).Milliseconds() > int64(sessionTimeLimit(session)) {
 		session.Set("status", "timeout")
 		app.Save(session)
 		return e.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Test session has timed out",
+			"error": sessionLabel(sessionType) + " session has timed out",
 		})
 	}
 
@@ -286,7 +308,7 @@ func handleTestAnswer(app core.App, e *core.RequestEvent) error {
 	}
 	if !questionInSession {
 		return e.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Question not in this test session",
+			"error": "Question not in this " + strings.ToLower(sessionLabel(sessionType)) + " session",
 		})
 	}
 
@@ -354,6 +376,15 @@ func handleTestAnswer(app core.App, e *core.RequestEvent) error {
 		flagged = true
 	}
 
+	// Practice sessions have a per-session XP cap
+	if sessionType == SessionTypePractice {
+		sessionXP := 0
+		for _, a := range answers {
+			sessionXP += a.XPEarned
+		}
+		xpEarned = min(xpEarned, max(MaxPracticeSessionXP-sessionXP, 0))
+	}
+
 	// Record the answer
 	answer := SessionAnswer{
 		QuestionID:     req.QuestionID,
@@ -376,6 +407,17 @@ func handleTestAnswer(app core.App, e *core.RequestEvent) error {
 		})
 	}
 
+	// Record the attempt and update the spaced-repetition schedule
+	if err := logQuestionAttempt(app, authRecord.Id, question, sessionType, session.Id, req.SelectedAnswer, req.TimeSpent, time.Now().UnixMilli(), correct); err != nil {
+		app.Logger().Error("Failed to log question attempt", "error", err)
+	}
+	if err := updateQuestionReview(app, authRecord.Id, req.QuestionID, correct, req.TimeSpent, true); err != nil {
+		app.Logger().Error("Failed to update review schedule", "error", err)
+	}
+	if err := creditDailyChallenges(app, authRecord); err != nil {
+		app.Logger().Error("Failed to credit daily challenges", "error", err)
+	}
+
 	return e.JSON(http.StatusOK, TestAnswerResponse{
 		Correct:       correct,
 		CorrectAnswer: question.CorrectAnswer,
@@ -493,10 +535,20 @@ func handleTestComplete(app core.App, e *core.RequestEvent) error {
 	}
 
 	totalQuestions := len(questionIds)
-	passed := float64(score)/float64(totalQuestions) >= 0.8 // 80% pass rate
+
+	// Score each blueprint section on its own and apply the blueprint's pass rules.
+	// Sessions created before blueprints fall back to a single 80% threshold.
+	var passed bool
+	var sections []SectionResult
+	blueprint, hasBlueprint := sessionBlueprint(session)
+	if hasBlueprint {
+		sections, passed = scoreBlueprint(blueprint, answers)
+	} else {
+		passed = totalQuestions > 0 && float64(score)/float64(totalQuestions) >= 0.8 // 80% pass rate
+	}
 
 	// Calculate time spent
-	startedAt, _ := time.Parse(time.RFC3339, session.GetString("startedAt"))
+	startedAt := session.GetDateTime("startedAt").Time()
 	timeSpent := int(time.Since(startedAt).Seconds())
 
 	// Add completion bonuses
@@ -513,24 +565,7 @@ func handleTestComplete(app core.App, e *core.RequestEvent) error {
 		totalXP = totalXP / 2 // 50% XP penalty for suspicious activity
 	}
 
-	// Update user XP (server-authoritative)
-	if !flagged || totalXP > 0 {
-		currentXP := authRecord.GetInt("xp")
-		authRecord.Set("xp", currentXP+totalXP)
-
-		// Update stats
-		questionsCompleted := authRecord.GetInt("questionsCompleted")
-		authRecord.Set("questionsCompleted", questionsCompleted+len(answers))
-
-		questionsCorrect := authRecord.GetInt("questionsCorrect")
-		authRecord.Set("questionsCorrect", questionsCorrect+score)
-
-		if err := app.Save(authRecord); err != nil {
-			app.Logger().Error("Failed to update user XP", "error", err)
-		}
-	}
-
-	// Mark session as completed
+	// Mark session as completed (before crediting XP so a retry can't pay twice)
 	session.Set("status", "completed")
 	session.Set("completedAt", time.Now().UTC().Format(time.RFC3339))
 
@@ -542,6 +577,8 @@ func handleTestComplete(app core.App, e *core.RequestEvent) error {
 		TimeSpent:         timeSpent,
 		XPEarned:          totalXP,
 		CategoryBreakdown: categoryBreakdown,
+		Blueprint:         blueprint.ID,
+		Sections:          sections,
 		Flagged:           flagged,
 		FlagReason:        flagReason,
 	}
@@ -554,6 +591,28 @@ func handleTestComplete(app core.App, e *core.RequestEvent) error {
 		})
 	}
 
+	// Update user stats and credit XP through the ledger (server-authoritative)
+	if !flagged || totalXP > 0 {
+		questionsCompleted := authRecord.GetInt("questionsCompleted")
+		authRecord.Set("questionsCompleted", questionsCompleted+len(answers))
+
+		questionsCorrect := authRecord.GetInt("questionsCorrect")
+		authRecord.Set("questionsCorrect", questionsCorrect+score)
+
+		if _, err := creditXP(app, authRecord, totalXP, "test_complete", session.Id, "test", session.Id, map[string]interface{}{
+			"score":     score,
+			"total":     totalQuestions,
+			"passed":    passed,
+			"blueprint": blueprint.ID,
+			"flagged":   flagged,
+		}); err != nil {
+			app.Logger().Error("Failed to credit test XP", "error", err)
+		}
+	}
+	if err := creditDailyChallenges(app, authRecord); err != nil {
+		app.Logger().Error("Failed to credit daily challenges", "error", err)
+	}
+
 	return e.JSON(http.StatusOK, results)
 }
 
@@ -611,10 +670,10 @@ func returnCachedResults(session *core.Record, e *core.RequestEvent) error {
 	return e.JSON(http.StatusOK, results)
 }
 
-// Helper function to shuffle records
-func shuffleRecords(records []*core.Record) {
-	for i := len(records) - 1; i > 0; i-- {
-		j := int(time.Now().UnixNano()) % (i + 1)
-		records[i], records[j] = records[j], records[i]
+// sessionLabel returns the user-facing name of a session type for error messages
+func sessionLabel(sessionType string) string {
+	if sessionType == SessionTypePractice {
+		return "Practice"
 	}
+	return "Test"
 }
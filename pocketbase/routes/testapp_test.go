@@ -0,0 +1,141 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	_ "driveprep/migrations"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+// newTestApp returns an app with an empty database and every migration applied
+func newTestApp(tb testing.TB) *tests.TestApp {
+	tb.Helper()
+
+	app, err := tests.NewTestAppWithConfig(core.BaseAppConfig{DataDir: tb.TempDir()})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(app.Cleanup)
+	return app
+}
+
+// rerunMigration reverts the migration whose file starts with prefix, calls
+// before (to set up data as it was before the migration) and applies it again
+func rerunMigration(tb testing.TB, app core.App, prefix string, before func()) {
+	tb.Helper()
+
+	var migration *core.Migration
+	for _, item := range core.AppMigrations.Items() {
+		if strings.HasPrefix(item.File, prefix) {
+			migration = item
+		}
+	}
+	if migration == nil {
+		tb.Fatalf("no migration %s registered", prefix)
+	}
+	if err := migration.Down(app); err != nil {
+		tb.Fatal(err)
+	}
+	before()
+	if err := migration.Up(app); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// newTestRecord saves a record with the given fields in collection
+func newTestRecord(tb testing.TB, app core.App, collection string, fields map[string]any) *core.Record {
+	tb.Helper()
+
+	c, err := app.FindCollectionByNameOrId(collection)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	record := core.NewRecord(c)
+	for key, value := range fields {
+		record.Set(key, value)
+	}
+	if err := app.Save(record); err != nil {
+		tb.Fatalf("create %s: %v", collection, err)
+	}
+	return record
+}
+
+// newTestQuestion saves a four-option question whose answer is option 1
+func newTestQuestion(tb testing.TB, app core.App) *core.Record {
+	tb.Helper()
+
+	return newTestRecord(tb, app, "questions", map[string]any{
+		"question":      "Question",
+		"options":       []string{"A", "B", "C", "D"},
+		"correctAnswer": "1",
+		"explanation":   "Because",
+		"category":      "Rules of the Road",
+		"difficulty":    1,
+	})
+}
+
+// newTestUser creates a user with the given email and extra fields
+func newTestUser(tb testing.TB, app core.App, email string, fields map[string]any) *core.Record {
+	tb.Helper()
+
+	users, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	user := core.NewRecord(users)
+	user.SetEmail(email)
+	user.SetPassword("password123")
+	user.Set("name", strings.Split(email, "@")[0])
+	for key, value := range fields {
+		user.Set(key, value)
+	}
+	if err := app.Save(user); err != nil {
+		tb.Fatalf("create user %s: %v", email, err)
+	}
+	return user
+}
+
+// newTestRouter builds a router with the routes the register function adds
+func newTestRouter(tb testing.TB, app core.App, register func(se *core.ServeEvent)) http.Handler {
+	tb.Helper()
+
+	r, err := apis.NewRouter(app)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	register(&core.ServeEvent{App: app, Router: r})
+
+	mux, err := r.BuildMux()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return mux
+}
+
+// serveTestRequest sends a request through the router as the given user
+// (nil for a guest) and returns the recorded response
+func serveTestRequest(tb testing.TB, mux http.Handler, user *core.Record, method, path, body string) *httptest.ResponseRecorder {
+	tb.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if user != nil {
+		token, err := user.NewAuthToken()
+		if err != nil {
+			tb.Fatal(err)
+		}
+		req.Header.Set("Authorization", token)
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
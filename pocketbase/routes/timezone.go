@@ -0,0 +1,87 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"driveprep/services"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// TimezoneChangeInterval is how often a user can move to another timezone.
+// Every change re-opens the local day, and with it daily login XP, streak
+// days and time-of-day badges, so it can't be done at will.
+const TimezoneChangeInterval = 24 * time.Hour
+
+// ErrTimezoneChangeTooSoon is returned for a timezone change within
+// TimezoneChangeInterval of the last one
+var ErrTimezoneChangeTooSoon = errors.New("timezone can only be changed once every 24 hours")
+
+// ErrTimezoneRequired is returned for clearing a timezone once it's set.
+// The cleared day falls back to UTC, so it would be a change of its own.
+var ErrTimezoneRequired = errors.New("timezone can't be cleared once set")
+
+// userLocation returns the user's timezone for day boundaries and local hours
+func userLocation(user *core.Record) *time.Location {
+	return services.UserLocation(user.GetString("timezone"))
+}
+
+// setUserTimezone sets a user's timezone, refusing a move within
+// TimezoneChangeInterval of the last and refusing to clear a set timezone.
+// Setting the first timezone, or the same one again, doesn't start a new
+// interval.
+func setUserTimezone(user *core.Record, timezone string, now time.Time) error {
+	current := user.Original().GetString("timezone")
+	if current == timezone {
+		user.Set("timezone", timezone)
+		return nil
+	}
+	if timezone == "" {
+		return ErrTimezoneRequired
+	}
+
+	if changedAt := user.GetDateTime("timezoneChangedAt"); !changedAt.IsZero() && now.Sub(changedAt.Time()) < TimezoneChangeInterval {
+		return ErrTimezoneChangeTooSoon
+	}
+	user.Set("timezone", timezone)
+	if current != "" {
+		user.Set("timezoneChangedAt", types.NowDateTime())
+	}
+	return nil
+}
+
+// RegisterTimezoneHooks rejects users whose timezone isn't a valid IANA
+// name, and limits timezone changes made through the records API
+func RegisterTimezoneHooks(app core.App) {
+	app.OnRecordValidate("users").BindFunc(func(e *core.RecordEvent) error {
+		if tz := e.Record.GetString("timezone"); tz != "" {
+			if _, err := services.ParseTimezone(tz); err != nil {
+				return validation.Errors{
+					"timezone": validation.NewError("validation_invalid_timezone", err.Error()),
+				}
+			}
+		}
+		return e.Next()
+	})
+
+	app.OnRecordUpdateRequest("users").BindFunc(func(e *core.RecordRequestEvent) error {
+		if e.HasSuperuserAuth() {
+			return e.Next()
+		}
+		if !e.Record.GetDateTime("timezoneChangedAt").Equal(e.Record.Original().GetDateTime("timezoneChangedAt")) {
+			return apis.NewForbiddenError("timezoneChangedAt can't be set", nil)
+		}
+		if err := setUserTimezone(e.Record, e.Record.GetString("timezone"), time.Now()); err != nil {
+			if errors.Is(err, ErrTimezoneRequired) {
+				return apis.NewBadRequestError(err.Error(), nil)
+			}
+			return apis.NewApiError(http.StatusTooManyRequests, err.Error(), nil)
+		}
+		return e.Next()
+	})
+}
@@ -0,0 +1,127 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestSetUserTimezone(t *testing.T) {
+	now := time.Now().UTC()
+
+	cases := []struct {
+		name      string
+		current   string
+		changedAt time.Time
+		timezone  string
+		wantErr   bool
+		wantClock bool // Whether the change starts a new interval
+	}{
+		{"first timezone", "", time.Time{}, "America/Toronto", false, false},
+		{"same timezone", "America/Toronto", now.Add(-time.Hour), "America/Toronto", false, false},
+		{"first change", "America/Toronto", time.Time{}, "Asia/Tokyo", false, true},
+		{"change after the interval", "America/Toronto", now.Add(-TimezoneChangeInterval - time.Minute), "Asia/Tokyo", false, true},
+		{"change within the interval", "America/Toronto", now.Add(-time.Hour), "Asia/Tokyo", true, false},
+		{"clearing the timezone", "America/Toronto", time.Time{}, "", true, false},
+		{"set within the interval of clearing", "", now.Add(-time.Hour), "Asia/Tokyo", true, false},
+	}
+
+	app := newTestApp(t)
+	for i, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fields := map[string]any{"timezone": c.current}
+			if !c.changedAt.IsZero() {
+				fields["timezoneChangedAt"] = c.changedAt
+			}
+			user := reload(t, app, newTestUser(t, app, fmt.Sprintf("tz%d@example.com", i), fields))
+
+			err := setUserTimezone(user, c.timezone, now)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("setUserTimezone = %v, want error %v", err, c.wantErr)
+			}
+			if c.wantErr {
+				return
+			}
+			if tz := user.GetString("timezone"); tz != c.timezone {
+				t.Fatalf("timezone = %q, want %q", tz, c.timezone)
+			}
+			restarted := !user.GetDateTime("timezoneChangedAt").Equal(user.Original().GetDateTime("timezoneChangedAt"))
+			if restarted != c.wantClock {
+				t.Fatalf("timezoneChangedAt moved = %v, want %v", restarted, c.wantClock)
+			}
+		})
+	}
+}
+
+func TestTimezoneChangeLimitedOverHTTP(t *testing.T) {
+	app := newTestApp(t)
+	RegisterTimezoneHooks(app)
+	mux := newTestRouter(t, app, func(se *core.ServeEvent) {
+		RegisterProgressRoutes(app, se)
+	})
+	user := newTestUser(t, app, "traveller@example.com", map[string]any{"timezone": "America/Toronto"})
+
+	// One move is fine
+	if rec := serveTestRequest(t, mux, user, http.MethodPatch, "/api/progress", `{"timezone":"Asia/Tokyo"}`); rec.Code != http.StatusOK {
+		t.Fatalf("first change: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Moving again the same day is refused, whichever API is used
+	if rec := serveTestRequest(t, mux, user, http.MethodPatch, "/api/progress", `{"timezone":"Pacific/Kiritimati"}`); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second change through progress: %d %s, want 429", rec.Code, rec.Body.String())
+	}
+	if rec := serveTestRequest(t, mux, user, http.MethodPatch, "/api/collections/users/records/"+user.Id, `{"timezone":"Pacific/Kiritimati"}`); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second change through the records API: %d %s, want 429", rec.Code, rec.Body.String())
+	}
+	if rec := serveTestRequest(t, mux, user, http.MethodPatch, "/api/collections/users/records/"+user.Id, `{"timezoneChangedAt":""}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("clearing timezoneChangedAt: %d %s, want 403", rec.Code, rec.Body.String())
+	}
+	if tz := reload(t, app, user).GetString("timezone"); tz != "Asia/Tokyo" {
+		t.Fatalf("timezone = %q, want Asia/Tokyo", tz)
+	}
+
+	// Other updates still go through
+	if rec := serveTestRequest(t, mux, user, http.MethodPatch, "/api/progress", `{"timezone":"Asia/Tokyo","streak":3}`); rec.Code != http.StatusOK {
+		t.Fatalf("update keeping the timezone: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestTimezoneClearThenSetLimited(t *testing.T) {
+	app := newTestApp(t)
+	RegisterTimezoneHooks(app)
+	mux := newTestRouter(t, app, func(se *core.ServeEvent) {
+		RegisterProgressRoutes(app, se)
+	})
+	user := newTestUser(t, app, "traveller@example.com", map[string]any{"timezone": "America/Toronto"})
+
+	if rec := serveTestRequest(t, mux, user, http.MethodPatch, "/api/progress", `{"timezone":"Asia/Tokyo"}`); rec.Code != http.StatusOK {
+		t.Fatalf("first change: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Clearing the timezone would re-open the free first set
+	if rec := serveTestRequest(t, mux, user, http.MethodPatch, "/api/collections/users/records/"+user.Id, `{"timezone":""}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("clearing through the records API: %d %s, want 400", rec.Code, rec.Body.String())
+	}
+	if rec := serveTestRequest(t, mux, user, http.MethodPatch, "/api/progress", `{"timezone":""}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("clearing through progress: %d %s, want 400", rec.Code, rec.Body.String())
+	}
+
+	// A timezone cleared some other way still doesn't skip the interval
+	cleared := reload(t, app, user)
+	cleared.Set("timezone", "")
+	if err := app.Save(cleared); err != nil {
+		t.Fatal(err)
+	}
+	if rec := serveTestRequest(t, mux, user, http.MethodPatch, "/api/progress", `{"timezone":"Pacific/Kiritimati"}`); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("set after clearing: %d %s, want 429", rec.Code, rec.Body.String())
+	}
+	if rec := serveTestRequest(t, mux, user, http.MethodPatch, "/api/collections/users/records/"+user.Id, `{"timezone":"Pacific/Kiritimati"}`); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("set after clearing through the records API: %d %s, want 429", rec.Code, rec.Body.String())
+	}
+	if tz := reload(t, app, user).GetString("timezone"); tz != "" {
+		t.Fatalf("timezone = %q, want still cleared", tz)
+	}
+}
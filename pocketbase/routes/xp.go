@@ -0,0 +1,297 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"driveprep/services"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// The xp_transactions ledger is the source of truth for XP. users.xp is a
+// cached balance that is recomputed from the ledger whenever XP is credited.
+
+var (
+	ErrUnknownXPReason  = errors.New("unknown XP reason")
+	ErrXPAmountMismatch = errors.New("XP amount does not match reason")
+	ErrXPDailyLimit     = errors.New("daily XP limit reached for reason")
+	ErrXPAlreadyAwarded = errors.New("XP already awarded for reference")
+)
+
+// XPReward is a fixed XP reward for a reason. The amount is defined
+// server-side; clients only ever name the reason.
+type XPReward struct {
+	Amount        int
+	ReferenceType string
+	DailyLimit    int // Max credits per local day in the user's timezone (0 = unlimited)
+}
+
+// clientXPReasons lists every reason the client is allowed to claim XP for
+// via /api/progress/add-xp. Everything else (answers, tests, badges, streaks,
+// daily challenges, mastered flashcards) is credited by the server where it
+// happens, so nothing is claimable at the moment.
+var clientXPReasons = map[string]XPReward{}
+
+// flashcardMasteredReward is credited once per question, for the first
+// on-time review that leaves it mastered (see services.MasteredIntervalDays)
+var flashcardMasteredReward = XPReward{Amount: 20, ReferenceType: "question", DailyLimit: 25}
+
+// serverUserFields are the users fields only the server writes: XP and
+// level come from the ledger, streaks from login days, and badges and
+// answer counts from the routes that check them
+var serverUserFields = []string{"xp", "level", "streak", "longestStreak", "lastStreakDate", "badges", "questionsCompleted", "questionsCorrect"}
+
+// XPBalance is a user's XP after a ledger change
+type XPBalance struct {
+	XP        int  `json:"newXP"`
+	Level     int  `json:"newLevel"`
+	OldLevel  int  `json:"-"`
+	LeveledUp bool `json:"leveledUp"`
+}
+
+// XPDrift is the difference between a user's cached XP and their ledger balance
+type XPDrift struct {
+	UserID   string `json:"userId"`
+	Email    string `json:"email"`
+	CachedXP int    `json:"cachedXP"`
+	LedgerXP int    `json:"ledgerXP"`
+	Drift    int    `json:"drift"` // cached - ledger
+}
+
+// RegisterXPHooks keeps XP, streaks, badges and answer counts out of
+// self-service user creates and updates through the records API
+func RegisterXPHooks(app core.App) {
+	guardUserFields(app, serverUserFields, "XP and progress can only be changed by the server")
+}
+
+// guardUserFields refuses creates and updates through the records API that
+// set any of fields on a users record, unless made by a superuser
+func guardUserFields(app core.App, fields []string, message string) {
+	app.OnRecordCreateRequest("users").BindFunc(func(e *core.RecordRequestEvent) error {
+		if !e.HasSuperuserAuth() {
+			blank := core.NewRecord(e.Collection)
+			for _, field := range fields {
+				if !reflect.DeepEqual(e.Record.Get(field), blank.Get(field)) {
+					return apis.NewForbiddenError(message, nil)
+				}
+			}
+		}
+		return e.Next()
+	})
+
+	app.OnRecordUpdateRequest("users").BindFunc(func(e *core.RecordRequestEvent) error {
+		if !e.HasSuperuserAuth() {
+			original := e.Record.Original()
+			for _, field := range fields {
+				if !reflect.DeepEqual(e.Record.Get(field), original.Get(field)) {
+					return apis.NewForbiddenError(message, nil)
+				}
+			}
+		}
+		return e.Next()
+	})
+}
+
+// creditXP appends an entry to the XP ledger and re-derives the user's XP and
+// level from it. Any other pending changes on the user record are saved in
+// the same transaction, so callers should set badges/streaks/stats first.
+// A reason pays at most once per reference: the check runs in the same
+// transaction as the insert, and a unique index backs it up.
+func creditXP(app core.App, user *core.Record, amount int, reason, referenceId, referenceType, sessionId string, metadata map[string]interface{}) (XPBalance, error) {
+	balance := XPBalance{OldLevel: user.GetInt("level")}
+
+	err := app.RunInTransaction(func(txApp core.App) error {
+		// Zero-XP events (e.g. a badge with no reward) still save the user changes
+		if amount == 0 {
+			return txApp.Save(user)
+		}
+
+		if referenceId != "" {
+			existing, _ := txApp.FindFirstRecordByFilter(
+				"xp_transactions",
+				"user = {:userId} && reason = {:reason} && referenceId = {:referenceId}",
+				map[string]any{"userId": user.Id, "reason": reason, "referenceId": referenceId},
+			)
+			if existing != nil {
+				return ErrXPAlreadyAwarded
+			}
+		}
+
+		if err := logXPTransaction(txApp, user.Id, amount, reason, referenceId, referenceType, sessionId, metadata); err != nil {
+			return err
+		}
+
+		xp, err := ledgerBalance(txApp, user.Id)
+		if err != nil {
+			return err
+		}
+
+		user.Set("xp", xp)
+		user.Set("level", calculateLevel(xp))
+		return txApp.Save(user)
+	})
+	if err != nil {
+		return balance, err
+	}
+
+	balance.XP = user.GetInt("xp")
+	balance.Level = user.GetInt("level")
+	balance.LeveledUp = balance.Level > balance.OldLevel
+	return balance, nil
+}
+
+// claimClientXP validates a client XP claim against clientXPReasons and credits it
+func claimClientXP(app core.App, user *core.Record, amount int, reason, referenceId, sessionId string, metadata map[string]interface{}) (XPBalance, error) {
+	def, ok := clientXPReasons[reason]
+	if !ok {
+		return XPBalance{}, ErrUnknownXPReason
+	}
+
+	// The amount is optional, but if the client sends one it must agree with ours
+	if amount != 0 && amount != def.Amount {
+		return XPBalance{}, ErrXPAmountMismatch
+	}
+
+	return creditRewardXP(app, user, def, reason, referenceId, sessionId, metadata)
+}
+
+// creditRewardXP credits a fixed reward, at most once per reference and at
+// most DailyLimit times per local day. The limit is counted in the same
+// transaction as the credit, so concurrent claims can't both pass it.
+func creditRewardXP(app core.App, user *core.Record, def XPReward, reason, referenceId, sessionId string, metadata map[string]interface{}) (XPBalance, error) {
+	var balance XPBalance
+	err := app.RunInTransaction(func(txApp core.App) error {
+		if def.DailyLimit > 0 {
+			claims, err := txApp.CountRecords("xp_transactions", dbx.NewExp(
+				"user = {:userId} AND reason = {:reason} AND created >= {:since}",
+				dbx.Params{"userId": user.Id, "reason": reason, "since": userDayStart(user)},
+			))
+			if err != nil {
+				return err
+			}
+			if int(claims) >= def.DailyLimit {
+				return ErrXPDailyLimit
+			}
+		}
+
+		var err error
+		balance, err = creditXP(txApp, user, def.Amount, reason, referenceId, def.ReferenceType, sessionId, metadata)
+		return err
+	})
+	return balance, err
+}
+
+// creditDailyCappedXP credits up to amount, less whatever would take the
+// user's XP for reasons today past limit, and returns what was credited.
+// Like creditRewardXP it counts in the same transaction as the credit.
+func creditDailyCappedXP(app core.App, user *core.Record, amount, limit int, reasons []string, reason, referenceId, referenceType, sessionId string, metadata map[string]interface{}) (XPBalance, int, error) {
+	var balance XPBalance
+	credited := 0
+	err := app.RunInTransaction(func(txApp core.App) error {
+		earned, err := dailyXP(txApp, user, reasons...)
+		if err != nil {
+			return err
+		}
+		credited = min(amount, max(limit-earned, 0))
+
+		balance, err = creditXP(txApp, user, credited, reason, referenceId, referenceType, sessionId, metadata)
+		return err
+	})
+	return balance, credited, err
+}
+
+// dailyXP sums the XP a user was credited for any of reasons since their
+// local day began
+func dailyXP(app core.App, user *core.Record, reasons ...string) (int, error) {
+	inReasons := make([]any, len(reasons))
+	for i, reason := range reasons {
+		inReasons[i] = reason
+	}
+
+	var result struct {
+		Total int `db:"total"`
+	}
+	err := app.DB().
+		Select("COALESCE(SUM(amount), 0) AS total").
+		From("xp_transactions").
+		Where(dbx.HashExp{"user": user.Id}).
+		AndWhere(dbx.In("reason", inReasons...)).
+		AndWhere(dbx.NewExp("created >= {:since}", dbx.Params{"since": userDayStart(user)})).
+		One(&result)
+	return result.Total, err
+}
+
+// userDayStart returns when the user's local day began, in the format
+// record dates are stored in
+func userDayStart(user *core.Record) string {
+	return services.LocalDayStart(time.Now(), userLocation(user)).UTC().Format(types.DefaultDateLayout)
+}
+
+// ledgerBalance sums a user's XP ledger
+func ledgerBalance(app core.App, userId string) (int, error) {
+	var result struct {
+		Total int `db:"total"`
+	}
+	err := app.DB().
+		NewQuery("SELECT COALESCE(SUM(amount), 0) AS total FROM xp_transactions WHERE user = {:userId}").
+		Bind(dbx.Params{"userId": userId}).
+		One(&result)
+	return result.Total, err
+}
+
+// ReconcileXP recomputes every user's XP from the ledger and returns the users
+// whose cached balance has drifted. With apply set, users.xp and users.level
+// are rewritten from the ledger.
+func ReconcileXP(app core.App, apply bool) ([]XPDrift, error) {
+	var rows []struct {
+		ID       string `db:"id"`
+		Email    string `db:"email"`
+		CachedXP int    `db:"xp"`
+		LedgerXP int    `db:"ledger"`
+	}
+	err := app.DB().NewQuery(`
+		SELECT u.id, u.email, COALESCE(u.xp, 0) AS xp, COALESCE(SUM(t.amount), 0) AS ledger
+		FROM users u
+		LEFT JOIN xp_transactions t ON t.user = u.id
+		GROUP BY u.id
+		HAVING COALESCE(u.xp, 0) != COALESCE(SUM(t.amount), 0)
+		ORDER BY u.email`).All(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	drifts := make([]XPDrift, 0, len(rows))
+	for _, row := range rows {
+		drifts = append(drifts, XPDrift{
+			UserID:   row.ID,
+			Email:    row.Email,
+			CachedXP: row.CachedXP,
+			LedgerXP: row.LedgerXP,
+			Drift:    row.CachedXP - row.LedgerXP,
+		})
+	}
+
+	if !apply {
+		return drifts, nil
+	}
+
+	for _, d := range drifts {
+		user, err := app.FindRecordById("users", d.UserID)
+		if err != nil {
+			return drifts, fmt.Errorf("user %s: %w", d.UserID, err)
+		}
+		user.Set("xp", d.LedgerXP)
+		user.Set("level", calculateLevel(d.LedgerXP))
+		if err := app.Save(user); err != nil {
+			return drifts, fmt.Errorf("user %s: %w", d.UserID, err)
+		}
+	}
+
+	return drifts, nil
+}
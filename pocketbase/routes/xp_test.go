@@ -0,0 +1,274 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"driveprep/services"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// creditConcurrently calls credit from n goroutines at once and returns how
+// many succeeded; every failure must be one of allowed
+func creditConcurrently(t *testing.T, n int, credit func(i int) error, allowed ...error) int {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = credit(i)
+		}(i)
+	}
+	wg.Wait()
+
+	credited := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			credited++
+		case !slices.ContainsFunc(allowed, func(target error) bool { return errors.Is(err, target) }):
+			t.Fatalf("credit: %v", err)
+		}
+	}
+	return credited
+}
+
+func TestCreditRewardXPOncePerReference(t *testing.T) {
+	app := newTestApp(t)
+	user := newTestUser(t, app, "flashcards@example.com", nil)
+
+	credited := creditConcurrently(t, 8, func(int) error {
+		u, err := app.FindRecordById("users", user.Id)
+		if err != nil {
+			return err
+		}
+		_, err = creditRewardXP(app, u, flashcardMasteredReward, "flashcard_mastered", "question-1", "", nil)
+		return err
+	}, ErrXPAlreadyAwarded)
+	if credited != 1 {
+		t.Fatalf("credited %d times, want once", credited)
+	}
+
+	if xp := reload(t, app, user).GetInt("xp"); xp != flashcardMasteredReward.Amount {
+		t.Fatalf("xp = %d, want %d", xp, flashcardMasteredReward.Amount)
+	}
+}
+
+func TestCreditRewardXPDailyLimit(t *testing.T) {
+	app := newTestApp(t)
+	user := newTestUser(t, app, "limit@example.com", nil)
+	reward := XPReward{Amount: 5, ReferenceType: "question", DailyLimit: 3}
+
+	credited := creditConcurrently(t, 10, func(i int) error {
+		u, err := app.FindRecordById("users", user.Id)
+		if err != nil {
+			return err
+		}
+		_, err = creditRewardXP(app, u, reward, "flashcard_mastered", fmt.Sprintf("question-%d", i), "", nil)
+		return err
+	}, ErrXPDailyLimit)
+	if credited != reward.DailyLimit {
+		t.Fatalf("credited %d times, want the daily limit of %d", credited, reward.DailyLimit)
+	}
+}
+
+func TestCreditDailyCappedXP(t *testing.T) {
+	app := newTestApp(t)
+	user := newTestUser(t, app, "practice@example.com", nil)
+
+	// Eight sessions of 300 XP against a 1500 XP day: five pay in full and
+	// the rest nothing, however they interleave
+	var mu sync.Mutex
+	total := 0
+	creditConcurrently(t, 8, func(i int) error {
+		u, err := app.FindRecordById("users", user.Id)
+		if err != nil {
+			return err
+		}
+		_, credited, err := creditDailyCappedXP(app, u, MaxPracticeSessionXP, MaxDailyPracticeXP, practiceXPReasons, "practice_complete", fmt.Sprintf("session-%d", i), "practice", "", nil)
+		mu.Lock()
+		total += credited
+		mu.Unlock()
+		return err
+	})
+	if total != MaxDailyPracticeXP {
+		t.Fatalf("credited %d XP, want the daily cap of %d", total, MaxDailyPracticeXP)
+	}
+	if xp := reload(t, app, user).GetInt("xp"); xp != MaxDailyPracticeXP {
+		t.Fatalf("xp = %d, want %d", xp, MaxDailyPracticeXP)
+	}
+
+	// Other reasons don't count against the cap
+	u := reload(t, app, user)
+	if _, err := creditXP(app, u, 50, "daily_login", "2026-03-08", "streak", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if earned, err := dailyXP(app, u, practiceXPReasons...); err != nil || earned != MaxDailyPracticeXP {
+		t.Fatalf("dailyXP = %d, %v; want %d", earned, err, MaxDailyPracticeXP)
+	}
+}
+
+func TestCreditXPOncePerReference(t *testing.T) {
+	app := newTestApp(t)
+	user := newTestUser(t, app, "login@example.com", nil)
+
+	// Daily login goes through creditXP directly, referenced by the local day
+	credited := creditConcurrently(t, 8, func(int) error {
+		u, err := app.FindRecordById("users", user.Id)
+		if err != nil {
+			return err
+		}
+		_, err = creditXP(app, u, 50, "daily_login", "2026-03-08", "streak", "", nil)
+		return err
+	}, ErrXPAlreadyAwarded)
+	if credited != 1 {
+		t.Fatalf("credited %d times, want once", credited)
+	}
+
+	// The index backs the check up for anything writing the ledger directly
+	if err := logXPTransaction(app, user.Id, 50, "daily_login", "2026-03-08", "streak", "", nil); err == nil {
+		t.Fatal("logged a second daily login for the same day")
+	}
+	if err := logXPTransaction(app, user.Id, 10, "daily_login", "", "streak", "", nil); err != nil {
+		t.Fatalf("entry without a reference: %v", err)
+	}
+	if err := logXPTransaction(app, user.Id, 10, "daily_login", "", "streak", "", nil); err != nil {
+		t.Fatalf("second entry without a reference: %v", err)
+	}
+}
+
+func TestXPReferenceIndexMigration(t *testing.T) {
+	app := newTestApp(t)
+	user := newTestUser(t, app, "legacy@example.com", nil)
+
+	// Client claims from before the ledger was server-side repeat references
+	rerunMigration(t, app, "1767065089_", func() {
+		for _, amount := range []int{10, 20, 30} {
+			if err := logXPTransaction(app, user.Id, amount, "correct_answer", "question-1", "question", "", nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	balance, err := ledgerBalance(app, user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance != 60 {
+		t.Fatalf("ledger balance = %d after the migration, want 60", balance)
+	}
+
+	kept, err := app.FindAllRecords("xp_transactions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	referenced, moved := 0, 0
+	for _, tx := range kept {
+		if tx.GetString("referenceId") == "question-1" {
+			referenced++
+		}
+		var metadata map[string]any
+		if err := tx.UnmarshalJSONField("metadata", &metadata); err == nil && metadata["duplicateReferenceId"] == "question-1" {
+			moved++
+		}
+	}
+	if referenced != 1 || moved != 2 {
+		t.Fatalf("referenced/moved = %d/%d, want 1/2", referenced, moved)
+	}
+}
+
+func TestXPHooksKeepProgressOutOfProfiles(t *testing.T) {
+	app := newTestApp(t)
+	RegisterXPHooks(app)
+	mux := newTestRouter(t, app, func(*core.ServeEvent) {})
+
+	user := newTestUser(t, app, "farmer@example.com", map[string]any{"xp": 120, "streak": 2})
+	for _, body := range []string{
+		`{"xp":99999}`,
+		`{"level":50}`,
+		`{"streak":29}`,
+		`{"longestStreak":29}`,
+		`{"lastStreakDate":"2026-03-07"}`,
+		`{"badges":["streak_30"]}`,
+		`{"questionsCompleted":5000}`,
+		`{"questionsCorrect":5000}`,
+	} {
+		rec := serveTestRequest(t, mux, user, http.MethodPatch, "/api/collections/users/records/"+user.Id, body)
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("PATCH %s: %d %s, want 403", body, rec.Code, rec.Body.String())
+		}
+	}
+	if u := reload(t, app, user); u.GetInt("xp") != 120 || u.GetInt("streak") != 2 {
+		t.Fatalf("xp/streak = %d/%d, want 120/2", u.GetInt("xp"), u.GetInt("streak"))
+	}
+
+	// Unchanged values and other fields still save
+	rec := serveTestRequest(t, mux, user, http.MethodPatch, "/api/collections/users/records/"+user.Id, `{"name":"Renamed","xp":120}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("profile update: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Nor can a new account start with XP
+	rec = serveTestRequest(t, mux, nil, http.MethodPost, "/api/collections/users/records",
+		`{"email":"new@example.com","password":"password123","passwordConfirm":"password123","xp":5000}`)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("sign up with XP: %d %s, want 403", rec.Code, rec.Body.String())
+	}
+	rec = serveTestRequest(t, mux, nil, http.MethodPost, "/api/collections/users/records",
+		`{"email":"new@example.com","password":"password123","passwordConfirm":"password123"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("sign up: %d %s", rec.Code, rec.Body.String())
+	}
+
+	superuser := newTestSuperuser(t, app, "root@example.com")
+	rec = serveTestRequest(t, mux, superuser, http.MethodPatch, "/api/collections/users/records/"+user.Id, `{"streak":3}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("superuser update: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestLoginStreak(t *testing.T) {
+	// Users default to Toronto, where DST starts on 2026-03-08
+	now := time.Date(2026, 3, 10, 9, 0, 0, 0, services.UserLocation(""))
+
+	cases := []struct {
+		name string
+		days []string
+		want int
+	}{
+		{"no logins", nil, 0},
+		{"yesterday only", []string{"2026-03-09"}, 1},
+		{"today doesn't count", []string{"2026-03-10", "2026-03-09"}, 1},
+		{"run across DST", []string{"2026-03-09", "2026-03-08", "2026-03-07", "2026-03-06"}, 4},
+		{"gap ends the run", []string{"2026-03-09", "2026-03-08", "2026-03-06", "2026-03-05"}, 2},
+		{"missed yesterday", []string{"2026-03-08", "2026-03-07"}, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			app := newTestApp(t)
+			user := newTestUser(t, app, "streak@example.com", map[string]any{"streak": 29})
+			for _, day := range c.days {
+				if err := logXPTransaction(app, user.Id, 50, "daily_login", day, "streak", "", nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := loginStreak(app, user, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.want {
+				t.Fatalf("loginStreak = %d, want %d", got, c.want)
+			}
+		})
+	}
+}
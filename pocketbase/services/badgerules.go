@@ -0,0 +1,200 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ganigeorgiev/fexpr"
+)
+
+// Badge rules use the same expression syntax as PocketBase API rules and
+// filters, evaluated against a flat map of numeric user stats, e.g.
+//
+//	questionsCompleted >= 100 && categories.road_signs.accuracy >= 80
+//
+// Supported operators are =, !=, >, >=, < and <=, joined with && or || and
+// grouped with parentheses. && binds tighter than ||, as in Go and SQL, so
+// "a && b || c" means "(a && b) || c".
+
+// RuleCondition is a single comparison in a badge rule and its outcome
+type RuleCondition struct {
+	Expression string  `json:"expression"`
+	Stat       string  `json:"stat"`
+	Op         string  `json:"op"`
+	Expected   float64 `json:"expected"`
+	Actual     float64 `json:"actual"`
+	Met        bool    `json:"met"`
+	Message    string  `json:"message"`
+}
+
+// RuleResult is the outcome of evaluating a badge rule
+type RuleResult struct {
+	Met        bool            `json:"met"`
+	Conditions []RuleCondition `json:"conditions"`
+}
+
+// Missing returns the conditions that were not met
+func (r RuleResult) Missing() []RuleCondition {
+	missing := []RuleCondition{}
+	for _, c := range r.Conditions {
+		if !c.Met {
+			missing = append(missing, c)
+		}
+	}
+	return missing
+}
+
+// ValidateRule checks that a rule parses and only references known stats
+func ValidateRule(rule string, stats map[string]float64) error {
+	_, err := EvaluateRule(rule, stats)
+	return err
+}
+
+// EvaluateRule evaluates a badge rule against the given stats
+func EvaluateRule(rule string, stats map[string]float64) (RuleResult, error) {
+	groups, err := fexpr.Parse(rule)
+	if err != nil {
+		return RuleResult{}, fmt.Errorf("invalid rule %q: %w", rule, err)
+	}
+
+	result := RuleResult{Conditions: []RuleCondition{}}
+	result.Met, err = evaluateGroups(groups, stats, &result.Conditions)
+	if err != nil {
+		return RuleResult{}, err
+	}
+
+	return result, nil
+}
+
+// evaluateGroups evaluates a list of joined groups as an OR of AND terms.
+// Every condition is evaluated, even once the outcome is known, so the
+// result lists everything a user still has to do.
+func evaluateGroups(groups []fexpr.ExprGroup, stats map[string]float64, conditions *[]RuleCondition) (bool, error) {
+	met := false
+	termMet := true
+	for i, group := range groups {
+		groupMet, err := evaluateItem(group.Item, stats, conditions)
+		if err != nil {
+			return false, err
+		}
+
+		if i > 0 && group.Join == fexpr.JoinOr {
+			met = met || termMet
+			termMet = true
+		}
+		termMet = termMet && groupMet
+	}
+	return met || termMet, nil
+}
+
+func evaluateItem(item any, stats map[string]float64, conditions *[]RuleCondition) (bool, error) {
+	switch item := item.(type) {
+	case fexpr.Expr:
+		condition, err := evaluateExpr(item, stats)
+		if err != nil {
+			return false, err
+		}
+		*conditions = append(*conditions, condition)
+		return condition.Met, nil
+	case fexpr.ExprGroup:
+		return evaluateGroups([]fexpr.ExprGroup{item}, stats, conditions)
+	case []fexpr.ExprGroup:
+		return evaluateGroups(item, stats, conditions)
+	default:
+		return false, fmt.Errorf("unsupported rule element %T", item)
+	}
+}
+
+func evaluateExpr(expr fexpr.Expr, stats map[string]float64) (RuleCondition, error) {
+	// Allow the stat on either side, e.g. "25 <= questionsCompleted"
+	left, right, op := expr.Left, expr.Right, expr.Op
+	if left.Type != fexpr.TokenIdentifier && right.Type == fexpr.TokenIdentifier {
+		left, right = right, left
+		op = flipOp(op)
+	}
+
+	if left.Type != fexpr.TokenIdentifier {
+		return RuleCondition{}, fmt.Errorf("condition %q must compare a stat", exprString(expr))
+	}
+	actual, ok := stats[left.Literal]
+	if !ok {
+		return RuleCondition{}, fmt.Errorf("unknown stat %q", left.Literal)
+	}
+
+	var expected float64
+	switch right.Type {
+	case fexpr.TokenNumber:
+		v, err := strconv.ParseFloat(right.Literal, 64)
+		if err != nil {
+			return RuleCondition{}, fmt.Errorf("invalid number %q", right.Literal)
+		}
+		expected = v
+	case fexpr.TokenIdentifier:
+		switch right.Literal {
+		case "true":
+			expected = 1
+		case "false":
+			expected = 0
+		default:
+			v, ok := stats[right.Literal]
+			if !ok {
+				return RuleCondition{}, fmt.Errorf("unknown stat %q", right.Literal)
+			}
+			expected = v
+		}
+	default:
+		return RuleCondition{}, fmt.Errorf("condition %q must compare against a number", exprString(expr))
+	}
+
+	var met bool
+	switch op {
+	case fexpr.SignEq:
+		met = actual == expected
+	case fexpr.SignNeq:
+		met = actual != expected
+	case fexpr.SignGt:
+		met = actual > expected
+	case fexpr.SignGte:
+		met = actual >= expected
+	case fexpr.SignLt:
+		met = actual < expected
+	case fexpr.SignLte:
+		met = actual <= expected
+	default:
+		return RuleCondition{}, fmt.Errorf("unsupported operator %q", op)
+	}
+
+	return RuleCondition{
+		Expression: exprString(expr),
+		Stat:       left.Literal,
+		Op:         string(op),
+		Expected:   expected,
+		Actual:     actual,
+		Met:        met,
+		Message:    fmt.Sprintf("%s is %s (needs %s %s)", left.Literal, formatNumber(actual), op, formatNumber(expected)),
+	}, nil
+}
+
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// flipOp mirrors a comparison so its operands can be swapped
+func flipOp(op fexpr.SignOp) fexpr.SignOp {
+	switch op {
+	case fexpr.SignGt:
+		return fexpr.SignLt
+	case fexpr.SignGte:
+		return fexpr.SignLte
+	case fexpr.SignLt:
+		return fexpr.SignGt
+	case fexpr.SignLte:
+		return fexpr.SignGte
+	}
+	return op
+}
+
+func exprString(expr fexpr.Expr) string {
+	return strings.Join([]string{expr.Left.Literal, string(expr.Op), expr.Right.Literal}, " ")
+}
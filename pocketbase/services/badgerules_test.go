@@ -0,0 +1,142 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ganigeorgiev/fexpr"
+)
+
+var testStats = map[string]float64{
+	"questionsCompleted":              120,
+	"streak":                          3,
+	"perfectTests":                    0,
+	"isPremium":                       1,
+	"categories.road_signs.accuracy":  85,
+	"categories.road_signs.attempted": 40,
+}
+
+func TestEvaluateRule(t *testing.T) {
+	cases := []struct {
+		name string
+		rule string
+		want bool
+	}{
+		{"single condition met", "questionsCompleted >= 100", true},
+		{"single condition not met", "streak >= 7", false},
+		{"and", "questionsCompleted >= 100 && streak >= 3", true},
+		{"and with one miss", "questionsCompleted >= 100 && streak >= 7", false},
+		{"or", "streak >= 7 || perfectTests = 0", true},
+		{"or with both missed", "streak >= 7 || perfectTests > 0", false},
+		{"stat on the right", "100 <= questionsCompleted", true},
+		{"stat on the right, flipped strictly", "120 > questionsCompleted", false},
+		{"compare two stats", "questionsCompleted > streak", true},
+		{"boolean literal", "isPremium = true", true},
+		{"dotted stat", "categories.road_signs.accuracy >= 80", true},
+		{"not equal", "perfectTests != 0", false},
+
+		// && binds tighter than ||
+		{"true || false && false", "questionsCompleted > 0 || streak > 10 && perfectTests > 0", true},
+		{"false && true || true", "streak > 10 && questionsCompleted > 0 || isPremium = true", true},
+		{"false || true && false", "streak > 10 || questionsCompleted > 0 && perfectTests > 0", false},
+		{"true && false || false && true", "questionsCompleted > 0 && streak > 10 || perfectTests > 0 && isPremium = true", false},
+		{"false && false || true && true", "streak > 10 && perfectTests > 0 || questionsCompleted > 0 && isPremium = true", true},
+
+		// Parentheses still override it
+		{"(true || false) && false", "(questionsCompleted > 0 || streak > 10) && perfectTests > 0", false},
+		{"true && (false || true)", "questionsCompleted > 0 && (streak > 10 || isPremium = true)", true},
+		{"nested groups", "(streak > 10 || (questionsCompleted > 0 && (perfectTests = 0))) && isPremium = true", true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result, err := EvaluateRule(c.rule, testStats)
+			if err != nil {
+				t.Fatalf("EvaluateRule(%q) error: %v", c.rule, err)
+			}
+			if result.Met != c.want {
+				t.Fatalf("EvaluateRule(%q).Met = %v, want %v", c.rule, result.Met, c.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateRule_Errors(t *testing.T) {
+	cases := []struct {
+		name    string
+		rule    string
+		wantErr string
+	}{
+		{"unknown stat", "lessonsWatched >= 5", `unknown stat "lessonsWatched"`},
+		{"unknown stat on the right", "streak >= lessonsWatched", `unknown stat "lessonsWatched"`},
+		{"no stat", "5 >= 3", "must compare a stat"},
+		{"string operand", "streak = 'three'", "must compare against a number"},
+		{"unsupported operator", "streak ~ 3", "unsupported operator"},
+		{"unknown stat in a later group", "streak >= 3 || (perfectTests > 0 && nope = 1)", `unknown stat "nope"`},
+		{"syntax error", "streak >= ", "invalid rule"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := EvaluateRule(c.rule, testStats)
+			if err == nil {
+				t.Fatalf("EvaluateRule(%q) succeeded, want an error containing %q", c.rule, c.wantErr)
+			}
+			if !strings.Contains(err.Error(), c.wantErr) {
+				t.Fatalf("EvaluateRule(%q) error = %q, want it to contain %q", c.rule, err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestEvaluateRule_ListsEveryCondition(t *testing.T) {
+	// The first term settles the outcome, but the rest is still reported
+	result, err := EvaluateRule("questionsCompleted >= 100 || streak >= 7 && perfectTests >= 1", testStats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Met {
+		t.Fatal("rule should be met")
+	}
+	if len(result.Conditions) != 3 {
+		t.Fatalf("got %d conditions, want 3", len(result.Conditions))
+	}
+
+	missing := result.Missing()
+	if len(missing) != 2 || missing[0].Stat != "streak" || missing[1].Stat != "perfectTests" {
+		t.Fatalf("Missing() = %+v, want streak and perfectTests", missing)
+	}
+	if want := "streak is 3 (needs >= 7)"; missing[0].Message != want {
+		t.Fatalf("Message = %q, want %q", missing[0].Message, want)
+	}
+}
+
+func TestEvaluateGroups_ExprGroupItem(t *testing.T) {
+	expr := func(stat, value string) fexpr.Expr {
+		return fexpr.Expr{
+			Left:  fexpr.Token{Type: fexpr.TokenIdentifier, Literal: stat},
+			Op:    fexpr.SignGte,
+			Right: fexpr.Token{Type: fexpr.TokenNumber, Literal: value},
+		}
+	}
+
+	// streak >= 7 || (questionsCompleted >= 100), with the group held as a
+	// single ExprGroup rather than a slice
+	groups := []fexpr.ExprGroup{
+		{Join: fexpr.JoinAnd, Item: expr("streak", "7")},
+		{Join: fexpr.JoinOr, Item: fexpr.ExprGroup{Join: fexpr.JoinAnd, Item: expr("questionsCompleted", "100")}},
+	}
+
+	var conditions []RuleCondition
+	met, err := evaluateGroups(groups, testStats, &conditions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !met || len(conditions) != 2 {
+		t.Fatalf("met = %v with %d conditions, want true with 2", met, len(conditions))
+	}
+
+	if _, err := evaluateGroups([]fexpr.ExprGroup{{Item: "streak"}}, testStats, &conditions); err == nil {
+		t.Fatal("an unsupported item should fail")
+	}
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Daily challenge types
+const (
+	ChallengeQuestions  = "questions"
+	ChallengeCorrect    = "correct"
+	ChallengeCategory   = "category"
+	ChallengeTest       = "test"
+	ChallengeFlashcards = "flashcards"
+	ChallengeStreak     = "streak"
+)
+
+// DailyChallengesPerDay is how many challenges each local day has
+const DailyChallengesPerDay = 3
+
+// ChallengeTemplate is a kind of daily challenge and the targets it can have
+type ChallengeTemplate struct {
+	Type     string
+	Category string // For ChallengeCategory
+	Targets  []int
+	XPReward int
+}
+
+// ChallengeTemplates must stay in step with CHALLENGE_TEMPLATES in the
+// client, which picks the same challenges to show
+var ChallengeTemplates = []ChallengeTemplate{
+	{Type: ChallengeQuestions, Targets: []int{10, 15, 20, 25}, XPReward: 100},
+	{Type: ChallengeCorrect, Targets: []int{5, 8, 10, 15}, XPReward: 120},
+	{Type: ChallengeCategory, Category: "Road Signs & Signals", Targets: []int{5, 8, 10}, XPReward: 100},
+	{Type: ChallengeTest, Targets: []int{1}, XPReward: 150},
+	{Type: ChallengeFlashcards, Targets: []int{10, 15, 20}, XPReward: 80},
+	{Type: ChallengeStreak, Targets: []int{1}, XPReward: 50},
+}
+
+// DailyChallenge is one challenge on one local day. Its ID is unique to the
+// day, so it doubles as the reference of the XP it pays.
+type DailyChallenge struct {
+	ID       string
+	Type     string
+	Category string
+	Target   int
+	XPReward int
+}
+
+// ChallengeActivity is what a user has done so far on a local day
+type ChallengeActivity struct {
+	Questions  int
+	Correct    int
+	ByCategory map[string]int
+	Tests      int
+	Flashcards int
+	LoggedIn   bool
+}
+
+// Progress returns how far the activity goes towards the challenge, capped
+// at its target
+func (c DailyChallenge) Progress(activity ChallengeActivity) int {
+	var done int
+	switch c.Type {
+	case ChallengeQuestions:
+		done = activity.Questions
+	case ChallengeCorrect:
+		done = activity.Correct
+	case ChallengeCategory:
+		done = activity.ByCategory[c.Category]
+	case ChallengeTest:
+		done = activity.Tests
+	case ChallengeFlashcards:
+		done = activity.Flashcards
+	case ChallengeStreak:
+		if activity.LoggedIn {
+			done = 1
+		}
+	}
+	return min(done, c.Target)
+}
+
+// Completed reports whether the activity meets the challenge's target
+func (c DailyChallenge) Completed(activity ChallengeActivity) bool {
+	return c.Progress(activity) >= c.Target
+}
+
+// DailyChallengesFor returns the challenges for a local date (LocalDateLayout).
+// The date seeds the pick the same way generateDailyChallenges does in the
+// client, down to its Math.sin-based random numbers.
+func DailyChallengesFor(date string) []DailyChallenge {
+	seed := 0
+	for _, part := range strings.Split(date, "-") {
+		n, _ := strconv.Atoi(part)
+		seed += n
+	}
+	random := func(index int) float64 {
+		x := math.Sin(float64(seed+index)) * 10000
+		return x - math.Floor(x)
+	}
+
+	challenges := make([]DailyChallenge, 0, DailyChallengesPerDay)
+	used := map[string]bool{}
+
+	for i := 0; i < DailyChallengesPerDay; i++ {
+		template := ChallengeTemplates[int(random(i)*float64(len(ChallengeTemplates)))]
+		if used[template.Type] {
+			continue
+		}
+		used[template.Type] = true
+
+		target := template.Targets[int(random(i+10)*float64(len(template.Targets)))]
+		challenges = append(challenges, newDailyChallenge(fmt.Sprintf("%s-%s-%d", date, template.Type, i), template, target))
+	}
+
+	// Top up with the first templates when the pick repeated itself
+	for len(challenges) < DailyChallengesPerDay {
+		template := ChallengeTemplates[len(challenges)]
+		challenges = append(challenges, newDailyChallenge(fmt.Sprintf("%s-fallback-%d", date, len(challenges)), template, template.Targets[0]))
+	}
+
+	return challenges
+}
+
+func newDailyChallenge(id string, template ChallengeTemplate, target int) DailyChallenge {
+	return DailyChallenge{
+		ID:       id,
+		Type:     template.Type,
+		Category: template.Category,
+		Target:   target,
+		XPReward: template.XPReward,
+	}
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDailyChallengesFor(t *testing.T) {
+	// Expected picks come from generateDailyChallenges in the client
+	cases := []struct {
+		date string
+		want []string
+	}{
+		{"2026-01-01", []string{"2026-01-01-streak-0", "2026-01-01-category-1", "2026-01-01-correct-2"}},
+		{"2026-01-02", []string{"2026-01-02-category-0", "2026-01-02-correct-1", "2026-01-02-questions-2"}},
+		{"2026-01-06", []string{"2026-01-06-correct-0", "2026-01-06-flashcards-1", "2026-01-06-fallback-2"}},
+		{"2026-01-07", []string{"2026-01-07-flashcards-0", "2026-01-07-correct-2", "2026-01-07-fallback-2"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.date, func(t *testing.T) {
+			var got []string
+			for _, challenge := range DailyChallengesFor(c.date) {
+				got = append(got, challenge.ID)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("DailyChallengesFor(%q) = %v, want %v", c.date, got, c.want)
+			}
+		})
+	}
+}
+
+func TestDailyChallengesFor_Targets(t *testing.T) {
+	challenges := DailyChallengesFor("2026-01-06")
+	want := []DailyChallenge{
+		{ID: "2026-01-06-correct-0", Type: ChallengeCorrect, Target: 5, XPReward: 120},
+		{ID: "2026-01-06-flashcards-1", Type: ChallengeFlashcards, Target: 20, XPReward: 80},
+		{ID: "2026-01-06-fallback-2", Type: ChallengeCategory, Category: "Road Signs & Signals", Target: 5, XPReward: 100},
+	}
+	if !reflect.DeepEqual(challenges, want) {
+		t.Fatalf("DailyChallengesFor = %+v, want %+v", challenges, want)
+	}
+}
+
+func TestDailyChallenge_Completed(t *testing.T) {
+	activity := ChallengeActivity{
+		Questions:  12,
+		Correct:    7,
+		ByCategory: map[string]int{"Road Signs & Signals": 5, "Rules of the Road": 7},
+		Tests:      0,
+		Flashcards: 20,
+		LoggedIn:   true,
+	}
+
+	cases := []struct {
+		name      string
+		challenge DailyChallenge
+		progress  int
+		completed bool
+	}{
+		{"questions met", DailyChallenge{Type: ChallengeQuestions, Target: 10}, 10, true},
+		{"questions short", DailyChallenge{Type: ChallengeQuestions, Target: 15}, 12, false},
+		{"correct short", DailyChallenge{Type: ChallengeCorrect, Target: 8}, 7, false},
+		{"category counts its category only", DailyChallenge{Type: ChallengeCategory, Category: "Road Signs & Signals", Target: 8}, 5, false},
+		{"category met", DailyChallenge{Type: ChallengeCategory, Category: "Road Signs & Signals", Target: 5}, 5, true},
+		{"no test yet", DailyChallenge{Type: ChallengeTest, Target: 1}, 0, false},
+		{"flashcards met", DailyChallenge{Type: ChallengeFlashcards, Target: 20}, 20, true},
+		{"streak met by logging in", DailyChallenge{Type: ChallengeStreak, Target: 1}, 1, true},
+		{"unknown type never completes", DailyChallenge{Type: "bogus", Target: 1}, 0, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.challenge.Progress(activity); got != c.progress {
+				t.Errorf("Progress = %d, want %d", got, c.progress)
+			}
+			if got := c.challenge.Completed(activity); got != c.completed {
+				t.Errorf("Completed = %v, want %v", got, c.completed)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Display names appear on public leaderboards, so they must not contain
+// contact details or profanity. Names are checked when saved; names saved
+// before the filter existed are checked again when shown and replaced by a
+// pseudonym if they fail.
+
+var (
+	ErrDisplayNameEmail     = errors.New("display name can't contain an email address")
+	ErrDisplayNamePhone     = errors.New("display name can't contain a phone number")
+	ErrDisplayNameURL       = errors.New("display name can't contain a link")
+	ErrDisplayNameProfanity = errors.New("display name contains inappropriate language")
+)
+
+var (
+	// Also catches "name at example dot com" style obfuscation
+	emailPattern = regexp.MustCompile(`(?i)[a-z0-9._%+-]+\s*(@|\(at\)|\[at\]|\sat\s)\s*[a-z0-9-]+(\s*(\.|\(dot\)|\[dot\]|\sdot\s)\s*[a-z0-9-]+)+`)
+	// Runs of digits with common phone separators; checked for 7+ digits below
+	phonePattern = regexp.MustCompile(`\+?\d[\d\s().-]*\d`)
+	urlPattern   = regexp.MustCompile(`(?i)(https?://|www\.)\S+|\b[a-z0-9-]+\.(com|net|org|ca|io|gg)\b`)
+)
+
+// phoneMinDigits is the fewest digits treated as a phone number (a local
+// number without area code), so "Driver 2007" stays allowed
+const phoneMinDigits = 7
+
+// profaneWords are rejected as whole words, after undoing common character
+// substitutions ("sh1t") and joining spelled-out letters ("s h i t").
+// Words that are also given names or surnames (Dick, Cock) are left out.
+var profaneWords = map[string]bool{
+	"ass": true, "asshole": true, "bastard": true, "bitch": true, "bollocks": true,
+	"cunt": true, "fag": true, "faggot": true, "fuck": true, "fucker": true,
+	"fucking": true, "motherfucker": true, "nigga": true, "nigger": true, "piss": true,
+	"pussy": true, "retard": true, "shit": true, "slut": true, "twat": true,
+	"whore": true, "wanker": true,
+}
+
+// profaneStems are rejected anywhere in the name, even inside other words.
+// Only stems that don't occur in real names belong here: "shit" is in
+// Yamashita and "cunt" in Scunthorpe, so those are whole-word checks only.
+var profaneStems = []string{"fuck", "motherf"}
+
+var leetReplacer = strings.NewReplacer(
+	"0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "8", "b",
+	"@", "a", "$", "s", "!", "i", "|", "l", "€", "e",
+)
+
+// ModerateDisplayName returns an error describing why a display name can't
+// be shown publicly, or nil if it is fine
+func ModerateDisplayName(name string) error {
+	if emailPattern.MatchString(name) {
+		return ErrDisplayNameEmail
+	}
+
+	for _, match := range phonePattern.FindAllString(name, -1) {
+		digits := 0
+		for _, r := range match {
+			if unicode.IsDigit(r) {
+				digits++
+			}
+		}
+		if digits >= phoneMinDigits {
+			return ErrDisplayNamePhone
+		}
+	}
+
+	if urlPattern.MatchString(name) {
+		return ErrDisplayNameURL
+	}
+
+	normalized := leetReplacer.Replace(strings.ToLower(name))
+
+	words := strings.FieldsFunc(normalized, func(r rune) bool { return !unicode.IsLetter(r) })
+
+	// Runs of single letters are joined back into a word ("s h i t")
+	spelled := ""
+	for _, word := range append(words, "") {
+		if len([]rune(word)) == 1 {
+			spelled += word
+			continue
+		}
+		if profaneWords[word] || profaneWords[spelled] {
+			return ErrDisplayNameProfanity
+		}
+		spelled = ""
+	}
+
+	collapsed := strings.Join(words, "")
+	for _, stem := range profaneStems {
+		if strings.Contains(collapsed, stem) {
+			return ErrDisplayNameProfanity
+		}
+	}
+
+	return nil
+}
+
+// pseudonymAlphabet has no vowels, and no digits that read as vowels, so a
+// pseudonym can't spell a word the filter rejects or look like a phone number
+const pseudonymAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// pseudonymLength gives 20^10 (about 1e13) pseudonyms, so even among a
+// million learners two sharing one is unlikely
+const pseudonymLength = 10
+
+// Pseudonym returns a stable, anonymous display name for a user, such as
+// "Learner #KTRBQ-ZXDMN", from the user's secret pseudonym key. Deriving it
+// from anything public, like the user ID, would let anyone link it back.
+func Pseudonym(key string) string {
+	sum := sha256.Sum256([]byte("leaderboard-pseudonym:" + key))
+	n := binary.BigEndian.Uint64(sum[:8])
+
+	var b strings.Builder
+	b.WriteString("Learner #")
+	for i := 0; i < pseudonymLength; i++ {
+		if i == pseudonymLength/2 {
+			b.WriteByte('-')
+		}
+		b.WriteByte(pseudonymAlphabet[n%uint64(len(pseudonymAlphabet))])
+		n /= uint64(len(pseudonymAlphabet))
+	}
+	return b.String()
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+)
+
+func TestModerateDisplayName(t *testing.T) {
+	cases := []struct {
+		name        string
+		displayName string
+		want        error
+	}{
+		{"plain name", "Jane Doe", nil},
+		{"hyphen and apostrophe", "Anne-Marie O'Neil", nil},
+		{"accented letters", "Zoë Brontë", nil},
+		{"year", "Driver 2007", nil},
+		{"six digits", "Class 123456", nil},
+		{"letters between digits", "R2D2", nil},
+		{"spelled-out initials", "J R R Tolkien", nil},
+
+		{"email", "jane.doe@example.com", ErrDisplayNameEmail},
+		{"email with spaces", "jane @ example . com", ErrDisplayNameEmail},
+		{"email spelled out", "jane at gmail dot com", ErrDisplayNameEmail},
+		{"email with bracketed at", "jane[at]gmail[dot]com", ErrDisplayNameEmail},
+
+		{"local phone number", "Call 555-1234", ErrDisplayNamePhone},
+		{"phone number with area code", "Jane 416 555 0199", ErrDisplayNamePhone},
+		{"international phone number", "+1 (416) 555-0199", ErrDisplayNamePhone},
+		{"run of digits", "Jane 4165550199", ErrDisplayNamePhone},
+
+		{"link", "https://example.com/me", ErrDisplayNameURL},
+		{"www link", "www.example.org", ErrDisplayNameURL},
+		{"bare domain", "follow janedrives.ca", ErrDisplayNameURL},
+
+		{"profanity", "Shit Driver", ErrDisplayNameProfanity},
+		{"profanity in capitals", "BITCH", ErrDisplayNameProfanity},
+		{"leetspeak", "sh1t happens", ErrDisplayNameProfanity},
+		{"symbol substitutions", "@$$hole", ErrDisplayNameProfanity},
+		{"spelled out with spaces", "s h i t", ErrDisplayNameProfanity},
+		{"spelled out with dots", "F.U.C.K", ErrDisplayNameProfanity},
+		{"stem inside a word", "Fuckface", ErrDisplayNameProfanity},
+		{"stem split by punctuation", "mother-fucker", ErrDisplayNameProfanity},
+
+		// Names that contain profane words but aren't profane
+		{"Scunthorpe", "Scunthorpe Sam", nil},
+		{"Yamashita", "Ken Yamashita", nil},
+		{"Dick as a given name", "Dick Smith", nil},
+		{"ass inside a word", "Cassandra Bass", nil},
+		{"Essex", "Essex Driver", nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := ModerateDisplayName(c.displayName); !errors.Is(got, c.want) {
+				t.Fatalf("ModerateDisplayName(%q) = %v, want %v", c.displayName, got, c.want)
+			}
+		})
+	}
+}
+
+func TestPseudonym(t *testing.T) {
+	a, b := Pseudonym("key_a"), Pseudonym("key_b")
+
+	if !regexp.MustCompile(`^Learner #[A-Z]{5}-[A-Z]{5}$`).MatchString(a) {
+		t.Fatalf("Pseudonym = %q, want Learner #XXXXX-XXXXX", a)
+	}
+	if Pseudonym("key_a") != a {
+		t.Fatal("Pseudonym should be stable for a key")
+	}
+	if a == b {
+		t.Fatalf("keys a and b both got %q", a)
+	}
+
+	// Collisions are rare on a busy board, and no pseudonym is moderated away
+	seen := map[string]string{}
+	for i := 0; i < 100000; i++ {
+		key := fmt.Sprintf("key%09d", i)
+		name := Pseudonym(key)
+		if other, ok := seen[name]; ok {
+			t.Fatalf("keys %s and %s both got %q", other, key, name)
+		}
+		seen[name] = key
+		if i < 10000 {
+			if err := ModerateDisplayName(name); err != nil {
+				t.Fatalf("Pseudonym %q fails moderation: %v", name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+// The offline answer log is an append-only list of answers a device gives
+// while offline. Each entry carries the MAC of the entry before it and its
+// own MAC over both, keyed with a secret only the device and the server
+// know, so entries can't be edited, dropped, reordered or made up without
+// breaking the chain from that point on.
+
+// OfflineLogEntry is one answer in an offline answer log
+type OfflineLogEntry struct {
+	Seq            int    `json:"seq"` // Position in the log, from 1
+	QuestionID     string `json:"questionId"`
+	SelectedAnswer int    `json:"selectedAnswer"`
+	TimeSpent      int    `json:"timeSpent"`  // milliseconds
+	AnsweredAt     int64  `json:"answeredAt"` // unix ms, device clock
+	Prev           string `json:"prev"`       // MAC of the previous entry, empty for the first
+	MAC            string `json:"mac"`
+}
+
+// ComputeMAC returns the entry's MAC under key, as base64url HMAC-SHA256
+// over its fields joined with "|"
+func (e OfflineLogEntry) ComputeMAC(key []byte) string {
+	h := hmac.New(sha256.New, key)
+	fmt.Fprintf(h, "%d|%s|%d|%d|%d|%s", e.Seq, e.QuestionID, e.SelectedAnswer, e.TimeSpent, e.AnsweredAt, e.Prev)
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// VerifyMAC reports whether the entry's MAC is valid under key
+func (e OfflineLogEntry) VerifyMAC(key []byte) bool {
+	return hmac.Equal([]byte(e.MAC), []byte(e.ComputeMAC(key)))
+}
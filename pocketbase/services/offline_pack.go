@@ -0,0 +1,43 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+)
+
+// OfflinePackFormat is the version of the offline content pack layout
+const OfflinePackFormat = 1
+
+// SealOfflinePack encrypts a content pack with AES-256-GCM under key,
+// authenticating aad alongside it. It returns the nonce and ciphertext.
+func SealOfflinePack(key, plaintext, aad []byte) (nonce, ciphertext []byte, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nonce = make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, err
+	}
+
+	return nonce, gcm.Seal(nil, nonce, plaintext, aad), nil
+}
+
+// OfflinePackDigest is the integrity hash of a sealed pack as recorded in its
+// signed metadata: base64url SHA-256 over nonce then ciphertext
+func OfflinePackDigest(nonce, ciphertext []byte) string {
+	h := sha256.New()
+	h.Write(nonce)
+	h.Write(ciphertext)
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
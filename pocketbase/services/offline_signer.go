@@ -0,0 +1,217 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Offline tokens are compact JWS (RFC 7515) signed with Ed25519 ("EdDSA").
+// The signing key comes from OFFLINE_SIGNING_KEY, a base64 Ed25519 seed.
+// Public keys that retired signing keys used can be listed in
+// OFFLINE_VERIFY_KEYS (comma-separated, base64) so their tokens stay valid
+// until they expire. Each key is identified by a key ID derived from the
+// public key, which clients use to pick the key to verify with. The same
+// keys sign content pack metadata; the "typ" header tells the two apart so
+// one can't be passed off as the other.
+
+const (
+	OfflineTokenType = "offline+jwt"      // typ of offline tokens
+	OfflinePackType  = "offline-pack+jwt" // typ of offline content pack metadata
+)
+
+var (
+	ErrOfflineKeyMissing   = errors.New("OFFLINE_SIGNING_KEY is not set; generate one with the \"offline keygen\" command")
+	ErrOfflineKeyInvalid   = errors.New("invalid offline signing key: must be a base64 Ed25519 seed (32 bytes)")
+	ErrOfflineTokenInvalid = errors.New("invalid offline token")
+)
+
+// JWK is an Ed25519 public key in JSON Web Key form (RFC 8037)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Active    bool   `json:"active"` // Whether new tokens are signed with this key
+}
+
+// jwsHeader is the protected header of an offline token
+type jwsHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+// OfflineSigner signs and verifies offline tokens
+type OfflineSigner struct {
+	seed       []byte
+	privateKey ed25519.PrivateKey
+	keyID      string
+	publicKeys map[string]ed25519.PublicKey
+}
+
+// NewOfflineSigner creates the offline token signer from OFFLINE_SIGNING_KEY
+// and OFFLINE_VERIFY_KEYS. Unlike encryption there is no passthrough mode:
+// without a key, offline tokens can't be issued.
+func NewOfflineSigner() (*OfflineSigner, error) {
+	encoded := strings.TrimSpace(os.Getenv("OFFLINE_SIGNING_KEY"))
+	if encoded == "" {
+		return nil, ErrOfflineKeyMissing
+	}
+
+	seed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, ErrOfflineKeyInvalid
+	}
+
+	privateKey := ed25519.NewKeyFromSeed(seed)
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+
+	s := &OfflineSigner{
+		seed:       seed,
+		privateKey: privateKey,
+		keyID:      OfflineKeyID(publicKey),
+		publicKeys: map[string]ed25519.PublicKey{},
+	}
+	s.publicKeys[s.keyID] = publicKey
+
+	for _, encoded := range strings.Split(os.Getenv("OFFLINE_VERIFY_KEYS"), ",") {
+		encoded = strings.TrimSpace(encoded)
+		if encoded == "" {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid key in OFFLINE_VERIFY_KEYS: must be a base64 Ed25519 public key (32 bytes)")
+		}
+		s.publicKeys[OfflineKeyID(key)] = ed25519.PublicKey(key)
+	}
+
+	return s, nil
+}
+
+// GenerateOfflineSigningKey returns a new base64 Ed25519 seed, its base64
+// public key and the key ID
+func GenerateOfflineSigningKey() (seed, publicKey, keyID string, err error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(private.Seed()), base64.StdEncoding.EncodeToString(public), OfflineKeyID(public), nil
+}
+
+// OfflineKeyID derives the key ID of a public key
+func OfflineKeyID(publicKey []byte) string {
+	sum := sha256.Sum256(publicKey)
+	return base64.RawURLEncoding.EncodeToString(sum[:8])
+}
+
+// KeyID returns the ID of the key new tokens are signed with
+func (s *OfflineSigner) KeyID() string {
+	return s.keyID
+}
+
+// Sign encodes claims as a compact JWS of type typ signed with the active key
+func (s *OfflineSigner) Sign(typ string, claims any) (string, error) {
+	header, err := json.Marshal(jwsHeader{Algorithm: "EdDSA", Type: typ, KeyID: s.keyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature := ed25519.Sign(s.privateKey, []byte(signingInput))
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Verify checks a compact JWS of type typ against the known keys and decodes
+// its claims. Expiry is left to the caller.
+func (s *OfflineSigner) Verify(typ, token string, claims any) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrOfflineTokenInvalid
+	}
+
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return ErrOfflineTokenInvalid
+	}
+	var header jwsHeader
+	if err := json.Unmarshal(headerBytes, &header); err != nil || header.Algorithm != "EdDSA" || header.Type != typ {
+		return ErrOfflineTokenInvalid
+	}
+
+	publicKey, ok := s.publicKeys[header.KeyID]
+	if !ok {
+		return ErrOfflineTokenInvalid
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !ed25519.Verify(publicKey, []byte(parts[0]+"."+parts[1]), signature) {
+		return ErrOfflineTokenInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ErrOfflineTokenInvalid
+	}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return ErrOfflineTokenInvalid
+	}
+
+	return nil
+}
+
+// PublicKeys returns every key tokens can be verified with, active key first
+func (s *OfflineSigner) PublicKeys() []JWK {
+	keys := []JWK{newJWK(s.keyID, s.publicKeys[s.keyID], true)}
+	for kid, key := range s.publicKeys {
+		if kid != s.keyID {
+			keys = append(keys, newJWK(kid, key, false))
+		}
+	}
+	return keys
+}
+
+// DeriveKey derives a 32-byte secret for purpose from the signing key. The
+// result changes when the signing key is rotated, so it only serves tokens
+// issued before each token got a key seed of its own.
+func (s *OfflineSigner) DeriveKey(purpose string, parts ...string) []byte {
+	return DeriveOfflineKey(s.seed, purpose, parts...)
+}
+
+// DeriveOfflineKey derives a 32-byte secret for purpose from secret
+func DeriveOfflineKey(secret []byte, purpose string, parts ...string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(purpose))
+	for _, part := range parts {
+		h.Write([]byte{0})
+		h.Write([]byte(part))
+	}
+	return h.Sum(nil)
+}
+
+func newJWK(kid string, key ed25519.PublicKey, active bool) JWK {
+	return JWK{
+		KeyType:   "OKP",
+		Curve:     "Ed25519",
+		X:         base64.RawURLEncoding.EncodeToString(key),
+		KeyID:     kid,
+		Use:       "sig",
+		Algorithm: "EdDSA",
+		Active:    active,
+	}
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newTestOfflineSigner(t *testing.T) *OfflineSigner {
+	t.Helper()
+
+	seed, _, _, err := GenerateOfflineSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("OFFLINE_SIGNING_KEY", seed)
+	t.Setenv("OFFLINE_VERIFY_KEYS", "")
+
+	signer, err := NewOfflineSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func TestOfflineSignerTypes(t *testing.T) {
+	signer := newTestOfflineSigner(t)
+
+	type claims struct {
+		Subject string `json:"sub"`
+	}
+
+	token, err := signer.Sign(OfflineTokenType, claims{Subject: "user_a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pack, err := signer.Sign(OfflinePackType, claims{Subject: "user_a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := signer.Sign(OfflineTokenType, claims{Subject: "user_b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// user_b's claims under user_a's signature
+	parts, otherParts := strings.Split(token, "."), strings.Split(other, ".")
+	tampered := parts[0] + "." + otherParts[1] + "." + parts[2]
+
+	cases := []struct {
+		name  string
+		typ   string
+		token string
+		want  error
+	}{
+		{"token as token", OfflineTokenType, token, nil},
+		{"pack as pack", OfflinePackType, pack, nil},
+		{"pack as token", OfflineTokenType, pack, ErrOfflineTokenInvalid},
+		{"token as pack", OfflinePackType, token, ErrOfflineTokenInvalid},
+		{"tampered token", OfflineTokenType, tampered, ErrOfflineTokenInvalid},
+		{"not a JWS", OfflineTokenType, "not.a.token", ErrOfflineTokenInvalid},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var got claims
+			if err := signer.Verify(c.typ, c.token, &got); !errors.Is(err, c.want) {
+				t.Fatalf("Verify = %v, want %v", err, c.want)
+			}
+			if c.want == nil && got.Subject != "user_a" {
+				t.Fatalf("sub = %q, want user_a", got.Subject)
+			}
+		})
+	}
+}
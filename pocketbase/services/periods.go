@@ -0,0 +1,125 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Leaderboard period types
+const (
+	PeriodWeekly  = "weekly"
+	PeriodMonthly = "monthly"
+	PeriodAllTime = "allTime"
+)
+
+// AllTimePeriodKey is the key of the single all-time period
+const AllTimePeriodKey = "all"
+
+var ErrInvalidPeriod = errors.New("invalid leaderboard period")
+
+// Period is a leaderboard time window [Start, End). Weekly periods are ISO
+// weeks starting Monday ("2026-W07"), monthly periods are calendar months
+// ("2026-02"). The all-time period has zero Start and End.
+type Period struct {
+	Type  string
+	Key   string
+	Start time.Time
+	End   time.Time
+}
+
+// IsAllTime reports whether the period is unbounded
+func (p Period) IsAllTime() bool {
+	return p.Type == PeriodAllTime
+}
+
+// Contains reports whether t falls inside the period
+func (p Period) Contains(t time.Time) bool {
+	if p.IsAllTime() {
+		return true
+	}
+	return !t.Before(p.Start) && t.Before(p.End)
+}
+
+// CurrentPeriod returns the period of the given type containing now.
+// Boundaries are local midnights in loc.
+func CurrentPeriod(periodType string, now time.Time, loc *time.Location) (Period, error) {
+	local := now.In(loc)
+	switch periodType {
+	case PeriodWeekly:
+		// Monday of the current ISO week
+		offset := (int(local.Weekday()) + 6) % 7
+		start := time.Date(local.Year(), local.Month(), local.Day()-offset, 0, 0, 0, 0, loc)
+		return weekPeriod(start, loc), nil
+	case PeriodMonthly:
+		start := time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, loc)
+		return monthPeriod(start, loc), nil
+	case PeriodAllTime:
+		return Period{Type: PeriodAllTime, Key: AllTimePeriodKey}, nil
+	}
+	return Period{}, ErrInvalidPeriod
+}
+
+// PreviousPeriod returns the period immediately before p
+func PreviousPeriod(p Period, loc *time.Location) (Period, error) {
+	switch p.Type {
+	case PeriodWeekly:
+		s := p.Start.In(loc)
+		return weekPeriod(time.Date(s.Year(), s.Month(), s.Day()-7, 0, 0, 0, 0, loc), loc), nil
+	case PeriodMonthly:
+		s := p.Start.In(loc)
+		return monthPeriod(time.Date(s.Year(), s.Month()-1, 1, 0, 0, 0, 0, loc), loc), nil
+	}
+	return Period{}, ErrInvalidPeriod
+}
+
+// ParsePeriod resolves a period key ("2026-W07", "2026-02" or "all")
+func ParsePeriod(periodType, key string, loc *time.Location) (Period, error) {
+	switch periodType {
+	case PeriodWeekly:
+		var year, week int
+		if _, err := fmt.Sscanf(key, "%d-W%d", &year, &week); err != nil || week < 1 || week > 53 {
+			return Period{}, ErrInvalidPeriod
+		}
+		// ISO week 1 is the week containing January 4th
+		jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, loc)
+		offset := (int(jan4.Weekday()) + 6) % 7
+		start := time.Date(year, time.January, 4-offset+(week-1)*7, 0, 0, 0, 0, loc)
+		p := weekPeriod(start, loc)
+		if p.Key != key {
+			return Period{}, ErrInvalidPeriod // e.g. week 53 of a 52-week year
+		}
+		return p, nil
+	case PeriodMonthly:
+		t, err := time.ParseInLocation("2006-01", key, loc)
+		if err != nil {
+			return Period{}, ErrInvalidPeriod
+		}
+		return monthPeriod(t, loc), nil
+	case PeriodAllTime:
+		if key != AllTimePeriodKey && key != "" {
+			return Period{}, ErrInvalidPeriod
+		}
+		return Period{Type: PeriodAllTime, Key: AllTimePeriodKey}, nil
+	}
+	return Period{}, ErrInvalidPeriod
+}
+
+func weekPeriod(start time.Time, loc *time.Location) Period {
+	year, week := start.ISOWeek()
+	return Period{
+		Type:  PeriodWeekly,
+		Key:   fmt.Sprintf("%d-W%02d", year, week),
+		Start: start,
+		End:   time.Date(start.Year(), start.Month(), start.Day()+7, 0, 0, 0, 0, loc),
+	}
+}
+
+func monthPeriod(start time.Time, loc *time.Location) Period {
+	return Period{
+		Type:  PeriodMonthly,
+		Key:   start.Format("2006-01"),
+		Start: start,
+		End:   time.Date(start.Year(), start.Month()+1, 1, 0, 0, 0, 0, loc),
+	}
+}
@@ -0,0 +1,252 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCurrentPeriod(t *testing.T) {
+	toronto := mustLoadLocation(t, "America/Toronto")
+
+	cases := []struct {
+		name       string
+		periodType string
+		now        time.Time
+		loc        *time.Location
+		wantKey    string
+		wantStart  time.Time
+		wantEnd    time.Time
+	}{
+		{
+			name:       "mid-week",
+			periodType: PeriodWeekly,
+			now:        time.Date(2026, 2, 12, 15, 0, 0, 0, time.UTC), // Thursday
+			loc:        time.UTC,
+			wantKey:    "2026-W07",
+			wantStart:  time.Date(2026, 2, 9, 0, 0, 0, 0, time.UTC),
+			wantEnd:    time.Date(2026, 2, 16, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "Sunday belongs to the week before",
+			periodType: PeriodWeekly,
+			now:        time.Date(2026, 2, 15, 23, 0, 0, 0, time.UTC),
+			loc:        time.UTC,
+			wantKey:    "2026-W07",
+			wantStart:  time.Date(2026, 2, 9, 0, 0, 0, 0, time.UTC),
+			wantEnd:    time.Date(2026, 2, 16, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "week 1 starts in the previous year",
+			periodType: PeriodWeekly,
+			now:        time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC), // Thursday
+			loc:        time.UTC,
+			wantKey:    "2026-W01",
+			wantStart:  time.Date(2025, 12, 29, 0, 0, 0, 0, time.UTC),
+			wantEnd:    time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "new year's day in week 53",
+			periodType: PeriodWeekly,
+			now:        time.Date(2027, 1, 1, 12, 0, 0, 0, time.UTC), // Friday
+			loc:        time.UTC,
+			wantKey:    "2026-W53",
+			wantStart:  time.Date(2026, 12, 28, 0, 0, 0, 0, time.UTC),
+			wantEnd:    time.Date(2027, 1, 4, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "late December in next year's week 1",
+			periodType: PeriodWeekly,
+			now:        time.Date(2024, 12, 31, 12, 0, 0, 0, time.UTC), // Tuesday
+			loc:        time.UTC,
+			wantKey:    "2025-W01",
+			wantStart:  time.Date(2024, 12, 30, 0, 0, 0, 0, time.UTC),
+			wantEnd:    time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "still Sunday in Toronto, already Monday in UTC",
+			periodType: PeriodWeekly,
+			now:        time.Date(2026, 2, 16, 3, 0, 0, 0, time.UTC),
+			loc:        toronto,
+			wantKey:    "2026-W07",
+			wantStart:  time.Date(2026, 2, 9, 5, 0, 0, 0, time.UTC),
+			wantEnd:    time.Date(2026, 2, 16, 5, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "Toronto week with spring-forward is 167 hours",
+			periodType: PeriodWeekly,
+			now:        time.Date(2026, 3, 8, 12, 0, 0, 0, toronto),
+			loc:        toronto,
+			wantKey:    "2026-W10",
+			wantStart:  time.Date(2026, 3, 2, 5, 0, 0, 0, time.UTC),
+			wantEnd:    time.Date(2026, 3, 9, 4, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "month",
+			periodType: PeriodMonthly,
+			now:        time.Date(2026, 2, 12, 15, 0, 0, 0, time.UTC),
+			loc:        time.UTC,
+			wantKey:    "2026-02",
+			wantStart:  time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC),
+			wantEnd:    time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "December ends in the next year",
+			periodType: PeriodMonthly,
+			now:        time.Date(2026, 12, 31, 12, 0, 0, 0, time.UTC),
+			loc:        time.UTC,
+			wantKey:    "2026-12",
+			wantStart:  time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC),
+			wantEnd:    time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "still the last of the month in Toronto",
+			periodType: PeriodMonthly,
+			now:        time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC),
+			loc:        toronto,
+			wantKey:    "2026-02",
+			wantStart:  time.Date(2026, 2, 1, 5, 0, 0, 0, time.UTC),
+			wantEnd:    time.Date(2026, 3, 1, 5, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p, err := CurrentPeriod(c.periodType, c.now, c.loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Key != c.wantKey || !p.Start.Equal(c.wantStart) || !p.End.Equal(c.wantEnd) {
+				t.Fatalf("CurrentPeriod = %s [%v, %v), want %s [%v, %v)",
+					p.Key, p.Start.UTC(), p.End.UTC(), c.wantKey, c.wantStart, c.wantEnd)
+			}
+			if !p.Contains(c.now) {
+				t.Fatalf("period %s doesn't contain %v", p.Key, c.now)
+			}
+		})
+	}
+}
+
+func TestCurrentPeriod_AllTime(t *testing.T) {
+	p, err := CurrentPeriod(PeriodAllTime, time.Now(), time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.IsAllTime() || p.Key != AllTimePeriodKey || !p.Contains(time.Time{}) {
+		t.Fatalf("CurrentPeriod(allTime) = %+v", p)
+	}
+
+	if _, err := CurrentPeriod("daily", time.Now(), time.UTC); !errors.Is(err, ErrInvalidPeriod) {
+		t.Fatalf("CurrentPeriod(daily) error = %v, want ErrInvalidPeriod", err)
+	}
+}
+
+func TestParsePeriod(t *testing.T) {
+	toronto := mustLoadLocation(t, "America/Toronto")
+
+	cases := []struct {
+		name       string
+		periodType string
+		key        string
+		loc        *time.Location
+		wantKey    string // Empty when the key should be rejected
+		wantStart  time.Time
+	}{
+		{"week", PeriodWeekly, "2026-W07", time.UTC, "2026-W07", time.Date(2026, 2, 9, 0, 0, 0, 0, time.UTC)},
+		{"week 1 starting in December", PeriodWeekly, "2026-W01", time.UTC, "2026-W01", time.Date(2025, 12, 29, 0, 0, 0, 0, time.UTC)},
+		{"week 1 starting on January 4th", PeriodWeekly, "2016-W01", time.UTC, "2016-W01", time.Date(2016, 1, 4, 0, 0, 0, 0, time.UTC)},
+		{"week 53 of a long year", PeriodWeekly, "2026-W53", time.UTC, "2026-W53", time.Date(2026, 12, 28, 0, 0, 0, 0, time.UTC)},
+		{"week 53 of 2020", PeriodWeekly, "2020-W53", time.UTC, "2020-W53", time.Date(2020, 12, 28, 0, 0, 0, 0, time.UTC)},
+		{"week in Toronto", PeriodWeekly, "2026-W07", toronto, "2026-W07", time.Date(2026, 2, 9, 5, 0, 0, 0, time.UTC)},
+		{"week 53 of a short year", PeriodWeekly, "2025-W53", time.UTC, "", time.Time{}},
+		{"week 0", PeriodWeekly, "2026-W00", time.UTC, "", time.Time{}},
+		{"week 54", PeriodWeekly, "2026-W54", time.UTC, "", time.Time{}},
+		{"unpadded week", PeriodWeekly, "2026-W7", time.UTC, "", time.Time{}},
+		{"month key as a week", PeriodWeekly, "2026-02", time.UTC, "", time.Time{}},
+		{"month", PeriodMonthly, "2026-02", time.UTC, "2026-02", time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"month in Toronto", PeriodMonthly, "2026-02", toronto, "2026-02", time.Date(2026, 2, 1, 5, 0, 0, 0, time.UTC)},
+		{"month 13", PeriodMonthly, "2026-13", time.UTC, "", time.Time{}},
+		{"week key as a month", PeriodMonthly, "2026-W07", time.UTC, "", time.Time{}},
+		{"all", PeriodAllTime, "all", time.UTC, AllTimePeriodKey, time.Time{}},
+		{"empty all-time key", PeriodAllTime, "", time.UTC, AllTimePeriodKey, time.Time{}},
+		{"other all-time key", PeriodAllTime, "2026", time.UTC, "", time.Time{}},
+		{"unknown type", "daily", "2026-02-12", time.UTC, "", time.Time{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p, err := ParsePeriod(c.periodType, c.key, c.loc)
+			if c.wantKey == "" {
+				if !errors.Is(err, ErrInvalidPeriod) {
+					t.Fatalf("ParsePeriod(%s, %q) = %+v, %v, want ErrInvalidPeriod", c.periodType, c.key, p, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePeriod(%s, %q) error: %v", c.periodType, c.key, err)
+			}
+			if p.Key != c.wantKey || !p.Start.Equal(c.wantStart) {
+				t.Fatalf("ParsePeriod(%s, %q) = %s from %v, want %s from %v", c.periodType, c.key, p.Key, p.Start.UTC(), c.wantKey, c.wantStart)
+			}
+		})
+	}
+}
+
+func TestParsePeriod_RoundTrips(t *testing.T) {
+	// Every week and month of several years parses back to itself
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	for now.Year() < 2030 {
+		for _, periodType := range []string{PeriodWeekly, PeriodMonthly} {
+			want, err := CurrentPeriod(periodType, now, time.UTC)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ParsePeriod(periodType, want.Key, time.UTC)
+			if err != nil {
+				t.Fatalf("ParsePeriod(%s, %q) error: %v", periodType, want.Key, err)
+			}
+			if !got.Start.Equal(want.Start) || !got.End.Equal(want.End) {
+				t.Fatalf("ParsePeriod(%s, %q) = [%v, %v), want [%v, %v)", periodType, want.Key, got.Start, got.End, want.Start, want.End)
+			}
+		}
+		now = now.AddDate(0, 0, 1)
+	}
+}
+
+func TestPreviousPeriod(t *testing.T) {
+	cases := []struct {
+		name       string
+		periodType string
+		key        string
+		want       string
+	}{
+		{"week", PeriodWeekly, "2026-W07", "2026-W06"},
+		{"week 1 to the last week of a short year", PeriodWeekly, "2026-W01", "2025-W52"},
+		{"week 1 to week 53", PeriodWeekly, "2027-W01", "2026-W53"},
+		{"month", PeriodMonthly, "2026-02", "2026-01"},
+		{"January to December", PeriodMonthly, "2026-01", "2025-12"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p, err := ParsePeriod(c.periodType, c.key, time.UTC)
+			if err != nil {
+				t.Fatal(err)
+			}
+			prev, err := PreviousPeriod(p, time.UTC)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if prev.Key != c.want {
+				t.Fatalf("PreviousPeriod(%s) = %s, want %s", c.key, prev.Key, c.want)
+			}
+			if !prev.End.Equal(p.Start) {
+				t.Fatalf("PreviousPeriod(%s) ends at %v, want %v", c.key, prev.End, p.Start)
+			}
+		})
+	}
+
+	if _, err := PreviousPeriod(Period{Type: PeriodAllTime, Key: AllTimePeriodKey}, time.UTC); !errors.Is(err, ErrInvalidPeriod) {
+		t.Fatalf("PreviousPeriod(allTime) error = %v, want ErrInvalidPeriod", err)
+	}
+}
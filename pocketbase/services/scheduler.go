@@ -0,0 +1,109 @@
+package services
+
+import (
+	"math"
+	"time"
+)
+
+// SM-2 scheduler constants
+const (
+	DefaultEaseFactor = 2.5
+	MinEaseFactor     = 1.3
+	// RelearnDelay is how soon a missed question comes back
+	RelearnDelay = 10 * time.Minute
+	// MasteredIntervalDays is the interval from which a question counts as mastered
+	MasteredIntervalDays = 21
+)
+
+// Answer grades on the SM-2 0-5 scale
+const (
+	GradeIncorrect   = 1
+	GradeCorrectSlow = 3
+	GradeCorrect     = 4
+	GradeCorrectFast = 5
+)
+
+// Answer time thresholds (milliseconds) used to grade correct answers
+const (
+	FastAnswerTime = 8000
+	SlowAnswerTime = 20000
+)
+
+// ReviewState is the spaced-repetition state of one question for one user
+type ReviewState struct {
+	EaseFactor     float64
+	IntervalDays   float64
+	Repetitions    int
+	Lapses         int
+	DueAt          time.Time
+	LastReviewedAt time.Time
+}
+
+// NewReviewState returns the state of a question the user has never seen
+func NewReviewState() ReviewState {
+	return ReviewState{EaseFactor: DefaultEaseFactor}
+}
+
+// Mastered reports whether the question is scheduled far enough out to count as mastered
+func (s ReviewState) Mastered() bool {
+	return s.IntervalDays >= MasteredIntervalDays
+}
+
+// GradeAnswer maps an answer to an SM-2 grade. Correct answers are graded
+// by how long the user needed; wrong answers are always a lapse.
+func GradeAnswer(correct bool, timeSpentMs int) int {
+	if !correct {
+		return GradeIncorrect
+	}
+	switch {
+	case timeSpentMs > 0 && timeSpentMs <= FastAnswerTime:
+		return GradeCorrectFast
+	case timeSpentMs >= SlowAnswerTime:
+		return GradeCorrectSlow
+	default:
+		return GradeCorrect
+	}
+}
+
+// Review applies an answer with the given grade at time now and returns the new state
+func (s ReviewState) Review(grade int, now time.Time) ReviewState {
+	if grade < 0 {
+		grade = 0
+	}
+	if grade > 5 {
+		grade = 5
+	}
+	if s.EaseFactor == 0 {
+		s.EaseFactor = DefaultEaseFactor
+	}
+
+	next := s
+	next.LastReviewedAt = now
+
+	if grade < 3 {
+		// Lapse: start over and bring the question back shortly
+		next.Repetitions = 0
+		next.IntervalDays = 0
+		next.Lapses++
+		next.DueAt = now.Add(RelearnDelay)
+	} else {
+		switch next.Repetitions {
+		case 0:
+			next.IntervalDays = 1
+		case 1:
+			next.IntervalDays = 6
+		default:
+			next.IntervalDays = math.Round(s.IntervalDays*s.EaseFactor*10) / 10
+		}
+		next.Repetitions++
+		next.DueAt = now.Add(time.Duration(next.IntervalDays * float64(24*time.Hour)))
+	}
+
+	q := float64(5 - grade)
+	next.EaseFactor = s.EaseFactor + (0.1 - q*(0.08+q*0.02))
+	if next.EaseFactor < MinEaseFactor {
+		next.EaseFactor = MinEaseFactor
+	}
+
+	return next
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestGradeAnswer(t *testing.T) {
+	cases := []struct {
+		name        string
+		correct     bool
+		timeSpentMs int
+		want        int
+	}{
+		{"wrong", false, 3000, GradeIncorrect},
+		{"wrong and slow", false, 60000, GradeIncorrect},
+		{"fast", true, 3000, GradeCorrectFast},
+		{"fast threshold", true, FastAnswerTime, GradeCorrectFast},
+		{"normal", true, FastAnswerTime + 1, GradeCorrect},
+		{"slow threshold", true, SlowAnswerTime, GradeCorrectSlow},
+		{"slow", true, 60000, GradeCorrectSlow},
+		{"no timing", true, 0, GradeCorrect},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := GradeAnswer(c.correct, c.timeSpentMs); got != c.want {
+				t.Fatalf("GradeAnswer(%v, %d) = %d, want %d", c.correct, c.timeSpentMs, got, c.want)
+			}
+		})
+	}
+}
+
+func TestReviewState_Review(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	cases := []struct {
+		name            string
+		state           ReviewState
+		grade           int
+		wantReps        int
+		wantLapses      int
+		wantInterval    float64
+		wantEase        float64
+		wantDueAfterNow time.Duration
+	}{
+		{
+			name:            "first review, fast",
+			state:           NewReviewState(),
+			grade:           GradeCorrectFast,
+			wantReps:        1,
+			wantInterval:    1,
+			wantEase:        2.6,
+			wantDueAfterNow: day,
+		},
+		{
+			name:            "first review, correct",
+			state:           NewReviewState(),
+			grade:           GradeCorrect,
+			wantReps:        1,
+			wantInterval:    1,
+			wantEase:        2.5,
+			wantDueAfterNow: day,
+		},
+		{
+			name:            "first review, slow",
+			state:           NewReviewState(),
+			grade:           GradeCorrectSlow,
+			wantReps:        1,
+			wantInterval:    1,
+			wantEase:        2.36,
+			wantDueAfterNow: day,
+		},
+		{
+			name:            "second review",
+			state:           ReviewState{EaseFactor: 2.5, IntervalDays: 1, Repetitions: 1},
+			grade:           GradeCorrect,
+			wantReps:        2,
+			wantInterval:    6,
+			wantEase:        2.5,
+			wantDueAfterNow: 6 * day,
+		},
+		{
+			name:            "third review multiplies by ease",
+			state:           ReviewState{EaseFactor: 2.5, IntervalDays: 6, Repetitions: 2},
+			grade:           GradeCorrect,
+			wantReps:        3,
+			wantInterval:    15,
+			wantEase:        2.5,
+			wantDueAfterNow: 15 * day,
+		},
+		{
+			name:            "interval rounds to a tenth of a day",
+			state:           ReviewState{EaseFactor: 2.36, IntervalDays: 6, Repetitions: 2},
+			grade:           GradeCorrect,
+			wantReps:        3,
+			wantInterval:    14.2,
+			wantEase:        2.36,
+			wantDueAfterNow: time.Duration(14.2 * float64(day)),
+		},
+		{
+			name:            "lapse starts over",
+			state:           ReviewState{EaseFactor: 2.5, IntervalDays: 15, Repetitions: 3, Lapses: 1},
+			grade:           GradeIncorrect,
+			wantReps:        0,
+			wantLapses:      2,
+			wantInterval:    0,
+			wantEase:        1.96,
+			wantDueAfterNow: RelearnDelay,
+		},
+		{
+			name:            "ease never drops below the minimum",
+			state:           ReviewState{EaseFactor: MinEaseFactor, Repetitions: 2, IntervalDays: 6},
+			grade:           GradeIncorrect,
+			wantLapses:      1,
+			wantEase:        MinEaseFactor,
+			wantDueAfterNow: RelearnDelay,
+		},
+		{
+			name:            "zero ease is treated as the default",
+			state:           ReviewState{},
+			grade:           GradeCorrect,
+			wantReps:        1,
+			wantInterval:    1,
+			wantEase:        2.5,
+			wantDueAfterNow: day,
+		},
+		{
+			name:            "grades above 5 are clamped",
+			state:           NewReviewState(),
+			grade:           9,
+			wantReps:        1,
+			wantInterval:    1,
+			wantEase:        2.6,
+			wantDueAfterNow: day,
+		},
+		{
+			name:            "grades below 0 are clamped",
+			state:           NewReviewState(),
+			grade:           -3,
+			wantLapses:      1,
+			wantEase:        1.7,
+			wantDueAfterNow: RelearnDelay,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := c.state.Review(c.grade, now)
+
+			if got.Repetitions != c.wantReps {
+				t.Errorf("Repetitions = %d, want %d", got.Repetitions, c.wantReps)
+			}
+			if got.Lapses != c.wantLapses {
+				t.Errorf("Lapses = %d, want %d", got.Lapses, c.wantLapses)
+			}
+			if math.Abs(got.IntervalDays-c.wantInterval) > 1e-9 {
+				t.Errorf("IntervalDays = %v, want %v", got.IntervalDays, c.wantInterval)
+			}
+			if math.Abs(got.EaseFactor-c.wantEase) > 1e-9 {
+				t.Errorf("EaseFactor = %v, want %v", got.EaseFactor, c.wantEase)
+			}
+			if want := now.Add(c.wantDueAfterNow); !got.DueAt.Equal(want) {
+				t.Errorf("DueAt = %v, want %v", got.DueAt, want)
+			}
+			if !got.LastReviewedAt.Equal(now) {
+				t.Errorf("LastReviewedAt = %v, want %v", got.LastReviewedAt, now)
+			}
+		})
+	}
+}
+
+func TestReviewState_ReviewDoesNotMutate(t *testing.T) {
+	state := ReviewState{EaseFactor: 2.5, IntervalDays: 6, Repetitions: 2}
+	state.Review(GradeIncorrect, time.Now())
+
+	if state.Repetitions != 2 || state.IntervalDays != 6 || state.EaseFactor != 2.5 {
+		t.Fatalf("Review changed its receiver: %+v", state)
+	}
+}
+
+func TestReviewState_Mastered(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	state := NewReviewState()
+
+	// 1, 6 and 15 days aren't enough; the fourth on-time answer gets there
+	for i, want := range []bool{false, false, false, true} {
+		state = state.Review(GradeCorrect, now)
+		if got := state.Mastered(); got != want {
+			t.Fatalf("after %d answers (interval %v): Mastered = %v, want %v", i+1, state.IntervalDays, got, want)
+		}
+		now = state.DueAt
+	}
+
+	if state = state.Review(GradeIncorrect, now); state.Mastered() {
+		t.Fatal("a lapse should unmaster the question")
+	}
+}
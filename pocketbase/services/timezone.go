@@ -0,0 +1,69 @@
+package services
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultTimezone is used for users who haven't set a timezone
+const DefaultTimezone = "America/Toronto"
+
+// LocalDateLayout is the format of local calendar dates (streaks, daily challenges)
+const LocalDateLayout = "2006-01-02"
+
+var ErrInvalidTimezone = errors.New("invalid timezone: must be an IANA name such as America/Toronto")
+
+// ParseTimezone loads an IANA timezone. Empty and "Local" are rejected so
+// results never depend on the server's own timezone.
+func ParseTimezone(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, ErrInvalidTimezone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, ErrInvalidTimezone
+	}
+	return loc, nil
+}
+
+// UserLocation returns the location for a user's timezone, falling back to
+// DefaultTimezone (and then UTC) when it is unset or invalid
+func UserLocation(name string) *time.Location {
+	if loc, err := ParseTimezone(name); err == nil {
+		return loc
+	}
+	if loc, err := time.LoadLocation(DefaultTimezone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// LocalDate returns the calendar date of t in loc
+func LocalDate(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format(LocalDateLayout)
+}
+
+// PreviousLocalDate returns the calendar date before t's date in loc.
+// It steps back by calendar day rather than 24 hours, so a 23- or 25-hour
+// DST day still yields the correct "yesterday".
+func PreviousLocalDate(t time.Time, loc *time.Location) string {
+	y, m, d := t.In(loc).Date()
+	return time.Date(y, m, d-1, 12, 0, 0, 0, loc).Format(LocalDateLayout)
+}
+
+// LocalHour returns the hour of day (0-23) of t in loc
+func LocalHour(t time.Time, loc *time.Location) int {
+	return t.In(loc).Hour()
+}
+
+// LocalDayStart returns the first instant of t's calendar day in loc.
+// In zones where DST starts at midnight (e.g. America/Santiago) local
+// midnight doesn't exist and the day starts at 01:00 instead.
+func LocalDayStart(t time.Time, loc *time.Location) time.Time {
+	y, m, d := t.In(loc).Date()
+	start := time.Date(y, m, d, 0, 0, 0, 0, loc)
+	for start.Day() != d {
+		start = start.Add(time.Hour).In(loc)
+	}
+	return start
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("timezone data for %s unavailable: %v", name, err)
+	}
+	return loc
+}
+
+func TestPreviousLocalDate(t *testing.T) {
+	toronto := mustLoadLocation(t, "America/Toronto")
+	santiago := mustLoadLocation(t, "America/Santiago")
+
+	cases := []struct {
+		name string
+		at   time.Time
+		loc  *time.Location
+		want string
+	}{
+		{"plain day", time.Date(2026, 6, 10, 15, 0, 0, 0, time.UTC), toronto, "2026-06-09"},
+		{"UTC already tomorrow", time.Date(2026, 6, 11, 2, 0, 0, 0, time.UTC), toronto, "2026-06-09"},
+		{"month boundary", time.Date(2026, 3, 1, 12, 0, 0, 0, toronto), toronto, "2026-02-28"},
+		{"year boundary", time.Date(2026, 1, 1, 0, 30, 0, 0, toronto), toronto, "2025-12-31"},
+		{"leap day", time.Date(2028, 3, 1, 9, 0, 0, 0, toronto), toronto, "2028-02-29"},
+
+		// Toronto springs forward at 02:00 on 2026-03-08: a 23-hour day
+		{"Toronto spring-forward day, early", time.Date(2026, 3, 8, 0, 30, 0, 0, toronto), toronto, "2026-03-07"},
+		{"Toronto spring-forward day, late", time.Date(2026, 3, 8, 23, 30, 0, 0, toronto), toronto, "2026-03-07"},
+		{"Toronto day after spring-forward, early", time.Date(2026, 3, 9, 0, 30, 0, 0, toronto), toronto, "2026-03-08"},
+
+		// Toronto falls back at 02:00 on 2026-11-01: a 25-hour day
+		{"Toronto fall-back day, early", time.Date(2026, 11, 1, 0, 30, 0, 0, toronto), toronto, "2026-10-31"},
+		{"Toronto fall-back day, late", time.Date(2026, 11, 1, 23, 30, 0, 0, toronto), toronto, "2026-10-31"},
+		{"Toronto day after fall-back, early", time.Date(2026, 11, 2, 0, 30, 0, 0, toronto), toronto, "2026-11-01"},
+
+		// Santiago springs forward at midnight on 2026-09-06: 00:00-00:59 doesn't exist
+		{"Santiago gap day, first instant", time.Date(2026, 9, 6, 4, 0, 0, 0, time.UTC), santiago, "2026-09-05"},
+		{"Santiago gap day, late", time.Date(2026, 9, 6, 23, 30, 0, 0, santiago), santiago, "2026-09-05"},
+		{"Santiago day after the gap", time.Date(2026, 9, 7, 0, 30, 0, 0, santiago), santiago, "2026-09-06"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := PreviousLocalDate(c.at, c.loc); got != c.want {
+				t.Fatalf("PreviousLocalDate(%v) = %s, want %s", c.at.In(c.loc), got, c.want)
+			}
+		})
+	}
+}
+
+func TestLocalDayStart(t *testing.T) {
+	toronto := mustLoadLocation(t, "America/Toronto")
+	santiago := mustLoadLocation(t, "America/Santiago")
+
+	cases := []struct {
+		name string
+		at   time.Time
+		loc  *time.Location
+		want time.Time // In UTC
+	}{
+		{"UTC", time.Date(2026, 6, 10, 15, 0, 0, 0, time.UTC), time.UTC, time.Date(2026, 6, 10, 0, 0, 0, 0, time.UTC)},
+		{"Toronto summer", time.Date(2026, 6, 10, 15, 0, 0, 0, time.UTC), toronto, time.Date(2026, 6, 10, 4, 0, 0, 0, time.UTC)},
+		{"Toronto winter", time.Date(2026, 1, 10, 15, 0, 0, 0, time.UTC), toronto, time.Date(2026, 1, 10, 5, 0, 0, 0, time.UTC)},
+		{"UTC already tomorrow", time.Date(2026, 6, 11, 2, 0, 0, 0, time.UTC), toronto, time.Date(2026, 6, 10, 4, 0, 0, 0, time.UTC)},
+
+		// The day starts at standard-time midnight and has 23 hours
+		{"Toronto spring-forward day", time.Date(2026, 3, 8, 12, 0, 0, 0, toronto), toronto, time.Date(2026, 3, 8, 5, 0, 0, 0, time.UTC)},
+		{"Toronto day after spring-forward", time.Date(2026, 3, 9, 12, 0, 0, 0, toronto), toronto, time.Date(2026, 3, 9, 4, 0, 0, 0, time.UTC)},
+
+		// The day starts at daylight-time midnight and has 25 hours
+		{"Toronto fall-back day", time.Date(2026, 11, 1, 12, 0, 0, 0, toronto), toronto, time.Date(2026, 11, 1, 4, 0, 0, 0, time.UTC)},
+		{"Toronto fall-back day, repeated hour", time.Date(2026, 11, 1, 6, 30, 0, 0, time.UTC), toronto, time.Date(2026, 11, 1, 4, 0, 0, 0, time.UTC)},
+		{"Toronto day after fall-back", time.Date(2026, 11, 2, 12, 0, 0, 0, toronto), toronto, time.Date(2026, 11, 2, 5, 0, 0, 0, time.UTC)},
+
+		// Local midnight doesn't exist, so the day starts at 01:00 (-03)
+		{"Santiago gap day", time.Date(2026, 9, 6, 12, 0, 0, 0, santiago), santiago, time.Date(2026, 9, 6, 4, 0, 0, 0, time.UTC)},
+		{"Santiago gap day, first instant", time.Date(2026, 9, 6, 4, 0, 0, 0, time.UTC), santiago, time.Date(2026, 9, 6, 4, 0, 0, 0, time.UTC)},
+		{"Santiago day before the gap", time.Date(2026, 9, 5, 12, 0, 0, 0, santiago), santiago, time.Date(2026, 9, 5, 4, 0, 0, 0, time.UTC)},
+		{"Santiago day after the gap", time.Date(2026, 9, 7, 12, 0, 0, 0, santiago), santiago, time.Date(2026, 9, 7, 3, 0, 0, 0, time.UTC)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := LocalDayStart(c.at, c.loc)
+			if !got.Equal(c.want) {
+				t.Fatalf("LocalDayStart(%v) = %v, want %v", c.at.In(c.loc), got.UTC(), c.want)
+			}
+			if d := got.In(c.loc).Day(); d != c.at.In(c.loc).Day() {
+				t.Fatalf("LocalDayStart(%v) is on day %d", c.at.In(c.loc), d)
+			}
+		})
+	}
+}
@@ -16,6 +16,7 @@ import Progress from "./pages/Progress";
 import Handbook from "./pages/Handbook";
 import Premium from "./pages/Premium";
 import Leaderboard from "./pages/Leaderboard";
+import DrivingSchool from "./pages/DrivingSchool";
 import NotFound from "./pages/NotFound";
 
 const queryClient = new QueryClient();
@@ -40,6 +41,7 @@ const App = () => (
               <Route path="/handbook" element={<Handbook />} />
               <Route path="/premium" element={<Premium />} />
               <Route path="/leaderboard" element={<Leaderboard />} />
+              <Route path="/school" element={<DrivingSchool />} />
               {/* ADD ALL CUSTOM ROUTES ABOVE THE CATCH-ALL "*" ROUTE */}
               <Route path="*" element={<NotFound />} />
             </Routes>
@@ -0,0 +1,53 @@
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/components/ui/card';
+import { Button } from '@/components/ui/button';
+import { LeaderboardVisibility } from '@/lib/pocketbase';
+import { useAuth } from '@/contexts/AuthContext';
+import { Eye, EyeOff, Shield, VenetianMask } from 'lucide-react';
+
+const OPTIONS: { value: LeaderboardVisibility; label: string; description: string; icon: typeof Eye }[] = [
+  { value: 'public', label: 'Public', description: 'Others see your name and avatar.', icon: Eye },
+  { value: 'pseudonymous', label: 'Pseudonym', description: 'You are ranked as an anonymous learner.', icon: VenetianMask },
+  { value: 'hidden', label: 'Hidden', description: 'You are left out of leaderboards entirely.', icon: EyeOff },
+];
+
+/**
+ * Lets the user choose how they appear on leaderboards and in study groups.
+ * Hiding takes effect immediately; ranks close the gap at the next refresh.
+ */
+const LeaderboardPrivacyCard = () => {
+  const { user, updateProfile } = useAuth();
+
+  if (!user) {
+    return null;
+  }
+
+  const current = user.leaderboardVisibility || 'public';
+  const selected = OPTIONS.find((option) => option.value === current) ?? OPTIONS[0];
+
+  return (
+    <Card className="mb-4">
+      <CardHeader className="pb-2">
+        <CardTitle className="text-lg flex items-center gap-2">
+          <Shield className="w-5 h-5 text-primary" />
+          Leaderboard Privacy
+        </CardTitle>
+        <CardDescription>{selected.description}</CardDescription>
+      </CardHeader>
+      <CardContent className="flex flex-wrap gap-2">
+        {OPTIONS.map(({ value, label, icon: Icon }) => (
+          <Button
+            key={value}
+            size="sm"
+            variant={value === current ? 'default' : 'outline'}
+            onClick={() => value !== current && updateProfile({ leaderboardVisibility: value })}
+          >
+            <Icon className="w-4 h-4 mr-1" />
+            {label}
+          </Button>
+        ))}
+      </CardContent>
+    </Card>
+  );
+};
+
+export default LeaderboardPrivacyCard;
@@ -0,0 +1,201 @@
+import { useState, useEffect } from 'react';
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/components/ui/card';
+import { Button } from '@/components/ui/button';
+import { Input } from '@/components/ui/input';
+import { Badge } from '@/components/ui/badge';
+import {
+  StudyGroup,
+  listGroups,
+  createGroup,
+  joinGroup,
+  removeGroupMember,
+  deleteGroup,
+} from '@/lib/groups-api';
+import { useAuth } from '@/contexts/AuthContext';
+import { Users, Plus, LogIn, Copy, Globe, Trash2, LogOut } from 'lucide-react';
+import { toast } from 'sonner';
+
+interface StudyGroupsCardProps {
+  selectedGroupId?: string;
+  onSelect: (group: StudyGroup | null) => void;
+}
+
+/**
+ * Lists the user's study groups and lets them create or join one.
+ * Selecting a group switches the leaderboard to that group's private ranking.
+ */
+const StudyGroupsCard = ({ selectedGroupId, onSelect }: StudyGroupsCardProps) => {
+  const { user } = useAuth();
+  const [groups, setGroups] = useState<StudyGroup[]>([]);
+  const [newGroupName, setNewGroupName] = useState('');
+  const [inviteCode, setInviteCode] = useState('');
+  const [isBusy, setIsBusy] = useState(false);
+
+  const refresh = async () => {
+    setGroups(await listGroups());
+  };
+
+  useEffect(() => {
+    if (user) {
+      refresh();
+    }
+  }, [user]);
+
+  if (!user) {
+    return null;
+  }
+
+  const handleCreate = async () => {
+    if (!newGroupName.trim()) return;
+    setIsBusy(true);
+    const result = await createGroup(newGroupName.trim());
+    setIsBusy(false);
+
+    if (result.error || !result.data) {
+      toast.error(result.error || 'Failed to create group');
+      return;
+    }
+    setNewGroupName('');
+    toast.success(`Group created! Share code ${result.data.inviteCode} to invite friends.`);
+    await refresh();
+    onSelect(result.data);
+  };
+
+  const handleJoin = async () => {
+    if (!inviteCode.trim()) return;
+    setIsBusy(true);
+    const result = await joinGroup(inviteCode);
+    setIsBusy(false);
+
+    if (result.error || !result.data) {
+      toast.error(result.error || 'Failed to join group');
+      return;
+    }
+    setInviteCode('');
+    toast.success(`Joined ${result.data.name}!`);
+    await refresh();
+    onSelect(result.data);
+  };
+
+  const handleLeaveOrDelete = async (group: StudyGroup) => {
+    const result = group.role === 'owner'
+      ? await deleteGroup(group.id)
+      : await removeGroupMember(group.id, user.id);
+
+    if (result.error) {
+      toast.error(result.error);
+      return;
+    }
+    toast.success(group.role === 'owner' ? 'Group deleted' : `Left ${group.name}`);
+    if (group.id === selectedGroupId) {
+      onSelect(null);
+    }
+    await refresh();
+  };
+
+  const copyCode = async (code: string) => {
+    try {
+      await navigator.clipboard.writeText(code);
+      toast.success('Invite code copied!');
+    } catch {
+      toast.info(`Invite code: ${code}`);
+    }
+  };
+
+  return (
+    <Card className="mb-4">
+      <CardHeader className="pb-2">
+        <CardTitle className="text-lg flex items-center gap-2">
+          <Users className="w-5 h-5 text-primary" />
+          Study Groups
+        </CardTitle>
+        <CardDescription>
+          Compete privately with friends or your driving school class.
+        </CardDescription>
+      </CardHeader>
+      <CardContent className="space-y-3">
+        <div className="flex flex-wrap gap-2">
+          <Button
+            size="sm"
+            variant={selectedGroupId ? 'outline' : 'default'}
+            onClick={() => onSelect(null)}
+          >
+            <Globe className="w-4 h-4 mr-1" />
+            Everyone
+          </Button>
+          {groups.map((group) => (
+            <Button
+              key={group.id}
+              size="sm"
+              variant={group.id === selectedGroupId ? 'default' : 'outline'}
+              onClick={() => onSelect(group)}
+            >
+              {group.name}
+              <Badge variant="secondary" className="ml-2 font-normal">
+                {group.memberCount}
+              </Badge>
+            </Button>
+          ))}
+        </div>
+
+        {groups
+          .filter((group) => group.id === selectedGroupId)
+          .map((group) => (
+            <div key={group.id} className="flex items-center justify-between gap-2 text-sm">
+              {group.inviteCode ? (
+                <Button size="sm" variant="ghost" onClick={() => copyCode(group.inviteCode!)}>
+                  <Copy className="w-4 h-4 mr-1" />
+                  Invite code: <span className="font-mono ml-1">{group.inviteCode}</span>
+                </Button>
+              ) : (
+                <span className="text-muted-foreground">
+                  {group.memberCount} of {group.maxMembers} members
+                </span>
+              )}
+              <Button size="sm" variant="ghost" onClick={() => handleLeaveOrDelete(group)}>
+                {group.role === 'owner' ? (
+                  <>
+                    <Trash2 className="w-4 h-4 mr-1" />
+                    Delete
+                  </>
+                ) : (
+                  <>
+                    <LogOut className="w-4 h-4 mr-1" />
+                    Leave
+                  </>
+                )}
+              </Button>
+            </div>
+          ))}
+
+        <div className="grid gap-2 sm:grid-cols-2">
+          <div className="flex gap-2">
+            <Input
+              placeholder="New group name"
+              value={newGroupName}
+              maxLength={60}
+              onChange={(e) => setNewGroupName(e.target.value)}
+            />
+            <Button size="icon" onClick={handleCreate} disabled={isBusy || !newGroupName.trim()}>
+              <Plus className="w-4 h-4" />
+            </Button>
+          </div>
+          <div className="flex gap-2">
+            <Input
+              placeholder="Invite code"
+              value={inviteCode}
+              maxLength={8}
+              className="font-mono uppercase"
+              onChange={(e) => setInviteCode(e.target.value)}
+            />
+            <Button size="icon" onClick={handleJoin} disabled={isBusy || !inviteCode.trim()}>
+              <LogIn className="w-4 h-4" />
+            </Button>
+          </div>
+        </div>
+      </CardContent>
+    </Card>
+  );
+};
+
+export default StudyGroupsCard;
@@ -1,6 +1,6 @@
 import React, { createContext, useContext, useState, useEffect, ReactNode } from 'react';
 import { pb, User, clearAuth, getCurrentUser, isAuthenticated } from '@/lib/pocketbase';
-import { getStoredProgress, saveProgress, type UserProgress as LocalProgress, ALL_BADGES } from '@/utils/storage';
+import { getStoredProgress, saveProgress, getBrowserTimezone, type UserProgress as LocalProgress, ALL_BADGES } from '@/utils/storage';
 import { initializeProgressSync, syncProgress as apiSyncProgress } from '@/lib/progress-api';
 import { toast } from 'sonner';
 
@@ -163,37 +163,28 @@ export const AuthProvider: React.FC<{ children: ReactNode }> = ({ children }) =>
     try {
       setIsLoading(true);
 
-      // Get local progress to initialize account
-      const localProgress = getStoredProgress();
-
-      // Create user with initial progress data
+      // Progress is server-only; local progress is merged by the sync below
       await pb.collection('users').create({
         email,
         password,
         passwordConfirm: password,
         name,
-        xp: localProgress.xp,
-        level: 1,
-        streak: localProgress.streak,
-        longestStreak: localProgress.longestStreak,
-        questionsCompleted: localProgress.questionsCompleted,
-        questionsCorrect: localProgress.questionsCorrect,
-        badges: localProgress.badges,
-        isPremium: false,
-        premiumPlan: 'free',
+        timezone: getBrowserTimezone(),
       });
 
       // Auto-login after signup
       await pb.collection('users').authWithPassword(email, password);
       setUser(getCurrentUser());
 
+      await syncProgress();
+
       toast.success('Account created! Welcome to DrivePrep!');
       setShowAuthModal(false);
 
       return true;
     } catch (error: any) {
       console.error('Signup failed:', error);
-      toast.error(error.message || 'Signup failed. Please try again.');
+      toast.error(error.response?.data?.name?.message || error.message || 'Signup failed. Please try again.');
       return false;
     } finally {
       setIsLoading(false);
@@ -255,7 +246,7 @@ export const AuthProvider: React.FC<{ children: ReactNode }> = ({ children }) =>
       return true;
     } catch (error: any) {
       console.error('Profile update failed:', error);
-      toast.error('Failed to update profile');
+      toast.error(error.response?.data?.name?.message || 'Failed to update profile');
       return false;
     }
   };
@@ -0,0 +1,142 @@
+/**
+ * Study Groups API Client
+ *
+ * Study groups are private leaderboards for friends and driving-school
+ * classes. The owner shares an invite code; members see a leaderboard
+ * ranked among themselves via fetchLeaderboard(period, limit, key, groupId).
+ */
+
+import { pb } from './pocketbase';
+
+// ============================================
+// Types
+// ============================================
+
+export type GroupRole = 'owner' | 'member';
+
+export interface StudyGroup {
+  id: string;
+  name: string;
+  description: string;
+  inviteCode?: string; // Only returned to the owner
+  maxMembers: number;
+  memberCount: number;
+  role: GroupRole;
+  created: string;
+}
+
+export interface StudyGroupMember {
+  memberId: string;
+  userId?: string; // Left out for members listed under a pseudonym
+  name: string;
+  avatar?: string;
+  role: GroupRole;
+  joinedAt: string;
+}
+
+export interface GroupResult<T> {
+  data?: T;
+  error?: string;
+}
+
+// ============================================
+// Helper Functions
+// ============================================
+
+/**
+ * Check if backend is available
+ */
+const isBackendAvailable = (): boolean => {
+  return !!pb.baseURL && !pb.baseURL.includes('localhost:8090');
+};
+
+/**
+ * Call a study-group endpoint and unwrap the { error } responses
+ */
+async function groupRequest<T>(
+  path: string,
+  method: 'GET' | 'POST' | 'DELETE' = 'GET',
+  body?: unknown
+): Promise<GroupResult<T>> {
+  if (!isBackendAvailable() || !pb.authStore.isValid) {
+    return { error: 'Please log in to use study groups' };
+  }
+
+  try {
+    const response = await fetch(`${pb.baseURL}${path}`, {
+      method,
+      headers: {
+        'Authorization': pb.authStore.token,
+        'Content-Type': 'application/json',
+      },
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+
+    const data = await response.json();
+    if (!response.ok) {
+      return { error: data.error || data.message || 'Request failed' };
+    }
+
+    return { data };
+  } catch (error) {
+    console.error('Study group request failed:', error);
+    return { error: 'Please check your connection and try again' };
+  }
+}
+
+// ============================================
+// API Functions
+// ============================================
+
+/**
+ * List the groups the current user belongs to
+ */
+export async function listGroups(): Promise<StudyGroup[]> {
+  const result = await groupRequest<StudyGroup[]>('/api/groups');
+  return result.data || [];
+}
+
+/**
+ * Get a group and its members
+ */
+export function getGroup(groupId: string) {
+  return groupRequest<{ group: StudyGroup; members: StudyGroupMember[] }>(`/api/groups/${groupId}`);
+}
+
+/**
+ * Create a group; the current user becomes its owner
+ */
+export function createGroup(name: string, description?: string, maxMembers?: number) {
+  return groupRequest<StudyGroup>('/api/groups', 'POST', { name, description, maxMembers });
+}
+
+/**
+ * Join a group with an invite code
+ */
+export function joinGroup(inviteCode: string) {
+  return groupRequest<StudyGroup>('/api/groups/join', 'POST', {
+    inviteCode: inviteCode.toUpperCase().replace(/\s/g, ''),
+  });
+}
+
+/**
+ * Generate a new invite code (owner only); the old code stops working
+ */
+export function regenerateInviteCode(groupId: string) {
+  return groupRequest<{ inviteCode: string }>(`/api/groups/${groupId}/invite-code`, 'POST');
+}
+
+/**
+ * Remove a member (owner only), or leave when member is the current user.
+ * Members are named by user ID, or by memberId when listed under a pseudonym.
+ */
+export function removeGroupMember(groupId: string, member: string) {
+  return groupRequest<{ success: boolean }>(`/api/groups/${groupId}/members/${member}`, 'DELETE');
+}
+
+/**
+ * Delete a group (owner only)
+ */
+export function deleteGroup(groupId: string) {
+  return groupRequest<{ success: boolean }>(`/api/groups/${groupId}`, 'DELETE');
+}
@@ -1,7 +1,7 @@
 import { pb, User } from './pocketbase';
 
 export interface LeaderboardEntry {
-  id: string;
+  id: string; // user ID, or an opaque per-board ID for pseudonymous users
   rank: number;
   name: string;
   avatar?: string;
@@ -10,13 +10,32 @@ export interface LeaderboardEntry {
   streak: number;
   badges: number;
   isCurrentUser?: boolean;
+  pseudonymous?: boolean; // name is an anonymous pseudonym
 }
 
+export type LeaderboardPeriod = 'weekly' | 'monthly' | 'allTime';
+
 export interface LeaderboardData {
   entries: LeaderboardEntry[];
   userRank?: number;
   totalUsers: number;
-  period: 'weekly' | 'allTime';
+  period: LeaderboardPeriod;
+  periodKey?: string;
+  group?: string;
+  startsAt?: string;
+  endsAt?: string;
+  refreshedAt?: string;
+  finalized?: boolean;
+}
+
+export interface LeaderboardPeriodSummary {
+  period: LeaderboardPeriod;
+  periodKey: string;
+  startsAt?: string;
+  endsAt?: string;
+  totalUsers: number;
+  finalized: boolean;
+  winners: LeaderboardEntry[];
 }
 
 // Demo leaderboard data for when no backend is configured
@@ -28,12 +47,12 @@ const DEMO_NAMES = [
 ];
 
 const generateDemoLeaderboard = (
-  period: 'weekly' | 'allTime',
+  period: LeaderboardPeriod,
   currentUserXp: number = 0,
   currentUserName: string = 'You'
 ): LeaderboardData => {
   // Generate random but consistent entries
-  const seed = period === 'weekly' ? 42 : 137;
+  const seed = period === 'weekly' ? 42 : period === 'monthly' ? 89 : 137;
   const seededRandom = (i: number) => {
     const x = Math.sin(seed + i) * 10000;
     return x - Math.floor(x);
@@ -42,7 +61,9 @@ const generateDemoLeaderboard = (
   let entries: LeaderboardEntry[] = DEMO_NAMES.map((name, i) => {
     const baseXp = period === 'weekly'
       ? Math.floor(seededRandom(i) * 2000) + 500
-      : Math.floor(seededRandom(i) * 10000) + 1000;
+      : period === 'monthly'
+        ? Math.floor(seededRandom(i) * 5000) + 800
+        : Math.floor(seededRandom(i) * 10000) + 1000;
 
     return {
       id: `demo-${i}`,
@@ -84,11 +105,15 @@ const generateDemoLeaderboard = (
 };
 
 /**
- * Fetch leaderboard data from the backend
+ * Fetch leaderboard data from the backend.
+ * `key` selects a past period ("2026-W07", "2026-02" or "previous").
+ * `groupId` ranks only the members of a study group.
  */
 export const fetchLeaderboard = async (
-  period: 'weekly' | 'allTime',
-  limit: number = 20
+  period: LeaderboardPeriod,
+  limit: number = 20,
+  key?: string,
+  groupId?: string
 ): Promise<LeaderboardData> => {
   // Check if backend is configured
   if (!pb.baseURL || pb.baseURL.includes('localhost:8090')) {
@@ -112,8 +137,16 @@ export const fetchLeaderboard = async (
   }
 
   try {
+    const params = new URLSearchParams({ period, limit: limit.toString() });
+    if (key) {
+      params.set('key', key);
+    }
+    if (groupId) {
+      params.set('group', groupId);
+    }
+
     const response = await fetch(
-      `${pb.baseURL}/api/leaderboard?period=${period}&limit=${limit}`,
+      `${pb.baseURL}/api/leaderboard?${params.toString()}`,
       {
         headers: {
           'Authorization': pb.authStore.token || '',
@@ -133,12 +166,44 @@ export const fetchLeaderboard = async (
   }
 };
 
+/**
+ * Fetch past weekly or monthly periods with their top 3
+ */
+export const fetchPastLeaderboards = async (
+  period: 'weekly' | 'monthly',
+  limit: number = 4
+): Promise<LeaderboardPeriodSummary[]> => {
+  if (!pb.baseURL || pb.baseURL.includes('localhost:8090')) {
+    return [];
+  }
+
+  try {
+    const response = await fetch(
+      `${pb.baseURL}/api/leaderboard/periods?period=${period}&limit=${limit}`,
+      {
+        headers: {
+          'Authorization': pb.authStore.token || '',
+        },
+      }
+    );
+
+    if (!response.ok) {
+      return [];
+    }
+
+    return await response.json();
+  } catch (error) {
+    console.error('Error fetching past leaderboards:', error);
+    return [];
+  }
+};
+
 /**
  * Get user's rank in the leaderboard
  */
 export const getUserRank = async (
   userId: string,
-  period: 'weekly' | 'allTime'
+  period: LeaderboardPeriod
 ): Promise<number | null> => {
   if (!pb.baseURL || pb.baseURL.includes('localhost:8090')) {
     return null;
@@ -159,7 +224,8 @@ export const getUserRank = async (
     }
 
     const data = await response.json();
-    return data.rank;
+    // Rank 0 means the user earned no XP in the period or hid themselves
+    return data.rank || null;
   } catch (error) {
     console.error('Error fetching user rank:', error);
     return null;
@@ -171,7 +237,7 @@ export const getUserRank = async (
  */
 export const getNearbyUsers = async (
   userId: string,
-  period: 'weekly' | 'allTime',
+  period: LeaderboardPeriod,
   range: number = 2
 ): Promise<LeaderboardEntry[]> => {
   if (!pb.baseURL || pb.baseURL.includes('localhost:8090')) {
@@ -277,7 +343,7 @@ export const shareContent = async (shareData: ShareData): Promise<boolean> => {
 
 // Challenge friend utilities
 export interface Challenge {
-  id: string;
+  id: string; // user ID, or an opaque per-board ID for pseudonymous users
   challengerId: string;
   challengerName: string;
   challengedId?: string;
@@ -3,11 +3,16 @@
  *
  * This module provides encrypted offline storage for questions using:
  * - IndexedDB for persistent storage
- * - Web Crypto API for AES-256-GCM encryption
+ * - Content packs encrypted by the server with AES-256-GCM, bound to the
+ *   offline token and device, and decrypted with the Web Crypto API
+ * - Signed pack metadata, checked before a pack is used
+ * - An append-only, MAC-chained log of answers given offline, replayed to
+ *   the server once back online
  * - Automatic expiration of cached data
  */
 
 import { pb } from './pocketbase';
+import { getQuestionChanges } from './questions-api';
 
 // ============================================
 // Types
@@ -24,12 +29,100 @@ export interface CachedQuestion {
   difficulty: number;
 }
 
+export interface OfflineDevice {
+  id: string;
+  deviceFingerprint?: string;
+  deviceName?: string;
+  userAgent?: string;
+  issuedAt: string;
+  expiresAt: string;
+  lastValidatedAt?: string;
+}
+
 export interface OfflineToken {
-  token: string;
+  token: string; // Compact JWS signed with Ed25519
+  keyId: string;
   encryptionKey: string;
+  logKey: string; // Key the offline answer log is MAC'd with
   expiresAt: number;
   maxQuestions: number;
   categories: string[];
+  publicKeys?: OfflinePublicKey[];
+}
+
+export interface OfflineTokenClaims {
+  sub: string;
+  email: string;
+  premium: boolean;
+  plan: string;
+  categories: string[];
+  maxQuestions: number;
+  iat: number;
+  exp: number;
+  jti: string;
+}
+
+// Ed25519 public key as served by /api/offline/keys (JWK)
+export interface OfflinePublicKey {
+  kty: 'OKP';
+  crv: 'Ed25519';
+  x: string;
+  kid: string;
+  use: string;
+  alg: 'EdDSA';
+  active: boolean;
+}
+
+// Content pack as served by /api/offline/pack
+export interface OfflinePack {
+  metadata: string; // Compact JWS of OfflinePackMetadata
+  iv: string; // Base64 encoded IV
+  ciphertext: string; // Base64 encoded ciphertext
+}
+
+// Signed description of a content pack
+export interface OfflinePackMetadata {
+  v: number;
+  pid: string; // Pack ID, authenticated with the ciphertext
+  sub: string;
+  jti: string; // Offline token the pack is bound to
+  dev: string;
+  bankVersion: number;
+  categories: string[];
+  count: number;
+  enc: 'A256GCM';
+  sha256: string; // Of IV then ciphertext, base64url
+  iat: number;
+  exp: number;
+}
+
+// One answer in the offline answer log
+export interface OfflineAnswerEntry {
+  seq: number; // Position in the log, from 1
+  questionId: string;
+  selectedAnswer: number;
+  timeSpent: number; // milliseconds
+  answeredAt: number; // unix ms
+  prev: string; // MAC of the previous entry, empty for the first
+  mac: string;
+}
+
+// Result of replaying offline answers to the server
+export interface OfflineReplaySummary {
+  accepted: number;
+  rejected: number;
+  duplicates: number;
+  xpEarned: number;
+}
+
+// Head of a token's offline answer log
+interface OfflineAnswerLog {
+  id: string; // log:<jti>
+  jti: string;
+  token: string;
+  logKey: string;
+  seq: number;
+  mac: string;
 }
 
 interface CacheMetadata {
@@ -39,11 +132,14 @@ interface CacheMetadata {
   questionCount: number;
   categories: string[];
   userId: string;
+  packId: string;
+  bankVersion: number;
 }
 
 interface EncryptedData {
   iv: string; // Base64 encoded IV
   data: string; // Base64 encoded ciphertext
+  pack: string; // Signed pack metadata (compact JWS)
   metadata: CacheMetadata;
 }
 
@@ -52,12 +148,17 @@ interface EncryptedData {
 // ============================================
 
 const DB_NAME = 'DriveOntarioOffline';
-const DB_VERSION = 1;
+const DB_VERSION = 2;
 const STORE_QUESTIONS = 'questions';
 const STORE_METADATA = 'metadata';
 const STORE_TOKEN = 'token';
+const STORE_ANSWERS = 'answers';
 
-const CACHE_VERSION = 1;
+const CACHE_VERSION = 2;
+const PACK_FORMAT = 1;
+const OFFLINE_TOKEN_TYPE = 'offline+jwt';
+const OFFLINE_PACK_TYPE = 'offline-pack+jwt';
+const MAX_REPLAY_ENTRIES = 500;
 const DEFAULT_EXPIRY_DAYS = 7;
 
 // ============================================
@@ -91,6 +192,9 @@ async function openDatabase(): Promise<IDBDatabase> {
       if (!database.objectStoreNames.contains(STORE_TOKEN)) {
         database.createObjectStore(STORE_TOKEN, { keyPath: 'id' });
       }
+      if (!database.objectStoreNames.contains(STORE_ANSWERS)) {
+        database.createObjectStore(STORE_ANSWERS, { keyPath: 'id' });
+      }
     };
   });
 }
@@ -117,32 +221,14 @@ async function deriveKey(keyString: string): Promise<CryptoKey> {
 }
 
 /**
- * Encrypt data using AES-256-GCM
- */
-async function encryptData(data: unknown, keyString: string): Promise<{ iv: string; ciphertext: string }> {
-  const key = await deriveKey(keyString);
-
-  // Generate random IV
-  const iv = crypto.getRandomValues(new Uint8Array(12));
-
-  // Encrypt
-  const encoded = new TextEncoder().encode(JSON.stringify(data));
-  const ciphertext = await crypto.subtle.encrypt(
-    { name: 'AES-GCM', iv },
-    key,
-    encoded
-  );
-
-  return {
-    iv: btoa(String.fromCharCode(...iv)),
-    ciphertext: btoa(String.fromCharCode(...new Uint8Array(ciphertext))),
-  };
-}
-
-/**
- * Decrypt data using AES-256-GCM
+ * Decrypt data using AES-256-GCM, authenticating additionalData with it
  */
-async function decryptData<T>(iv: string, ciphertext: string, keyString: string): Promise<T> {
+async function decryptData<T>(
+  iv: string,
+  ciphertext: string,
+  keyString: string,
+  additionalData?: string
+): Promise<T> {
   const key = await deriveKey(keyString);
 
   // Decode base64
@@ -151,7 +237,9 @@ async function decryptData<T>(iv: string, ciphertext: string, keyString: string)
 
   // Decrypt
   const decrypted = await crypto.subtle.decrypt(
-    { name: 'AES-GCM', iv: ivBytes },
+    additionalData === undefined
+      ? { name: 'AES-GCM', iv: ivBytes }
+      : { name: 'AES-GCM', iv: ivBytes, additionalData: new TextEncoder().encode(additionalData) },
     key,
     ciphertextBytes
   );
@@ -191,6 +279,9 @@ export async function requestOfflineToken(validDays: number = DEFAULT_EXPIRY_DAY
 
     const data = await response.json();
 
+    // Keep the public keys so the token can be verified while offline
+    data.publicKeys = await fetchOfflinePublicKeys();
+
     // Store token in IndexedDB
     const database = await openDatabase();
     const tx = database.transaction(STORE_TOKEN, 'readwrite');
@@ -214,7 +305,7 @@ export async function requestOfflineToken(validDays: number = DEFAULT_EXPIRY_DAY
 }
 
 /**
- * Get stored offline token
+ * Get stored offline token, if it's unexpired and its signature checks out
  */
 export async function getOfflineToken(): Promise<OfflineToken | null> {
   try {
@@ -222,24 +313,104 @@ export async function getOfflineToken(): Promise<OfflineToken | null> {
     const tx = database.transaction(STORE_TOKEN, 'readonly');
     const store = tx.objectStore(STORE_TOKEN);
 
-    return new Promise((resolve, reject) => {
+    const result: OfflineToken | undefined = await new Promise((resolve, reject) => {
       const request = store.get('current');
-      request.onsuccess = () => {
-        const result = request.result;
-        if (result && result.expiresAt * 1000 > Date.now()) {
-          resolve(result);
-        } else {
-          resolve(null);
-        }
-      };
+      request.onsuccess = () => resolve(request.result);
       request.onerror = () => reject(request.error);
     });
+
+    if (!result || result.expiresAt * 1000 <= Date.now()) {
+      return null;
+    }
+
+    if (result.publicKeys?.length) {
+      const verified = await verifyOfflineToken(result.token, result.publicKeys);
+      if (verified === false) {
+        return null;
+      }
+    }
+
+    return result;
   } catch (error) {
     console.error('Error getting offline token:', error);
     return null;
   }
 }
 
+/**
+ * Fetch the public keys offline tokens are signed with
+ */
+export async function fetchOfflinePublicKeys(): Promise<OfflinePublicKey[]> {
+  try {
+    const response = await fetch(`${pb.baseURL}/api/offline/keys`);
+    if (!response.ok) {
+      throw new Error('Failed to fetch offline public keys');
+    }
+    const data = await response.json();
+    return data.keys || [];
+  } catch (error) {
+    console.error('Error fetching offline public keys:', error);
+    return [];
+  }
+}
+
+/**
+ * Verify an offline token's Ed25519 signature locally. Returns the claims,
+ * false when the token is invalid or expired, or null when this browser
+ * can't verify Ed25519 signatures.
+ */
+export async function verifyOfflineToken(
+  token: string,
+  keys: OfflinePublicKey[]
+): Promise<OfflineTokenClaims | false | null> {
+  const claims = await verifyJWS<OfflineTokenClaims>(token, keys, OFFLINE_TOKEN_TYPE);
+  if (!claims) return claims;
+  if (claims.exp * 1000 <= Date.now()) return false;
+
+  return claims;
+}
+
+/**
+ * Verify a compact JWS of the given type signed with one of the offline keys.
+ * Returns the payload, false when the signature or type is invalid, or null
+ * when this browser can't verify Ed25519 signatures.
+ */
+async function verifyJWS<T>(jws: string, keys: OfflinePublicKey[], typ: string): Promise<T | false | null> {
+  const parts = jws.split('.');
+  if (parts.length !== 3) return false;
+
+  try {
+    const header = JSON.parse(new TextDecoder().decode(base64UrlDecode(parts[0])));
+    const jwk = keys.find(k => k.kid === header.kid);
+    if (header.alg !== 'EdDSA' || header.typ !== typ || !jwk) return false;
+
+    let key: CryptoKey;
+    try {
+      key = await crypto.subtle.importKey(
+        'jwk',
+        { kty: jwk.kty, crv: jwk.crv, x: jwk.x },
+        { name: 'Ed25519' },
+        false,
+        ['verify']
+      );
+    } catch {
+      return null; // Ed25519 not supported by this browser
+    }
+
+    const valid = await crypto.subtle.verify(
+      { name: 'Ed25519' },
+      key,
+      base64UrlDecode(parts[2]),
+      new TextEncoder().encode(`${parts[0]}.${parts[1]}`)
+    );
+    if (!valid) return false;
+
+    return decodeJWSPayload<T>(jws);
+  } catch {
+    return false;
+  }
+}
+
 /**
  * Clear offline token
  */
@@ -264,7 +435,9 @@ export async function clearOfflineToken(): Promise<void> {
 // ============================================
 
 /**
- * Cache questions for offline use
+ * Download the content pack for this device and cache it for offline use.
+ * The pack stays encrypted at rest; its signed metadata and hash are
+ * checked before it's stored.
  */
 export async function cacheQuestionsForOffline(
   categories?: string[]
@@ -274,49 +447,58 @@ export async function cacheQuestionsForOffline(
   }
 
   try {
-    // Request questions from server
-    const response = await fetch(`${pb.baseURL}/api/offline/questions`, {
+    // Packs are bound to the offline token, so make sure we hold one
+    const token = (await getOfflineToken()) || (await requestOfflineToken());
+    if (!token) {
+      throw new Error('No offline token');
+    }
+
+    const response = await fetch(`${pb.baseURL}/api/offline/pack`, {
       method: 'POST',
       headers: {
         'Authorization': pb.authStore.token,
         'Content-Type': 'application/json',
       },
       body: JSON.stringify({
+        token: token.token,
         categories,
         deviceFingerprint: getDeviceFingerprint(),
       }),
     });
 
     if (!response.ok) {
-      throw new Error('Failed to fetch questions for offline');
+      throw new Error('Failed to fetch offline pack');
     }
 
-    const data = await response.json();
-    const { questions, encryptionKey, expiresAt } = data;
-
-    // Encrypt and store questions
-    const encrypted = await encryptData(questions, encryptionKey);
+    const pack: OfflinePack = await response.json();
+    const packMetadata = await verifyOfflinePack(pack, token);
+    if (!packMetadata) {
+      throw new Error('Offline pack failed integrity check');
+    }
 
     const metadata: CacheMetadata = {
       version: CACHE_VERSION,
-      encryptedAt: Date.now(),
-      expiresAt: expiresAt * 1000,
-      questionCount: questions.length,
-      categories: categories || [],
-      userId: pb.authStore.record?.id || '',
+      encryptedAt: packMetadata.iat * 1000,
+      expiresAt: packMetadata.exp * 1000,
+      questionCount: packMetadata.count,
+      categories: packMetadata.categories,
+      userId: packMetadata.sub,
+      packId: packMetadata.pid,
+      bankVersion: packMetadata.bankVersion,
     };
 
     const database = await openDatabase();
 
-    // Store encrypted questions
+    // Store the pack as downloaded
     const tx1 = database.transaction(STORE_QUESTIONS, 'readwrite');
     const questionsStore = tx1.objectStore(STORE_QUESTIONS);
 
     await new Promise<void>((resolve, reject) => {
       const request = questionsStore.put({
         id: 'encrypted_questions',
-        iv: encrypted.iv,
-        data: encrypted.ciphertext,
+        iv: pack.iv,
+        data: pack.ciphertext,
+        pack: pack.metadata,
         metadata,
       });
       request.onsuccess = () => resolve();
@@ -335,8 +517,8 @@ export async function cacheQuestionsForOffline(
 
     return {
       success: true,
-      count: questions.length,
-      expiresAt: expiresAt * 1000,
+      count: metadata.questionCount,
+      expiresAt: metadata.expiresAt,
     };
   } catch (error) {
     console.error('Error caching questions:', error);
@@ -379,11 +561,25 @@ export async function getCachedQuestions(): Promise<CachedQuestion[] | null> {
       return null;
     }
 
+    // Check integrity; packs from an older cache version or another token
+    // can't be used
+    const packMetadata = encryptedData.pack
+      ? await verifyOfflinePack(
+          { metadata: encryptedData.pack, iv: encryptedData.iv, ciphertext: encryptedData.data },
+          token
+        )
+      : false;
+    if (!packMetadata) {
+      await clearCachedQuestions();
+      throw new Error('Cached questions failed integrity check');
+    }
+
     // Decrypt questions
     const questions = await decryptData<CachedQuestion[]>(
       encryptedData.iv,
       encryptedData.data,
-      token.encryptionKey
+      token.encryptionKey,
+      packMetadata.pid
     );
 
     return questions;
@@ -393,6 +589,48 @@ export async function getCachedQuestions(): Promise<CachedQuestion[] | null> {
   }
 }
 
+/**
+ * Check a content pack before use: its metadata must be signed by an offline
+ * key, bound to the given token, unexpired and match the ciphertext's hash.
+ * Returns the metadata, or false when the pack can't be trusted.
+ */
+export async function verifyOfflinePack(
+  pack: OfflinePack,
+  token: OfflineToken
+): Promise<OfflinePackMetadata | false> {
+  try {
+    let metadata = await verifyJWS<OfflinePackMetadata>(pack.metadata, token.publicKeys || [], OFFLINE_PACK_TYPE);
+    if (metadata === false) return false;
+    if (metadata === null) {
+      // Ed25519 unsupported: fall back to the hash and binding checks
+      metadata = decodeJWSPayload<OfflinePackMetadata>(pack.metadata);
+    }
+
+    const tokenClaims = decodeJWSPayload<OfflineTokenClaims>(token.token);
+    if (
+      metadata.v !== PACK_FORMAT ||
+      metadata.enc !== 'A256GCM' ||
+      metadata.jti !== tokenClaims.jti ||
+      metadata.sub !== tokenClaims.sub ||
+      metadata.exp * 1000 <= Date.now()
+    ) {
+      return false;
+    }
+
+    const iv = Uint8Array.from(atob(pack.iv), c => c.charCodeAt(0));
+    const ciphertext = Uint8Array.from(atob(pack.ciphertext), c => c.charCodeAt(0));
+    const hashed = new Uint8Array(iv.length + ciphertext.length);
+    hashed.set(iv);
+    hashed.set(ciphertext, iv.length);
+    const digest = new Uint8Array(await crypto.subtle.digest('SHA-256', hashed));
+    if (base64UrlEncode(digest) !== metadata.sha256) return false;
+
+    return metadata;
+  } catch {
+    return false;
+  }
+}
+
 /**
  * Get cache metadata without decrypting questions
  */
@@ -450,6 +688,224 @@ export async function clearAllOfflineData(): Promise<void> {
   await clearCachedQuestions();
 }
 
+// ============================================
+// Offline Answer Log
+// ============================================
+
+/**
+ * Append an answer given offline to the current token's answer log. Each
+ * entry is chained to the one before by its MAC, so the log can't be edited
+ * without the server noticing on replay.
+ */
+export async function recordOfflineAnswer(
+  questionId: string,
+  selectedAnswer: number,
+  timeSpent: number
+): Promise<boolean> {
+  try {
+    const token = await getOfflineToken();
+    if (!token?.logKey) return false;
+
+    const jti = decodeJWSPayload<OfflineTokenClaims>(token.token).jti;
+    const database = await openDatabase();
+
+    const log: OfflineAnswerLog = (await idbRequest(
+      database.transaction(STORE_ANSWERS, 'readonly').objectStore(STORE_ANSWERS).get(`log:${jti}`)
+    )) || { id: `log:${jti}`, jti, token: token.token, logKey: token.logKey, seq: 0, mac: '' };
+
+    const entry: OfflineAnswerEntry = {
+      seq: log.seq + 1,
+      questionId,
+      selectedAnswer,
+      timeSpent: Math.round(timeSpent),
+      answeredAt: Date.now(),
+      prev: log.mac,
+      mac: '',
+    };
+    entry.mac = await offlineAnswerMAC(entry, log.logKey);
+
+    // Entry and head are written together so the chain never forks
+    const tx = database.transaction(STORE_ANSWERS, 'readwrite');
+    const store = tx.objectStore(STORE_ANSWERS);
+    store.put({ id: `${jti}:${entry.seq}`, jti, ...entry });
+    store.put({ ...log, seq: entry.seq, mac: entry.mac });
+    await new Promise<void>((resolve, reject) => {
+      tx.oncomplete = () => resolve();
+      tx.onerror = () => reject(tx.error);
+    });
+
+    return true;
+  } catch (error) {
+    console.error('Error recording offline answer:', error);
+    return false;
+  }
+}
+
+/**
+ * Replay every offline answer log to the server, which credits the answers
+ * it accepts. Replayed entries are dropped from the log.
+ */
+export async function replayOfflineAnswers(): Promise<OfflineReplaySummary | null> {
+  if (!pb.authStore.isValid) return null;
+
+  const summary: OfflineReplaySummary = { accepted: 0, rejected: 0, duplicates: 0, xpEarned: 0 };
+  try {
+    const database = await openDatabase();
+    const records: Array<OfflineAnswerLog | (OfflineAnswerEntry & { id: string; jti: string })> = await idbRequest(
+      database.transaction(STORE_ANSWERS, 'readonly').objectStore(STORE_ANSWERS).getAll()
+    );
+
+    const logs = records.filter((r): r is OfflineAnswerLog => r.id.startsWith('log:'));
+    const current = await getOfflineToken();
+    const currentJti = current ? decodeJWSPayload<OfflineTokenClaims>(current.token).jti : '';
+
+    for (const log of logs) {
+      const entries = records
+        .filter((r): r is OfflineAnswerEntry & { id: string; jti: string } => !r.id.startsWith('log:') && r.jti === log.jti)
+        .sort((a, b) => a.seq - b.seq);
+
+      let done = false; // Whether the log can be dropped
+      for (let i = 0; i < entries.length; i += MAX_REPLAY_ENTRIES) {
+        const batch = entries.slice(i, i + MAX_REPLAY_ENTRIES);
+        const response = await fetch(`${pb.baseURL}/api/offline/replay`, {
+          method: 'POST',
+          headers: {
+            'Authorization': pb.authStore.token,
+            'Content-Type': 'application/json',
+          },
+          body: JSON.stringify({
+            token: log.token,
+            deviceFingerprint: getDeviceFingerprint(),
+            entries: batch.map(({ seq, questionId, selectedAnswer, timeSpent, answeredAt, prev, mac }) => ({
+              seq, questionId, selectedAnswer, timeSpent, answeredAt, prev, mac,
+            })),
+          }),
+        });
+
+        // A revoked token or broken log will never replay; give up on it
+        if (response.status === 400 || response.status === 401) {
+          done = true;
+          break;
+        }
+        if (!response.ok) {
+          throw new Error('Failed to replay offline answers');
+        }
+
+        const data = await response.json();
+        summary.accepted += data.accepted;
+        summary.rejected += data.rejected;
+        summary.duplicates += data.duplicates;
+        summary.xpEarned += data.xpEarned;
+
+        const tx = database.transaction(STORE_ANSWERS, 'readwrite');
+        const store = tx.objectStore(STORE_ANSWERS);
+        for (const entry of batch) {
+          if (entry.seq <= data.replayedSeq) store.delete(entry.id);
+        }
+        await new Promise<void>((resolve, reject) => {
+          tx.oncomplete = () => resolve();
+          tx.onerror = () => reject(tx.error);
+        });
+      }
+
+      // Logs of the current token keep growing; drop the others once replayed
+      if (done || log.jti !== currentJti) {
+        const tx = database.transaction(STORE_ANSWERS, 'readwrite');
+        const store = tx.objectStore(STORE_ANSWERS);
+        store.delete(log.id);
+        for (const entry of entries) store.delete(entry.id);
+        await new Promise<void>((resolve, reject) => {
+          tx.oncomplete = () => resolve();
+          tx.onerror = () => reject(tx.error);
+        });
+      }
+    }
+
+    return summary;
+  } catch (error) {
+    console.error('Error replaying offline answers:', error);
+    return null;
+  }
+}
+
+/**
+ * MAC an answer log entry: base64url HMAC-SHA256 over its fields joined with "|"
+ */
+async function offlineAnswerMAC(entry: OfflineAnswerEntry, logKey: string): Promise<string> {
+  const key = await crypto.subtle.importKey(
+    'raw',
+    Uint8Array.from(atob(logKey), c => c.charCodeAt(0)),
+    { name: 'HMAC', hash: 'SHA-256' },
+    false,
+    ['sign']
+  );
+  const message = [entry.seq, entry.questionId, entry.selectedAnswer, entry.timeSpent, entry.answeredAt, entry.prev].join('|');
+  const mac = await crypto.subtle.sign('HMAC', key, new TextEncoder().encode(message));
+  return base64UrlEncode(new Uint8Array(mac));
+}
+
+// ============================================
+// Offline Devices
+// ============================================
+
+/**
+ * List the devices that hold a valid offline token
+ */
+export async function listOfflineDevices(): Promise<OfflineDevice[]> {
+  if (!pb.authStore.isValid) {
+    return [];
+  }
+
+  try {
+    const response = await fetch(`${pb.baseURL}/api/offline/devices`, {
+      headers: {
+        'Authorization': pb.authStore.token,
+      },
+    });
+
+    if (!response.ok) {
+      throw new Error('Failed to list offline devices');
+    }
+
+    const data = await response.json();
+    return data.devices || [];
+  } catch (error) {
+    console.error('Error listing offline devices:', error);
+    return [];
+  }
+}
+
+/**
+ * Revoke the offline token of one device. Revoking this device also clears
+ * its local offline data.
+ */
+export async function revokeOfflineDevice(device: OfflineDevice): Promise<boolean> {
+  if (!pb.authStore.isValid) {
+    return false;
+  }
+
+  try {
+    const response = await fetch(`${pb.baseURL}/api/offline/devices/${device.id}`, {
+      method: 'DELETE',
+      headers: {
+        'Authorization': pb.authStore.token,
+      },
+    });
+
+    if (!response.ok) {
+      throw new Error('Failed to revoke offline device');
+    }
+
+    if (device.deviceFingerprint === getDeviceFingerprint()) {
+      await clearAllOfflineData();
+    }
+    return true;
+  } catch (error) {
+    console.error('Error revoking offline device:', error);
+    return false;
+  }
+}
+
 // ============================================
 // Offline Status
 // ============================================
@@ -477,6 +933,7 @@ export async function getOfflineStatus(): Promise<{
   categories: string[];
   expiresAt: number | null;
   isExpired: boolean;
+  bankVersion: number | null;
 }> {
   const token = await getOfflineToken();
   const metadata = await getCacheMetadata();
@@ -490,6 +947,7 @@ export async function getOfflineStatus(): Promise<{
     categories: metadata?.categories || [],
     expiresAt: metadata?.expiresAt || null,
     isExpired: metadata ? metadata.expiresAt < now : true,
+    bankVersion: metadata?.bankVersion ?? null,
   };
 }
 
@@ -497,6 +955,39 @@ export async function getOfflineStatus(): Promise<{
 // Helpers
 // ============================================
 
+/**
+ * Encode bytes as unpadded base64url (as used in JWS)
+ */
+function base64UrlEncode(bytes: Uint8Array): string {
+  return btoa(String.fromCharCode(...bytes)).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+}
+
+/**
+ * Wrap an IndexedDB request in a promise
+ */
+function idbRequest<T>(request: IDBRequest<T>): Promise<T> {
+  return new Promise((resolve, reject) => {
+    request.onsuccess = () => resolve(request.result);
+    request.onerror = () => reject(request.error);
+  });
+}
+
+/**
+ * Decode the payload of a compact JWS without verifying it
+ */
+function decodeJWSPayload<T>(jws: string): T {
+  return JSON.parse(new TextDecoder().decode(base64UrlDecode(jws.split('.')[1])));
+}
+
+/**
+ * Decode unpadded base64url (as used in JWS)
+ */
+function base64UrlDecode(value: string): Uint8Array {
+  const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+  const padded = base64 + '='.repeat((4 - (base64.length % 4)) % 4);
+  return Uint8Array.from(atob(padded), c => c.charCodeAt(0));
+}
+
 /**
  * Generate a device fingerprint for key derivation
  */
@@ -562,12 +1053,23 @@ export async function initializeOfflineCache(): Promise<void> {
   // Check if we have valid cached data
   const status = await getOfflineStatus();
 
-  // If no valid data or about to expire (less than 1 day), refresh
+  // If no valid data, about to expire (less than 1 day) or the question
+  // bank changed since the pack was built, refresh
   const oneDayMs = 24 * 60 * 60 * 1000;
-  const needsRefresh = !status.hasQuestions ||
+  let needsRefresh = !status.hasQuestions ||
     status.isExpired ||
     (status.expiresAt && status.expiresAt - Date.now() < oneDayMs);
 
+  if (!needsRefresh && status.bankVersion !== null && isOnline()) {
+    const changes = await getQuestionChanges(status.bankVersion);
+    needsRefresh = !!changes && changes.added.length + changes.changed.length + changes.removed.length > 0;
+  }
+
+  if (isOnline()) {
+    // Credit answers given while offline before the token is replaced
+    await replayOfflineAnswers();
+  }
+
   if (needsRefresh && isOnline()) {
     try {
       // Get new token
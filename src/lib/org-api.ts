@@ -0,0 +1,246 @@
+/**
+ * Organizations API Client
+ *
+ * Organizations are driving schools with seat-limited enterprise licenses.
+ * Students join with the school's code or by accepting an invite, and get
+ * premium while they hold a seat; owners and instructors see their students'
+ * progress.
+ */
+
+import { pb } from './pocketbase';
+
+// ============================================
+// Types
+// ============================================
+
+export type OrgRole = 'owner' | 'instructor' | 'student';
+
+export interface Organization {
+  id: string;
+  name: string;
+  contactEmail?: string; // Only returned to owners and instructors
+  joinCode?: string; // Only returned to owners and instructors
+  role: OrgRole;
+  seats: number;
+  seatsUsed: number;
+  licenseExpiresAt?: string;
+  created: string;
+}
+
+export interface OrgMember {
+  userId: string;
+  name: string;
+  email: string;
+  role: OrgRole;
+  joinedAt: string;
+}
+
+export interface OrgInvite {
+  id: string;
+  email: string;
+  role: 'instructor' | 'student';
+  invitedAt: string;
+  expiresAt: string;
+}
+
+export interface ReceivedOrgInvite {
+  id: string;
+  organizationId: string;
+  organizationName: string;
+  role: 'instructor' | 'student';
+  expiresAt: string;
+}
+
+export interface OrgStudentSummary {
+  userId: string;
+  name: string;
+  email: string;
+  avatar?: string;
+  joinedAt: string;
+  xp: number;
+  level: number;
+  streak: number;
+  questionsCompleted: number;
+  accuracy: number; // 0-1
+  testsTaken: number;
+  testsPassed: number;
+  lastActiveAt?: string;
+}
+
+export interface OrgTestResult {
+  sessionId: string;
+  completedAt: string;
+  score: number;
+  totalQuestions: number;
+  passed: boolean;
+  timeSpent: number; // seconds
+  blueprint?: string;
+  categoryBreakdown: Record<string, { correct: number; total: number }>;
+  flagged?: boolean;
+}
+
+export interface OrgWeakCategory {
+  category: string;
+  attempts: number;
+  correct: number;
+  errorRate: number;
+  weightedErrorRate: number;
+  lastAttemptAt: string;
+}
+
+export interface OrgStudentDetail {
+  student: OrgStudentSummary;
+  categoryProgress: Record<string, { correct: number; total: number }> | null;
+  testHistory: OrgTestResult[];
+  weakCategories: OrgWeakCategory[];
+}
+
+export interface OrgResult<T> {
+  data?: T;
+  error?: string;
+}
+
+// ============================================
+// Helper Functions
+// ============================================
+
+/**
+ * Check if backend is available
+ */
+const isBackendAvailable = (): boolean => {
+  return !!pb.baseURL && !pb.baseURL.includes('localhost:8090');
+};
+
+/**
+ * Call an organization endpoint and unwrap the { error } responses
+ */
+async function orgRequest<T>(
+  path: string,
+  method: 'GET' | 'POST' | 'DELETE' = 'GET',
+  body?: unknown
+): Promise<OrgResult<T>> {
+  if (!isBackendAvailable() || !pb.authStore.isValid) {
+    return { error: 'Please log in to use your driving school account' };
+  }
+
+  try {
+    const response = await fetch(`${pb.baseURL}${path}`, {
+      method,
+      headers: {
+        'Authorization': pb.authStore.token,
+        'Content-Type': 'application/json',
+      },
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+
+    const data = await response.json();
+    if (!response.ok) {
+      return { error: data.error || data.message || 'Request failed' };
+    }
+
+    return { data };
+  } catch (error) {
+    console.error('Organization request failed:', error);
+    return { error: 'Please check your connection and try again' };
+  }
+}
+
+// ============================================
+// API Functions
+// ============================================
+
+/**
+ * List the organizations the current user belongs to
+ */
+export async function listOrganizations(): Promise<Organization[]> {
+  const result = await orgRequest<Organization[]>('/api/org');
+  return result.data || [];
+}
+
+/**
+ * Join a driving school as a student with its join code
+ */
+export function joinOrganization(joinCode: string) {
+  return orgRequest<Organization>('/api/org/join', 'POST', {
+    joinCode: joinCode.toUpperCase().replace(/\s/g, ''),
+  });
+}
+
+/**
+ * Invite someone by email (owners invite instructors, instructors invite
+ * students). The response is the same whether or not they have an account.
+ */
+export function inviteOrgMember(orgId: string, email: string, role: 'student' | 'instructor' = 'student') {
+  return orgRequest<{ status: string; email: string }>(`/api/org/${orgId}/invites`, 'POST', { email, role });
+}
+
+/**
+ * List pending invites (owners and instructors)
+ */
+export function listOrgInvites(orgId: string) {
+  return orgRequest<OrgInvite[]>(`/api/org/${orgId}/invites`);
+}
+
+/**
+ * Withdraw a pending invite
+ */
+export function withdrawOrgInvite(orgId: string, inviteId: string) {
+  return orgRequest<{ success: boolean }>(`/api/org/${orgId}/invites/${inviteId}`, 'DELETE');
+}
+
+/**
+ * List the invites sent to the current user's verified email
+ */
+export async function listReceivedOrgInvites(): Promise<ReceivedOrgInvite[]> {
+  const result = await orgRequest<ReceivedOrgInvite[]>('/api/org/invites');
+  return result.data || [];
+}
+
+/**
+ * Accept an invite, joining the organization
+ */
+export function acceptOrgInvite(inviteId: string) {
+  return orgRequest<Organization>(`/api/org/invites/${inviteId}/accept`, 'POST');
+}
+
+/**
+ * Decline an invite
+ */
+export function declineOrgInvite(inviteId: string) {
+  return orgRequest<{ success: boolean }>(`/api/org/invites/${inviteId}/decline`, 'POST');
+}
+
+/**
+ * List members, optionally of one role (owners and instructors)
+ */
+export function listOrgMembers(orgId: string, role?: OrgRole) {
+  return orgRequest<OrgMember[]>(`/api/org/${orgId}/members${role ? `?role=${role}` : ''}`);
+}
+
+/**
+ * Remove a member, or leave when userId is the current user
+ */
+export function removeOrgMember(orgId: string, userId: string) {
+  return orgRequest<{ success: boolean }>(`/api/org/${orgId}/members/${userId}`, 'DELETE');
+}
+
+/**
+ * Generate a new join code (owner only); the old code stops working
+ */
+export function regenerateJoinCode(orgId: string) {
+  return orgRequest<{ joinCode: string }>(`/api/org/${orgId}/join-code`, 'POST');
+}
+
+/**
+ * Instructor dashboard: every student with their headline progress
+ */
+export function listOrgStudents(orgId: string) {
+  return orgRequest<OrgStudentSummary[]>(`/api/org/${orgId}/students`);
+}
+
+/**
+ * Instructor dashboard: one student's progress, tests and weak categories
+ */
+export function getOrgStudent(orgId: string, userId: string) {
+  return orgRequest<OrgStudentDetail>(`/api/org/${orgId}/students/${userId}`);
+}
@@ -10,6 +10,8 @@ export const pb = new PocketBase(POCKETBASE_URL);
 pb.autoCancellation(false);
 
 // Types for our collections
+export type LeaderboardVisibility = 'public' | 'pseudonymous' | 'hidden';
+
 export interface User extends RecordModel {
   email: string;
   name: string;
@@ -24,6 +26,8 @@ export interface User extends RecordModel {
   questionsCompleted: number;
   questionsCorrect: number;
   badges: string[];
+  timezone?: string;
+  leaderboardVisibility?: LeaderboardVisibility; // Empty means public
   isPremium: boolean;
   premiumPlan: 'free' | 'monthly' | 'yearly' | 'lifetime';
   premiumExpiresAt?: string;
@@ -6,9 +6,11 @@
  * The server is the source of truth - local storage is used only for offline cache.
  */
 
-import { pb } from './pocketbase';
+import { pb, User } from './pocketbase';
 import {
   UserProgress,
+  getBrowserTimezone,
+  getLocalDateString,
   getStoredProgress,
   saveProgress,
   checkAndAwardBadges,
@@ -88,6 +90,40 @@ export interface XPTransaction {
   created: string;
 }
 
+export interface WeakSpotCategory {
+  category: string;
+  attempts: number;
+  correct: number;
+  errorRate: number;
+  weightedErrorRate: number;
+  lastAttemptAt: string;
+}
+
+export interface WeakSpotQuestion {
+  question: {
+    id: string;
+    question: string;
+    options: string[];
+    category: string;
+    imageUrl?: string;
+    isPremium: boolean;
+    difficulty: number;
+  };
+  attempts: number;
+  correct: number;
+  errorRate: number;
+  weightedErrorRate: number;
+  lastAttemptAt: string;
+  lastCorrect: boolean;
+}
+
+export interface WeakSpotsResponse {
+  categories: WeakSpotCategory[];
+  questions: WeakSpotQuestion[];
+  totalAttempts: number;
+  windowDays: number;
+}
+
 // ============================================
 // Progress Sync
 // ============================================
@@ -291,6 +327,37 @@ export async function getXPHistory(limit: number = 50): Promise<XPTransaction[]>
   }
 }
 
+// ============================================
+// Weak Spots
+// ============================================
+
+/**
+ * Get the categories and questions the user gets wrong most, weighted
+ * towards recent attempts
+ */
+export async function getWeakSpots(limit: number = 5): Promise<WeakSpotsResponse | null> {
+  if (!isBackendAvailable() || !pb.authStore.isValid) {
+    return null;
+  }
+
+  try {
+    const response = await fetch(`${pb.baseURL}/api/progress/weak-spots?limit=${limit}`, {
+      headers: {
+        'Authorization': pb.authStore.token,
+      },
+    });
+
+    if (!response.ok) {
+      throw new Error('Failed to fetch weak spots');
+    }
+
+    return await response.json();
+  } catch (error) {
+    console.error('Error fetching weak spots:', error);
+    return null;
+  }
+}
+
 // ============================================
 // Badge Management
 // ============================================
@@ -471,7 +538,7 @@ export async function updateStreak(): Promise<StreakResponse | null> {
       progress.totalXpEarned = Math.max(progress.totalXpEarned, data.newXP);
       progress.loginDays += 1;
     }
-    progress.lastActiveDate = new Date().toISOString().split('T')[0];
+    progress.lastActiveDate = getLocalDateString();
     saveProgress(progress);
 
     return data;
@@ -486,22 +553,14 @@ export async function updateStreak(): Promise<StreakResponse | null> {
 // ============================================
 
 /**
- * Update progress fields on the server
+ * Update progress fields on the server. Stats, streaks and badges are
+ * recorded by the server and can't be set here.
  */
 export async function updateProgress(
   updates: Partial<{
-    xp: number;
-    streak: number;
-    longestStreak: number;
-    questionsCompleted: number;
-    questionsCorrect: number;
-    badges: string[];
-    categoryProgress: Record<string, { correct: number; total: number }>;
-    testHistory: unknown[];
+    timezone: string;
     dailyChallenges: unknown[];
     dailyChallengeDate: string;
-    fastestTestTime: number;
-    bestCorrectStreak: number;
   }>
 ): Promise<boolean> {
   if (!isBackendAvailable() || !pb.authStore.isValid) {
@@ -542,6 +601,21 @@ export async function updateProgress(
   }
 }
 
+/**
+ * Store the browser's timezone on the user if it isn't set yet
+ */
+export async function syncTimezone(): Promise<void> {
+  const user = pb.authStore.record as User | null;
+  const timezone = getBrowserTimezone();
+  if (!user || user.timezone || !timezone) {
+    return;
+  }
+
+  if (await updateProgress({ timezone })) {
+    pb.authStore.save(pb.authStore.token, { ...user, timezone });
+  }
+}
+
 // ============================================
 // Initialization
 // ============================================
@@ -572,6 +646,9 @@ export async function initializeProgressSync(): Promise<{
     const syncResult = await syncProgress();
     result.synced = syncResult !== null;
 
+    // Streak days roll over in the user's timezone, so record it first
+    await syncTimezone();
+
     // 2. Update streak for daily login
     const streakResult = await updateStreak();
     if (streakResult && streakResult.newLogin) {
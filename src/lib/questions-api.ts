@@ -68,6 +68,15 @@ export interface TestCompleteResponse {
   flagReason?: string;
 }
 
+// Questions added, changed and removed since a question bank version
+export interface QuestionBankChanges {
+  version: number; // Current bank version
+  since: number;
+  added: string[];
+  changed: string[];
+  removed: string[];
+}
+
 // Check if backend is configured and available
 const isBackendAvailable = (): boolean => {
   return !!pb.baseURL && !pb.baseURL.includes('localhost:8090');
@@ -103,6 +112,23 @@ export async function getCategories(): Promise<{ categories: CategoryCount[]; to
   }
 }
 
+/**
+ * Get the questions that changed since a question bank version (0 for all),
+ * so cached questions can be synced without downloading everything again
+ */
+export async function getQuestionChanges(since: number): Promise<QuestionBankChanges | null> {
+  if (!isBackendAvailable()) return null;
+
+  try {
+    const response = await fetch(`${pb.baseURL}/api/questions/changes?since=${since}`);
+    if (!response.ok) throw new Error('Failed to fetch question changes');
+    return await response.json();
+  } catch (error) {
+    console.error('Error fetching question changes:', error);
+    return null;
+  }
+}
+
 /**
  * Get practice questions
  */
@@ -21,11 +21,12 @@ import {
   getBadgeInfo,
   getLevel,
   generateDailyChallenges,
+  getLocalDateString,
   ALL_BADGES,
   TIER_COLORS,
 } from "@/utils/storage";
 import { getTotalQuestions } from "@/data/questions";
-import { BookOpen, Brain, Trophy, Flame, CheckCircle, ArrowRight, Award, Target, Zap, Star, Calendar, Crown, Medal, Users } from "lucide-react";
+import { BookOpen, Brain, Trophy, Flame, CheckCircle, ArrowRight, Award, Target, Zap, Star, Calendar, Crown, Medal, Users, GraduationCap } from "lucide-react";
 import { toast } from "sonner";
 
 const Dashboard = () => {
@@ -57,7 +58,7 @@ const Dashboard = () => {
     let updatedProgress = updateStreak(progress);
 
     // Generate daily challenges if needed
-    const today = new Date().toISOString().split("T")[0];
+    const today = getLocalDateString();
     if (updatedProgress.dailyChallengeDate !== today) {
       const challenges = generateDailyChallenges(updatedProgress);
       updatedProgress = {
@@ -584,6 +585,16 @@ const Dashboard = () => {
             Driver's Handbook Reference
             <ArrowRight className="w-4 h-4 sm:w-5 sm:h-5 ml-auto" />
           </Button>
+
+          <Button
+            variant="outline"
+            className="w-full h-12 sm:h-14 text-sm sm:text-base gap-2"
+            onClick={() => navigate("/school")}
+          >
+            <GraduationCap className="w-4 h-4 sm:w-5 sm:h-5" />
+            Driving School
+            <ArrowRight className="w-4 h-4 sm:w-5 sm:h-5 ml-auto" />
+          </Button>
         </div>
       </div>
     </div>
@@ -0,0 +1,498 @@
+import { useState, useEffect } from 'react';
+import { useNavigate } from 'react-router-dom';
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/components/ui/card';
+import { Button } from '@/components/ui/button';
+import { Input } from '@/components/ui/input';
+import { Badge } from '@/components/ui/badge';
+import { Skeleton } from '@/components/ui/skeleton';
+import {
+  Table,
+  TableBody,
+  TableCell,
+  TableHead,
+  TableHeader,
+  TableRow,
+} from '@/components/ui/table';
+import {
+  Organization,
+  OrgInvite,
+  OrgStudentSummary,
+  OrgStudentDetail,
+  ReceivedOrgInvite,
+  listOrganizations,
+  joinOrganization,
+  inviteOrgMember,
+  listOrgInvites,
+  withdrawOrgInvite,
+  listReceivedOrgInvites,
+  acceptOrgInvite,
+  declineOrgInvite,
+  removeOrgMember,
+  listOrgStudents,
+  getOrgStudent,
+} from '@/lib/org-api';
+import { useAuth } from '@/contexts/AuthContext';
+import { ArrowLeft, GraduationCap, Copy, UserPlus, LogIn, LogOut, X, CheckCircle2, XCircle, Mail } from 'lucide-react';
+import { toast } from 'sonner';
+
+const formatDate = (value?: string) => (value ? new Date(value).toLocaleDateString() : '—');
+
+const percent = (value: number) => `${Math.round(value * 100)}%`;
+
+/**
+ * Driving school page. Students join their school with its code or by
+ * accepting an invite; owners and instructors see every student's progress,
+ * tests and weak categories.
+ */
+const DrivingSchool = () => {
+  const navigate = useNavigate();
+  const { user } = useAuth();
+  const [orgs, setOrgs] = useState<Organization[]>([]);
+  const [selectedId, setSelectedId] = useState<string | null>(null);
+  const [students, setStudents] = useState<OrgStudentSummary[]>([]);
+  const [detail, setDetail] = useState<OrgStudentDetail | null>(null);
+  const [invites, setInvites] = useState<OrgInvite[]>([]);
+  const [receivedInvites, setReceivedInvites] = useState<ReceivedOrgInvite[]>([]);
+  const [joinCode, setJoinCode] = useState('');
+  const [studentEmail, setStudentEmail] = useState('');
+  const [isLoading, setIsLoading] = useState(true);
+  const [isBusy, setIsBusy] = useState(false);
+
+  const org = orgs.find((o) => o.id === selectedId) ?? orgs[0];
+  const isStaff = org?.role === 'owner' || org?.role === 'instructor';
+
+  const refresh = async () => {
+    const [organizations, received] = await Promise.all([listOrganizations(), listReceivedOrgInvites()]);
+    setOrgs(organizations);
+    setReceivedInvites(received);
+    setIsLoading(false);
+  };
+
+  useEffect(() => {
+    if (user) {
+      refresh();
+    } else {
+      setIsLoading(false);
+    }
+  }, [user]);
+
+  useEffect(() => {
+    setDetail(null);
+    if (org && isStaff) {
+      listOrgStudents(org.id).then((result) => setStudents(result.data || []));
+      listOrgInvites(org.id).then((result) => setInvites(result.data || []));
+    } else {
+      setStudents([]);
+      setInvites([]);
+    }
+  }, [org?.id, isStaff]);
+
+  const handleJoin = async () => {
+    if (!joinCode.trim()) return;
+    setIsBusy(true);
+    const result = await joinOrganization(joinCode);
+    setIsBusy(false);
+
+    if (result.error || !result.data) {
+      toast.error(result.error || 'Failed to join');
+      return;
+    }
+    setJoinCode('');
+    toast.success(`Welcome to ${result.data.name}! Premium is unlocked.`);
+    setSelectedId(result.data.id);
+    await refresh();
+  };
+
+  const handleInviteStudent = async () => {
+    if (!org || !studentEmail.trim()) return;
+    setIsBusy(true);
+    const result = await inviteOrgMember(org.id, studentEmail.trim());
+    setIsBusy(false);
+
+    if (result.error || !result.data) {
+      toast.error(result.error || 'Failed to send invite');
+      return;
+    }
+    setStudentEmail('');
+    toast.success(`Invited ${result.data.email}. They'll join once they accept.`);
+    const updated = await listOrgInvites(org.id);
+    setInvites(updated.data || []);
+  };
+
+  const handleWithdrawInvite = async (invite: OrgInvite) => {
+    if (!org) return;
+    const result = await withdrawOrgInvite(org.id, invite.id);
+    if (result.error) {
+      toast.error(result.error);
+      return;
+    }
+    setInvites(invites.filter((i) => i.id !== invite.id));
+  };
+
+  const handleAcceptInvite = async (invite: ReceivedOrgInvite) => {
+    setIsBusy(true);
+    const result = await acceptOrgInvite(invite.id);
+    setIsBusy(false);
+
+    if (result.error || !result.data) {
+      toast.error(result.error || 'Failed to accept invite');
+      return;
+    }
+    toast.success(
+      invite.role === 'student'
+        ? `Welcome to ${result.data.name}! Premium is unlocked.`
+        : `You're now an instructor at ${result.data.name}.`
+    );
+    setSelectedId(result.data.id);
+    await refresh();
+  };
+
+  const handleDeclineInvite = async (invite: ReceivedOrgInvite) => {
+    const result = await declineOrgInvite(invite.id);
+    if (result.error) {
+      toast.error(result.error);
+      return;
+    }
+    setReceivedInvites(receivedInvites.filter((i) => i.id !== invite.id));
+  };
+
+  const handleRemoveStudent = async (student: OrgStudentSummary) => {
+    if (!org) return;
+    const result = await removeOrgMember(org.id, student.userId);
+    if (result.error) {
+      toast.error(result.error);
+      return;
+    }
+    toast.success(`${student.name || student.email} removed`);
+    setStudents(students.filter((s) => s.userId !== student.userId));
+    setDetail(null);
+    await refresh();
+  };
+
+  const handleLeave = async () => {
+    if (!org || !user) return;
+    const result = await removeOrgMember(org.id, user.id);
+    if (result.error) {
+      toast.error(result.error);
+      return;
+    }
+    toast.success(`Left ${org.name}`);
+    setSelectedId(null);
+    await refresh();
+  };
+
+  const showStudent = async (student: OrgStudentSummary) => {
+    if (!org) return;
+    const result = await getOrgStudent(org.id, student.userId);
+    if (result.error || !result.data) {
+      toast.error(result.error || 'Failed to load student');
+      return;
+    }
+    setDetail(result.data);
+  };
+
+  const copyCode = async (code: string) => {
+    try {
+      await navigator.clipboard.writeText(code);
+      toast.success('Join code copied!');
+    } catch {
+      toast.info(`Join code: ${code}`);
+    }
+  };
+
+  return (
+    <div className="min-h-screen bg-background pb-20">
+      {/* Header */}
+      <div className="bg-gradient-to-br from-primary to-secondary p-4 sm:p-6 text-primary-foreground">
+        <div className="max-w-4xl mx-auto flex items-center gap-3">
+          <Button
+            variant="ghost"
+            size="icon"
+            className="text-primary-foreground hover:bg-white/10"
+            onClick={() => navigate('/')}
+          >
+            <ArrowLeft className="w-5 h-5" />
+          </Button>
+          <div className="flex-1">
+            <h1 className="text-2xl sm:text-3xl font-bold flex items-center gap-2">
+              <GraduationCap className="w-6 h-6" />
+              Driving School
+            </h1>
+            <p className="text-sm text-primary-foreground/80">
+              {org ? org.name : 'Join your driving school to unlock premium'}
+            </p>
+          </div>
+        </div>
+      </div>
+
+      <div className="max-w-4xl mx-auto px-4 sm:px-6 mt-4 space-y-4">
+        {isLoading ? (
+          <Skeleton className="h-32 w-full" />
+        ) : !user ? (
+          <Card>
+            <CardContent className="p-6 text-center text-muted-foreground">
+              Log in to join your driving school.
+            </CardContent>
+          </Card>
+        ) : (
+          <>
+            {/* Invites to the current user */}
+            {receivedInvites.length > 0 && (
+              <Card>
+                <CardHeader className="pb-2">
+                  <CardTitle className="text-lg flex items-center gap-2">
+                    <Mail className="w-5 h-5" />
+                    Invitations
+                  </CardTitle>
+                  <CardDescription>Accepting lets the school's instructors see your progress.</CardDescription>
+                </CardHeader>
+                <CardContent className="space-y-2">
+                  {receivedInvites.map((invite) => (
+                    <div key={invite.id} className="flex flex-wrap items-center justify-between gap-2">
+                      <span className="text-sm">
+                        <span className="font-medium">{invite.organizationName}</span>
+                        <span className="text-muted-foreground"> · as {invite.role}</span>
+                      </span>
+                      <div className="flex gap-2">
+                        <Button size="sm" onClick={() => handleAcceptInvite(invite)} disabled={isBusy}>
+                          Accept
+                        </Button>
+                        <Button size="sm" variant="ghost" onClick={() => handleDeclineInvite(invite)}>
+                          Decline
+                        </Button>
+                      </div>
+                    </div>
+                  ))}
+                </CardContent>
+              </Card>
+            )}
+
+            {/* School selector */}
+            {orgs.length > 1 && (
+              <div className="flex flex-wrap gap-2">
+                {orgs.map((o) => (
+                  <Button
+                    key={o.id}
+                    size="sm"
+                    variant={o.id === org?.id ? 'default' : 'outline'}
+                    onClick={() => setSelectedId(o.id)}
+                  >
+                    {o.name}
+                  </Button>
+                ))}
+              </div>
+            )}
+
+            {/* School summary */}
+            {org && (
+              <Card>
+                <CardHeader className="pb-2">
+                  <CardTitle className="text-lg flex items-center justify-between gap-2">
+                    {org.name}
+                    <Badge variant="secondary" className="capitalize">{org.role}</Badge>
+                  </CardTitle>
+                  <CardDescription>
+                    {org.seatsUsed} of {org.seats} seats used
+                    {org.licenseExpiresAt && ` · License until ${formatDate(org.licenseExpiresAt)}`}
+                  </CardDescription>
+                </CardHeader>
+                <CardContent className="flex flex-wrap items-center justify-between gap-2">
+                  {org.joinCode ? (
+                    <Button size="sm" variant="ghost" onClick={() => copyCode(org.joinCode!)}>
+                      <Copy className="w-4 h-4 mr-1" />
+                      Join code: <span className="font-mono ml-1">{org.joinCode}</span>
+                    </Button>
+                  ) : (
+                    <span className="text-sm text-muted-foreground">
+                      Your instructors can see your progress and test results.
+                    </span>
+                  )}
+                  {org.role !== 'owner' && (
+                    <Button size="sm" variant="ghost" onClick={handleLeave}>
+                      <LogOut className="w-4 h-4 mr-1" />
+                      Leave
+                    </Button>
+                  )}
+                </CardContent>
+              </Card>
+            )}
+
+            {/* Join a school */}
+            {!org && (
+              <Card>
+                <CardHeader className="pb-2">
+                  <CardTitle className="text-lg">Join your driving school</CardTitle>
+                  <CardDescription>Enter the code your school gave you.</CardDescription>
+                </CardHeader>
+                <CardContent className="flex gap-2">
+                  <Input
+                    placeholder="Join code"
+                    value={joinCode}
+                    maxLength={8}
+                    className="font-mono uppercase"
+                    onChange={(e) => setJoinCode(e.target.value)}
+                  />
+                  <Button onClick={handleJoin} disabled={isBusy || !joinCode.trim()}>
+                    <LogIn className="w-4 h-4 mr-1" />
+                    Join
+                  </Button>
+                </CardContent>
+              </Card>
+            )}
+
+            {/* Instructor dashboard */}
+            {org && isStaff && (
+              <Card>
+                <CardHeader className="pb-2">
+                  <CardTitle className="text-lg">Students</CardTitle>
+                  <CardDescription>Select a student to see their tests and weak categories.</CardDescription>
+                </CardHeader>
+                <CardContent className="space-y-3">
+                  <div className="flex gap-2">
+                    <Input
+                      type="email"
+                      placeholder="Student's email"
+                      value={studentEmail}
+                      onChange={(e) => setStudentEmail(e.target.value)}
+                    />
+                    <Button onClick={handleInviteStudent} disabled={isBusy || !studentEmail.trim()}>
+                      <UserPlus className="w-4 h-4 mr-1" />
+                      Invite
+                    </Button>
+                  </div>
+
+                  {invites.length > 0 && (
+                    <div className="space-y-1">
+                      {invites.map((invite) => (
+                        <div key={invite.id} className="flex items-center justify-between text-sm">
+                          <span className="text-muted-foreground">
+                            {invite.email} · invited {invite.role}, until {formatDate(invite.expiresAt)}
+                          </span>
+                          <Button size="icon" variant="ghost" onClick={() => handleWithdrawInvite(invite)}>
+                            <X className="w-4 h-4" />
+                          </Button>
+                        </div>
+                      ))}
+                    </div>
+                  )}
+
+                  {students.length === 0 ? (
+                    <p className="text-sm text-muted-foreground text-center py-4">
+                      No students yet. Share the join code to fill your seats.
+                    </p>
+                  ) : (
+                    <Table>
+                      <TableHeader>
+                        <TableRow>
+                          <TableHead>Student</TableHead>
+                          <TableHead className="text-right">Accuracy</TableHead>
+                          <TableHead className="text-right">Tests passed</TableHead>
+                          <TableHead className="text-right hidden sm:table-cell">Last active</TableHead>
+                        </TableRow>
+                      </TableHeader>
+                      <TableBody>
+                        {students.map((student) => (
+                          <TableRow
+                            key={student.userId}
+                            className="cursor-pointer"
+                            onClick={() => showStudent(student)}
+                          >
+                            <TableCell>
+                              <p className="font-medium">{student.name || student.email}</p>
+                              <p className="text-xs text-muted-foreground">
+                                Level {student.level} · {student.questionsCompleted} questions
+                              </p>
+                            </TableCell>
+                            <TableCell className="text-right">{percent(student.accuracy)}</TableCell>
+                            <TableCell className="text-right">
+                              {student.testsPassed}/{student.testsTaken}
+                            </TableCell>
+                            <TableCell className="text-right hidden sm:table-cell">
+                              {formatDate(student.lastActiveAt)}
+                            </TableCell>
+                          </TableRow>
+                        ))}
+                      </TableBody>
+                    </Table>
+                  )}
+                </CardContent>
+              </Card>
+            )}
+
+            {/* Student detail */}
+            {org && isStaff && detail && (
+              <Card>
+                <CardHeader className="pb-2">
+                  <CardTitle className="text-lg flex items-center justify-between gap-2">
+                    {detail.student.name || detail.student.email}
+                    <Button size="icon" variant="ghost" onClick={() => setDetail(null)}>
+                      <X className="w-4 h-4" />
+                    </Button>
+                  </CardTitle>
+                  <CardDescription>
+                    {detail.student.email} · Joined {formatDate(detail.student.joinedAt)}
+                  </CardDescription>
+                </CardHeader>
+                <CardContent className="space-y-4">
+                  <div>
+                    <h3 className="font-semibold mb-2">Weakest categories</h3>
+                    {detail.weakCategories.length === 0 ? (
+                      <p className="text-sm text-muted-foreground">No answers in the last 90 days.</p>
+                    ) : (
+                      <div className="space-y-1">
+                        {detail.weakCategories.map((weak) => (
+                          <div key={weak.category} className="flex justify-between text-sm">
+                            <span>{weak.category}</span>
+                            <span className="text-muted-foreground">
+                              {percent(weak.errorRate)} wrong · {weak.attempts} answers
+                            </span>
+                          </div>
+                        ))}
+                      </div>
+                    )}
+                  </div>
+
+                  <div>
+                    <h3 className="font-semibold mb-2">Mock tests</h3>
+                    {detail.testHistory.length === 0 ? (
+                      <p className="text-sm text-muted-foreground">No completed tests yet.</p>
+                    ) : (
+                      <div className="space-y-1">
+                        {detail.testHistory.map((test) => (
+                          <div key={test.sessionId} className="flex items-center justify-between text-sm">
+                            <span className="flex items-center gap-2">
+                              {test.passed ? (
+                                <CheckCircle2 className="w-4 h-4 text-green-500" />
+                              ) : (
+                                <XCircle className="w-4 h-4 text-destructive" />
+                              )}
+                              {formatDate(test.completedAt)}
+                              {test.flagged && <Badge variant="outline">Flagged</Badge>}
+                            </span>
+                            <span className="text-muted-foreground">
+                              {test.score}/{test.totalQuestions} · {Math.round(test.timeSpent / 60)} min
+                            </span>
+                          </div>
+                        ))}
+                      </div>
+                    )}
+                  </div>
+
+                  <Button
+                    size="sm"
+                    variant="outline"
+                    onClick={() => handleRemoveStudent(detail.student)}
+                  >
+                    Remove from school
+                  </Button>
+                </CardContent>
+              </Card>
+            )}
+          </>
+        )}
+      </div>
+    </div>
+  );
+};
+
+export default DrivingSchool;
@@ -8,13 +8,19 @@ import { Badge } from '@/components/ui/badge';
 import { Skeleton } from '@/components/ui/skeleton';
 import {
   fetchLeaderboard,
+  fetchPastLeaderboards,
   LeaderboardData,
   LeaderboardEntry,
+  LeaderboardPeriod,
+  LeaderboardPeriodSummary,
   shareContent,
   generateShareText,
 } from '@/lib/leaderboard';
-import { getStoredProgress, getLevel } from '@/utils/storage';
+import { StudyGroup } from '@/lib/groups-api';
+import { getStoredProgress, getLevel, LEVELS } from '@/utils/storage';
 import { useAuth } from '@/contexts/AuthContext';
+import StudyGroupsCard from '@/components/StudyGroupsCard';
+import LeaderboardPrivacyCard from '@/components/LeaderboardPrivacyCard';
 import {
   ArrowLeft,
   Trophy,
@@ -26,6 +32,8 @@ import {
   Users,
   TrendingUp,
   Calendar,
+  CalendarDays,
+  History,
   Zap,
 } from 'lucide-react';
 import { toast } from 'sonner';
@@ -60,7 +68,8 @@ const RankBadge = ({ rank }: { rank: number }) => {
 };
 
 const LeaderboardRow = ({ entry, highlight }: { entry: LeaderboardEntry; highlight?: boolean }) => {
-  const level = getLevel(entry.xp);
+  // entry.xp is the XP earned in the period, so use the user's overall level
+  const level = LEVELS.find(l => l.level === entry.level) ?? getLevel(entry.xp);
 
   return (
     <div
@@ -134,8 +143,10 @@ const LeaderboardSkeleton = () => (
 const Leaderboard = () => {
   const navigate = useNavigate();
   const { user } = useAuth();
-  const [period, setPeriod] = useState<'weekly' | 'allTime'>('weekly');
+  const [period, setPeriod] = useState<LeaderboardPeriod>('weekly');
   const [data, setData] = useState<LeaderboardData | null>(null);
+  const [pastWeeks, setPastWeeks] = useState<LeaderboardPeriodSummary[]>([]);
+  const [group, setGroup] = useState<StudyGroup | null>(null);
   const [isLoading, setIsLoading] = useState(true);
   const progress = getStoredProgress();
   const currentLevel = getLevel(progress.xp);
@@ -144,7 +155,7 @@ const Leaderboard = () => {
     const loadLeaderboard = async () => {
       setIsLoading(true);
       try {
-        const leaderboardData = await fetchLeaderboard(period);
+        const leaderboardData = await fetchLeaderboard(period, 20, undefined, group?.id);
         setData(leaderboardData);
       } catch (error) {
         console.error('Failed to load leaderboard:', error);
@@ -155,7 +166,11 @@ const Leaderboard = () => {
     };
 
     loadLeaderboard();
-  }, [period]);
+  }, [period, group]);
+
+  useEffect(() => {
+    fetchPastLeaderboards('weekly').then(setPastWeeks);
+  }, []);
 
   const handleShare = async () => {
     const shareData = generateShareText('progress', {
@@ -196,7 +211,7 @@ const Leaderboard = () => {
                 Leaderboard
               </h1>
               <p className="text-sm text-primary-foreground/80">
-                Compete with other learners
+                {group ? group.name : 'Compete with other learners'}
               </p>
             </div>
             <Button
@@ -247,19 +262,27 @@ const Leaderboard = () => {
       </div>
 
       <div className="max-w-4xl mx-auto px-4 sm:px-6 -mt-4">
+        {/* Study group selector */}
+        <StudyGroupsCard selectedGroupId={group?.id} onSelect={setGroup} />
+        <LeaderboardPrivacyCard />
+
         {/* Period Tabs */}
         <Tabs
           value={period}
-          onValueChange={(v) => setPeriod(v as 'weekly' | 'allTime')}
+          onValueChange={(v) => setPeriod(v as LeaderboardPeriod)}
           className="w-full"
         >
           <Card className="mb-4">
             <CardContent className="p-2">
-              <TabsList className="w-full grid grid-cols-2">
+              <TabsList className="w-full grid grid-cols-3">
                 <TabsTrigger value="weekly" className="gap-2">
                   <Calendar className="w-4 h-4" />
                   This Week
                 </TabsTrigger>
+                <TabsTrigger value="monthly" className="gap-2">
+                  <CalendarDays className="w-4 h-4" />
+                  This Month
+                </TabsTrigger>
                 <TabsTrigger value="allTime" className="gap-2">
                   <TrendingUp className="w-4 h-4" />
                   All Time
@@ -284,7 +307,7 @@ const Leaderboard = () => {
                   )}
                 </CardTitle>
                 <CardDescription>
-                  Top performers this week. Resets every Monday.
+                  XP earned this week. Resets every Monday.
                 </CardDescription>
               </CardHeader>
               <CardContent className="space-y-2">
@@ -309,6 +332,47 @@ const Leaderboard = () => {
             </Card>
           </TabsContent>
 
+          <TabsContent value="monthly" className="mt-0">
+            <Card>
+              <CardHeader className="pb-2">
+                <CardTitle className="text-lg flex items-center justify-between">
+                  <span className="flex items-center gap-2">
+                    <CalendarDays className="w-5 h-5 text-primary" />
+                    Monthly Leaders
+                  </span>
+                  {data && (
+                    <Badge variant="secondary" className="font-normal">
+                      <Users className="w-3 h-3 mr-1" />
+                      {data.totalUsers} learners
+                    </Badge>
+                  )}
+                </CardTitle>
+                <CardDescription>
+                  XP earned this month. Resets on the 1st.
+                </CardDescription>
+              </CardHeader>
+              <CardContent className="space-y-2">
+                {isLoading ? (
+                  <LeaderboardSkeleton />
+                ) : data?.entries.length === 0 ? (
+                  <div className="text-center py-8 text-muted-foreground">
+                    <Trophy className="w-12 h-12 mx-auto mb-3 opacity-50" />
+                    <p>No entries yet this month</p>
+                    <p className="text-sm">Be the first to practice!</p>
+                  </div>
+                ) : (
+                  data?.entries.map((entry) => (
+                    <LeaderboardRow
+                      key={entry.id}
+                      entry={entry}
+                      highlight={entry.isCurrentUser}
+                    />
+                  ))
+                )}
+              </CardContent>
+            </Card>
+          </TabsContent>
+
           <TabsContent value="allTime" className="mt-0">
             <Card>
               <CardHeader className="pb-2">
@@ -351,6 +415,38 @@ const Leaderboard = () => {
           </TabsContent>
         </Tabs>
 
+        {/* Past weekly winners */}
+        {period === 'weekly' && !group && pastWeeks.length > 0 && (
+          <Card className="mt-4">
+            <CardHeader className="pb-2">
+              <CardTitle className="text-lg flex items-center gap-2">
+                <History className="w-5 h-5 text-primary" />
+                Past Winners
+              </CardTitle>
+              <CardDescription>Top 3 of previous weeks</CardDescription>
+            </CardHeader>
+            <CardContent className="space-y-4">
+              {pastWeeks.map((week) => (
+                <div key={week.periodKey} className="space-y-2">
+                  <p className="text-sm font-medium text-muted-foreground">
+                    Week of{' '}
+                    {week.startsAt
+                      ? new Date(week.startsAt).toLocaleDateString(undefined, { month: 'short', day: 'numeric' })
+                      : week.periodKey}
+                  </p>
+                  {week.winners.map((entry) => (
+                    <LeaderboardRow
+                      key={entry.id}
+                      entry={entry}
+                      highlight={entry.isCurrentUser}
+                    />
+                  ))}
+                </div>
+              ))}
+            </CardContent>
+          </Card>
+        )}
+
         {/* Motivational Card */}
         {userRank && userRank > 3 && (
           <Card className="mt-4 bg-gradient-to-br from-primary/5 to-transparent border-primary/20">
@@ -1,14 +1,21 @@
+import { useEffect, useState } from "react";
 import { useNavigate } from "react-router-dom";
 import { Card, CardContent, CardHeader, CardTitle } from "@/components/ui/card";
 import { Button } from "@/components/ui/button";
 import { ProgressBar } from "@/components/ProgressBar";
 import { getStoredProgress, getBadgeInfo } from "@/utils/storage";
 import { CATEGORIES } from "@/data/questions";
-import { ArrowLeft, Award, Trophy, Calendar } from "lucide-react";
+import { getWeakSpots, WeakSpotsResponse } from "@/lib/progress-api";
+import { ArrowLeft, Award, Trophy, Calendar, Target } from "lucide-react";
 
 const Progress = () => {
   const navigate = useNavigate();
   const progress = getStoredProgress();
+  const [weakSpots, setWeakSpots] = useState<WeakSpotsResponse | null>(null);
+
+  useEffect(() => {
+    getWeakSpots().then(setWeakSpots);
+  }, []);
 
   return (
     <div className="min-h-screen bg-background">
@@ -90,6 +97,61 @@ const Progress = () => {
           </CardContent>
         </Card>
 
+        {/* Weak Spots */}
+        {weakSpots && weakSpots.totalAttempts > 0 && (
+          <Card className="mb-4 sm:mb-6 animate-slide-up" style={{ animationDelay: "0.15s" }}>
+            <CardHeader className="p-4 sm:p-6">
+              <CardTitle className="flex items-center gap-2 text-lg sm:text-xl">
+                <Target className="w-4 h-4 sm:w-5 sm:h-5" />
+                Weak Spots
+              </CardTitle>
+              <p className="text-xs sm:text-sm text-muted-foreground">
+                Based on your answers from the last {weakSpots.windowDays} days
+              </p>
+            </CardHeader>
+            <CardContent className="space-y-4 p-4 sm:p-6 pt-0">
+              {weakSpots.categories.length > 0 && (
+                <div className="space-y-2">
+                  {weakSpots.categories.map(spot => (
+                    <div
+                      key={spot.category}
+                      className="flex items-center justify-between p-3 rounded-lg border bg-card"
+                    >
+                      <span className="font-medium text-sm sm:text-base">{spot.category}</span>
+                      <span className="text-xs sm:text-sm text-warning">
+                        {Math.round(spot.errorRate * 100)}% missed ({spot.attempts - spot.correct}/{spot.attempts})
+                      </span>
+                    </div>
+                  ))}
+                </div>
+              )}
+
+              {weakSpots.questions.length > 0 && (
+                <div>
+                  <div className="text-xs sm:text-sm font-semibold mb-2">Questions to review</div>
+                  <div className="space-y-2">
+                    {weakSpots.questions.map(spot => (
+                      <div key={spot.question.id} className="p-3 rounded-lg border bg-card">
+                        <div className="text-xs sm:text-sm">{spot.question.question}</div>
+                        <div className="flex items-center justify-between text-[10px] sm:text-xs text-muted-foreground mt-1">
+                          <span>{spot.question.category}</span>
+                          <span>
+                            Missed {spot.attempts - spot.correct} of {spot.attempts}
+                          </span>
+                        </div>
+                      </div>
+                    ))}
+                  </div>
+                </div>
+              )}
+
+              <Button size="sm" onClick={() => navigate("/practice-selection")}>
+                Practice these categories
+              </Button>
+            </CardContent>
+          </Card>
+        )}
+
         {/* Test History */}
         {progress.testHistory.length > 0 && (
           <Card className="animate-slide-up" style={{ animationDelay: "0.2s" }}>
@@ -90,12 +90,30 @@ export const getLevel = (xp: number) => {
 
 const STORAGE_KEY = "ontario_driveprep_progress";
 
+// Calendar date (YYYY-MM-DD) in the device's local timezone. Streaks and daily
+// challenges roll over at local midnight, matching the server.
+export const getLocalDateString = (date: Date = new Date()): string => {
+  const y = date.getFullYear();
+  const m = String(date.getMonth() + 1).padStart(2, "0");
+  const d = String(date.getDate()).padStart(2, "0");
+  return `${y}-${m}-${d}`;
+};
+
+// IANA timezone of the device, e.g. "America/Toronto"
+export const getBrowserTimezone = (): string => {
+  try {
+    return Intl.DateTimeFormat().resolvedOptions().timeZone || "";
+  } catch {
+    return "";
+  }
+};
+
 const getDefaultProgress = (): UserProgress => ({
   questionsCompleted: 0,
   questionsCorrect: 0,
   categoryProgress: {},
   streak: 0,
-  lastActiveDate: new Date().toISOString().split("T")[0],
+  lastActiveDate: getLocalDateString(),
   badges: [],
   testHistory: [],
   xp: 0,
@@ -124,7 +142,7 @@ export const saveProgress = (progress: UserProgress) => {
 };
 
 export const updateStreak = (progress: UserProgress): UserProgress => {
-  const today = new Date().toISOString().split("T")[0];
+  const today = getLocalDateString();
   const lastActive = progress.lastActiveDate;
 
   if (lastActive === today) {
@@ -133,7 +151,7 @@ export const updateStreak = (progress: UserProgress): UserProgress => {
 
   const yesterday = new Date();
   yesterday.setDate(yesterday.getDate() - 1);
-  const yesterdayStr = yesterday.toISOString().split("T")[0];
+  const yesterdayStr = getLocalDateString(yesterday);
 
   let newStreak: number;
   let xpBonus = XP_REWARDS.DAILY_LOGIN;
@@ -426,7 +444,7 @@ const CHALLENGE_TEMPLATES = [
 ];
 
 export const generateDailyChallenges = (progress: UserProgress): DailyChallenge[] => {
-  const today = new Date().toISOString().split("T")[0];
+  const today = getLocalDateString();
 
   // Return existing challenges if already generated today
   if (progress.dailyChallengeDate === today && progress.dailyChallenges.length > 0) {